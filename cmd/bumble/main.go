@@ -12,6 +12,7 @@ import (
 
 	config "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/config"
 	list "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/list"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
 	repl "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/repl"
 
 	concurrency "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/concurrency"
@@ -79,6 +80,9 @@ func main() {
 
 	// [BTREE]
 	var dbFlag = flag.String("db", "data/", "DB folder")
+	var framesFlag = flag.Int64("frames", config.NumPages, "buffer frames per table, if -globalframes is 0")
+	var globalFramesFlag = flag.Int64("globalframes", config.NumGlobalFrames, "buffer frames shared by all tables (0 for per-table frames)")
+	var pageSizeFlag = flag.Int64("pagesize", pager.PAGESIZE, "page size in bytes")
 
 	// [CONCURRENCY]
 	var portFlag = flag.Int("p", DEFAULT_PORT, "port number")
@@ -87,7 +91,10 @@ func main() {
 
 	// [BTREE]
 	// Open the db.
-	database, err := db.Open(*dbFlag)
+	database, err := db.Open(*dbFlag,
+		db.WithFramesPerTable(*framesFlag),
+		db.WithGlobalFrames(*globalFramesFlag),
+		db.WithPageSize(*pageSizeFlag))
 	if err != nil {
 		panic(err)
 	}
@@ -134,6 +141,7 @@ func main() {
 	case "db":
 		server = false
 		repls = append(repls, db.DatabaseRepl(database))
+		repls = append(repls, query.QueryRepl(database))
 
 	// [QUERY]
 	case "query":
@@ -72,6 +72,8 @@ func main() {
 	var workloadFlag = flag.String("workload", "", "workload file (required)")
 	var nFlag = flag.Int("n", 1, "number of threads to run (default: 1)")
 	var verifyFlag = flag.Bool("verify", false, "enable to verify database state at the end of the workload")
+	var policyFlag = flag.String("policy", "lru", "buffer replacement policy: [lru,clock,lru-k,2q]")
+	var statsFlag = flag.Bool("stats", false, "enable to print buffer hit/miss counters at the end of the workload")
 	flag.Parse()
 	// Open the db.
 	database, err := db.Open("data")
@@ -87,9 +89,12 @@ func main() {
 	// Setup close conditions.
 	defer database.Close()
 	setupCloseHandler(database)
-	// Clean up old db resources.
-	os.Remove("./data/t")
-	os.Remove("./data/t.meta")
+	// Clean up old db resources. Dropping the table through the catalog removes all its files.
+	if _, ok := database.GetCatalog().Tables["t"]; ok {
+		if err := database.DropTable("t"); err != nil {
+			panic(err)
+		}
+	}
 	// Run REPL.
 	r := db.DatabaseRepl(database)
 	c := make(chan string)
@@ -106,6 +111,7 @@ func main() {
 		fmt.Println("must specify -index [btree,hash]")
 		return
 	}
+	c <- fmt.Sprintf("policy %s on t", *policyFlag)
 	// Parse and run workload.
 	if *workloadFlag == "" {
 		fmt.Println("no workload file given")
@@ -124,6 +130,11 @@ func main() {
 		go handleWorkload(c, &wg, workload, i, *nFlag)
 	}
 	wg.Wait()
+	// Report buffer hit/miss counters.
+	if *statsFlag {
+		c <- "cache from t"
+		time.Sleep(STARTUP)
+	}
 	// Verify the structure of the index.
 	if *verifyFlag {
 		index, err := database.GetTable("t")
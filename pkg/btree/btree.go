@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 
+	heap "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/heap"
 	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
 	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 )
@@ -12,12 +13,26 @@ import (
 type BTreeIndex struct {
 	pager  *pager.Pager // The page handler to read from files.
 	rootPN int64        // The root page number.
+	values *heap.Values // Holds the byte-slice values of the table.
 }
 
 // OpenTable returns a table associated with the given database filename.
 func OpenTable(filename string) (table *BTreeIndex, err error) {
+	return OpenTableWithOptions(filename, pager.DefaultOptions())
+}
+
+// OpenTableWithOptions returns a table whose pager is sized by the given options.
+func OpenTableWithOptions(filename string, options pager.Options) (table *BTreeIndex, err error) {
 	// Create a pager for the table
-	pager := pager.NewPager()
+	pager, err := pager.NewPagerWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return OpenTableWithPager(filename, pager)
+}
+
+// OpenTableWithPager returns a table read through the given, not yet opened, pager.
+func OpenTableWithPager(filename string, pager *pager.Pager) (table *BTreeIndex, err error) {
 	err = pager.Open(filename)
 	if err != nil {
 		return nil, err
@@ -32,8 +47,9 @@ func OpenTable(filename string) (table *BTreeIndex, err error) {
 		initPage(rootPage, LEAF_NODE)
 		rootNode := pageToLeafNode(rootPage)
 		rootNode.setRightSibling(-1)
+		rootNode.setLeftSibling(-1)
 	}
-	return &BTreeIndex{pager: pager, rootPN: ROOT_PN}, nil
+	return &BTreeIndex{pager: pager, rootPN: ROOT_PN, values: heap.NewValues(pager)}, nil
 }
 
 // Get this index's filename.
@@ -46,9 +62,17 @@ func (table *BTreeIndex) GetPager() *pager.Pager {
 	return table.pager
 }
 
+// Get this index's values file.
+func (table *BTreeIndex) GetValues() *heap.Values {
+	return table.values
+}
+
 // Close flushes all changes to disk.
 func (table *BTreeIndex) Close() (err error) {
 	err = table.pager.Close()
+	if valuesErr := table.values.Close(); err == nil {
+		err = valuesErr
+	}
 	return err
 }
 
@@ -66,15 +90,45 @@ func (table *BTreeIndex) Find(key int64) (utils.Entry, error) {
 	defer unsafeUnlockRoot(rootNode)
 	defer rootPage.Put()
 	// Insert the entry into the root node.
-	value, found := rootNode.get(key)
+	entry, found := rootNode.get(key)
 	if found {
-		return BTreeEntry{key: key, value: value}, nil
+		return table.resolve(entry)
+	}
+	return nil, utils.ErrNotFound
+}
+
+// resolve returns the given entry, with its value read in if it is a reference to a byte slice.
+func (table *BTreeIndex) resolve(entry BTreeEntry) (utils.Entry, error) {
+	if !entry.ref {
+		return entry, nil
+	}
+	value, err := table.values.Get(entry.value)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("entry could not be found")
+	return utils.NewBytesEntry(entry.key, value), nil
 }
 
 // Inserts an entry to the table.
 func (table *BTreeIndex) Insert(key int64, value int64) error {
+	return table.insert(BTreeEntry{key: key, value: value})
+}
+
+// InsertBytes inserts an entry with a byte-slice value to the table.
+func (table *BTreeIndex) InsertBytes(key int64, value []byte) error {
+	ref, err := table.values.Put(value)
+	if err != nil {
+		return err
+	}
+	if err := table.insert(newRefEntry(key, ref)); err != nil {
+		table.values.Delete(ref)
+		return err
+	}
+	return nil
+}
+
+// insert adds the given entry to the table.
+func (table *BTreeIndex) insert(entry BTreeEntry) error {
 	// Get the root node.
 	rootPage, err := table.pager.GetPage(table.rootPN)
 	if err != nil {
@@ -87,7 +141,7 @@ func (table *BTreeIndex) Insert(key int64, value int64) error {
 	defer unsafeUnlockRoot(rootNode)
 	defer rootPage.Put()
 	// Insert the entry into the root node.
-	result := rootNode.insert(key, value, false)
+	result := rootNode.insert(entry, false)
 	// Check if we need to split the root node.
 	// Remember to preserve the invariant that the root node occupies page 0.
 	if result.isSplit {
@@ -111,6 +165,10 @@ func (table *BTreeIndex) Insert(key int64, value int64) error {
 			leafyRoot := pageToLeafNode(rootNode.getPage())
 			newNode.copy(leafyRoot)
 			newNodePN = newNode.page.GetPageNum()
+			// The new right half still points back at the root's page.
+			if err := newNode.linkRightSibling(); err != nil {
+				return err
+			}
 		} else {
 			// Create a new internal node.
 			newNode, err := createInternalNode(table.pager)
@@ -137,10 +195,42 @@ func (table *BTreeIndex) Insert(key int64, value int64) error {
 
 // Update modifies an existing entry.
 func (table *BTreeIndex) Update(key int64, value int64) error {
+	return table.update(BTreeEntry{key: key, value: value})
+}
+
+// UpdateBytes modifies an existing entry to hold a byte-slice value.
+func (table *BTreeIndex) UpdateBytes(key int64, value []byte) error {
+	ref, err := table.values.Put(value)
+	if err != nil {
+		return err
+	}
+	if err := table.update(newRefEntry(key, ref)); err != nil {
+		table.values.Delete(ref)
+		return err
+	}
+	return nil
+}
+
+// update overwrites the entry with the given entry's key, freeing the byte-slice value it replaces.
+func (table *BTreeIndex) update(entry BTreeEntry) error {
+	// The entry replaced is found in the same descent that overwrites it, so no other
+	// update or delete can free its value too.
+	replaced, err := table.modify(entry)
+	if err != nil {
+		return err
+	}
+	if replaced.ref {
+		return table.values.Delete(replaced.value)
+	}
+	return nil
+}
+
+// modify overwrites the entry with the given entry's key, returning the entry it replaced.
+func (table *BTreeIndex) modify(entry BTreeEntry) (BTreeEntry, error) {
 	// Get the root node.
 	rootPage, err := table.pager.GetPage(table.rootPN)
 	if err != nil {
-		return err
+		return BTreeEntry{}, err
 	}
 	// [CONCURRENCY] Lock and eventually unlock the root node.
 	lockRoot(rootPage)
@@ -149,16 +239,29 @@ func (table *BTreeIndex) Update(key int64, value int64) error {
 	defer unsafeUnlockRoot(rootNode)
 	defer rootPage.Put()
 	// Update the entry.
-	result := rootNode.insert(key, value, true)
-	return result.err
+	result := rootNode.insert(entry, true)
+	if result.err != nil {
+		return BTreeEntry{}, result.err
+	}
+	return *result.replaced, nil
 }
 
-// Delete removes a key from the table.
+// Delete removes a key from the table, along with its byte-slice value.
 func (table *BTreeIndex) Delete(key int64) error {
+	// Deleting a missing key is not an error.
+	removed, err := table.remove(key)
+	if err != nil || removed == nil || !removed.ref {
+		return err
+	}
+	return table.values.Delete(removed.value)
+}
+
+// remove takes the entry with the given key out of the tree, returning it if it was there.
+func (table *BTreeIndex) remove(key int64) (*BTreeEntry, error) {
 	// Get the root node.
 	rootPage, err := table.pager.GetPage(table.rootPN)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// [CONCURRENCY] Lock and eventually unlock the root node.
 	lockRoot(rootPage)
@@ -167,8 +270,28 @@ func (table *BTreeIndex) Delete(key int64) error {
 	defer unsafeUnlockRoot(rootNode)
 	defer rootPage.Put()
 	// Delete the key.
-	rootNode.delete(key)
-	return nil
+	result := rootNode.delete(key)
+	// Check if the root has lost its last key, leaving a single child.
+	// Remember to preserve the invariant that the root node occupies page 0.
+	if result.isUnderflow {
+		// [CONCURRENCY] Unlock the super node.
+		defer SUPER_NODE.unlock()
+		// Pull the only child up into the root's page.
+		child, err := pageToInternalNode(rootPage).getChildAt(0)
+		if err != nil {
+			return nil, err
+		}
+		childPN := child.getPage().GetPageNum()
+		switch child := child.(type) {
+		case *LeafNode:
+			pageToLeafNode(rootPage).copy(child)
+		case *InternalNode:
+			pageToInternalNode(rootPage).copy(child)
+		}
+		child.getPage().Put()
+		return result.removed, table.pager.FreePage(childPN)
+	}
+	return result.removed, result.err
 }
 
 // Select returns a slice of all entries in the table.
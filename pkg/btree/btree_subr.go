@@ -23,18 +23,34 @@ var NODE_HEADER_SIZE int64 = NODETYPE_SIZE + NUM_KEYS_SIZE
 // Leaf node header constants.
 var RIGHT_SIBLING_PN_OFFSET int64 = NODE_HEADER_SIZE
 var RIGHT_SIBLING_PN_SIZE int64 = binary.MaxVarintLen64
-var LEAF_NODE_HEADER_SIZE int64 = NODE_HEADER_SIZE + RIGHT_SIBLING_PN_SIZE
-var ENTRIES_PER_LEAF_NODE int64 = ((pager.PAGESIZE - LEAF_NODE_HEADER_SIZE) / ENTRYSIZE) - 1
+var LEFT_SIBLING_PN_OFFSET int64 = RIGHT_SIBLING_PN_OFFSET + RIGHT_SIBLING_PN_SIZE
+var LEFT_SIBLING_PN_SIZE int64 = binary.MaxVarintLen64
+var LEAF_NODE_HEADER_SIZE int64 = NODE_HEADER_SIZE + RIGHT_SIBLING_PN_SIZE + LEFT_SIBLING_PN_SIZE
 
 // Internal node header constants.
 var KEY_SIZE int64 = binary.MaxVarintLen64
 var PN_SIZE int64 = binary.MaxVarintLen64
 var INTERNAL_NODE_HEADER_SIZE int64 = NODE_HEADER_SIZE
-var ptrSpace int64 = pager.PAGESIZE - INTERNAL_NODE_HEADER_SIZE - KEY_SIZE
-var KEYS_PER_INTERNAL_NODE int64 = (ptrSpace / (KEY_SIZE + PN_SIZE)) - 1
 var KEYS_OFFSET int64 = INTERNAL_NODE_HEADER_SIZE
-var KEYS_SIZE int64 = KEY_SIZE * (KEYS_PER_INTERNAL_NODE + 1)
-var PNS_OFFSET int64 = KEYS_OFFSET + KEYS_SIZE
+
+// The remaining layout depends on the page size of the table, so it is computed at runtime.
+
+// EntriesPerLeafNode returns the number of entries a leaf node holds for the given page size.
+func EntriesPerLeafNode(pageSize int64) int64 {
+	return ((pageSize - LEAF_NODE_HEADER_SIZE) / ENTRYSIZE) - 1
+}
+
+// KeysPerInternalNode returns the number of keys an internal node holds for the given page size.
+func KeysPerInternalNode(pageSize int64) int64 {
+	ptrSpace := pageSize - INTERNAL_NODE_HEADER_SIZE - KEY_SIZE
+	return (ptrSpace / (KEY_SIZE + PN_SIZE)) - 1
+}
+
+// pnsOffset returns the offset of an internal node's pagenumbers for the given page size.
+func pnsOffset(pageSize int64) int64 {
+	keysSize := KEY_SIZE * (KeysPerInternalNode(pageSize) + 1)
+	return KEYS_OFFSET + keysSize
+}
 
 // [CONCURRENCY]
 var SUPER_NODE *InternalNode = &InternalNode{NodeHeader{INTERNAL_NODE, 0, &pager.Page{}}, nil}
@@ -58,6 +74,7 @@ type NodeHeader struct {
 type LeafNode struct {
 	NodeHeader           // Include header information
 	rightSiblingPN int64 // Page number of the right sibling node
+	leftSiblingPN  int64 // Page number of the left sibling node
 	parent         Node  // Pointer to the parent node for unlocking.
 }
 
@@ -74,7 +91,7 @@ type InternalNode struct {
 // initPage resets the page then sets the nodeType variable.
 func initPage(page *pager.Page, nodeType NodeType) {
 	page.SetDirty(true)
-	copy(*page.GetData(), make([]byte, pager.PAGESIZE))
+	copy(*page.GetData(), make([]byte, len(*page.GetData())))
 	if nodeType == LEAF_NODE {
 		(*page.GetData())[int(NODETYPE_OFFSET)] = 1 // Set the nodeType bit
 	}
@@ -107,6 +124,11 @@ func pageToNodeHeader(page *pager.Page) NodeHeader {
 	}
 }
 
+// pageSize returns the size of the page backing this node.
+func (header *NodeHeader) pageSize() int64 {
+	return int64(len(*header.page.GetData()))
+}
+
 // entryPos computes the position of an entry within a page given a headersize.
 func entryPos(headersize int64, entrynum int64) int64 {
 	return headersize + entrynum*ENTRYSIZE
@@ -118,8 +140,8 @@ func keyPos(index int64) int64 {
 }
 
 // pnPos returns the page offset to the internal node's ith child's pagenumber
-func pnPos(index int64) int64 {
-	return PNS_OFFSET + index*PN_SIZE
+func pnPos(pageSize int64, index int64) int64 {
+	return pnsOffset(pageSize) + index*PN_SIZE
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -132,9 +154,13 @@ func pageToLeafNode(page *pager.Page) *LeafNode {
 	rightSiblingPN, _ := binary.Varint(
 		(*page.GetData())[RIGHT_SIBLING_PN_OFFSET : RIGHT_SIBLING_PN_OFFSET+RIGHT_SIBLING_PN_SIZE],
 	)
+	leftSiblingPN, _ := binary.Varint(
+		(*page.GetData())[LEFT_SIBLING_PN_OFFSET : LEFT_SIBLING_PN_OFFSET+LEFT_SIBLING_PN_SIZE],
+	)
 	return &LeafNode{
 		nodeHeader,
 		rightSiblingPN,
+		leftSiblingPN,
 		nil,
 	}
 }
@@ -166,6 +192,7 @@ func (node *LeafNode) copy(toCopy *LeafNode) {
 	copy(*node.page.GetData(), *toCopy.page.GetData())
 	node.updateNumKeys(toCopy.numKeys)
 	node.setRightSibling(toCopy.rightSiblingPN)
+	node.setLeftSibling(toCopy.leftSiblingPN)
 }
 
 // isRoot returns true if the current node is the root node.
@@ -173,6 +200,47 @@ func (node *LeafNode) isRoot() bool {
 	return node.page.GetPageNum() == ROOT_PN
 }
 
+// maxKeys returns the number of entries this leaf node can hold.
+func (node *LeafNode) maxKeys() int64 {
+	return EntriesPerLeafNode(node.pageSize())
+}
+
+// minKeys returns the fewest entries a non-root leaf node may hold: what a split leaves in each half.
+func (node *LeafNode) minKeys() int64 {
+	return (node.maxKeys() + 1) / 2
+}
+
+// lendLast moves this leaf's last entry to the front of its right sibling.
+func (node *LeafNode) lendLast(right *LeafNode) {
+	for i := right.numKeys - 1; i >= 0; i-- {
+		right.modifyEntry(i+1, right.getEntry(i))
+	}
+	right.modifyEntry(0, node.getEntry(node.numKeys-1))
+	right.updateNumKeys(right.numKeys + 1)
+	node.updateNumKeys(node.numKeys - 1)
+}
+
+// lendFirst moves this leaf's first entry to the end of its left sibling.
+func (node *LeafNode) lendFirst(left *LeafNode) {
+	left.modifyEntry(left.numKeys, node.getEntry(0))
+	left.updateNumKeys(left.numKeys + 1)
+	for i := int64(0); i < node.numKeys-1; i++ {
+		node.modifyEntry(i, node.getEntry(i+1))
+	}
+	node.updateNumKeys(node.numKeys - 1)
+}
+
+// merge appends every entry of the right sibling to this leaf and unlinks the sibling.
+func (node *LeafNode) merge(right *LeafNode) error {
+	for i := int64(0); i < right.numKeys; i++ {
+		node.modifyEntry(node.numKeys+i, right.getEntry(i))
+	}
+	node.updateNumKeys(node.numKeys + right.numKeys)
+	node.setRightSibling(right.rightSiblingPN)
+	right.updateNumKeys(0)
+	return node.linkRightSibling()
+}
+
 // setRightSibling sets the right sibling pagenumber attribute of the leaf node
 // and updates the leaf node's page accordingly. returns the old right sibling.
 func (node *LeafNode) setRightSibling(siblingPN int64) int64 {
@@ -190,6 +258,38 @@ func (node *LeafNode) setRightSibling(siblingPN int64) int64 {
 	return oldSiblingPN
 }
 
+// setLeftSibling sets the left sibling pagenumber attribute of the leaf node
+// and updates the leaf node's page accordingly. returns the old left sibling.
+func (node *LeafNode) setLeftSibling(siblingPN int64) int64 {
+	oldSiblingPN := node.leftSiblingPN
+	node.leftSiblingPN = siblingPN
+	siblingData := make([]byte, LEFT_SIBLING_PN_SIZE)
+	binary.PutVarint(siblingData, node.leftSiblingPN)
+	node.page.Update(
+		siblingData,
+		LEFT_SIBLING_PN_OFFSET,
+		LEFT_SIBLING_PN_SIZE,
+	)
+	return oldSiblingPN
+}
+
+// linkRightSibling points the left sibling of this leaf's right sibling back at this leaf.
+func (node *LeafNode) linkRightSibling() error {
+	if node.rightSiblingPN < 0 {
+		return nil
+	}
+	page, err := node.page.GetPager().GetPage(node.rightSiblingPN)
+	if err != nil {
+		return err
+	}
+	defer page.Put()
+	// [CONCURRENCY] The sibling may have another parent, so lock it while we write.
+	page.WLock()
+	defer page.WUnlock()
+	pageToLeafNode(page).setLeftSibling(node.page.GetPageNum())
+	return nil
+}
+
 // entryPos returns the page offset to the entry at the given index.
 func (node *LeafNode) entryPos(index int64) int64 {
 	return entryPos(LEAF_NODE_HEADER_SIZE, index)
@@ -286,6 +386,74 @@ func (node *InternalNode) isRoot() bool {
 	return node.page.GetPageNum() == ROOT_PN
 }
 
+// maxKeys returns the number of keys this internal node can hold.
+func (node *InternalNode) maxKeys() int64 {
+	return KeysPerInternalNode(node.pageSize())
+}
+
+// minKeys returns the fewest keys a non-root internal node may hold: what a split leaves in the left half.
+func (node *InternalNode) minKeys() int64 {
+	return node.maxKeys()/2 - 1
+}
+
+// lendLast moves this node's last child to the front of its right sibling, rotating
+// the separator between them down into the sibling. Returns the new separator.
+func (node *InternalNode) lendLast(right *InternalNode, sepKey int64) int64 {
+	for i := right.numKeys - 1; i >= 0; i-- {
+		right.updateKeyAt(i+1, right.getKeyAt(i))
+	}
+	for i := right.numKeys; i >= 0; i-- {
+		right.updatePNAt(i+1, right.getPNAt(i))
+	}
+	right.updateKeyAt(0, sepKey)
+	right.updatePNAt(0, node.getPNAt(node.numKeys))
+	right.updateNumKeys(right.numKeys + 1)
+	newSepKey := node.getKeyAt(node.numKeys - 1)
+	node.updateNumKeys(node.numKeys - 1)
+	return newSepKey
+}
+
+// lendFirst moves this node's first child to the end of its left sibling, rotating
+// the separator between them down into the sibling. Returns the new separator.
+func (node *InternalNode) lendFirst(left *InternalNode, sepKey int64) int64 {
+	left.updateKeyAt(left.numKeys, sepKey)
+	left.updatePNAt(left.numKeys+1, node.getPNAt(0))
+	left.updateNumKeys(left.numKeys + 1)
+	newSepKey := node.getKeyAt(0)
+	for i := int64(0); i < node.numKeys-1; i++ {
+		node.updateKeyAt(i, node.getKeyAt(i+1))
+	}
+	for i := int64(0); i < node.numKeys; i++ {
+		node.updatePNAt(i, node.getPNAt(i+1))
+	}
+	node.updateNumKeys(node.numKeys - 1)
+	return newSepKey
+}
+
+// merge appends the separator and every key and child of the right sibling to this node.
+func (node *InternalNode) merge(right *InternalNode, sepKey int64) {
+	node.updateKeyAt(node.numKeys, sepKey)
+	for i := int64(0); i < right.numKeys; i++ {
+		node.updateKeyAt(node.numKeys+1+i, right.getKeyAt(i))
+	}
+	for i := int64(0); i <= right.numKeys; i++ {
+		node.updatePNAt(node.numKeys+1+i, right.getPNAt(i))
+	}
+	node.updateNumKeys(node.numKeys + right.numKeys + 1)
+	right.updateNumKeys(0)
+}
+
+// removeAt removes the key at the given index along with the child to its right.
+func (node *InternalNode) removeAt(index int64) {
+	for i := index; i < node.numKeys-1; i++ {
+		node.updateKeyAt(i, node.getKeyAt(i+1))
+	}
+	for i := index + 1; i < node.numKeys; i++ {
+		node.updatePNAt(i, node.getPNAt(i+1))
+	}
+	node.updateNumKeys(node.numKeys - 1)
+}
+
 // getKeyAt returns the key stored at the given index of the internal node.
 func (node *InternalNode) getKeyAt(index int64) int64 {
 	startPos := keyPos(index)
@@ -304,7 +472,7 @@ func (node *InternalNode) updateKeyAt(index int64, key int64) {
 
 // getPNAt returns the pagenumber stored at the given index of the internal node.
 func (node *InternalNode) getPNAt(index int64) int64 {
-	startPos := pnPos(index)
+	startPos := pnPos(node.pageSize(), index)
 	pagenum, _ := binary.Varint((*node.page.GetData())[startPos : startPos+PN_SIZE])
 	return pagenum
 }
@@ -314,7 +482,7 @@ func (node *InternalNode) updatePNAt(index int64, pagenum int64) {
 	// Serialize the pagenum data
 	data := make([]byte, PN_SIZE)
 	binary.PutVarint(data, pagenum)
-	startPos := pnPos(int64(index))
+	startPos := pnPos(node.pageSize(), int64(index))
 	node.page.Update(data, startPos, PN_SIZE)
 }
 
@@ -410,7 +578,7 @@ func (node *InternalNode) initChild(child Node) {
 // only checks if force == false
 func (node *InternalNode) unlockParent(force bool) error {
 	// If we could split and if we're not writing, don't unlock the parents.
-	if !force && node.numKeys == KEYS_PER_INTERNAL_NODE {
+	if !force && node.numKeys == node.maxKeys() {
 		return nil
 	}
 	// Else, unlock the parents recursively, and remove parent pointers.
@@ -428,6 +596,15 @@ func (node *InternalNode) unlockParent(force bool) error {
 	return nil
 }
 
+// unlockParentOnDelete unlocks the parents unless a delete below this node
+// could make it underflow, or, for the root, lose its last key.
+func (node *InternalNode) unlockParentOnDelete() error {
+	if node.isRoot() && node.numKeys > 1 || !node.isRoot() && node.numKeys > node.minKeys() {
+		return node.unlockParent(true)
+	}
+	return nil
+}
+
 // unlock this internal node.
 func (node *InternalNode) unlock() {
 	node.parent = nil
@@ -439,7 +616,7 @@ func (node *InternalNode) unlock() {
 // only checks if force == false
 func (node *LeafNode) unlockParent(force bool) error {
 	// If we could split and if we're not writing, don't unlock the parents.
-	if !force && node.numKeys == ENTRIES_PER_LEAF_NODE {
+	if !force && node.numKeys == node.maxKeys() {
 		return nil
 	}
 	// Unlock the parents recursively, and remove parent pointers.
@@ -457,6 +634,14 @@ func (node *LeafNode) unlockParent(force bool) error {
 	return nil
 }
 
+// unlockParentOnDelete unlocks the parents unless a delete could make this node underflow.
+func (node *LeafNode) unlockParentOnDelete() error {
+	if node.isRoot() || node.numKeys > node.minKeys() {
+		return node.unlockParent(true)
+	}
+	return nil
+}
+
 // unlock this leaf node.
 func (node *LeafNode) unlock() {
 	node.parent = nil
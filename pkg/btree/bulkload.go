@@ -0,0 +1,226 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// childRef is a node built by a bulk load, along with the smallest key beneath it.
+type childRef struct {
+	key int64 // Smallest key in the node's subtree.
+	pn  int64 // Page number of the node.
+}
+
+// sliceCursor traverses a slice of entries.
+type sliceCursor struct {
+	entries []utils.Entry // The entries to traverse.
+	index   int           // Position of the current entry.
+}
+
+// StepForward moves the cursor ahead by one entry. Returns true at the end of the slice.
+func (cursor *sliceCursor) StepForward() bool {
+	if cursor.index+1 >= len(cursor.entries) {
+		cursor.index = len(cursor.entries)
+		return true
+	}
+	cursor.index++
+	return false
+}
+
+// IsEnd returns true if at end.
+func (cursor *sliceCursor) IsEnd() bool {
+	return cursor.index >= len(cursor.entries)
+}
+
+// GetEntry returns the entry currently pointed to by the cursor.
+func (cursor *sliceCursor) GetEntry() (utils.Entry, error) {
+	if cursor.IsEnd() {
+		return BTreeEntry{}, errors.New("getEntry: entry is non-existent")
+	}
+	return cursor.entries[cursor.index], nil
+}
+
+// BulkLoadEntries builds the given empty table from a slice of entries sorted by key.
+func BulkLoadEntries(table *BTreeIndex, entries []utils.Entry, fillFactor float64) error {
+	return BulkLoad(table, &sliceCursor{entries: entries}, fillFactor)
+}
+
+// BulkLoad builds the given empty table from a cursor over entries in strictly ascending key order.
+// Leaves are filled left to right to fillFactor of their capacity, then each level of internal
+// nodes is built from the one below it, and the topmost level is written into the root.
+// Nodes are never left less than half full, so fill factors under 0.5 behave like 0.5.
+// If loading fails, the table is left empty, and the pages and values written are given back.
+func BulkLoad(table *BTreeIndex, cursor utils.Cursor, fillFactor float64) (err error) {
+	if fillFactor <= 0 || fillFactor > 1 {
+		return fmt.Errorf("bulk load: fill factor %v is not in (0, 1]", fillFactor)
+	}
+	rootPage, err := table.pager.GetPage(table.rootPN)
+	if err != nil {
+		return err
+	}
+	// [CONCURRENCY] Hold the root for the whole load so no other operation can start.
+	lockRoot(rootPage)
+	defer SUPER_NODE.page.WUnlock()
+	defer rootPage.WUnlock()
+	defer rootPage.Put()
+	if header := pageToNodeHeader(rootPage); header.nodeType != LEAF_NODE || header.numKeys != 0 {
+		return errors.New("bulk load: table is not empty")
+	}
+	pageSize := int64(len(*rootPage.GetData()))
+	leafMax := EntriesPerLeafNode(pageSize)
+	leafMin := (leafMax + 1) / 2
+	perLeaf := fillTarget(fillFactor, leafMin, leafMax)
+	// Fill leaves left to right, holding back enough entries that the last leaf can't underflow.
+	children := make([]childRef, 0)
+	pending := make([]BTreeEntry, 0, perLeaf+leafMin)
+	var prev *LeafNode
+	defer func() {
+		if prev != nil {
+			prev.page.Put()
+		}
+	}()
+	// Nodes and values written so far, none of them reachable from the root until it is built.
+	written, refs := make([]int64, 0), make([]int64, 0)
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, pn := range written {
+			table.pager.FreePage(pn)
+		}
+		for _, ref := range refs {
+			table.values.Delete(ref)
+		}
+	}()
+	emit := func(entries []BTreeEntry) error {
+		leaf, err := createLeafNode(table.pager)
+		if err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			leaf.modifyEntry(int64(i), entry)
+		}
+		leaf.updateNumKeys(int64(len(entries)))
+		leaf.setRightSibling(-1)
+		leaf.setLeftSibling(-1)
+		if prev != nil {
+			prev.setRightSibling(leaf.page.GetPageNum())
+			leaf.setLeftSibling(prev.page.GetPageNum())
+			prev.page.Put()
+		}
+		prev = leaf
+		written = append(written, leaf.page.GetPageNum())
+		children = append(children, childRef{key: entries[0].key, pn: leaf.page.GetPageNum()})
+		return nil
+	}
+	for !cursor.IsEnd() {
+		entry, err := cursor.GetEntry()
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 && entry.GetKey() == pending[len(pending)-1].key {
+			return fmt.Errorf("bulk load: duplicate key %v", entry.GetKey())
+		}
+		if len(pending) > 0 && entry.GetKey() < pending[len(pending)-1].key {
+			return fmt.Errorf("bulk load: key %v is out of order", entry.GetKey())
+		}
+		loaded := BTreeEntry{key: entry.GetKey(), value: entry.GetValue()}
+		if bytesEntry, ok := entry.(utils.BytesEntry); ok {
+			ref, err := table.values.Put(bytesEntry.GetBytes())
+			if err != nil {
+				return err
+			}
+			refs = append(refs, ref)
+			loaded = newRefEntry(entry.GetKey(), ref)
+		}
+		pending = append(pending, loaded)
+		if int64(len(pending)) == perLeaf+leafMin {
+			if err := emit(pending[:perLeaf]); err != nil {
+				return err
+			}
+			pending = pending[:copy(pending, pending[perLeaf:])]
+		}
+		if cursor.StepForward() {
+			break
+		}
+	}
+	// If everything fits in one leaf, the root is that leaf.
+	if len(children) == 0 && int64(len(pending)) <= leafMax {
+		root := pageToLeafNode(rootPage)
+		for i, entry := range pending {
+			root.modifyEntry(int64(i), entry)
+		}
+		root.updateNumKeys(int64(len(pending)))
+		return nil
+	}
+	// Otherwise, flush what was held back into one or two leaves.
+	for _, size := range groupSizes(int64(len(pending)), leafMax, leafMin, leafMax) {
+		if err := emit(pending[:size]); err != nil {
+			return err
+		}
+		pending = pending[size:]
+	}
+	// Build internal levels bottom-up until the children fit under the root.
+	// Internal nodes are sized by their number of children, one more than their number of keys.
+	keysMax := KeysPerInternalNode(pageSize)
+	nodeMax := keysMax + 1
+	nodeMin := keysMax / 2
+	perNode := fillTarget(fillFactor, nodeMin, nodeMax)
+	for int64(len(children)) > nodeMax {
+		parents := make([]childRef, 0)
+		for _, size := range groupSizes(int64(len(children)), perNode, nodeMin, nodeMax) {
+			node, err := createInternalNode(table.pager)
+			if err != nil {
+				return err
+			}
+			written = append(written, node.page.GetPageNum())
+			node.adopt(children[:size])
+			parents = append(parents, childRef{key: children[0].key, pn: node.page.GetPageNum()})
+			node.page.Put()
+			children = children[size:]
+		}
+		children = parents
+	}
+	initPage(rootPage, INTERNAL_NODE)
+	pageToInternalNode(rootPage).adopt(children)
+	return nil
+}
+
+// adopt fills an empty internal node with the given children, in order.
+func (node *InternalNode) adopt(children []childRef) {
+	for i, child := range children {
+		node.updatePNAt(int64(i), child.pn)
+		if i > 0 {
+			node.updateKeyAt(int64(i-1), child.key)
+		}
+	}
+	node.updateNumKeys(int64(len(children) - 1))
+}
+
+// fillTarget returns how many items a bulk-loaded node holds at the given fill factor.
+func fillTarget(fillFactor float64, min int64, max int64) int64 {
+	target := int64(fillFactor * float64(max))
+	if target < min {
+		return min
+	}
+	if target > max {
+		return max
+	}
+	return target
+}
+
+// groupSizes splits n items into nodes of per items each, leaving every node between min and max.
+// The last per+min items or fewer are split into one node, or two nodes if they don't fit in one.
+func groupSizes(n int64, per int64, min int64, max int64) []int64 {
+	sizes := make([]int64, 0)
+	for n >= per+min {
+		sizes = append(sizes, per)
+		n -= per
+	}
+	if n <= max {
+		return append(sizes, n)
+	}
+	return append(sizes, n/2, n-n/2)
+}
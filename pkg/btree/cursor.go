@@ -2,6 +2,7 @@ package btree
 
 import (
 	"errors"
+	"math"
 	"sync"
 
 	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
@@ -72,7 +73,7 @@ func (table *BTreeIndex) TableEnd() (utils.Cursor, error) {
 	}
 	// Set the cursor to point to the last entry in the rightmost leaf node.
 	rightmostNode := pageToLeafNode(curPage)
-	cursor.isEnd = false
+	cursor.isEnd = (rightmostNode.numKeys == 0)
 	cursor.cellnum = rightmostNode.numKeys - 1
 	cursor.curNode = rightmostNode
 	return &cursor, nil
@@ -102,31 +103,38 @@ func (table *BTreeIndex) TableFind(key int64) (utils.Cursor, error) {
 	return &cursor, nil
 }
 
+// tableSeek returns a cursor pointing to the first entry with a key at or after the given key,
+// which may be in the leaf after the one the key belongs in.
+func (table *BTreeIndex) tableSeek(key int64) (*BTreeCursor, error) {
+	found, err := table.TableFind(key)
+	if err != nil {
+		return nil, err
+	}
+	cursor := found.(*BTreeCursor)
+	if cursor.cellnum == cursor.curNode.numKeys {
+		cursor.cellnum--
+		cursor.isEnd = cursor.StepForward()
+	}
+	return cursor, nil
+}
+
 // TableFindRange returns a slice of Entries with keys between the startKey and endKey.
 func (table *BTreeIndex) TableFindRange(startKey int64, endKey int64) ([]utils.Entry, error) {
-	/* SOLUTION {{{ */
-	// Initialize entries array, get starting cursor.
 	entries := make([]utils.Entry, 0)
-	cursor, err := table.TableFind(startKey)
-	if err != nil {
-		return entries, err
-	}
-	// Keep advancing the cursor and adding the current entry to the list of
-	// entries until reaching the end key.
-	curEntry, err := cursor.GetEntry()
+	cursor, err := table.TableRange(&Bound{Key: startKey, Inclusive: true}, &Bound{Key: endKey}, false)
 	if err != nil {
 		return entries, err
 	}
-	for endKey > curEntry.GetKey() && !cursor.IsEnd() {
-		entries = append(entries, curEntry)
-		cursor.StepForward()
-		curEntry, err = cursor.GetEntry()
+	// Keep advancing the cursor and adding the current entry to the list of entries.
+	for !cursor.IsEnd() {
+		curEntry, err := cursor.GetEntry()
 		if err != nil {
 			return entries, err
 		}
+		entries = append(entries, curEntry)
+		cursor.StepForward()
 	}
 	return entries, nil
-	/* SOLUTION }}} */
 }
 
 // stepForward moves the cursor ahead by one entry. Returns true at the end of the BTree.
@@ -136,11 +144,13 @@ func (cursor *BTreeCursor) StepForward() (atEnd bool) {
 		// Get the next node's page number.
 		nextPN := cursor.curNode.rightSiblingPN
 		if nextPN < 0 {
+			cursor.isEnd = true
 			return true
 		}
 		// Convert the page into a node.
 		nextPage, err := cursor.table.pager.GetPage(nextPN)
 		if err != nil {
+			cursor.isEnd = true
 			return true
 		}
 		defer nextPage.Put()
@@ -165,6 +175,45 @@ func (cursor *BTreeCursor) StepForward() (atEnd bool) {
 	return false
 }
 
+// StepBackward moves the cursor back by one entry. Returns true at the start of the BTree,
+// leaving the cursor where it was.
+func (cursor *BTreeCursor) StepBackward() (atStart bool) {
+	// If the cursor is at the start of the node, go to the previous node.
+	if cursor.cellnum-1 < 0 {
+		// Get the previous node's page number.
+		prevPN := cursor.curNode.leftSiblingPN
+		if prevPN < 0 {
+			return true
+		}
+		// Convert the page into a node.
+		prevPage, err := cursor.table.pager.GetPage(prevPN)
+		if err != nil {
+			return true
+		}
+		defer prevPage.Put()
+		prevNode := pageToLeafNode(prevPage)
+		// If the previous node is empty, step to the node before it.
+		if prevNode.numKeys == 0 {
+			cellnum, curNode := cursor.cellnum, cursor.curNode
+			cursor.cellnum, cursor.curNode = 0, prevNode
+			if cursor.StepBackward() {
+				cursor.cellnum, cursor.curNode = cellnum, curNode
+				return true
+			}
+			return false
+		}
+		// Reinitialize the cursor.
+		cursor.cellnum = prevNode.numKeys - 1
+		cursor.curNode = prevNode
+		cursor.isEnd = false
+		return false
+	}
+	// Else, just move the cursor back.
+	cursor.cellnum--
+	cursor.isEnd = false
+	return false
+}
+
 // IsEnd returns true if at end.
 func (cursor *BTreeCursor) IsEnd() bool {
 	return cursor.isEnd
@@ -177,7 +226,109 @@ func (cursor *BTreeCursor) GetEntry() (utils.Entry, error) {
 		return BTreeEntry{}, errors.New("getEntry: entry is non-existent")
 	}
 	cursor.curNode.page.WLock()
-	defer cursor.curNode.page.WUnlock()
 	entry := cursor.curNode.getEntry(cursor.cellnum)
-	return entry, nil
+	cursor.curNode.page.WUnlock()
+	return cursor.table.resolve(entry)
+}
+
+// Bound is one end of a range of keys.
+type Bound struct {
+	Key       int64 // The key at this end of the range.
+	Inclusive bool  // Whether the key itself is in the range.
+}
+
+// BTreeRangeCursor lazily traverses the entries of a table with keys inside a range,
+// in ascending order, or descending order if reversed.
+type BTreeRangeCursor struct {
+	cursor  *BTreeCursor // Points to the current entry.
+	lower   *Bound       // The lower end of the range, or nil if unbounded.
+	upper   *Bound       // The upper end of the range, or nil if unbounded.
+	reverse bool         // Whether the cursor steps from the upper end down.
+	isEnd   bool         // Indicates that the cursor has left the range.
+}
+
+// TableRange returns a cursor pointing to the first entry with a key between the given bounds,
+// or the last such entry if reverse is set. A nil bound leaves that end of the range open.
+// Entries are read a leaf at a time as the cursor steps.
+func (table *BTreeIndex) TableRange(lower *Bound, upper *Bound, reverse bool) (*BTreeRangeCursor, error) {
+	rangeCursor := &BTreeRangeCursor{lower: lower, upper: upper, reverse: reverse}
+	var err error
+	if !reverse {
+		// Start at the first key at or after the lower bound.
+		seekKey := int64(math.MinInt64)
+		if lower != nil {
+			seekKey = lower.Key
+		}
+		rangeCursor.cursor, err = table.tableSeek(seekKey)
+		if err != nil {
+			return nil, err
+		}
+		if lower != nil && !lower.Inclusive && !rangeCursor.cursor.IsEnd() &&
+			rangeCursor.cursor.curNode.getKeyAt(rangeCursor.cursor.cellnum) == lower.Key {
+			rangeCursor.isEnd = rangeCursor.cursor.StepForward()
+		}
+	} else {
+		// Start at the last key at or before the upper bound.
+		if upper != nil {
+			rangeCursor.cursor, err = table.tableSeek(upper.Key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if upper == nil || rangeCursor.cursor.IsEnd() {
+			end, err := table.TableEnd()
+			if err != nil {
+				return nil, err
+			}
+			rangeCursor.cursor = end.(*BTreeCursor)
+		} else if key := rangeCursor.cursor.curNode.getKeyAt(rangeCursor.cursor.cellnum); key > upper.Key ||
+			key == upper.Key && !upper.Inclusive {
+			rangeCursor.isEnd = rangeCursor.cursor.StepBackward()
+		}
+	}
+	rangeCursor.checkBounds()
+	return rangeCursor, nil
+}
+
+// checkBounds ends the cursor if it has stepped out of the range.
+func (cursor *BTreeRangeCursor) checkBounds() {
+	if cursor.isEnd || cursor.cursor.IsEnd() {
+		cursor.isEnd = true
+		return
+	}
+	key := cursor.cursor.curNode.getKeyAt(cursor.cursor.cellnum)
+	if cursor.lower != nil && (key < cursor.lower.Key || key == cursor.lower.Key && !cursor.lower.Inclusive) {
+		cursor.isEnd = true
+	}
+	if cursor.upper != nil && (key > cursor.upper.Key || key == cursor.upper.Key && !cursor.upper.Inclusive) {
+		cursor.isEnd = true
+	}
+}
+
+// StepForward moves the cursor to the next entry in the range, which is the previous entry
+// in the table if reversed. Returns true once the cursor leaves the range.
+func (cursor *BTreeRangeCursor) StepForward() bool {
+	if cursor.isEnd {
+		return true
+	}
+	if cursor.reverse {
+		cursor.isEnd = cursor.cursor.StepBackward()
+	} else {
+		cursor.isEnd = cursor.cursor.StepForward()
+	}
+	cursor.checkBounds()
+	return cursor.isEnd
+}
+
+// IsEnd returns true if at end.
+func (cursor *BTreeRangeCursor) IsEnd() bool {
+	return cursor.isEnd
+}
+
+// GetEntry returns the entry currently pointed to by the cursor.
+func (cursor *BTreeRangeCursor) GetEntry() (utils.Entry, error) {
+	if cursor.isEnd {
+		return BTreeEntry{}, errors.New("getEntry: entry is non-existent")
+	}
+	return cursor.cursor.GetEntry()
 }
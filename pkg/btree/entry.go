@@ -4,13 +4,25 @@ import (
 	"encoding/binary"
 )
 
-// Global size for Entries.
-var ENTRYSIZE int64 = binary.MaxVarintLen64 * 2
+// Global size for Entries: an int64 key, an int64 value, and a flag byte.
+var ENTRYSIZE int64 = binary.MaxVarintLen64*2 + 1
 
 // Entry is a struct of one unit of information in our table.
+// If ref is set, value is a reference to a byte-slice value in the table's values file.
 type BTreeEntry struct {
 	key   int64
 	value int64
+	ref   bool
+}
+
+// NewBTreeEntry returns an entry with the given key and value.
+func NewBTreeEntry(key int64, value int64) BTreeEntry {
+	return BTreeEntry{key: key, value: value}
+}
+
+// newRefEntry returns an entry whose value is a reference into the values file.
+func newRefEntry(key int64, ref int64) BTreeEntry {
+	return BTreeEntry{key: key, value: ref, ref: true}
 }
 
 // Get key.
@@ -44,13 +56,19 @@ func (entry BTreeEntry) Marshal() []byte {
 	bin = make([]byte, binary.MaxVarintLen64)
 	binary.PutVarint(bin, entry.GetValue())
 	newdata = append(newdata, bin...)
+	// Marshall the reference flag.
+	if entry.ref {
+		newdata = append(newdata, 1)
+	} else {
+		newdata = append(newdata, 0)
+	}
 	// Return the combined byte array.
 	return newdata
 }
 
 // unmarshalEntry deserializes a byte array into an entry.
 func unmarshalEntry(data []byte) (entry BTreeEntry) {
-	k, _ := binary.Varint(data[:len(data)/2])
-	v, _ := binary.Varint(data[len(data)/2:])
-	return BTreeEntry{key: k, value: v}
+	k, _ := binary.Varint(data[:binary.MaxVarintLen64])
+	v, _ := binary.Varint(data[binary.MaxVarintLen64 : 2*binary.MaxVarintLen64])
+	return BTreeEntry{key: k, value: v, ref: data[2*binary.MaxVarintLen64] == 1}
 }
@@ -0,0 +1,36 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// ReadLegacyEntries reads the entries of a btree table written before pages had headers,
+// when a leaf's header held only its right sibling, from each leaf in file order.
+func ReadLegacyEntries(path string) ([]utils.Entry, error) {
+	headerSize := NODE_HEADER_SIZE + RIGHT_SIBLING_PN_SIZE
+	entrySize := int64(2 * binary.MaxVarintLen64) // Legacy entries had no reference flag.
+	maxKeys := (pager.LEGACY_PAGESIZE - headerSize) / entrySize
+	entries := make([]utils.Entry, 0)
+	err := pager.ReadLegacyPages(path, func(pagenum int64, data []byte) error {
+		nodeType := data[NODETYPE_OFFSET]
+		numKeys, n := binary.Varint(data[NUM_KEYS_OFFSET : NUM_KEYS_OFFSET+NUM_KEYS_SIZE])
+		if nodeType > 1 || n <= 0 || numKeys < 0 || (nodeType == 1 && numKeys > maxKeys) {
+			return fmt.Errorf("page %v of %v is not a legacy btree node", pagenum, path)
+		}
+		if nodeType != 1 {
+			return nil
+		}
+		for i := int64(0); i < numKeys; i++ {
+			pos := headerSize + i*entrySize
+			key, _ := binary.Varint(data[pos : pos+binary.MaxVarintLen64])
+			value, _ := binary.Varint(data[pos+binary.MaxVarintLen64 : pos+entrySize])
+			entries = append(entries, NewBTreeEntry(key, value))
+		}
+		return nil
+	})
+	return entries, err
+}
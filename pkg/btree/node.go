@@ -17,15 +17,25 @@ type Split struct {
 	leftPN  int64 // The pagenumber for the left node.
 	rightPN int64 // The pagenumber for the right node.
 	err     error // Used to propagate errors upwards.
+	// The entry an update overwrote, so its byte-slice value can be freed.
+	replaced *BTreeEntry
+}
+
+// Underflow is a supporting data structure to propagate underflows up our B+ tree.
+type Underflow struct {
+	isUnderflow bool  // A flag that's set if the node fell below its minimum occupancy.
+	err         error // Used to propagate errors upwards.
+	// The entry the delete removed, if its key was found, so its byte-slice value can be freed.
+	removed *BTreeEntry
 }
 
 // Node defines a common interface for leaf and internal nodes.
 type Node interface {
 	// Interface for main node functions.
 	search(int64) int64
-	insert(int64, int64, bool) Split
-	delete(int64)
-	get(int64) (int64, bool)
+	insert(BTreeEntry, bool) Split
+	delete(int64) Underflow
+	get(int64) (BTreeEntry, bool)
 
 	// Interface for helper functions.
 	keyToNodeEntry(int64) (*LeafNode, int64, error)
@@ -55,7 +65,7 @@ func (node *LeafNode) search(key int64) int64 {
 
 // insert finds the appropriate place in a leaf node to insert a new tuple.
 // if update is true, allow overwriting existing keys. else, error.
-func (node *LeafNode) insert(key int64, value int64, update bool) Split { //++++++++++++++++++++++++++++++++
+func (node *LeafNode) insert(entry BTreeEntry, update bool) Split { //++++++++++++++++++++++++++++++++
 	/* SOLUTION {{{ */
 	// lock the parent first
 	// unlockParent checks to see if the node could split. if not, will unlock parents. 
@@ -64,13 +74,15 @@ func (node *LeafNode) insert(key int64, value int64, update bool) Split { //++++
 	//defer node.unlockParent(true)
 	defer node.unlock()
 	// Get insert position.
+	key := entry.GetKey()
 	insertPos := node.search(key)
 	// Check if this is a duplicate entry.
 	if insertPos < node.numKeys && node.getKeyAt(insertPos) == key {
 		if update {
-			node.updateValueAt(insertPos, value)
+			replaced := node.getEntry(insertPos)
+			node.modifyEntry(insertPos, entry)
 			node.unlockParent(true)
-			return Split{}
+			return Split{replaced: &replaced}
 		} else {
 			return Split{err: errors.New("cannot insert duplicate key")}
 		}
@@ -82,14 +94,13 @@ func (node *LeafNode) insert(key int64, value int64, update bool) Split { //++++
 	}
 	// Shift entries to the right if needed.
 	for i := node.numKeys - 1; i >= insertPos; i-- {
-		node.updateKeyAt(i+1, node.getKeyAt(i))
-		node.updateValueAt(i+1, node.getValueAt(i))
+		node.modifyEntry(i+1, node.getEntry(i))
 	}
 	node.updateNumKeys(node.numKeys + 1)
 	// Modify the Entry at this position.
-	node.modifyEntry(insertPos, BTreeEntry{key: key, value: value})
+	node.modifyEntry(insertPos, entry)
 	// Check if we need to split the node.
-	if node.numKeys > ENTRIES_PER_LEAF_NODE {
+	if node.numKeys > node.maxKeys() {
 		return node.split()
 	}
 	return Split{}
@@ -97,21 +108,24 @@ func (node *LeafNode) insert(key int64, value int64, update bool) Split { //++++
 }
 
 // delete removes a given tuple from the leaf node, if the given key exists.
-func (node *LeafNode) delete(key int64) {
+// If the node underflows, the parent is left locked so it can rebalance its children.
+func (node *LeafNode) delete(key int64) Underflow {
 	// Find entry.
-	node.unlockParent(true)
+	node.unlockParentOnDelete()
 	defer node.unlock()
 	deletePos := node.search(key)
 	if deletePos >= node.numKeys || node.getKeyAt(deletePos) != key {
 		// Thank you Mario! But our key is in another castle!
-		return
+		node.unlockParent(true)
+		return Underflow{}
 	}
+	removed := node.getEntry(deletePos)
 	// Shift entries to the left.
 	for i := deletePos; i < node.numKeys-1; i++ {
-		node.updateKeyAt(i, node.getKeyAt(i+1))
-		node.updateValueAt(i, node.getValueAt(i+1))
+		node.modifyEntry(i, node.getEntry(i+1))
 	}
 	node.updateNumKeys(node.numKeys - 1)
+	return Underflow{isUnderflow: !node.isRoot() && node.numKeys < node.minKeys(), removed: &removed}
 }
 
 // split is a helper function to split a leaf node, then propagate the split upwards.
@@ -126,11 +140,14 @@ func (node *LeafNode) split() Split {
 	// Set the right sibling for our two nodes.
 	prevSiblingPN := node.setRightSibling(newNode.page.GetPageNum())
 	newNode.setRightSibling(prevSiblingPN)
+	newNode.setLeftSibling(node.page.GetPageNum())
+	if err := newNode.linkRightSibling(); err != nil {
+		return Split{err: err}
+	}
 	// Transfer entries to the new node (plus the new entry) accordingly.
 	midpoint := node.numKeys / 2
 	for i := midpoint; i < node.numKeys; i++ {
-		newNode.updateKeyAt(newNode.numKeys, node.getKeyAt(i))
-		newNode.updateValueAt(newNode.numKeys, node.getValueAt(i))
+		newNode.modifyEntry(newNode.numKeys, node.getEntry(i))
 		newNode.updateNumKeys(newNode.numKeys + 1)
 	}
 	node.updateNumKeys(midpoint)
@@ -143,8 +160,8 @@ func (node *LeafNode) split() Split {
 	/* SOLUTION }}} */
 }
 
-// get returns the value associated with a given key from the leaf node.
-func (node *LeafNode) get(key int64) (value int64, found bool) {
+// get returns the entry associated with a given key from the leaf node.
+func (node *LeafNode) get(key int64) (entry BTreeEntry, found bool) {
 	// Unlock parents, eventually unlock this node.
 	node.unlockParent(true)
 	defer node.unlock()
@@ -152,10 +169,9 @@ func (node *LeafNode) get(key int64) (value int64, found bool) {
 	index := node.search(key)
 	if index >= node.numKeys || node.getKeyAt(index) != key {
 		// Thank you Mario! But our key is in another castle!
-		return 0, false
+		return BTreeEntry{}, false
 	}
-	entry := node.getEntry(index)
-	return entry.GetValue(), true
+	return node.getEntry(index), true
 }
 
 // keyToNodeEntry is a helper function to create cursors that point to a given index within a leaf node.
@@ -207,10 +223,10 @@ func (node *InternalNode) search(key int64) int64 {
 }
 
 // insert finds the appropriate place in a leaf node to insert a new tuple.
-func (node *InternalNode) insert(key int64, value int64, update bool) Split { //+++++++++++++++++++++++++++++++++
+func (node *InternalNode) insert(entry BTreeEntry, update bool) Split { //+++++++++++++++++++++++++++++++++
 	node.unlockParent(false)
 	// Insert the entry into the appropriate child node. Use getChildAt for the indexing
-	childIdx := node.search(key)
+	childIdx := node.search(entry.GetKey())
 	child, err := node.getAndLockChildAt(childIdx)
 	if err != nil {
 		return Split{err: err}
@@ -219,7 +235,7 @@ func (node *InternalNode) insert(key int64, value int64, update bool) Split { //
 	node.initChild(child)
 	defer child.getPage().Put()
 	// Insert value into the child.
-	result := child.insert(key, value, update)
+	result := child.insert(entry, update)
 	// Insert a new key into our node if necessary.
 	if result.isSplit {
 		split := node.insertSplit(result)
@@ -231,7 +247,7 @@ func (node *InternalNode) insert(key int64, value int64, update bool) Split { //
 		}
 		return split
 	}
-	return Split{err: result.err}
+	return Split{err: result.err, replaced: result.replaced}
 }
 
 // insertSplit inserts a split result into an internal node.
@@ -252,7 +268,7 @@ func (node *InternalNode) insertSplit(split Split) Split {
 	node.updatePNAt(insertPos+1, split.rightPN)
 	node.updateNumKeys(node.numKeys + 1)
 	// Check if we need to split.
-	if node.numKeys > KEYS_PER_INTERNAL_NODE {
+	if node.numKeys > node.maxKeys() {
 		return node.split()
 	}
 	return Split{}
@@ -260,18 +276,96 @@ func (node *InternalNode) insertSplit(split Split) Split {
 }
 
 // delete removes a given tuple from the leaf node, if the given key exists.
-func (node *InternalNode) delete(key int64) {
+// If the child underflows, it is rebalanced; if that leaves this node underflowing
+// (or, for the root, without keys), the underflow is cascaded upwards.
+func (node *InternalNode) delete(key int64) Underflow {
 	// Get child.
-	node.unlockParent(true)
+	node.unlockParentOnDelete()
 	childIdx := node.search(key)
 	child, err := node.getAndLockChildAt(childIdx)
 	if err != nil {
-		return
+		node.unlockParent(true)
+		return Underflow{err: err}
 	}
 	node.initChild(child)
 	defer child.getPage().Put()
 	// Delete from child.
-	child.delete(key)
+	result := child.delete(key)
+	if !result.isUnderflow {
+		return result
+	}
+	// The child left us locked; rebalance it, then unlock.
+	defer node.unlock()
+	if err := node.fixUnderflow(childIdx, child); err != nil {
+		node.unlockParent(true)
+		return Underflow{err: err, removed: result.removed}
+	}
+	var underflow bool
+	if node.isRoot() {
+		underflow = node.numKeys == 0
+	} else {
+		underflow = node.numKeys < node.minKeys()
+	}
+	if !underflow {
+		node.unlockParent(true)
+	}
+	return Underflow{isUnderflow: underflow, removed: result.removed}
+}
+
+// fixUnderflow brings the child at the given index back to its minimum occupancy,
+// borrowing from a sibling that can spare a key and merging with one otherwise.
+func (node *InternalNode) fixUnderflow(childIdx int64, child Node) error {
+	// Prefer the left sibling; the leftmost child only has a right one.
+	siblingIdx := childIdx - 1
+	if childIdx == 0 {
+		siblingIdx = 1
+	}
+	sibling, err := node.getAndLockChildAt(siblingIdx)
+	if err != nil {
+		return err
+	}
+	defer sibling.getPage().Put()
+	defer sibling.getPage().WUnlock()
+	// sepIdx is the index of the key separating the left node from the right one.
+	left, right, sepIdx := child, sibling, childIdx
+	if siblingIdx < childIdx {
+		left, right, sepIdx = sibling, child, siblingIdx
+	}
+	var merged bool
+	switch left := left.(type) {
+	case *LeafNode:
+		right := right.(*LeafNode)
+		if siblingIdx < childIdx && left.numKeys > left.minKeys() {
+			left.lendLast(right)
+		} else if siblingIdx > childIdx && right.numKeys > right.minKeys() {
+			right.lendFirst(left)
+		} else {
+			if err := left.merge(right); err != nil {
+				return err
+			}
+			merged = true
+		}
+		if !merged {
+			node.updateKeyAt(sepIdx, right.getKeyAt(0))
+		}
+	case *InternalNode:
+		right := right.(*InternalNode)
+		sepKey := node.getKeyAt(sepIdx)
+		if siblingIdx < childIdx && left.numKeys > left.minKeys() {
+			node.updateKeyAt(sepIdx, left.lendLast(right, sepKey))
+		} else if siblingIdx > childIdx && right.numKeys > right.minKeys() {
+			node.updateKeyAt(sepIdx, right.lendFirst(left, sepKey))
+		} else {
+			left.merge(right, sepKey)
+			merged = true
+		}
+	}
+	if !merged {
+		return nil
+	}
+	// The right node is now empty; drop it from this node and give its page back.
+	node.removeAt(sepIdx)
+	return node.page.GetPager().FreePage(right.getPage().GetPageNum())
 }
 
 // split is a helper function that splits an internal node, then propagates the split upwards.
@@ -305,15 +399,15 @@ func (node *InternalNode) split() Split {
 	/* SOLUTION }}} */
 }
 
-// get returns the value associated with a given key from the leaf node.
-func (node *InternalNode) get(key int64) (value int64, found bool) {
+// get returns the entry associated with a given key from the leaf node.
+func (node *InternalNode) get(key int64) (entry BTreeEntry, found bool) {
 	// [CONCURRENCY] Unlock parents.
 	node.unlockParent(true)
 	// Find the child.
 	childIdx := node.search(key)
 	child, err := node.getAndLockChildAt(childIdx)
 	if err != nil {
-		return 0, false
+		return BTreeEntry{}, false
 	}
 	node.initChild(child)
 	defer child.getPage().Put()
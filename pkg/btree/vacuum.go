@@ -0,0 +1,117 @@
+package btree
+
+import (
+	heap "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/heap"
+)
+
+// nodeRef locates a node's page number within its parent.
+type nodeRef struct {
+	parentPN int64 // Page number of the parent node.
+	index    int64 // Position of the node among the parent's children.
+}
+
+// entryRef locates an entry within a leaf.
+type entryRef struct {
+	leafPN int64 // Page number of the leaf.
+	index  int64 // Position of the entry in the leaf.
+}
+
+// Vacuum compacts the table's file and its values file, moving nodes and values into free
+// pages and truncating them. Returns the number of pages reclaimed.
+func (table *BTreeIndex) Vacuum() (int64, error) {
+	rootPage, err := table.pager.GetPage(table.rootPN)
+	if err != nil {
+		return 0, err
+	}
+	defer rootPage.Put()
+	// [CONCURRENCY] Hold the root for the whole vacuum so no other operation can start.
+	lockRoot(rootPage)
+	defer SUPER_NODE.page.WUnlock()
+	defer rootPage.WUnlock()
+	// Find every node's parent, and every entry referencing a page of values.
+	parents := make(map[int64]nodeRef)
+	refs := make(map[int64][]entryRef)
+	var walk func(node Node) error
+	walk = func(node Node) error {
+		pagenum := node.getPage().GetPageNum()
+		if pagenum != table.rootPN {
+			defer node.getPage().Put()
+		}
+		switch node := node.(type) {
+		case *LeafNode:
+			for i := int64(0); i < node.numKeys; i++ {
+				if entry := node.getEntry(i); entry.ref {
+					valuesPN := heap.RefPage(entry.value)
+					refs[valuesPN] = append(refs[valuesPN], entryRef{pagenum, i})
+				}
+			}
+		case *InternalNode:
+			for i := int64(0); i <= node.numKeys; i++ {
+				parents[node.getPNAt(i)] = nodeRef{pagenum, i}
+				child, err := node.getChildAt(i)
+				if err != nil {
+					return err
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(pageToNode(rootPage)); err != nil {
+		return 0, err
+	}
+	// Repoint the entries referencing each moved page of values, before the leaves move.
+	reclaimed, err := table.values.Vacuum(func(from int64, to int64) error {
+		for _, ref := range refs[from] {
+			leafPage, err := table.pager.GetPage(ref.leafPN)
+			if err != nil {
+				return err
+			}
+			leaf := pageToLeafNode(leafPage)
+			entry := leaf.getEntry(ref.index)
+			leaf.modifyEntry(ref.index, newRefEntry(entry.key, heap.MoveRef(entry.value, to)))
+			leafPage.Put()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Repoint the parent, the siblings, and the children of each moved node.
+	n, err := table.pager.Vacuum(func(from int64, to int64) error {
+		ref := parents[from]
+		parentPage, err := table.pager.GetPage(ref.parentPN)
+		if err != nil {
+			return err
+		}
+		pageToInternalNode(parentPage).updatePNAt(ref.index, to)
+		parentPage.Put()
+		parents[to] = ref
+		delete(parents, from)
+		page, err := table.pager.GetPage(to)
+		if err != nil {
+			return err
+		}
+		defer page.Put()
+		switch node := pageToNode(page).(type) {
+		case *InternalNode:
+			for i := int64(0); i <= node.numKeys; i++ {
+				parents[node.getPNAt(i)] = nodeRef{to, i}
+			}
+		case *LeafNode:
+			if node.leftSiblingPN > 0 {
+				leftPage, err := table.pager.GetPage(node.leftSiblingPN)
+				if err != nil {
+					return err
+				}
+				pageToLeafNode(leftPage).setRightSibling(to)
+				leftPage.Put()
+			}
+			return node.linkRightSibling()
+		}
+		return nil
+	})
+	return reclaimed + n, err
+}
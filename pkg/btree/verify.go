@@ -10,15 +10,65 @@ func IsBTree(index *BTreeIndex) (l int64, r int64, isbtree bool, err error) {
 	if err != nil {
 		return 0, 0, false, err
 	}
-	//defer rootPage.Put()
+	defer rootPage.Put()
 	n := pageToNode(rootPage)
-	return isBTree(n)
+	l, r, isbtree, err = isBTree(n)
+	if err != nil || !isbtree {
+		return l, r, isbtree, err
+	}
+	linked, err := isLinked(n)
+	return l, r, linked, err
+}
+
+// isLinked checks that the leaves under the given root are chained in both directions.
+func isLinked(root Node) (bool, error) {
+	// Find the leftmost leaf.
+	node := root
+	for {
+		internal, ok := node.(*InternalNode)
+		if !ok {
+			break
+		}
+		child, err := internal.getChildAt(0)
+		if err != nil {
+			return false, err
+		}
+		if internal != root {
+			internal.getPage().Put()
+		}
+		node = child
+	}
+	leaf := node.(*LeafNode)
+	prevPN := int64(-1)
+	for {
+		ok := leaf.leftSiblingPN == prevPN
+		prevPN = leaf.page.GetPageNum()
+		nextPN := leaf.rightSiblingPN
+		if leaf != root {
+			leaf.page.Put()
+		}
+		if !ok {
+			return false, nil
+		}
+		if nextPN < 0 {
+			return true, nil
+		}
+		page, err := root.getPage().GetPager().GetPage(nextPN)
+		if err != nil {
+			return false, err
+		}
+		leaf = pageToLeafNode(page)
+	}
 }
 
 func isBTree(n Node) (l int64, r int64, isbtree bool, err error) {
 	// Depending on the node type...
 	switch n := n.(type) {
 	case *InternalNode:
+		// Check that the node is at least half full; the root only needs two children.
+		if n.isRoot() && n.numKeys < 1 || !n.isRoot() && n.numKeys < n.minKeys() {
+			return -1, -1, false, nil
+		}
 		// Check that each key is less than the bounds of the node it goes around.
 		var lowest, highest int64
 		for i := int64(0); i < n.numKeys+1; i++ {
@@ -27,9 +77,9 @@ func isBTree(n Node) (l int64, r int64, isbtree bool, err error) {
 			if err != nil {
 				return -1, -1, false, err
 			}
-			//defer c.getPage().Put()
 			// Check if child is BTree
 			cl, cr, cisbtree, err := isBTree(c)
+			c.getPage().Put()
 			if err != nil {
 				return -1, -1, false, err
 			} else if !cisbtree {
@@ -59,6 +109,10 @@ func isBTree(n Node) (l int64, r int64, isbtree bool, err error) {
 		// Return bounds.
 		return lowest, highest, true, nil
 	case *LeafNode:
+		// Check that the node is at least half full, unless it is the root.
+		if !n.isRoot() && n.numKeys < n.minKeys() {
+			return -1, -1, false, nil
+		}
 		// Check that each key is less than the one after it.
 		for i := int64(0); i < n.numKeys-1; i++ {
 			if n.getKeyAt(i) > n.getKeyAt(i+1) {
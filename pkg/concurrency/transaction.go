@@ -2,6 +2,7 @@ package concurrency
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 
 	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
@@ -68,6 +69,17 @@ func (tm *TransactionManager) GetTransactions() (txs map[uuid.UUID]*Transaction)
 	return tm.transactions
 }
 
+// Return an error naming the given operation if any transaction is running.
+// Operations that replace a table's files cannot be interleaved with transactions.
+func (tm *TransactionManager) CheckIdle(op string) (err error) {
+	tm.tmMtx.RLock()
+	defer tm.tmMtx.RUnlock()
+	if len(tm.transactions) > 0 {
+		return fmt.Errorf("cannot %s a table while transactions are running", op)
+	}
+	return nil
+}
+
 // Get a particular transaction.
 func (tm *TransactionManager) GetTransaction(clientId uuid.UUID) (tx *Transaction, found bool) {
 	tm.tmMtx.RLock()
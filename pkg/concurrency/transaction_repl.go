@@ -10,6 +10,7 @@ import (
 	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
 	query "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/query"
 	repl "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/repl"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
 
 	uuid "github.com/google/uuid"
 )
@@ -19,25 +20,34 @@ func TransactionREPL(d *db.Database, tm *TransactionManager) *repl.REPL {
 	r := repl.NewRepl()
 	r.AddCommand("create", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleCreateTable(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Create a table. usage: create table <table>")
+	}, "Create a table, optionally with typed columns, or a secondary index on a column. usage: create [btree|hash] table <table> [(<column> <int|text|float> [primary key], ...)] | create index <index> on <table>(<column>) using <btree|hash>")
+	r.AddCommand("drop", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleDrop(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Delete a table and its files. usage: drop table <table>")
+	r.AddCommand("rename", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleRename(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Rename a table. usage: rename table <table> to <new name>")
+	r.AddCommand("truncate", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleTruncate(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Delete every entry of a table. usage: truncate table <table>")
 	r.AddCommand("find", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleFind(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Find an element. usage: find <key> from <table>")
+	}, "Find an element by its key, or the elements a condition holds for. usage: find <key> from <table> | find from <table> where <condition>")
 	r.AddCommand("insert", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleInsert(d, tm, payload, replConfig.GetAddr())
-	}, "Insert an element. usage: insert <key> <value> into <table>")
+	}, "Insert an element. usage: insert into <table> [(<column>, ...)] values (<value>, ...) | insert <key> <value> into <table>")
 	r.AddCommand("update", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleUpdate(d, tm, payload, replConfig.GetAddr())
-	}, "Update en element. usage: update <table> <key> <value>")
+	}, "Update the elements a condition holds for, or replace one by its key. usage: update <table> set <column> = <value>, ... [where <condition>] | update <table> <key> <value>")
 	r.AddCommand("delete", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleDelete(d, tm, payload, replConfig.GetAddr())
-	}, "Delete an element. usage: delete <key> from <table>")
+	}, "Delete the elements a condition holds for, or one by its key. usage: delete from <table> [where <condition>] | delete <key> from <table>")
 	r.AddCommand("select", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleSelect(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Select elements from a table. usage: select from <table>")
+	}, "Select elements from a table, or count, sum, min, max or avg them by group. usage: select [<column>, ...] from <table> [where <condition>] [group by <column>, ...] [order by <column> [asc|desc], ...] [limit <n>]")
 	r.AddCommand("join", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleJoin(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Joins two tables. usage: join <table1> <key/val for table1> on <table2> <key/val for table2>")
+	}, "Joins tables, each with what the joins before it produce. Outer joins pair entries without a match with null, and semi and anti joins find the entries with and without one. usage: join <table1> <key/val for table1> [left|right|full|semi|anti] on <table2> <key/val for table2> [<key/val for table3>] [[left|right|full|semi|anti] on <table3> <key/val for table3> ...] [using <merge|index|block|hash>]")
 	r.AddCommand("transaction", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleTransaction(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
 	}, "Handle transactions. usage: transaction <begin|commit>")
@@ -73,27 +83,56 @@ func HandleCreateTable(d *db.Database, tm *TransactionManager, payload string, w
 	return db.HandleCreateTable(d, payload, w)
 }
 
+// Handle drop table.
+func HandleDrop(d *db.Database, tm *TransactionManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	if err = tm.CheckIdle("drop"); err != nil {
+		return err
+	}
+	return db.HandleDrop(d, payload, w)
+}
+
+// Handle rename table.
+func HandleRename(d *db.Database, tm *TransactionManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	if err = tm.CheckIdle("rename"); err != nil {
+		return err
+	}
+	return db.HandleRename(d, payload, w)
+}
+
+// Handle truncate table.
+func HandleTruncate(d *db.Database, tm *TransactionManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	if err = tm.CheckIdle("truncate"); err != nil {
+		return err
+	}
+	return db.HandleTruncate(d, payload, w)
+}
+
 // Handle find.
 func HandleFind(d *db.Database, tm *TransactionManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: find <key> from <table>
-	var key int
-	var table db.Index
-	if numFields != 4 || fields[2] != "from" {
-		return fmt.Errorf("usage: find <key> from <table>")
-	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
+	statement, err := sql.Parse(payload)
+	if err != nil {
 		return fmt.Errorf("find error: %v", err)
 	}
-	if table, err = d.GetTable(fields[3]); err != nil {
+	// Usage: find <key> from <table> | find from <table> where <condition>
+	find, ok := statement.(*sql.FindStmt)
+	if !ok {
+		return fmt.Errorf("usage: find <key> from <table> | find from <table> where <condition>")
+	}
+	var table db.Index
+	if table, err = d.GetTable(find.Table); err != nil {
 		return fmt.Errorf("find error: %v", err)
 	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), R_LOCK); err != nil {
+	keys, err := d.QueryKeys(find.Table, find.Where)
+	if err != nil {
 		return fmt.Errorf("find error: %v", err)
 	}
-	if err = db.HandleFind(d, payload, w); err != nil {
+	// Get the transaction, lock the entries found, then run the find.
+	for _, key := range keys {
+		if err = tm.Lock(clientId, table, key, R_LOCK); err != nil {
+			return fmt.Errorf("find error: %v", err)
+		}
+	}
+	if err = query.HandleFind(d, payload, w); err != nil {
 		return fmt.Errorf("find error: %v", err)
 	}
 	return nil
@@ -101,105 +140,55 @@ func HandleFind(d *db.Database, tm *TransactionManager, payload string, w io.Wri
 
 // Handle inserts.
 func HandleInsert(d *db.Database, tm *TransactionManager, payload string, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: insert <key> <value> into <table>
-	var key int
-	var table db.Index
-	if numFields != 5 || fields[3] != "into" {
-		return fmt.Errorf("usage: insert <key> <value> into <table>")
-	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	if table, err = d.GetTable(fields[4]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), W_LOCK); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	if err = db.HandleInsert(d, payload); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	return nil
+	return handleEdit(d, tm, "insert", payload, clientId)
 }
 
 // Handle update.
 func HandleUpdate(d *db.Database, tm *TransactionManager, payload string, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: update <table> <key> <value>
-	var key int
-	var table db.Index
-	if numFields != 4 {
-		return fmt.Errorf("usage: update <table> <key> <value>")
-	}
-	if key, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	if table, err = d.GetTable(fields[1]); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), W_LOCK); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	if err = db.HandleUpdate(d, payload); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	return nil
+	return handleEdit(d, tm, "update", payload, clientId)
 }
 
 // Handle delete.
 func HandleDelete(d *db.Database, tm *TransactionManager, payload string, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: delete <key> from <table>
-	var key int
-	var table db.Index
-	if numFields != 4 || fields[2] != "from" {
-		return fmt.Errorf("usage: delete <key> from <table>")
-	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
-	}
-	if table, err = d.GetTable(fields[3]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	return handleEdit(d, tm, "delete", payload, clientId)
+}
+
+// handleEdit runs an insert, update or delete, locking each key it changes.
+func handleEdit(d *db.Database, tm *TransactionManager, command string, payload string, clientId uuid.UUID) (err error) {
+	tableName, edits, err := db.ParseEdits(d, command, payload)
+	if err != nil {
+		return err
 	}
-	// Get the transaction, run the find, release lock and rollback if error.
-	if err = tm.Lock(clientId, table, int64(key), W_LOCK); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	var table db.Index
+	if table, err = d.GetTable(tableName); err != nil {
+		return fmt.Errorf("%s error: %v", command, err)
 	}
-	if err = db.HandleDelete(d, payload); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	for _, edit := range edits {
+		if err = ApplyEdit(tm, table, edit, clientId); err != nil {
+			return fmt.Errorf("%s error: %v", command, err)
+		}
 	}
 	return nil
 }
 
+// ApplyEdit grabs a write lock on the key an edit changes for the client's transaction,
+// then makes the edit.
+func ApplyEdit(tm *TransactionManager, table db.Index, edit db.Edit, clientId uuid.UUID) error {
+	if err := tm.Lock(clientId, table, edit.Key, W_LOCK); err != nil {
+		return err
+	}
+	return db.ApplyEdit(table, edit)
+}
+
 // Handle select.
 func HandleSelect(d *db.Database, tm *TransactionManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: select from <table>
-	if numFields != 3 || fields[1] != "from" {
-		return fmt.Errorf("usage: select from <table>")
-	}
 	// NOTE: Select is unsafe; not locking anything. May provide an inconsistent view of the database.
-	if err = db.HandleSelect(d, payload, w); err != nil {
-		return fmt.Errorf("select error: %v", err)
-	}
-	return nil
+	return query.HandleSelect(d, payload, w)
 }
 
 // Handle join.
 func HandleJoin(d *db.Database, tm *TransactionManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: join <table1> <key/val for table1> on <table2> <key/val for table2>
-	if numFields != 6 || fields[3] != "on" || (fields[2] != "key" && fields[2] != "val") || (fields[5] != "key" && fields[5] != "val") {
-		return fmt.Errorf("usage: join <table1> <key/val for table1> on <table2> <key/val for table2>")
-	}
+	// query.HandleJoin checks the command's usage.
 	// NOTE: Join is unsafe; not locking anything. May provide an inconsistent view of the database.
 	err = query.HandleJoin(d, payload, w)
 	return err
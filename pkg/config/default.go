@@ -10,6 +10,9 @@ const Prompt = DBName + "> "
 // Number of pages.
 const NumPages = 32
 
+// Number of frames in the buffer pool shared by a database's tables.
+const NumGlobalFrames = 256
+
 // Name of log file.
 const LogFileName = "./db.log"
 
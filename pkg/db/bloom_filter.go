@@ -0,0 +1,175 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	bitset "github.com/bits-and-blooms/bitset"
+	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+)
+
+// A BloomFilter records a set of keys in a fixed number of bits, answering whether a key may
+// be in it: never no for a key that is, but sometimes yes for one that isn't. Each key sets
+// the bits its hashes pick. Its k hashes are derived from two, xxhash and MurmurHash3, as
+// the i-th is the first plus i times the second.
+type BloomFilter struct {
+	size   int64 // Number of bits.
+	hashes int64 // Number of hashes each key sets a bit for.
+	keys   int64 // Number of keys inserted.
+	bits   *bitset.BitSet
+}
+
+// NewBloomFilter returns an empty filter of the given number of bits, each key setting the
+// bits of the given number of hashes.
+func NewBloomFilter(size int64, hashes int64) *BloomFilter {
+	size, hashes = int64(math.Max(float64(size), 1)), int64(math.Max(float64(hashes), 1))
+	return &BloomFilter{size: size, hashes: hashes, bits: bitset.New(uint(size))}
+}
+
+// FilterSize returns the number of bits a filter needs to hold n keys with the given rate of
+// false positives, using the best number of hashes: -n ln p / (ln 2)^2.
+func FilterSize(n int64, falsePositiveRate float64) int64 {
+	size := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	return int64(math.Max(size, 1))
+}
+
+// FilterHashes returns the number of hashes that gives a filter of the given size holding n
+// keys the fewest false positives: size / n ln 2.
+func FilterHashes(n int64, size int64) int64 {
+	if n <= 0 {
+		return 1
+	}
+	return int64(math.Max(math.Round(float64(size)/float64(n)*math.Ln2), 1))
+}
+
+// FilterCapacity returns the number of keys a filter of the given size holds before its rate
+// of false positives exceeds the given one, the inverse of FilterSize.
+func FilterCapacity(size int64, falsePositiveRate float64) int64 {
+	return int64(float64(size) * math.Ln2 * math.Ln2 / -math.Log(falsePositiveRate))
+}
+
+// NewOptimalFilter returns an empty filter sized to hold n keys with the given rate of false
+// positives.
+func NewOptimalFilter(n int64, falsePositiveRate float64) *BloomFilter {
+	size := FilterSize(n, falsePositiveRate)
+	return NewBloomFilter(size, FilterHashes(n, size))
+}
+
+// Get the number of bits in the filter.
+func (filter *BloomFilter) Size() int64 {
+	return filter.size
+}
+
+// Get the number of hashes each key sets a bit for.
+func (filter *BloomFilter) Hashes() int64 {
+	return filter.hashes
+}
+
+// Get the number of keys inserted into the filter; for a union or intersection, at most
+// that many are in it.
+func (filter *BloomFilter) Keys() int64 {
+	return filter.keys
+}
+
+// positions calls visit with the bit each of the key's hashes picks.
+func (filter *BloomFilter) positions(key int64, visit func(uint) bool) {
+	first, second := hash.XxHasher(key, filter.size), hash.MurmurHasher(key, filter.size)
+	for i := int64(0); i < filter.hashes; i++ {
+		if !visit((first + uint(i)*second) % uint(filter.size)) {
+			return
+		}
+	}
+}
+
+// Insert adds a key to the filter.
+func (filter *BloomFilter) Insert(key int64) {
+	filter.positions(key, func(position uint) bool {
+		filter.bits.Set(position)
+		return true
+	})
+	filter.keys++
+}
+
+// Contains checks whether the key may have been inserted into the filter.
+func (filter *BloomFilter) Contains(key int64) bool {
+	found := true
+	filter.positions(key, func(position uint) bool {
+		found = filter.bits.Test(position)
+		return found
+	})
+	return found
+}
+
+// compatible checks that another filter has the same size and hashes as this one, so their
+// bits mean the same keys.
+func (filter *BloomFilter) compatible(other *BloomFilter) error {
+	if filter.size != other.size || filter.hashes != other.hashes {
+		return errors.New("cannot combine filters of different sizes or numbers of hashes")
+	}
+	return nil
+}
+
+// Union adds every key inserted into another filter of the same size and hashes to this one.
+func (filter *BloomFilter) Union(other *BloomFilter) error {
+	if err := filter.compatible(other); err != nil {
+		return err
+	}
+	filter.bits.InPlaceUnion(other.bits)
+	filter.keys += other.keys
+	return nil
+}
+
+// Intersect keeps only the bits this filter shares with another of the same size and hashes,
+// so it contains every key inserted into both. It may contain more than a filter of just
+// those keys would.
+func (filter *BloomFilter) Intersect(other *BloomFilter) error {
+	if err := filter.compatible(other); err != nil {
+		return err
+	}
+	filter.bits.InPlaceIntersection(other.bits)
+	if other.keys < filter.keys {
+		filter.keys = other.keys
+	}
+	return nil
+}
+
+// Marshal encodes the filter: its size, hashes and keys as varints, then its bits as
+// little-endian words.
+func (filter *BloomFilter) Marshal() []byte {
+	words := filter.bits.Bytes()
+	data := make([]byte, 0, 3*binary.MaxVarintLen64+8*len(words))
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, field := range []int64{filter.size, filter.hashes, filter.keys} {
+		n := binary.PutVarint(buf, field)
+		data = append(data, buf[:n]...)
+	}
+	for _, word := range words {
+		binary.LittleEndian.PutUint64(buf, word)
+		data = append(data, buf[:8]...)
+	}
+	return data
+}
+
+// UnmarshalFilter decodes a filter encoded by Marshal.
+func UnmarshalFilter(data []byte) (*BloomFilter, error) {
+	corrupted := errors.New("bloom filter is corrupted")
+	fields := make([]int64, 3)
+	for i := range fields {
+		field, n := binary.Varint(data)
+		if n <= 0 || field < 0 {
+			return nil, corrupted
+		}
+		fields[i], data = field, data[n:]
+	}
+	size, hashes, keys := fields[0], fields[1], fields[2]
+	if size < 1 || hashes < 1 || int64(len(data)) != 8*((size+63)/64) {
+		return nil, corrupted
+	}
+	words := make([]uint64, len(data)/8)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+	bits := bitset.From(words)
+	return &BloomFilter{size: size, hashes: hashes, keys: keys, bits: bits}, nil
+}
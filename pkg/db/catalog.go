@@ -0,0 +1,126 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// Name of the catalog file in a database's folder. Table names are alphanumeric,
+// so it can't clash with a table's files.
+var CATALOG_FILE = "catalog.json"
+
+// TableInfo is what the catalog records about a table.
+type TableInfo struct {
+	Name     string       `json:"name"`
+	Type     IndexType    `json:"type"`
+	Schema   *Schema      `json:"schema,omitempty"`  // Column layout, or nil for a table of (key, value) pairs.
+	PageSize int64        `json:"page_size"`         // Page size the table's files were created with.
+	Indexes  []*IndexInfo `json:"indexes,omitempty"` // Secondary indexes on the table's columns.
+	Stats    *TableStats  `json:"stats,omitempty"`   // Statistics about the rows, once analyzed.
+	Filter   *FilterInfo  `json:"filter,omitempty"`  // Bloom filter of the table's keys, if it has one.
+	// New name of a rename that may not have moved all of the table's files yet.
+	RenamingTo string `json:"renaming_to,omitempty"`
+}
+
+// IndexInfo is what the catalog records about a secondary index.
+type IndexInfo struct {
+	Name   string    `json:"name"`
+	Column string    `json:"column"` // Name of the indexed column.
+	Type   IndexType `json:"type"`
+}
+
+// FilterInfo is what the catalog records about a table's bloom filter. Its bits are kept in
+// a file of their own.
+type FilterInfo struct {
+	FalsePositiveRate float64 `json:"false_positive_rate"` // Rate of false positives the filter is kept sized for.
+}
+
+// Catalog records the tables of a database, and is kept as JSON next to them.
+type Catalog struct {
+	Tables map[string]*TableInfo `json:"tables"`
+}
+
+// Get the names of the tables in the catalog, in order.
+func (catalog *Catalog) GetNames() []string {
+	names := make([]string, 0, len(catalog.Tables))
+	for name := range catalog.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findIndex returns the secondary index with the given name and the table it is on.
+func (catalog *Catalog) findIndex(name string) (*TableInfo, *IndexInfo) {
+	for _, info := range catalog.Tables {
+		for _, indexInfo := range info.Indexes {
+			if indexInfo.Name == name {
+				return info, indexInfo
+			}
+		}
+	}
+	return nil, nil
+}
+
+// readCatalog reads the catalog in the given folder. A folder without one, written before
+// databases kept catalogs, is cataloged from the table files in it, with the given page size.
+func readCatalog(folder string, pageSize int64) (*Catalog, error) {
+	catalog := &Catalog{Tables: make(map[string]*TableInfo)}
+	data, err := ioutil.ReadFile(filepath.Join(folder, CATALOG_FILE))
+	if os.IsNotExist(err) {
+		return scanCatalog(folder, pageSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, fmt.Errorf("catalog is corrupted: %v", err)
+	}
+	return catalog, nil
+}
+
+// scanCatalog catalogs the tables whose files are in the given folder, writing the catalog
+// if there are any. A table is a hash table if it has a .meta file, and a btree table if not.
+// Tables in the format written before pages had headers are migrated when opened.
+func scanCatalog(folder string, pageSize int64) (*Catalog, error) {
+	catalog := &Catalog{Tables: make(map[string]*TableInfo)}
+	files, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+	alphanumeric := regexp.MustCompile(`^\w+$`)
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !alphanumeric.MatchString(name) {
+			continue
+		}
+		info := &TableInfo{Name: name, Type: BTreeIndexType, PageSize: pageSize}
+		if _, err := os.Stat(filepath.Join(folder, name+".meta")); err == nil {
+			info.Type = HashIndexType
+		}
+		catalog.Tables[name] = info
+	}
+	if len(catalog.Tables) == 0 {
+		return catalog, nil
+	}
+	return catalog, catalog.write(folder)
+}
+
+// write replaces the catalog in the given folder, writing a temp file first so a crash
+// can't leave it half written.
+func (catalog *Catalog) write(folder string) error {
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(folder, CATALOG_FILE)
+	if err := ioutil.WriteFile(path+".tmp", data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
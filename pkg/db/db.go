@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,7 +10,9 @@ import (
 	"strings"
 
 	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	config "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/config"
 	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	heap "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/heap"
 	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
 	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 )
@@ -18,6 +21,46 @@ import (
 type Database struct {
 	basepath string
 	tables   map[string]Index
+	catalog  *Catalog          // Schemas of the tables.
+	options  Options           // Buffer pool configuration.
+	pool     *pager.BufferPool // Frames shared by every table, if GlobalFrames is positive.
+}
+
+// Options configure the buffer pool of a database.
+type Options struct {
+	FramesPerTable int64 // Frames given to each table's pager.
+	GlobalFrames   int64 // If positive, the size of a buffer pool shared by all tables instead.
+	PageSize       int64 // Page size of every table file.
+}
+
+// An Option modifies the Options a database is opened with.
+type Option func(*Options)
+
+// DefaultOptions returns the compile-time defaults.
+func DefaultOptions() Options {
+	defaults := pager.DefaultOptions()
+	return Options{FramesPerTable: defaults.NumFrames, GlobalFrames: config.NumGlobalFrames, PageSize: defaults.PageSize}
+}
+
+// WithFramesPerTable gives each table's pager n frames.
+func WithFramesPerTable(n int64) Option {
+	return func(options *Options) {
+		options.FramesPerTable = n
+	}
+}
+
+// WithGlobalFrames shares a pool of n frames between all tables; 0 gives each table its own frames.
+func WithGlobalFrames(n int64) Option {
+	return func(options *Options) {
+		options.GlobalFrames = n
+	}
+}
+
+// WithPageSize sets the page size of every table file.
+func WithPageSize(n int64) Option {
+	return func(options *Options) {
+		options.PageSize = n
+	}
 }
 
 // Index interface.
@@ -25,14 +68,18 @@ type Index interface {
 	Close() error
 	GetName() string
 	GetPager() *pager.Pager
+	GetValues() *heap.Values
 	Find(int64) (utils.Entry, error)
 	Insert(int64, int64) error
+	InsertBytes(int64, []byte) error
 	Update(int64, int64) error
+	UpdateBytes(int64, []byte) error
 	Delete(int64) error
 	Select() ([]utils.Entry, error)
 	Print(io.Writer)
 	PrintPN(int, io.Writer)
 	TableStart() (utils.Cursor, error)
+	Vacuum() (int64, error)
 }
 
 // An index can either be a B+Tree or a Hash Table.
@@ -43,8 +90,49 @@ const (
 	HashIndexType  IndexType = 1
 )
 
+var indexTypeNames = map[IndexType]string{BTreeIndexType: "btree", HashIndexType: "hash"}
+
+// String returns the name tables of the index type are created with.
+func (indexType IndexType) String() string {
+	if name, ok := indexTypeNames[indexType]; ok {
+		return name
+	}
+	return fmt.Sprintf("IndexType(%d)", int64(indexType))
+}
+
+// ParseIndexType returns the index type with the given name.
+func ParseIndexType(name string) (IndexType, error) {
+	for indexType, typeName := range indexTypeNames {
+		if typeName == name {
+			return indexType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown index type %v", name)
+}
+
+// MarshalText encodes the index type by its name.
+func (indexType IndexType) MarshalText() ([]byte, error) {
+	return []byte(indexType.String()), nil
+}
+
+// UnmarshalText decodes an index type from its name.
+func (indexType *IndexType) UnmarshalText(text []byte) (err error) {
+	*indexType, err = ParseIndexType(string(text))
+	return err
+}
+
 // Opens a database given a data folder.
-func Open(folder string) (*Database, error) {
+func Open(folder string, opts ...Option) (*Database, error) {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.GlobalFrames < 0 {
+		return nil, errors.New("global frame budget must not be negative")
+	}
+	if err := (pager.Options{NumFrames: options.FramesPerTable, PageSize: options.PageSize}).Validate(); err != nil {
+		return nil, err
+	}
 	// Ensure folder is of the form */
 	if !strings.HasSuffix(folder, "/") {
 		folder += "/"
@@ -54,15 +142,68 @@ func Open(folder string) (*Database, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Return an empty database.
-	return &Database{
+	// Set up the shared buffer pool.
+	var pool *pager.BufferPool
+	if options.GlobalFrames > 0 {
+		pool, err = pager.NewBufferPool(pager.Options{NumFrames: options.GlobalFrames, PageSize: options.PageSize})
+		if err != nil {
+			return nil, err
+		}
+	}
+	catalog, err := readCatalog(folder, options.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	// Return a database with no tables open yet.
+	db := &Database{
 		basepath: folder,
 		tables:   make(map[string]Index),
-	}, nil
+		catalog:  catalog,
+		options:  options,
+		pool:     pool,
+	}
+	// Finish the renames a crash interrupted.
+	renaming := make([]*TableInfo, 0)
+	for _, info := range catalog.Tables {
+		if info.RenamingTo != "" {
+			renaming = append(renaming, info)
+		}
+	}
+	for _, info := range renaming {
+		if err := db.finishRename(info); err != nil {
+			return nil, fmt.Errorf("cannot finish renaming table %v: %v", info.Name, err)
+		}
+	}
+	return db, nil
+}
+
+// Get the options this database was opened with.
+func (db *Database) GetOptions() Options {
+	return db.options
+}
+
+// Get the buffer pool shared by the tables, or nil if each table has its own frames.
+func (db *Database) GetPool() *pager.BufferPool {
+	return db.pool
 }
 
-// Close each table in the database, then close the database.
+// newPager returns a pager for a table with the given page size, drawing from the shared pool if there is one.
+func (db *Database) newPager(pageSize int64) (*pager.Pager, error) {
+	if db.pool != nil {
+		// Tables in a shared pool all have the pool's page size.
+		if pageSize != db.pool.GetPageSize() {
+			return nil, fmt.Errorf("table has %v byte pages, but the buffer pool has %v byte pages",
+				pageSize, db.pool.GetPageSize())
+		}
+		return db.pool.NewPager(), nil
+	}
+	return pager.NewPagerWithOptions(pager.Options{NumFrames: db.options.FramesPerTable, PageSize: pageSize})
+}
+
+// Close each table in the database, then close the database, recording any changes
+// edits made to the tables' stats.
 func (db *Database) Close() (err error) {
+	err = db.writeStats()
 	for _, table := range db.tables {
 		curErr := table.Close()
 		if err == nil {
@@ -84,66 +225,282 @@ func (db *Database) CreateLogFile(filename string) error {
 	return file.Close()
 }
 
-// Create a table with the given type.
-func (db *Database) createTable(name string, indexType IndexType) (index Index, err error) {
+// Create a table with the given type, and the given schema or nil for (key, value) pairs.
+func (db *Database) createTable(name string, indexType IndexType, schema *Schema) (index Index, err error) {
 	// Ensure the db name is alphanumeric.
 	alphanumeric, _ := regexp.Compile(`\W`)
 	if alphanumeric.MatchString(name) {
 		return nil, errors.New("table name must be alphanumeric")
 	}
 	// Create the file, if not exists.
-	path := filepath.Join(db.basepath, name)
-	if _, err := os.Stat(path); err == nil {
+	if _, ok := db.catalog.Tables[name]; ok {
 		return nil, errors.New("table already exists")
 	}
+	if info, _ := db.catalog.findIndex(name); info != nil {
+		return nil, fmt.Errorf("%v is the name of an index", name)
+	}
+	// Files of a table the catalog doesn't know are left from a drop that never finished.
+	if err := removeFiles(db.tableFiles(name)); err != nil {
+		return nil, err
+	}
+	info := &TableInfo{Name: name, Type: indexType, Schema: schema, PageSize: db.options.PageSize}
+	index, err = db.openTable(info)
+	if err != nil {
+		return nil, err
+	}
+	db.tables[name] = index
+	db.catalog.Tables[name] = info
+	if err := db.catalog.write(db.basepath); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// openTable opens the files of the table the catalog describes with the given info,
+// along with its secondary indexes.
+func (db *Database) openTable(info *TableInfo) (index Index, err error) {
+	tablePager, err := db.newPager(info.PageSize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open table %v: %v", info.Name, err)
+	}
 	// Open the right type of index.
-	switch indexType {
+	path := filepath.Join(db.basepath, info.Name)
+	switch info.Type {
 	case BTreeIndexType:
-		index, err = btree.OpenTable(path)
+		index, err = btree.OpenTableWithPager(path, tablePager)
+	case HashIndexType:
+		index, err = hash.OpenTableWithPager(path, tablePager)
+	default:
+		err = errors.New("invalid index type")
+	}
+	if err != nil {
+		// Give the pager's frames back to the pool.
+		tablePager.Close()
+		return nil, err
+	}
+	if len(info.Indexes) == 0 && info.Stats == nil && info.Filter == nil {
+		return index, nil
+	}
+	table := &IndexedTable{Index: index, schema: info.Schema, stats: info.Stats}
+	for _, indexInfo := range info.Indexes {
+		secondary, err := db.openSecondary(info, indexInfo)
 		if err != nil {
+			table.Close()
 			return nil, err
 		}
-	case HashIndexType:
-		index, err = hash.OpenTable(path)
-		if err != nil {
+		table.secondaries = append(table.secondaries, secondary)
+	}
+	if info.Filter != nil {
+		if table.filter, err = openKeyFilter(info.Filter, filterFile(path), index); err != nil {
+			table.Close()
 			return nil, err
 		}
-	default:
-		return nil, errors.New("invalid index type")
 	}
-	db.tables[name] = index
-	return index, nil
+	return table, nil
 }
 
-// Get a table by its name, either from existing tables, or by creating a new one.
+// indexedTable returns the given open table as an indexed table, wrapping it in one if it
+// isn't yet, so its secondary indexes, stats and filter can be kept up to date.
+func (db *Database) indexedTable(name string) *IndexedTable {
+	indexed, ok := db.tables[name].(*IndexedTable)
+	if !ok {
+		indexed = &IndexedTable{Index: db.tables[name], schema: db.catalog.Tables[name].Schema}
+		db.tables[name] = indexed
+	}
+	return indexed
+}
+
+// GetSchema returns the schema of the given table, or nil if it holds (key, value) pairs.
+func (db *Database) GetSchema(name string) *Schema {
+	if info, ok := db.catalog.Tables[name]; ok {
+		return info.Schema
+	}
+	return nil
+}
+
+// Get the catalog of the database's tables.
+func (db *Database) GetCatalog() *Catalog {
+	return db.catalog
+}
+
+// Get a table by its name, either from existing tables, or by opening it as the catalog describes.
 func (db *Database) GetTable(name string) (index Index, err error) {
 	// Check existing set of tables.
 	if idx, ok := db.tables[name]; ok {
 		return idx, nil
 	}
-	// Check if file exists; if not, error.
-	path := filepath.Join(db.basepath, name)
-	if _, err := os.Stat(path); err != nil {
+	// Check if the table was ever created; if not, error.
+	info, ok := db.catalog.Tables[name]
+	if !ok {
 		return nil, errors.New("table not found")
 	}
+	if err := db.migrateLegacyTable(info); err != nil {
+		return nil, fmt.Errorf("cannot migrate table %v: %v", name, err)
+	}
+	if _, err := os.Stat(filepath.Join(db.basepath, name)); err != nil {
+		return nil, fmt.Errorf("table %v is missing its file", name)
+	}
 	// Else, open from disk.
-	// NOTE: This is janky; assumes that if a .meta file exists, then it is a hash index,
-	// else, it is a btree index.
-	// if _, err := os.Stat(path + ".meta"); err == nil {
-	// 	index, err = hash.OpenTable(path)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// } else {
-	index, err = btree.OpenTable(path)
+	index, err = db.openTable(info)
 	if err != nil {
 		return nil, err
 	}
-	// }
 	db.tables[name] = index
 	return index, nil
 }
 
+// filesAt returns the paths of the files an index kept at the given path may have.
+func filesAt(path string) []string {
+	return []string{path, path + ".meta", path + ".values"}
+}
+
+// tableFiles returns the paths of the files a table with the given name may have.
+func (db *Database) tableFiles(name string) []string {
+	path := filepath.Join(db.basepath, name)
+	return append(filesAt(path), filterFile(path))
+}
+
+// removeFiles removes whichever of the given files exist.
+func removeFiles(files []string) error {
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeTable closes the table with the given name if it is open.
+func (db *Database) closeTable(name string) error {
+	index, ok := db.tables[name]
+	if !ok {
+		return nil
+	}
+	delete(db.tables, name)
+	return index.Close()
+}
+
+// DropTable closes the given table and removes it, its secondary indexes, and their files.
+// The table is gone once the catalog has been rewritten without it.
+func (db *Database) DropTable(name string) error {
+	info, ok := db.catalog.Tables[name]
+	if !ok {
+		return errors.New("table not found")
+	}
+	if err := db.closeTable(name); err != nil {
+		return err
+	}
+	delete(db.catalog.Tables, name)
+	if err := db.catalog.write(db.basepath); err != nil {
+		return err
+	}
+	for _, indexInfo := range info.Indexes {
+		if err := removeFiles(db.indexFiles(indexInfo.Name)); err != nil {
+			return err
+		}
+	}
+	return removeFiles(db.tableFiles(name))
+}
+
+// RenameTable closes the given table and moves it and its files to a new name. The rename
+// is recorded in the catalog before any file is moved, so one a crash interrupts is finished
+// when the database is next opened. If any file can't be moved, the ones already moved are
+// moved back.
+func (db *Database) RenameTable(name string, newName string) (err error) {
+	info, ok := db.catalog.Tables[name]
+	if !ok {
+		return errors.New("table not found")
+	}
+	alphanumeric, _ := regexp.Compile(`\W`)
+	if alphanumeric.MatchString(newName) {
+		return errors.New("table name must be alphanumeric")
+	}
+	if _, ok := db.catalog.Tables[newName]; ok {
+		return errors.New("table already exists")
+	}
+	if info, _ := db.catalog.findIndex(newName); info != nil {
+		return fmt.Errorf("%v is the name of an index", newName)
+	}
+	if err := removeFiles(db.tableFiles(newName)); err != nil {
+		return err
+	}
+	if err := db.closeTable(name); err != nil {
+		return err
+	}
+	info.RenamingTo = newName
+	if err := db.catalog.write(db.basepath); err != nil {
+		info.RenamingTo = ""
+		return err
+	}
+	return db.finishRename(info)
+}
+
+// finishRename moves the files of a table being renamed to its new name, taking a file
+// already at its new path as moved, then records the new name in the catalog. If anything
+// fails, the files are moved back and the rename is abandoned.
+func (db *Database) finishRename(info *TableInfo) (err error) {
+	name, newName := info.Name, info.RenamingTo
+	from, to := db.tableFiles(name), db.tableFiles(newName)
+	moved := 0
+	defer func() {
+		if err != nil {
+			for i := 0; i < moved; i++ {
+				os.Rename(to[i], from[i])
+			}
+			info.RenamingTo = ""
+			db.catalog.write(db.basepath)
+		}
+	}()
+	for ; moved < len(from); moved++ {
+		if err := os.Rename(from[moved], to[moved]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	delete(db.catalog.Tables, name)
+	info.Name, info.RenamingTo = newName, ""
+	db.catalog.Tables[newName] = info
+	if err = db.catalog.write(db.basepath); err != nil {
+		delete(db.catalog.Tables, newName)
+		info.Name = name
+		db.catalog.Tables[name] = info
+		return err
+	}
+	return nil
+}
+
+// TruncateTable removes every entry of the given table by replacing its files, and those of
+// its secondary indexes, with empty ones.
+func (db *Database) TruncateTable(name string) error {
+	info, ok := db.catalog.Tables[name]
+	if !ok {
+		return errors.New("table not found")
+	}
+	if err := db.closeTable(name); err != nil {
+		return err
+	}
+	if err := removeFiles(db.tableFiles(name)); err != nil {
+		return err
+	}
+	for _, indexInfo := range info.Indexes {
+		if err := removeFiles(db.indexFiles(indexInfo.Name)); err != nil {
+			return err
+		}
+	}
+	// An analyzed table keeps stats, now of no rows.
+	if info.Stats != nil {
+		info.Stats = newTableStats(tableColumns(info.Schema))
+		if err := db.catalog.write(db.basepath); err != nil {
+			return err
+		}
+	}
+	index, err := db.openTable(info)
+	if err != nil {
+		return err
+	}
+	db.tables[name] = index
+	return nil
+}
+
 // Get a database's tables.
 func (db *Database) GetTables() map[string]Index {
 	return db.tables
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// Load variables
+var LOAD_RUN_SIZE int = 4096       // Entries sorted in memory at a time before spilling a run
+var LOAD_FILL_FACTOR float64 = 0.9 // How full load packs each node, leaving room for inserts
+
+// Handle load.
+func HandleLoad(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: load <file> into <table>
+	if numFields != 4 || fields[2] != "into" {
+		return fmt.Errorf("usage: load <file> into <table>")
+	}
+	tableName := fields[3]
+	table, err := d.GetTable(tableName)
+	if err != nil {
+		return fmt.Errorf("load error: %v", err)
+	}
+	btreeTable, ok := PrimaryIndex(table).(*btree.BTreeIndex)
+	if !ok {
+		return fmt.Errorf("load error: table %v is not a btree table", tableName)
+	}
+	file, err := os.Open(fields[1])
+	if err != nil {
+		return fmt.Errorf("load error: %v", err)
+	}
+	defer file.Close()
+	n, err := LoadEntries(btreeTable, d.GetSchema(tableName), file)
+	if err != nil {
+		return fmt.Errorf("load error: %v", err)
+	}
+	// Loading bypasses the secondary indexes and the filter, so file the loaded entries in
+	// them.
+	if indexed, ok := table.(*IndexedTable); ok {
+		if indexed.filter != nil {
+			if err := indexed.filter.rebuild(btreeTable); err != nil {
+				return fmt.Errorf("load error: %v", err)
+			}
+		}
+		for _, secondary := range indexed.secondaries {
+			if err := secondary.build(btreeTable, indexed.schema); err != nil {
+				return fmt.Errorf("load error: %v", err)
+			}
+		}
+		// Loading bypasses the stats too, so analyze the table again.
+		if indexed.stats != nil {
+			if _, err := d.Analyze(tableName); err != nil {
+				return fmt.Errorf("load error: %v", err)
+			}
+		}
+	}
+	io.WriteString(w, fmt.Sprintf("%v entries loaded into table %v.\n", n, tableName))
+	return nil
+}
+
+// LoadEntries bulk loads an empty table with the given schema from lines of its rows, in
+// any order. Each line lists a row's values as an insert without into does, so a table
+// without a schema has lines of "<key> <value>". Input is sorted first with an external
+// merge sort, which spills runs of LOAD_RUN_SIZE entries. Returns the number of entries.
+func LoadEntries(table *btree.BTreeIndex, schema *Schema, r io.Reader) (int64, error) {
+	sorter := newEntrySorter()
+	defer sorter.Close()
+	n := int64(0)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		entry, err := loadEntry(schema, scanner.Text())
+		if err != nil {
+			return 0, fmt.Errorf("line %v: %v", line, err)
+		}
+		if err := sorter.Add(entry); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	cursor, err := newSortedCursor(sorter)
+	if err != nil {
+		return 0, err
+	}
+	if err := btree.BulkLoad(table, cursor, LOAD_FILL_FACTOR); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// loadEntry returns the entry that stores the row a line of a file to load gives.
+func loadEntry(schema *Schema, line string) (utils.Entry, error) {
+	exprs, err := sql.ParseValues(line)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, len(exprs))
+	for i, expr := range exprs {
+		values[i] = expr.(*sql.Literal).Value
+	}
+	edit, err := buildEdit(InsertEdit, schema, values)
+	if err != nil {
+		return nil, err
+	}
+	if edit.IsBytes {
+		return utils.NewBytesEntry(edit.Key, edit.Bytes), nil
+	}
+	return btree.NewBTreeEntry(edit.Key, edit.Value), nil
+}
+
+// SortEntries sorts the entries a cursor reads by key with the same external merge sort as
+// load, returning a cursor over them in key order and a function that removes the runs it
+// spilled. The cursor must only be at its end once every entry has been read.
+func SortEntries(source utils.Cursor) (sorted utils.Cursor, cleanup func(), err error) {
+	sorter := newEntrySorter()
+	defer func() {
+		if err != nil {
+			sorter.Close()
+		}
+	}()
+	for ; !source.IsEnd(); source.StepForward() {
+		entry, err := source.GetEntry()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := sorter.Add(entry); err != nil {
+			return nil, nil, err
+		}
+	}
+	cursor, err := newSortedCursor(sorter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cursor, sorter.Close, nil
+}
+
+// newEntrySorter returns an external sort of entries by key that holds LOAD_RUN_SIZE of them
+// in memory.
+func newEntrySorter() *ExternalSorter {
+	return NewExternalSorter(entryCodec{}, SortOptions{Records: LOAD_RUN_SIZE})
+}
+
+// entryCodec orders entries by key, and spills them as WriteEntry writes them.
+type entryCodec struct{}
+
+func (entryCodec) Compare(a interface{}, b interface{}) (int, error) {
+	keyA, keyB := a.(utils.Entry).GetKey(), b.(utils.Entry).GetKey()
+	if keyA < keyB {
+		return -1, nil
+	}
+	if keyA > keyB {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (entryCodec) Encode(record interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := WriteEntry(&buf, record.(utils.Entry))
+	return buf.Bytes(), err
+}
+
+func (entryCodec) Decode(data []byte) (interface{}, error) {
+	return ReadEntry(bytes.NewReader(data))
+}
+
+// WriteEntry writes an entry to a temp file, such as a run being sorted: its key, then 0 and
+// its value if it is an int, or one more than the length of its value and the value if it is
+// a byte slice. Returns the number of bytes written.
+func WriteEntry(writer io.Writer, entry utils.Entry) (int, error) {
+	data := make([]byte, 3*binary.MaxVarintLen64)
+	n := binary.PutVarint(data, entry.GetKey())
+	bytesEntry, isBytes := entry.(utils.BytesEntry)
+	if !isBytes {
+		n += binary.PutUvarint(data[n:], 0)
+		n += binary.PutVarint(data[n:], entry.GetValue())
+		return writer.Write(data[:n])
+	}
+	n += binary.PutUvarint(data[n:], uint64(len(bytesEntry.GetBytes()))+1)
+	written, err := writer.Write(data[:n])
+	if err != nil {
+		return written, err
+	}
+	n, err = writer.Write(bytesEntry.GetBytes())
+	return written + n, err
+}
+
+// An EntryReader is what ReadEntry reads an entry from.
+type EntryReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// ReadEntry reads an entry WriteEntry wrote. Returns io.EOF if there are none left.
+func ReadEntry(reader EntryReader) (utils.Entry, error) {
+	key, err := binary.ReadVarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	length, err := binary.ReadUvarint(reader)
+	if err == nil && length == 0 {
+		var value int64
+		if value, err = binary.ReadVarint(reader); err == nil {
+			return btree.NewBTreeEntry(key, value), nil
+		}
+	} else if err == nil {
+		value := make([]byte, length-1)
+		if _, err = io.ReadFull(reader, value); err == nil {
+			return utils.NewBytesEntry(key, value), nil
+		}
+	}
+	// The entry was cut short.
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// sortedCursor traverses the entries of an external sort in key order. Once reading a run
+// fails, the cursor stays where it is, and getting its entry returns the error.
+type sortedCursor struct {
+	sorter *ExternalSorter
+	entry  utils.Entry // The current entry, or nil at the end.
+	err    error       // The error hit reading a run.
+}
+
+// newSortedCursor sorts the entries added to a sort, returning a cursor at the smallest.
+func newSortedCursor(sorter *ExternalSorter) (*sortedCursor, error) {
+	if err := sorter.Sort(); err != nil {
+		return nil, err
+	}
+	cursor := &sortedCursor{sorter: sorter}
+	cursor.next()
+	return cursor, cursor.err
+}
+
+// next reads the sort's next entry, keeping the current one if reading fails.
+func (cursor *sortedCursor) next() {
+	record, err := cursor.sorter.Next()
+	if err != nil {
+		cursor.err = err
+	} else if record == nil {
+		cursor.entry = nil
+	} else {
+		cursor.entry = record.(utils.Entry)
+	}
+}
+
+// StepForward moves the cursor ahead by one entry. Returns true once every entry is read.
+func (cursor *sortedCursor) StepForward() bool {
+	if cursor.IsEnd() {
+		return true
+	}
+	if cursor.err == nil {
+		cursor.next()
+	}
+	return cursor.IsEnd()
+}
+
+// IsEnd returns true if at end.
+func (cursor *sortedCursor) IsEnd() bool {
+	return cursor.entry == nil && cursor.err == nil
+}
+
+// GetEntry returns the entry currently pointed to by the cursor.
+func (cursor *sortedCursor) GetEntry() (utils.Entry, error) {
+	if cursor.err != nil {
+		return nil, cursor.err
+	}
+	if cursor.IsEnd() {
+		return nil, errors.New("getEntry: entry is non-existent")
+	}
+	return cursor.entry, nil
+}
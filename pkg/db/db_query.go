@@ -0,0 +1,499 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// How an access path reads a table.
+type AccessKind int
+
+const (
+	FullScan  AccessKind = iota // Read every entry.
+	KeySeek                     // Find the entry under one key.
+	RangeScan                   // Read a range of a btree table's keys.
+	IndexSeek                   // Look a column value up in a secondary index.
+)
+
+var accessKindNames = map[AccessKind]string{FullScan: "scan", KeySeek: "key seek", RangeScan: "range scan", IndexSeek: "index seek"}
+
+// String returns the name of the access kind.
+func (kind AccessKind) String() string {
+	return accessKindNames[kind]
+}
+
+// An AccessPath is a way to read the entries of a table that a where clause may hold for.
+// The clause must still be checked against each row read.
+type AccessPath struct {
+	Table  string
+	Kind   AccessKind
+	Key    int64        // The key of a key seek.
+	Column string       // The column of an index seek.
+	Value  Value        // The value of an index seek.
+	Lower  *btree.Bound // The lower end of a range scan, or nil if open.
+	Upper  *btree.Bound // The upper end of a range scan, or nil if open.
+	IsHash bool         // Whether the table is a hash table, whose scans aren't in key order.
+	Rows   int64        // Estimated rows read, from the table's stats, or -1 if it hasn't been analyzed.
+}
+
+// String describes the access path.
+func (path *AccessPath) String() string {
+	switch path.Kind {
+	case KeySeek:
+		return fmt.Sprintf("%v %v (key = %v)", path.Kind, path.Table, path.Key)
+	case IndexSeek:
+		return fmt.Sprintf("%v %v (%v = %v)", path.Kind, path.Table, path.Column, FormatValue(path.Value))
+	case RangeScan:
+		lower, upper := "(-inf", "inf)"
+		if path.Lower != nil {
+			lower = fmt.Sprintf("(%v", path.Lower.Key)
+			if path.Lower.Inclusive {
+				lower = fmt.Sprintf("[%v", path.Lower.Key)
+			}
+		}
+		if path.Upper != nil {
+			upper = fmt.Sprintf("%v)", path.Upper.Key)
+			if path.Upper.Inclusive {
+				upper = fmt.Sprintf("%v]", path.Upper.Key)
+			}
+		}
+		return fmt.Sprintf("%v %v %v, %v", path.Kind, path.Table, lower, upper)
+	default:
+		return fmt.Sprintf("%v %v", path.Kind, path.Table)
+	}
+}
+
+// Ordered checks whether the access path reads entries in key order.
+func (path *AccessPath) Ordered() bool {
+	return path.Kind != FullScan || !path.IsHash
+}
+
+// ChooseAccessPath picks how to read the rows of a table a where clause may hold for: the
+// entry under a key the clause names, a secondary index lookup of a column the clause
+// names, a range of a btree table's keys the clause bounds, or else every entry.
+func (db *Database) ChooseAccessPath(tableName string, where sql.Expr) (*AccessPath, error) {
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.refreshStats(tableName, table); err != nil {
+		return nil, err
+	}
+	schema := db.GetSchema(tableName)
+	scope := TableScope(tableName, schema)
+	_, isBTree := PrimaryIndex(table).(*btree.BTreeIndex)
+	path := &AccessPath{Table: tableName, Kind: FullScan, IsHash: !isBTree}
+	indexed := make(map[int]bool)
+	for _, indexInfo := range db.GetCatalog().Tables[tableName].Indexes {
+		indexed[columnPosition(schema, indexInfo.Column)] = true
+	}
+	for _, conjunct := range sql.Conjuncts(where) {
+		var comparisons []literalComparison
+		switch conjunct := conjunct.(type) {
+		case *sql.BinaryExpr:
+			if comparison, ok := compareToLiteral(scope, conjunct.Op, conjunct.Left, conjunct.Right); ok {
+				comparisons = append(comparisons, comparison)
+			}
+		case *sql.BetweenExpr:
+			if conjunct.Not {
+				continue
+			}
+			if low, ok := compareToLiteral(scope, ">=", conjunct.Expr, conjunct.Low); ok {
+				if high, ok := compareToLiteral(scope, "<=", conjunct.Expr, conjunct.High); ok {
+					comparisons = append(comparisons, low, high)
+				}
+			}
+		}
+		for _, comparison := range comparisons {
+			value, err := coerceColumn(schema, comparison.column, comparison.value)
+			if err != nil {
+				// The comparison can't be used to read the table; the filter reports the mismatch.
+				continue
+			}
+			if comparison.column == keyColumn(schema) {
+				key := value.(int64)
+				switch comparison.op {
+				case "=":
+					path.Kind, path.Key = KeySeek, key
+				case ">", ">=":
+					path.Lower = tighten(path.Lower, key, comparison.op == ">=", true)
+				case "<", "<=":
+					path.Upper = tighten(path.Upper, key, comparison.op == "<=", false)
+				}
+			} else if comparison.op == "=" && indexed[comparison.column] && path.Kind != KeySeek {
+				path.Kind, path.Column, path.Value = IndexSeek, scope.Columns[comparison.column], value
+			}
+		}
+	}
+	if path.Kind == FullScan && isBTree && (path.Lower != nil || path.Upper != nil) {
+		path.Kind = RangeScan
+	}
+	if path.Kind != RangeScan {
+		path.Lower, path.Upper = nil, nil
+	}
+	path.Rows = estimatePathRows(GetStats(table), schema, path)
+	return path, nil
+}
+
+// A literalComparison compares a column to a literal.
+type literalComparison struct {
+	column int
+	op     string
+	value  Value
+}
+
+// Comparisons with their operands swapped.
+var flippedComparisons = map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// compareToLiteral checks whether a comparison is between a column and a literal, putting
+// the column on the left.
+func compareToLiteral(scope *Scope, op string, left sql.Expr, right sql.Expr) (literalComparison, bool) {
+	if _, ok := left.(*sql.Literal); ok {
+		left, right, op = right, left, flippedComparisons[op]
+	}
+	ref, ok := left.(*sql.ColumnRef)
+	literal, isLiteral := right.(*sql.Literal)
+	if !ok || !isLiteral || op == "" {
+		return literalComparison{}, false
+	}
+	column, err := scope.Resolve(ref)
+	if err != nil {
+		return literalComparison{}, false
+	}
+	return literalComparison{column: column, op: op, value: literal.Value}, true
+}
+
+// tighten narrows a bound of a range of keys to the given key, if that is narrower.
+func tighten(bound *btree.Bound, key int64, inclusive bool, lower bool) *btree.Bound {
+	if bound != nil {
+		narrower := key > bound.Key
+		if !lower {
+			narrower = key < bound.Key
+		}
+		if !narrower && (key != bound.Key || inclusive) {
+			return bound
+		}
+	}
+	return &btree.Bound{Key: key, Inclusive: inclusive}
+}
+
+// OpenAccessPath returns a cursor over the entries an access path reads: in key order, or
+// descending key order if desc is set, if the path is ordered.
+func (db *Database) OpenAccessPath(path *AccessPath, desc bool) (utils.Cursor, error) {
+	table, err := db.GetTable(path.Table)
+	if err != nil {
+		return nil, err
+	}
+	switch path.Kind {
+	case KeySeek:
+		// Find errors if there is no entry under the key.
+		if entry, err := table.Find(path.Key); err == nil {
+			return &entryCursor{entries: []utils.Entry{entry}}, nil
+		}
+		return &entryCursor{}, nil
+	case IndexSeek:
+		entries, err := db.Lookup(path.Table, path.Column, path.Value)
+		if err != nil {
+			return nil, err
+		}
+		if desc {
+			for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+				entries[i], entries[j] = entries[j], entries[i]
+			}
+		}
+		return &entryCursor{entries: entries}, nil
+	}
+	if btreeTable, ok := PrimaryIndex(table).(*btree.BTreeIndex); ok {
+		return btreeTable.TableRange(path.Lower, path.Upper, desc)
+	}
+	return TableCursor(table)
+}
+
+// TableCursor returns a cursor over every entry of a table, in key order if it is a btree
+// table. Unlike a hash table's own cursor, it is only at its end once every entry has been
+// read.
+func TableCursor(table Index) (utils.Cursor, error) {
+	if btreeTable, ok := PrimaryIndex(table).(*btree.BTreeIndex); ok {
+		return btreeTable.TableRange(nil, nil, false)
+	}
+	cursor, err := table.TableStart()
+	if err != nil {
+		return nil, err
+	}
+	scan := &bucketsCursor{cursor: cursor}
+	// Skip past empty buckets.
+	for !scan.isEnd && cursor.IsEnd() {
+		scan.isEnd = cursor.StepForward()
+	}
+	return scan, nil
+}
+
+// entryCursor traverses a slice of entries.
+type entryCursor struct {
+	entries []utils.Entry
+	i       int
+}
+
+// StepForward moves the cursor ahead by one entry. Returns true once past the last entry.
+func (cursor *entryCursor) StepForward() bool {
+	if cursor.i < len(cursor.entries) {
+		cursor.i++
+	}
+	return cursor.IsEnd()
+}
+
+// IsEnd returns true if at end.
+func (cursor *entryCursor) IsEnd() bool {
+	return cursor.i >= len(cursor.entries)
+}
+
+// GetEntry returns the entry currently pointed to by the cursor.
+func (cursor *entryCursor) GetEntry() (utils.Entry, error) {
+	if cursor.IsEnd() {
+		return nil, errors.New("getEntry: entry is non-existent")
+	}
+	return cursor.entries[cursor.i], nil
+}
+
+// bucketsCursor traverses a hash table across buckets; the table's own cursor is at its
+// end at the end of each bucket.
+type bucketsCursor struct {
+	cursor utils.Cursor
+	isEnd  bool
+}
+
+// StepForward moves the cursor ahead by one entry. Returns true once past the last entry.
+func (scan *bucketsCursor) StepForward() bool {
+	for !scan.isEnd {
+		scan.isEnd = scan.cursor.StepForward()
+		if !scan.cursor.IsEnd() {
+			break
+		}
+	}
+	return scan.isEnd
+}
+
+// IsEnd returns true if at end.
+func (scan *bucketsCursor) IsEnd() bool {
+	return scan.isEnd
+}
+
+// GetEntry returns the entry currently pointed to by the cursor.
+func (scan *bucketsCursor) GetEntry() (utils.Entry, error) {
+	if scan.isEnd {
+		return nil, errors.New("getEntry: entry is non-existent")
+	}
+	return scan.cursor.GetEntry()
+}
+
+// matchRows passes the rows of a table a where clause holds for to visit, until it returns
+// false.
+func (db *Database) matchRows(tableName string, where sql.Expr, visit func(Row) (bool, error)) error {
+	path, err := db.ChooseAccessPath(tableName, where)
+	if err != nil {
+		return err
+	}
+	schema := db.GetSchema(tableName)
+	filter, err := TableScope(tableName, schema).CompileCondition(where)
+	if err != nil {
+		return err
+	}
+	cursor, err := db.OpenAccessPath(path, false)
+	if err != nil {
+		return err
+	}
+	for ; !cursor.IsEnd(); cursor.StepForward() {
+		entry, err := cursor.GetEntry()
+		if err != nil {
+			return err
+		}
+		row, err := EntryRow(schema, entry)
+		if err != nil {
+			return err
+		}
+		if ok, err := filter(row); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if more, err := visit(row); err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryKeys returns the keys of the rows of a table a where clause holds for.
+func (db *Database) QueryKeys(tableName string, where sql.Expr) ([]int64, error) {
+	keys := make([]int64, 0)
+	key := keyColumn(db.GetSchema(tableName))
+	err := db.matchRows(tableName, where, func(row Row) (bool, error) {
+		keys = append(keys, row[key].(int64))
+		return true, nil
+	})
+	return keys, err
+}
+
+// The kind of change an edit makes.
+type EditAction int
+
+const (
+	InsertEdit EditAction = iota
+	UpdateEdit
+	DeleteEdit
+)
+
+// An Edit is a change to the entry under one key of a table.
+type Edit struct {
+	Action  EditAction
+	Key     int64
+	Value   int64  // The new value, unless it is a byte slice.
+	Bytes   []byte // The new value, if IsBytes is set.
+	IsBytes bool
+}
+
+// Edits returns the table an insert, update or delete statement changes, and the edits it
+// makes to it, one per key, without making them.
+func (db *Database) Edits(statement sql.Statement) (tableName string, edits []Edit, err error) {
+	switch statement := statement.(type) {
+	case *sql.InsertStmt:
+		edit, err := db.insertEdit(statement)
+		return statement.Table, []Edit{edit}, err
+	case *sql.UpdateStmt:
+		edits, err := db.updateEdits(statement)
+		return statement.Table, edits, err
+	case *sql.DeleteStmt:
+		keys, err := db.QueryKeys(statement.Table, statement.Where)
+		if err != nil {
+			return statement.Table, nil, err
+		}
+		edits := make([]Edit, len(keys))
+		for i, key := range keys {
+			edits[i] = Edit{Action: DeleteEdit, Key: key}
+		}
+		return statement.Table, edits, nil
+	default:
+		return "", nil, errors.New("not an insert, update or delete")
+	}
+}
+
+// insertEdit builds the row an insert statement gives.
+func (db *Database) insertEdit(statement *sql.InsertStmt) (Edit, error) {
+	if _, err := db.GetTable(statement.Table); err != nil {
+		return Edit{}, err
+	}
+	schema := db.GetSchema(statement.Table)
+	columns := tableColumns(schema)
+	values := make([]Value, len(statement.Values))
+	for i, expr := range statement.Values {
+		values[i] = expr.(*sql.Literal).Value
+	}
+	// Put named columns in column order.
+	if len(statement.Columns) > 0 {
+		if len(statement.Columns) != len(columns) {
+			return Edit{}, fmt.Errorf("expected a value for each of the %v columns, got %v", len(columns), len(statement.Columns))
+		}
+		ordered := make([]Value, len(columns))
+		for i, name := range statement.Columns {
+			position := columnPosition(schema, name)
+			if position < 0 {
+				return Edit{}, fmt.Errorf("no column named %q", name)
+			}
+			if ordered[position] != nil {
+				return Edit{}, fmt.Errorf("column %v is given twice", name)
+			}
+			ordered[position] = values[i]
+		}
+		values = ordered
+	}
+	return buildEdit(InsertEdit, schema, values)
+}
+
+// updateEdits builds the new rows an update statement gives.
+func (db *Database) updateEdits(statement *sql.UpdateStmt) ([]Edit, error) {
+	if _, err := db.GetTable(statement.Table); err != nil {
+		return nil, err
+	}
+	schema := db.GetSchema(statement.Table)
+	// The legacy form gives the whole row, key included.
+	if len(statement.Set) == 0 {
+		values := make([]Value, len(statement.Values))
+		for i, expr := range statement.Values {
+			values[i] = expr.(*sql.Literal).Value
+		}
+		edit, err := buildEdit(UpdateEdit, schema, values)
+		return []Edit{edit}, err
+	}
+	scope := TableScope(statement.Table, schema)
+	positions := make([]int, len(statement.Set))
+	assignments := make([]Evaluator, len(statement.Set))
+	for i, assignment := range statement.Set {
+		var err error
+		if positions[i], err = scope.Resolve(&sql.ColumnRef{Name: assignment.Column}); err != nil {
+			return nil, err
+		}
+		if positions[i] == scope.Key(statement.Table) {
+			return nil, fmt.Errorf("cannot update the primary key %v", scope.Columns[positions[i]])
+		}
+		if assignments[i], err = scope.Compile(assignment.Value); err != nil {
+			return nil, err
+		}
+	}
+	edits := make([]Edit, 0)
+	err := db.matchRows(statement.Table, statement.Where, func(row Row) (bool, error) {
+		// Every assignment sees the row as it was.
+		values := append(make([]Value, 0, len(row)), row...)
+		for i, assignment := range assignments {
+			value, err := assignment(row)
+			if err != nil {
+				return false, err
+			}
+			values[positions[i]] = value
+		}
+		edit, err := buildEdit(UpdateEdit, schema, values)
+		edits = append(edits, edit)
+		return err == nil, err
+	})
+	return edits, err
+}
+
+// buildEdit builds an edit that stores a row of a table with the given schema.
+func buildEdit(action EditAction, schema *Schema, values []Value) (Edit, error) {
+	row := Row(values)
+	if schema != nil {
+		var err error
+		if row, err = schema.BuildRow(values); err != nil {
+			return Edit{}, err
+		}
+	}
+	key, value, bytes, isBytes, err := rowPair(schema, row)
+	if err != nil {
+		return Edit{}, err
+	}
+	return Edit{Action: action, Key: key, Value: value, Bytes: bytes, IsBytes: isBytes}, nil
+}
+
+// ApplyEdit makes an edit to a table.
+func ApplyEdit(table Index, edit Edit) error {
+	switch edit.Action {
+	case InsertEdit:
+		if entry, _ := table.Find(edit.Key); entry != nil {
+			return errors.New("key already in table")
+		}
+		if edit.IsBytes {
+			return table.InsertBytes(edit.Key, edit.Bytes)
+		}
+		return table.Insert(edit.Key, edit.Value)
+	case UpdateEdit:
+		if edit.IsBytes {
+			return table.UpdateBytes(edit.Key, edit.Bytes)
+		}
+		return table.Update(edit.Key, edit.Value)
+	default:
+		return table.Delete(edit.Key)
+	}
+}
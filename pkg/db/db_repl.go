@@ -7,8 +7,9 @@ import (
 	"strconv"
 	"strings"
 
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
 	repl "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/repl"
-	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
 )
 
 // Creates a DB Repl for the given index.
@@ -16,175 +17,289 @@ func DatabaseRepl(db *Database) *repl.REPL {
 	r := repl.NewRepl()
 	r.AddCommand("create", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleCreateTable(db, payload, replConfig.GetWriter())
-	}, "Create a table. usage: create table <table>")
-	r.AddCommand("find", func(payload string, replConfig *repl.REPLConfig) error {
-		return HandleFind(db, payload, replConfig.GetWriter())
-	}, "Find an element. usage: find <key> from <table>")
-	r.AddCommand("insert", func(payload string, replConfig *repl.REPLConfig) error { return HandleInsert(db, payload) }, "Insert an element. usage: insert <key> <value> into <table>")
-	r.AddCommand("update", func(payload string, replConfig *repl.REPLConfig) error { return HandleUpdate(db, payload) }, "Update en element. usage: update <table> <key> <value>")
-	r.AddCommand("delete", func(payload string, replConfig *repl.REPLConfig) error { return HandleDelete(db, payload) }, "Delete an element. usage: delete <key> from <table>")
-	r.AddCommand("select", func(payload string, replConfig *repl.REPLConfig) error {
-		return HandleSelect(db, payload, replConfig.GetWriter())
-	}, "Select elements from a table. usage: select from <table>")
+	}, "Create a table, optionally with typed columns or holding the rows a join produces, or a secondary index on a column. usage: create [btree|hash] table <table> [(<column> <int|text|float> [primary key], ...)] | create [btree|hash] table <table> as <join ...> | create index <index> on <table>(<column>) using <btree|hash>")
+	r.AddCommand("drop", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleDrop(db, payload, replConfig.GetWriter())
+	}, "Delete a table or secondary index and its files. usage: drop <table|index> <name>")
+	r.AddCommand("rename", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleRename(db, payload, replConfig.GetWriter())
+	}, "Rename a table. usage: rename table <table> to <new name>")
+	r.AddCommand("truncate", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleTruncate(db, payload, replConfig.GetWriter())
+	}, "Delete every entry of a table. usage: truncate table <table>")
+	r.AddCommand("show", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleShowTables(db, payload, replConfig.GetWriter())
+	}, "List the tables in the database. usage: show tables")
+	r.AddCommand("describe", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleDescribe(db, payload, replConfig.GetWriter())
+	}, "Print a table's index type and columns. usage: describe <table>")
+	r.AddCommand("insert", func(payload string, replConfig *repl.REPLConfig) error { return HandleInsert(db, payload) }, "Insert an element; the value may be a quoted string, or a table with columns takes one value per column. usage: insert into <table> [(<column>, ...)] values (<value>, ...) | insert <key> <value> into <table>")
+	r.AddCommand("update", func(payload string, replConfig *repl.REPLConfig) error { return HandleUpdate(db, payload) }, "Update the elements a condition holds for, or replace one by its key. usage: update <table> set <column> = <value>, ... [where <condition>] | update <table> <key> <value>")
+	r.AddCommand("delete", func(payload string, replConfig *repl.REPLConfig) error { return HandleDelete(db, payload) }, "Delete the elements a condition holds for, or one by its key. usage: delete from <table> [where <condition>] | delete <key> from <table>")
 	r.AddCommand("pretty", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandlePretty(db, payload, replConfig.GetWriter())
 	}, "Print out the internal data representation. usage: pretty")
+	r.AddCommand("load", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleLoad(db, payload, replConfig.GetWriter())
+	}, "Bulk load a btree table from a file of <key> <value> lines. usage: load <file> into <table>")
+	r.AddCommand("vacuum", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleVacuum(db, payload, replConfig.GetWriter())
+	}, "Compact a table's files, reclaiming their free pages. usage: vacuum <table>")
+	r.AddCommand("analyze", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleAnalyze(db, payload, replConfig.GetWriter())
+	}, "Compute a table's row count and the distinct values, range and histogram of each column. usage: analyze <table>")
+	r.AddCommand("filter", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleFilter(db, payload, replConfig.GetWriter())
+	}, "Keep a bloom filter of a table's keys, sized for a rate of false positives (0.01 by default), so finds of keys not in it skip its index, or stop keeping one. usage: filter on <table> [<false positive rate>] | filter off <table>")
+	r.AddCommand("policy", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandlePolicy(db, payload, replConfig.GetWriter())
+	}, "Set a table's buffer replacement policy. usage: policy <lru|clock|lru-k|2q> on <table>")
+	r.AddCommand("cache", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleCache(db, payload, replConfig.GetWriter())
+	}, "Print buffer hit/miss counters. usage: cache [from <table>]")
 	return r
 }
 
-// Handle create table.
+// Handle create table and create index.
 func HandleCreateTable(d *Database, payload string, w io.Writer) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: create <type> table <table>
-	if numFields != 4 || fields[2] != "table" || (fields[1] != "btree" && fields[1] != "hash") {
-		return fmt.Errorf("usage: create <btree|hash> table <table>")
-	}
-	var tableType IndexType
-	switch fields[1] {
-	case "btree":
-		tableType = BTreeIndexType
-	case "hash":
-		tableType = HashIndexType
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("create error: %v", err)
+	}
+	switch statement := statement.(type) {
+	case *sql.CreateIndexStmt:
+		return createIndex(d, statement, w)
+	case *sql.CreateTableStmt:
+		tableType, err := ParseIndexType(statement.Type)
+		if err != nil {
+			return fmt.Errorf("create error: %v", err)
+		}
+		if statement.As != "" {
+			rows, err := d.CreateTableAs(statement.Table, tableType, statement.As)
+			if err != nil {
+				return fmt.Errorf("create error: %v", err)
+			}
+			io.WriteString(w, fmt.Sprintf("%s table %s created with %v rows.\n", tableType, statement.Table, rows))
+			return nil
+		}
+		var schema *Schema
+		if len(statement.Columns) > 0 {
+			if schema, err = NewSchema(statement.Columns); err != nil {
+				return fmt.Errorf("create error: %v", err)
+			}
+		}
+		if _, err = d.createTable(statement.Table, tableType, schema); err != nil {
+			return err
+		}
+		io.WriteString(w, fmt.Sprintf("%s table %s created.\n", tableType, statement.Table))
+		return nil
 	default:
-		return errors.New("create error: internal error")
+		return fmt.Errorf("usage: create [btree|hash] table <table> [(<column> <int|text|float> [primary key], ...)] | create [btree|hash] table <table> as <join ...> | create index <index> on <table>(<column>) using <btree|hash>")
 	}
-	tableName := fields[3]
-	_, err = d.createTable(tableName, tableType)
+}
+
+// createIndex creates a secondary index.
+func createIndex(d *Database, statement *sql.CreateIndexStmt, w io.Writer) (err error) {
+	indexType, err := ParseIndexType(statement.Type)
 	if err != nil {
-		return err
+		return fmt.Errorf("create error: %v", err)
+	}
+	if err = d.CreateIndex(statement.Name, statement.Table, statement.Column, indexType); err != nil {
+		return fmt.Errorf("create error: %v", err)
 	}
-	io.WriteString(w, fmt.Sprintf("%s table %s created.\n", fields[1], tableName))
+	io.WriteString(w, fmt.Sprintf("%s index %s created on %s(%s).\n", indexType, statement.Name, statement.Table, statement.Column))
 	return nil
 }
 
-// Handle find.
-func HandleFind(d *Database, payload string, w io.Writer) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: find <key> from <table>
-	var key int
-	if numFields != 4 || fields[2] != "from" {
-		return fmt.Errorf("usage: find <key> from <table>")
+// Handle drop table and drop index.
+func HandleDrop(d *Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("drop error: %v", err)
 	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("find error: %v", err)
+	drop, ok := statement.(*sql.DropStmt)
+	if !ok {
+		return fmt.Errorf("usage: drop <table|index> <name>")
 	}
-	tableName := fields[3]
-	table, err := d.GetTable(tableName)
-	if err != nil {
-		return fmt.Errorf("find error: %v", err)
+	if drop.Kind == "index" {
+		err = d.DropIndex(drop.Name)
+	} else {
+		err = d.DropTable(drop.Name)
 	}
-	entry, err := table.Find(int64(key))
-	if err != nil || entry == nil {
-		return fmt.Errorf("find error: %v", err)
+	if err != nil {
+		return fmt.Errorf("drop error: %v", err)
 	}
-	io.WriteString(w, fmt.Sprintf("found entry: (%d, %d)\n",
-		entry.GetKey(), entry.GetValue()))
+	io.WriteString(w, fmt.Sprintf("%s %s dropped.\n", drop.Kind, drop.Name))
 	return nil
 }
 
-// Handle insert.
-func HandleInsert(d *Database, payload string) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: insert <key> <value> into <table>
-	var key, value int
-	if numFields != 5 || fields[3] != "into" {
-		return fmt.Errorf("usage: insert <key> <value> into <table>")
+// Handle rename table.
+func HandleRename(d *Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("rename error: %v", err)
 	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+	rename, ok := statement.(*sql.RenameStmt)
+	if !ok {
+		return fmt.Errorf("usage: rename table <table> to <new name>")
 	}
-	if value, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
+	if err = d.RenameTable(rename.Table, rename.NewName); err != nil {
+		return fmt.Errorf("rename error: %v", err)
 	}
-	tableName := fields[4]
-	table, err := d.GetTable(tableName)
+	io.WriteString(w, fmt.Sprintf("table %s renamed to %s.\n", rename.Table, rename.NewName))
+	return nil
+}
+
+// Handle truncate table.
+func HandleTruncate(d *Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
 	if err != nil {
-		return fmt.Errorf("insert error: %v", err)
+		return fmt.Errorf("truncate error: %v", err)
 	}
-	val, _ := table.Find(int64(key))
-	if val != nil {
-		return fmt.Errorf("insert error: key already in table")
+	truncate, ok := statement.(*sql.TruncateStmt)
+	if !ok {
+		return fmt.Errorf("usage: truncate table <table>")
 	}
-	err = table.Insert(int64(key), int64(value))
-	if err != nil {
-		return fmt.Errorf("insert error: %v", err)
+	if err = d.TruncateTable(truncate.Table); err != nil {
+		return fmt.Errorf("truncate error: %v", err)
 	}
+	io.WriteString(w, fmt.Sprintf("table %s truncated.\n", truncate.Table))
 	return nil
 }
 
-// Handle update.
-func HandleUpdate(d *Database, payload string) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: update <table> <key> <value>
-	var key, value int
-	if numFields != 4 {
-		return fmt.Errorf("usage: update <table> <key> <value>")
+// Handle show tables.
+func HandleShowTables(d *Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("show error: %v", err)
 	}
-	if key, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+	if _, ok := statement.(*sql.ShowTablesStmt); !ok {
+		return fmt.Errorf("usage: show tables")
 	}
-	if value, err = strconv.Atoi(fields[3]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+	for _, name := range d.GetCatalog().GetNames() {
+		info := d.GetCatalog().Tables[name]
+		io.WriteString(w, fmt.Sprintf("%v (%v)\n", name, info.Type))
 	}
-	tableName := fields[1]
-	table, err := d.GetTable(tableName)
+	return nil
+}
+
+// Handle describe.
+func HandleDescribe(d *Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
 	if err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("describe error: %v", err)
+	}
+	describe, ok := statement.(*sql.DescribeStmt)
+	if !ok {
+		return fmt.Errorf("usage: describe <table>")
+	}
+	info, ok := d.GetCatalog().Tables[describe.Table]
+	if !ok {
+		return fmt.Errorf("describe error: table not found")
+	}
+	io.WriteString(w, fmt.Sprintf("%v table %v, %v byte pages\n", info.Type, info.Name, info.PageSize))
+	if info.Schema == nil {
+		io.WriteString(w, "key int primary key\nvalue int or text\n")
+		describeIndexes(info, w)
+		return describeFilter(d, info, w)
+	}
+	for i, column := range info.Schema.Columns {
+		if i == info.Schema.Key {
+			io.WriteString(w, fmt.Sprintf("%v %v primary key\n", column.Name, column.Type))
+		} else {
+			io.WriteString(w, fmt.Sprintf("%v %v\n", column.Name, column.Type))
+		}
+	}
+	describeIndexes(info, w)
+	return describeFilter(d, info, w)
+}
+
+// describeIndexes prints the secondary indexes of a table.
+func describeIndexes(info *TableInfo, w io.Writer) {
+	for _, indexInfo := range info.Indexes {
+		io.WriteString(w, fmt.Sprintf("index %v on %v using %v\n", indexInfo.Name, indexInfo.Column, indexInfo.Type))
+	}
+}
+
+// describeFilter prints the bloom filter of a table's keys, if it has one.
+func describeFilter(d *Database, info *TableInfo, w io.Writer) error {
+	if info.Filter == nil {
+		return nil
 	}
-	err = table.Update(int64(key), int64(value))
+	stats, ok, err := d.GetFilterStats(info.Name)
 	if err != nil {
-		return fmt.Errorf("update error: %v", err)
+		return fmt.Errorf("describe error: %v", err)
+	}
+	if ok {
+		io.WriteString(w, fmt.Sprintf("bloom filter of %v bits with %v hashes for a false positive rate of %v: %v keys, %v finds skipped\n",
+			stats.Size, stats.Hashes, info.Filter.FalsePositiveRate, stats.Keys, stats.Skipped))
 	}
 	return nil
 }
 
+// Handle insert.
+func HandleInsert(d *Database, payload string) (err error) {
+	return handleEdit(d, "insert", payload)
+}
+
+// Handle update.
+func HandleUpdate(d *Database, payload string) (err error) {
+	return handleEdit(d, "update", payload)
+}
+
 // Handle delete.
 func HandleDelete(d *Database, payload string) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: delete <key> from <table>
-	var key int
-	if numFields != 4 || fields[2] != "from" {
-		return fmt.Errorf("usage: delete <key> from <table>")
-	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	return handleEdit(d, "delete", payload)
+}
+
+// handleEdit runs an insert, update or delete.
+func handleEdit(d *Database, command string, payload string) (err error) {
+	tableName, edits, err := ParseEdits(d, command, payload)
+	if err != nil {
+		return err
 	}
-	tableName := fields[3]
 	table, err := d.GetTable(tableName)
 	if err != nil {
-		return fmt.Errorf("delete error: %v", err)
+		return fmt.Errorf("%s error: %v", command, err)
 	}
-	err = table.Delete(int64(key))
-	if err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	for _, edit := range edits {
+		if err = ApplyEdit(table, edit); err != nil {
+			return fmt.Errorf("%s error: %v", command, err)
+		}
 	}
 	return nil
 }
 
-// Handle select.
-func HandleSelect(d *Database, payload string, w io.Writer) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: select from <table>
-	if numFields != 3 || fields[1] != "from" {
-		return fmt.Errorf("usage: select from <table>")
-	}
-	tableName := fields[2]
-	table, err := d.GetTable(tableName)
+// Usages of the statements that edit tables.
+var editUsages = map[string]string{
+	"insert": "usage: insert into <table> [(<column>, ...)] values (<value>, ...) | insert <value> ... into <table>",
+	"update": "usage: update <table> set <column> = <value>, ... [where <condition>] | update <table> <value> ...",
+	"delete": "usage: delete from <table> [where <condition>] | delete <key> from <table>",
+}
+
+// ParseEdits parses the given insert, update or delete command, returning the table it
+// changes and the edits it makes to it.
+func ParseEdits(d *Database, command string, payload string) (tableName string, edits []Edit, err error) {
+	statement, err := sql.Parse(payload)
 	if err != nil {
-		return fmt.Errorf("select error: %v", err)
+		return "", nil, fmt.Errorf("%s error: %v", command, err)
 	}
-	var results []utils.Entry
-	if results, err = table.Select(); err != nil {
-		return err
+	ok := false
+	switch statement.(type) {
+	case *sql.InsertStmt:
+		ok = command == "insert"
+	case *sql.UpdateStmt:
+		ok = command == "update"
+	case *sql.DeleteStmt:
+		ok = command == "delete"
 	}
-	printResults(results, w)
-	return nil
+	if !ok {
+		return "", nil, errors.New(editUsages[command])
+	}
+	if tableName, edits, err = d.Edits(statement); err != nil {
+		return "", nil, fmt.Errorf("%s error: %v", command, err)
+	}
+	return tableName, edits, nil
 }
 
 // Handle pretty printing.
@@ -216,10 +331,134 @@ func HandlePretty(d *Database, payload string, w io.Writer) (err error) {
 	return nil
 }
 
-// printResults prints all given entries in a standard format.
-func printResults(entries []utils.Entry, w io.Writer) {
-	for _, entry := range entries {
-		io.WriteString(w, fmt.Sprintf("(%v, %v)\n",
-			entry.GetKey(), entry.GetValue()))
+// Handle vacuum.
+func HandleVacuum(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: vacuum <table>
+	if numFields != 2 {
+		return fmt.Errorf("usage: vacuum <table>")
+	}
+	table, err := d.GetTable(fields[1])
+	if err != nil {
+		return fmt.Errorf("vacuum error: %v", err)
+	}
+	reclaimed, err := table.Vacuum()
+	if err != nil {
+		return fmt.Errorf("vacuum error: %v", err)
+	}
+	io.WriteString(w, fmt.Sprintf("%v pages reclaimed from table %v.\n", reclaimed, fields[1]))
+	return nil
+}
+
+// Handle analyze.
+func HandleAnalyze(d *Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("analyze error: %v", err)
+	}
+	analyze, ok := statement.(*sql.AnalyzeStmt)
+	if !ok {
+		return fmt.Errorf("usage: analyze <table>")
+	}
+	stats, err := d.Analyze(analyze.Table)
+	if err != nil {
+		return fmt.Errorf("analyze error: %v", err)
+	}
+	io.WriteString(w, fmt.Sprintf("%v rows in table %v.\n", stats.RowCount(), analyze.Table))
+	for i, column := range stats.Columns {
+		io.WriteString(w, fmt.Sprintf("%v: %v distinct, min %v, max %v\n", column.Name, stats.Distinct(i),
+			FormatValue(column.Min.Value), FormatValue(column.Max.Value)))
+		buckets := make([]string, len(column.Histogram))
+		for j, bucket := range column.Histogram {
+			buckets[j] = fmt.Sprintf("<= %v: %v", FormatValue(bucket.Upper.Value), bucket.Rows)
+		}
+		io.WriteString(w, fmt.Sprintf("  histogram: %v\n", strings.Join(buckets, ", ")))
+	}
+	return nil
+}
+
+// Handle filter.
+func HandleFilter(d *Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("filter error: %v", err)
+	}
+	filter, ok := statement.(*sql.FilterStmt)
+	if !ok {
+		return fmt.Errorf("usage: filter on <table> [<false positive rate>] | filter off <table>")
 	}
+	if !filter.On {
+		if err := d.DropFilter(filter.Table); err != nil {
+			return fmt.Errorf("filter error: %v", err)
+		}
+		return nil
+	}
+	rate := DEFAULT_FALSE_POSITIVE_RATE
+	if filter.Rate != nil {
+		value, err := CoerceValue(FloatColumn, filter.Rate.(*sql.Literal).Value)
+		if err != nil {
+			return fmt.Errorf("filter error: %v", err)
+		}
+		rate = value.(float64)
+	}
+	if err := d.CreateFilter(filter.Table, rate); err != nil {
+		return fmt.Errorf("filter error: %v", err)
+	}
+	stats, _, err := d.GetFilterStats(filter.Table)
+	if err != nil {
+		return fmt.Errorf("filter error: %v", err)
+	}
+	io.WriteString(w, fmt.Sprintf("bloom filter of %v bits with %v hashes on table %v.\n", stats.Size, stats.Hashes, filter.Table))
+	return nil
+}
+
+// Handle policy.
+func HandlePolicy(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: policy <lru|clock|lru-k|2q> on <table>
+	if numFields != 4 || fields[2] != "on" {
+		return fmt.Errorf("usage: policy <lru|clock|lru-k|2q> on <table>")
+	}
+	table, err := d.GetTable(fields[3])
+	if err != nil {
+		return fmt.Errorf("policy error: %v", err)
+	}
+	policy, err := pager.NewReplacementPolicy(fields[1], table.GetPager().GetNumFrames())
+	if err != nil {
+		return fmt.Errorf("policy error: %v", err)
+	}
+	table.GetPager().SetReplacementPolicy(policy)
+	table.GetPager().ResetStats()
+	return nil
+}
+
+// Handle cache.
+func HandleCache(d *Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: cache
+	if numFields == 1 {
+		pool := d.GetPool()
+		if pool == nil {
+			return fmt.Errorf("cache error: tables do not share a buffer pool")
+		}
+		io.WriteString(w, fmt.Sprintf("frames: %v\n", pool.GetNumFrames()))
+		for _, usage := range pool.GetUsage() {
+			io.WriteString(w, pager.FormatUsage(usage))
+		}
+		return nil
+	}
+	// Usage: cache from <table>
+	if numFields != 3 || fields[1] != "from" {
+		return fmt.Errorf("usage: cache [from <table>]")
+	}
+	table, err := d.GetTable(fields[2])
+	if err != nil {
+		return fmt.Errorf("cache error: %v", err)
+	}
+	p := table.GetPager()
+	io.WriteString(w, pager.FormatStats(p.GetReplacementPolicy().Name(), p.GetStats()))
+	return nil
 }
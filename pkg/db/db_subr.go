@@ -1,7 +1,10 @@
 package db
 
 import (
+	"fmt"
 	"io/ioutil"
+
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 )
 
 // Get a temporary db file.
@@ -13,3 +16,91 @@ func GetTempDB() (string, error) {
 	defer tmpfile.Close()
 	return tmpfile.Name(), nil
 }
+
+// coerceColumn converts a literal to the type of the column at the given position of a table
+// with the given schema; a table without one has an int key and an int or text value.
+func coerceColumn(schema *Schema, column int, value Value) (Value, error) {
+	if schema != nil {
+		v, err := CoerceValue(schema.Columns[column].Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %v", schema.Columns[column].Name, err)
+		}
+		return v, nil
+	}
+	switch value.(type) {
+	case int64:
+		return value, nil
+	case string:
+		if column == 1 {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("column %v: %v is not an int", tableColumns(schema)[column], FormatValue(value))
+}
+
+// rowPair splits a row of a table with the given schema into the key and value it is
+// stored under, the reverse of EntryRow.
+func rowPair(schema *Schema, row Row) (key int64, value int64, bytes []byte, isBytes bool, err error) {
+	if schema != nil {
+		key, bytes, err = schema.EncodeRow(row)
+		return key, 0, bytes, true, err
+	}
+	if len(row) != 2 {
+		return 0, 0, nil, false, fmt.Errorf("expected a key and a value, got %v values", len(row))
+	}
+	for i := range row {
+		if row[i], err = coerceColumn(nil, i, row[i]); err != nil {
+			return 0, 0, nil, false, err
+		}
+	}
+	if s, ok := row[1].(string); ok {
+		return row[0].(int64), 0, []byte(s), true, nil
+	}
+	return row[0].(int64), row[1].(int64), nil, false, nil
+}
+
+// tableColumns returns the column names of a table with the given schema; a table
+// without one has a key and a value.
+func tableColumns(schema *Schema) []string {
+	if schema == nil {
+		return []string{"key", "value"}
+	}
+	names := make([]string, len(schema.Columns))
+	for i, column := range schema.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// columnPosition returns the position of the named column among a table's columns, or -1.
+func columnPosition(schema *Schema, name string) int {
+	for i, column := range tableColumns(schema) {
+		if column == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyColumn returns the position of the key among a table's columns.
+func keyColumn(schema *Schema) int {
+	if schema == nil {
+		return 0
+	}
+	return schema.Key
+}
+
+// EntryRow converts an entry of a table with the given schema into a row.
+func EntryRow(schema *Schema, entry utils.Entry) (Row, error) {
+	bytesEntry, isBytes := entry.(utils.BytesEntry)
+	if schema == nil {
+		if isBytes {
+			return Row{entry.GetKey(), string(bytesEntry.GetBytes())}, nil
+		}
+		return Row{entry.GetKey(), entry.GetValue()}, nil
+	}
+	if !isBytes {
+		return nil, fmt.Errorf("entry %v does not hold a row", entry.GetKey())
+	}
+	return schema.DecodeRow(entry.GetKey(), bytesEntry.GetBytes())
+}
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// An Evaluator computes the value of a compiled expression over a row; a condition
+// evaluates to a bool.
+type Evaluator func(Row) (Value, error)
+
+// A Scope resolves the column names an expression may use to positions in a row, which
+// may hold the columns of several tables.
+type Scope struct {
+	Tables  []string       // Table of each column, which qualified names must match.
+	Columns []string       // Names of the columns, in row order.
+	Keys    map[string]int // Position of each table's primary key, which can also be named "key".
+}
+
+// TableScope returns the scope of the rows of a table with the given name and schema.
+func TableScope(name string, schema *Schema) *Scope {
+	columns := tableColumns(schema)
+	tables := make([]string, len(columns))
+	for i := range tables {
+		tables[i] = name
+	}
+	return &Scope{Tables: tables, Columns: columns, Keys: map[string]int{name: keyColumn(schema)}}
+}
+
+// Join returns the scope of rows made of a row of this scope followed by a row of the other.
+func (scope *Scope) Join(other *Scope) *Scope {
+	joined := &Scope{
+		Tables:  append(append([]string{}, scope.Tables...), other.Tables...),
+		Columns: append(append([]string{}, scope.Columns...), other.Columns...),
+		Keys:    make(map[string]int),
+	}
+	for table, key := range scope.Keys {
+		joined.Keys[table] = key
+	}
+	for table, key := range other.Keys {
+		joined.Keys[table] = len(scope.Columns) + key
+	}
+	return joined
+}
+
+// Key returns the position of the primary key of the given table, or -1.
+func (scope *Scope) Key(table string) int {
+	if key, ok := scope.Keys[table]; ok {
+		return key
+	}
+	return -1
+}
+
+// Resolve returns the position of the referenced column.
+func (scope *Scope) Resolve(ref *sql.ColumnRef) (int, error) {
+	position := -1
+	for i, column := range scope.Columns {
+		if column == ref.Name && (ref.Table == "" || ref.Table == scope.Tables[i]) {
+			if position >= 0 {
+				return -1, fmt.Errorf("column name %q is ambiguous", ref.Name)
+			}
+			position = i
+		}
+	}
+	if position >= 0 {
+		return position, nil
+	}
+	if ref.Name == "key" {
+		if ref.Table != "" {
+			if key := scope.Key(ref.Table); key >= 0 {
+				return key, nil
+			}
+		} else if len(scope.Keys) == 1 {
+			for _, key := range scope.Keys {
+				return key, nil
+			}
+		} else if len(scope.Keys) > 1 {
+			return -1, errors.New(`column name "key" is ambiguous`)
+		}
+	}
+	for _, table := range scope.Tables {
+		if table == ref.Table {
+			return -1, fmt.Errorf("no column named %q", ref.String())
+		}
+	}
+	if ref.Table != "" {
+		return -1, fmt.Errorf("no table named %q", ref.Table)
+	}
+	return -1, fmt.Errorf("no column named %q", ref.Name)
+}
+
+// Compile resolves the columns of an expression, returning a function that evaluates it.
+func (scope *Scope) Compile(expr sql.Expr) (Evaluator, error) {
+	switch expr := expr.(type) {
+	case *sql.Literal:
+		value := Value(expr.Value)
+		return func(Row) (Value, error) { return value, nil }, nil
+	case *sql.ColumnRef:
+		position, err := scope.Resolve(expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(row Row) (Value, error) { return row[position], nil }, nil
+	case *sql.FuncCall:
+		// An aggregate function is a column of the rows an aggregation produces.
+		for position, name := range scope.Columns {
+			if scope.Tables[position] == "" && name == expr.String() {
+				return func(row Row) (Value, error) { return row[position], nil }, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not an aggregated column", expr)
+	case *sql.NotExpr:
+		operand, err := scope.compileCondition(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(row Row) (Value, error) {
+			v, err := operand(row)
+			if err != nil {
+				return nil, err
+			}
+			return !v.(bool), nil
+		}, nil
+	case *sql.BetweenExpr:
+		operand, err := scope.Compile(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		low, err := scope.Compile(expr.Low)
+		if err != nil {
+			return nil, err
+		}
+		high, err := scope.Compile(expr.High)
+		if err != nil {
+			return nil, err
+		}
+		return func(row Row) (Value, error) {
+			v, err := operand(row)
+			if err != nil {
+				return nil, err
+			}
+			for i, bound := range []Evaluator{low, high} {
+				b, err := bound(row)
+				if err != nil {
+					return nil, err
+				}
+				cmp, err := CompareValues(v, b)
+				if err != nil {
+					return nil, err
+				}
+				if i == 0 && cmp < 0 || i == 1 && cmp > 0 {
+					return expr.Not, nil
+				}
+			}
+			return !expr.Not, nil
+		}, nil
+	case *sql.BinaryExpr:
+		if expr.Op == "and" || expr.Op == "or" {
+			return scope.compileLogical(expr)
+		}
+		left, err := scope.Compile(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := scope.Compile(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		op := expr.Op
+		return func(row Row) (Value, error) {
+			l, err := left(row)
+			if err != nil {
+				return nil, err
+			}
+			r, err := right(row)
+			if err != nil {
+				return nil, err
+			}
+			cmp, err := CompareValues(l, r)
+			if err != nil {
+				// Values of different types are never equal, but can't be ordered.
+				if op == "=" || op == "!=" {
+					return op == "!=", nil
+				}
+				return nil, err
+			}
+			switch op {
+			case "=":
+				return cmp == 0, nil
+			case "!=":
+				return cmp != 0, nil
+			case "<":
+				return cmp < 0, nil
+			case "<=":
+				return cmp <= 0, nil
+			case ">":
+				return cmp > 0, nil
+			default:
+				return cmp >= 0, nil
+			}
+		}, nil
+	case *sql.InExpr:
+		// Selects plan a subquery as a join, so it can only be anded with the rest of the clause.
+		return nil, fmt.Errorf("%v can only be a condition of a select's where clause anded with the rest", expr)
+	case *sql.Star:
+		return nil, errors.New("* is not a value")
+	default:
+		return nil, fmt.Errorf("unsupported expression %v", expr)
+	}
+}
+
+// compileCondition compiles an expression that must evaluate to a bool.
+func (scope *Scope) compileCondition(expr sql.Expr) (Evaluator, error) {
+	switch expr := expr.(type) {
+	case *sql.ColumnRef, *sql.Literal, *sql.Star:
+		return nil, fmt.Errorf("%v is not a condition", expr)
+	}
+	return scope.Compile(expr)
+}
+
+// compileLogical compiles an and or an or, which only evaluates its right side if needed.
+func (scope *Scope) compileLogical(expr *sql.BinaryExpr) (Evaluator, error) {
+	left, err := scope.compileCondition(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := scope.compileCondition(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+	isAnd := expr.Op == "and"
+	return func(row Row) (Value, error) {
+		l, err := left(row)
+		if err != nil {
+			return nil, err
+		}
+		if l.(bool) != isAnd {
+			return l, nil
+		}
+		return right(row)
+	}, nil
+}
+
+// CompileCondition compiles a where clause; a nil clause holds for every row.
+func (scope *Scope) CompileCondition(expr sql.Expr) (func(Row) (bool, error), error) {
+	if expr == nil {
+		return func(Row) (bool, error) { return true, nil }, nil
+	}
+	condition, err := scope.compileCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(row Row) (bool, error) {
+		v, err := condition(row)
+		if err != nil {
+			return false, err
+		}
+		return v.(bool), nil
+	}, nil
+}
+
+// CompareValues compares two values, returning a negative number, zero or a positive
+// number as a is less than, equal to or greater than b. Ints and floats compare as numbers.
+func CompareValues(a Value, b Value) (int, error) {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return compareInts(a, b), nil
+		case float64:
+			return compareFloats(float64(a), b), nil
+		}
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return compareFloats(a, float64(b)), nil
+		case float64:
+			return compareFloats(a, b), nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %v with %v", FormatValue(a), FormatValue(b))
+}
+
+func compareInts(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareFloats(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
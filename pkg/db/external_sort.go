@@ -0,0 +1,304 @@
+package db
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// A SortCodec orders the records an external sort sorts, and spills them to its runs.
+type SortCodec interface {
+	Compare(a interface{}, b interface{}) (int, error)
+	Encode(record interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// SortOptions bound the memory an external sort uses.
+type SortOptions struct {
+	Records int   // Records held in memory before they are spilled as a run, or 0 for no limit.
+	Bytes   int64 // Bytes of encoded records held in memory before they are spilled, or 0 for no limit.
+	FanIn   int   // Runs merged into one at a time, or 0 to merge every run at once.
+}
+
+// SortStats count the work an external sort did.
+type SortStats struct {
+	Runs   int64 // Runs of records spilled, not counting merged ones.
+	Passes int64 // Merge passes over the runs, counting the merge as records are read.
+	Bytes  int64 // Bytes written to runs, including merged ones.
+}
+
+// An ExternalSorter sorts records with an external merge sort, keeping records that tie in
+// the order they were added. Records are held in memory until they would exceed its
+// options, then sorted and spilled as a run to a temp file. Once every record is added, runs
+// are merged FanIn at a time, leaving a buffer for the merged run, until FanIn+1 or fewer
+// are left, which are merged as the records are read. Records that fit in memory are never
+// spilled.
+type ExternalSorter struct {
+	codec    SortCodec
+	options  SortOptions
+	buffered []sortRecord // Records added and not yet spilled.
+	size     int64        // Bytes the buffered records take up encoded.
+	runs     []*SpillFile // Runs spilled and not yet removed, in the order they were spilled.
+	merge    *runMerge    // Merges the last runs, if any were spilled.
+	i        int          // The next buffered record to read, if none were spilled.
+	stats    SortStats
+}
+
+// A sortRecord is a record with its encoding.
+type sortRecord struct {
+	record interface{}
+	data   []byte
+}
+
+// NewExternalSorter returns an empty external sort.
+func NewExternalSorter(codec SortCodec, options SortOptions) *ExternalSorter {
+	return &ExternalSorter{codec: codec, options: options}
+}
+
+// Add adds a record to the sort, spilling the records held in memory if it doesn't fit.
+func (sorter *ExternalSorter) Add(record interface{}) error {
+	data, err := sorter.codec.Encode(record)
+	if err != nil {
+		return err
+	}
+	full := sorter.options.Records > 0 && len(sorter.buffered) >= sorter.options.Records
+	full = full || (sorter.options.Bytes > 0 && sorter.size+int64(len(data)) > sorter.options.Bytes)
+	if full && len(sorter.buffered) > 0 {
+		if err := sorter.spill(); err != nil {
+			return err
+		}
+	}
+	sorter.buffered = append(sorter.buffered, sortRecord{record: record, data: data})
+	sorter.size += int64(len(data))
+	return nil
+}
+
+// sortBuffered sorts the records held in memory.
+func (sorter *ExternalSorter) sortBuffered() (err error) {
+	sort.SliceStable(sorter.buffered, func(i, j int) bool {
+		cmp, compareErr := sorter.codec.Compare(sorter.buffered[i].record, sorter.buffered[j].record)
+		if compareErr != nil && err == nil {
+			err = compareErr
+		}
+		return cmp < 0
+	})
+	return err
+}
+
+// spill sorts the records held in memory and writes them out as a new run.
+func (sorter *ExternalSorter) spill() error {
+	if err := sorter.sortBuffered(); err != nil {
+		return err
+	}
+	run, err := sorter.newRun()
+	if err != nil {
+		return err
+	}
+	for _, buffered := range sorter.buffered {
+		if err := run.Write(buffered.data); err != nil {
+			return err
+		}
+	}
+	if err := run.Rewind(); err != nil {
+		return err
+	}
+	sorter.stats.Runs++
+	sorter.stats.Bytes += run.Size()
+	sorter.buffered, sorter.size = sorter.buffered[:0], 0
+	return nil
+}
+
+// Sort sorts the records added, merging runs until few enough are left to merge as they
+// are read.
+func (sorter *ExternalSorter) Sort() error {
+	if len(sorter.runs) == 0 {
+		sorter.i = 0
+		return sorter.sortBuffered()
+	}
+	if len(sorter.buffered) > 0 {
+		if err := sorter.spill(); err != nil {
+			return err
+		}
+	}
+	sorter.buffered = nil
+	runs := append([]*SpillFile{}, sorter.runs...)
+	fanIn := sorter.options.FanIn
+	for fanIn > 0 && len(runs) > fanIn+1 {
+		merged := make([]*SpillFile, 0)
+		for len(runs) > 0 {
+			n := fanIn
+			if len(runs) < n {
+				n = len(runs)
+			}
+			run, err := sorter.mergeRuns(runs[:n])
+			if err != nil {
+				return err
+			}
+			merged, runs = append(merged, run), runs[n:]
+		}
+		runs = merged
+		sorter.stats.Passes++
+	}
+	var err error
+	sorter.merge, err = sorter.newRunMerge(runs)
+	sorter.stats.Passes++
+	return err
+}
+
+// mergeRuns merges runs into a new run, removing them.
+func (sorter *ExternalSorter) mergeRuns(runs []*SpillFile) (*SpillFile, error) {
+	merge, err := sorter.newRunMerge(runs)
+	if err != nil {
+		return nil, err
+	}
+	run, err := sorter.newRun()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		record, err := merge.next()
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			break
+		}
+		data, err := sorter.codec.Encode(record)
+		if err != nil {
+			return nil, err
+		}
+		if err := run.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := run.Rewind(); err != nil {
+		return nil, err
+	}
+	sorter.stats.Bytes += run.Size()
+	for _, merged := range runs {
+		sorter.removeRun(merged)
+	}
+	return run, nil
+}
+
+// Next returns the next record in order, or nil once every record has been read.
+func (sorter *ExternalSorter) Next() (interface{}, error) {
+	if sorter.merge != nil {
+		return sorter.merge.next()
+	}
+	if sorter.i >= len(sorter.buffered) {
+		return nil, nil
+	}
+	sorter.i++
+	return sorter.buffered[sorter.i-1].record, nil
+}
+
+// Close removes every run the sort spilled.
+func (sorter *ExternalSorter) Close() {
+	for len(sorter.runs) > 0 {
+		sorter.removeRun(sorter.runs[0])
+	}
+	sorter.buffered, sorter.merge = nil, nil
+}
+
+// Stats returns the work the sort did.
+func (sorter *ExternalSorter) Stats() SortStats {
+	return sorter.stats
+}
+
+// newRun creates an empty run.
+func (sorter *ExternalSorter) newRun() (*SpillFile, error) {
+	run, err := NewSpillFile()
+	if err != nil {
+		return nil, err
+	}
+	sorter.runs = append(sorter.runs, run)
+	return run, nil
+}
+
+// removeRun deletes a run's temp file.
+func (sorter *ExternalSorter) removeRun(run *SpillFile) {
+	for i, spilled := range sorter.runs {
+		if spilled == run {
+			sorter.runs = append(sorter.runs[:i], sorter.runs[i+1:]...)
+			break
+		}
+	}
+	run.Remove()
+}
+
+// runMerge merges runs, producing their records in order. Records that tie are produced
+// from the run spilled first, which keeps the sort stable.
+type runMerge struct {
+	codec SortCodec
+	runs  []*SpillFile  // Every run merged, in the order they were spilled.
+	heads []interface{} // The current record of each run.
+	heap  []int         // Runs that still have records, smallest current record first.
+	err   error         // The first error hit comparing records.
+}
+
+// newRunMerge reads the first record of each run.
+func (sorter *ExternalSorter) newRunMerge(runs []*SpillFile) (*runMerge, error) {
+	merge := &runMerge{codec: sorter.codec, runs: runs, heads: make([]interface{}, len(runs)), heap: make([]int, 0, len(runs))}
+	for i, run := range runs {
+		if err := run.Rewind(); err != nil {
+			return nil, err
+		}
+		ok, err := merge.advance(i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			merge.heap = append(merge.heap, i)
+		}
+	}
+	heap.Init(merge)
+	return merge, merge.err
+}
+
+// advance reads the next record of a run into its head, returning false once it has none.
+func (merge *runMerge) advance(i int) (bool, error) {
+	data, err := merge.runs[i].Read()
+	if err != nil || data == nil {
+		return false, err
+	}
+	merge.heads[i], err = merge.codec.Decode(data)
+	return err == nil, err
+}
+
+// next returns the smallest record across the runs, or nil once every record has been
+// produced.
+func (merge *runMerge) next() (interface{}, error) {
+	if len(merge.heap) == 0 {
+		return nil, merge.err
+	}
+	i := merge.heap[0]
+	record := merge.heads[i]
+	ok, err := merge.advance(i)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		heap.Fix(merge, 0)
+	} else {
+		heap.Pop(merge)
+	}
+	return record, merge.err
+}
+
+func (merge *runMerge) Len() int { return len(merge.heap) }
+func (merge *runMerge) Less(i, j int) bool {
+	a, b := merge.heap[i], merge.heap[j]
+	cmp, err := merge.codec.Compare(merge.heads[a], merge.heads[b])
+	if err != nil && merge.err == nil {
+		merge.err = err
+	}
+	return cmp < 0 || (cmp == 0 && a < b)
+}
+func (merge *runMerge) Swap(i, j int)      { merge.heap[i], merge.heap[j] = merge.heap[j], merge.heap[i] }
+func (merge *runMerge) Push(x interface{}) { merge.heap = append(merge.heap, x.(int)) }
+func (merge *runMerge) Pop() interface{} {
+	old := merge.heap
+	i := old[len(old)-1]
+	merge.heap = old[:len(old)-1]
+	return i
+}
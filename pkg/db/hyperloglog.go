@@ -0,0 +1,80 @@
+package db
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+var HLL_PRECISION uint = 12 // A sketch has 2^HLL_PRECISION registers, for about 1.6% error
+
+// HyperLogLog estimates the number of distinct values added to it in a fixed amount of
+// space. Each value's hash picks a register by its first bits, which keeps the longest run
+// of leading zeros seen in the rest.
+type HyperLogLog struct {
+	Registers []byte `json:"registers"`
+}
+
+// NewHyperLogLog returns an empty sketch.
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{Registers: make([]byte, 1<<HLL_PRECISION)}
+}
+
+// precision returns the number of hash bits that pick a register.
+func (hll *HyperLogLog) precision() uint {
+	return uint(bits.TrailingZeros(uint(len(hll.Registers))))
+}
+
+// Add adds a value to the sketch.
+func (hll *HyperLogLog) Add(value Value) {
+	hash := mix64(uint64(indexKey(value)))
+	p := hll.precision()
+	register := hash >> (64 - p)
+	// Stop at a set bit past the last one, so the rank is at most 64 - p + 1.
+	rank := byte(bits.LeadingZeros64(hash<<p|1<<(p-1)) + 1)
+	if rank > hll.Registers[register] {
+		hll.Registers[register] = rank
+	}
+}
+
+// Merge adds every value added to another sketch of the same size to this one.
+func (hll *HyperLogLog) Merge(other *HyperLogLog) error {
+	if len(other.Registers) != len(hll.Registers) {
+		return errors.New("cannot merge sketches of different sizes")
+	}
+	for i, rank := range other.Registers {
+		if rank > hll.Registers[i] {
+			hll.Registers[i] = rank
+		}
+	}
+	return nil
+}
+
+// Estimate returns the estimated number of distinct values added to the sketch.
+func (hll *HyperLogLog) Estimate() int64 {
+	m := float64(len(hll.Registers))
+	sum, zeros := 0.0, 0
+	for _, rank := range hll.Registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Few values leave many registers empty, which counting them estimates better.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// mix64 scrambles the bits of a value, so that similar values hash far apart.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// migrateLegacyTable rewrites a table whose file was written before pages had headers in
+// the current format. The old file is first moved aside with a .legacy suffix, and only
+// removed once the new one is written, so a migration a crash interrupts is started over.
+// The entries are read into memory to be rewritten.
+func (db *Database) migrateLegacyTable(info *TableInfo) (err error) {
+	path := filepath.Join(db.basepath, info.Name)
+	legacy := path + ".legacy"
+	if _, err := os.Stat(legacy); os.IsNotExist(err) {
+		isLegacy, err := pager.IsLegacyFile(path, info.PageSize)
+		if err != nil || !isLegacy {
+			return err
+		}
+		// A torn first page fails its checksum too; a file that can't be read as legacy
+		// pages is left to be reported as corrupt.
+		if _, err := readLegacyEntries(info.Type, path); err != nil {
+			return nil
+		}
+		if err := os.Rename(path, legacy); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	// A hash table's old directory isn't needed, as every page of its file is a bucket.
+	if err := removeFiles(db.tableFiles(info.Name)); err != nil {
+		return err
+	}
+	entries, err := readLegacyEntries(info.Type, legacy)
+	if err != nil {
+		return err
+	}
+	index, err := db.openTable(&TableInfo{Name: info.Name, Type: info.Type, PageSize: info.PageSize})
+	if err != nil {
+		return err
+	}
+	if btreeIndex, ok := index.(*btree.BTreeIndex); ok {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].GetKey() < entries[j].GetKey() })
+		err = btree.BulkLoadEntries(btreeIndex, entries, LOAD_FILL_FACTOR)
+	} else {
+		for _, entry := range entries {
+			if err = index.Insert(entry.GetKey(), entry.GetValue()); err != nil {
+				break
+			}
+		}
+	}
+	if closeErr := index.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(legacy)
+}
+
+// readLegacyEntries reads the entries of a table of the given type from a file written
+// before pages had headers.
+func readLegacyEntries(indexType IndexType, path string) ([]utils.Entry, error) {
+	if indexType == HashIndexType {
+		return hash.ReadLegacyEntries(path)
+	}
+	return btree.ReadLegacyEntries(path)
+}
@@ -0,0 +1,346 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// ColumnType is the type of the values in a column.
+type ColumnType int64
+
+const (
+	IntColumn   ColumnType = 0
+	TextColumn  ColumnType = 1
+	FloatColumn ColumnType = 2
+)
+
+var columnTypeNames = map[ColumnType]string{IntColumn: "int", TextColumn: "text", FloatColumn: "float"}
+
+// String returns the name the column type is declared with.
+func (columnType ColumnType) String() string {
+	if name, ok := columnTypeNames[columnType]; ok {
+		return name
+	}
+	return fmt.Sprintf("ColumnType(%d)", int64(columnType))
+}
+
+// ParseColumnType returns the column type with the given name.
+func ParseColumnType(name string) (ColumnType, error) {
+	for columnType, typeName := range columnTypeNames {
+		if typeName == name {
+			return columnType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column type %v", name)
+}
+
+// MarshalText encodes the column type by its name.
+func (columnType ColumnType) MarshalText() ([]byte, error) {
+	return []byte(columnType.String()), nil
+}
+
+// UnmarshalText decodes a column type from its name.
+func (columnType *ColumnType) UnmarshalText(text []byte) (err error) {
+	*columnType, err = ParseColumnType(string(text))
+	return err
+}
+
+// Column is a named, typed column of a table.
+type Column struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+}
+
+// Schema describes the columns of a table. The primary key column, which must be an int,
+// is the key of the table's index; the other columns are encoded together as its value.
+type Schema struct {
+	Columns []Column `json:"columns"`
+	Key     int      `json:"key"` // Position of the primary key column.
+}
+
+// A Value is an int64, float64 or string, according to the type of its column.
+type Value interface{}
+
+// A Row holds one value per column of a schema, in column order.
+type Row []Value
+
+// NewSchema builds a schema from parsed column definitions, such as those of
+// (id int primary key, name text, score float).
+func NewSchema(defs []sql.ColumnDef) (*Schema, error) {
+	alphanumeric := regexp.MustCompile(`^\w+$`)
+	schema := &Schema{Key: -1}
+	for _, def := range defs {
+		if !alphanumeric.MatchString(def.Name) {
+			return nil, fmt.Errorf("column name %v must be alphanumeric", def.Name)
+		}
+		if schema.ColumnIndex(def.Name) >= 0 {
+			return nil, fmt.Errorf("duplicate column %v", def.Name)
+		}
+		columnType, err := ParseColumnType(def.Type)
+		if err != nil {
+			return nil, err
+		}
+		if def.PrimaryKey {
+			if schema.Key >= 0 {
+				return nil, errors.New("a table can only have one primary key")
+			}
+			if columnType != IntColumn {
+				return nil, errors.New("the primary key must be an int column")
+			}
+			schema.Key = len(schema.Columns)
+		}
+		schema.Columns = append(schema.Columns, Column{Name: def.Name, Type: columnType})
+	}
+	if schema.Key < 0 {
+		return nil, errors.New("a table needs an int primary key")
+	}
+	return schema, nil
+}
+
+// String formats the schema as it would be declared.
+func (schema *Schema) String() string {
+	defs := make([]string, len(schema.Columns))
+	for i, column := range schema.Columns {
+		defs[i] = column.Name + " " + column.Type.String()
+		if i == schema.Key {
+			defs[i] += " primary key"
+		}
+	}
+	return "(" + strings.Join(defs, ", ") + ")"
+}
+
+// ColumnIndex returns the position of the column with the given name, or -1 if there is none.
+func (schema *Schema) ColumnIndex(name string) int {
+	for i, column := range schema.Columns {
+		if column.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// CoerceValue converts a literal to the given column type. An int stands for the same
+// float, but no other conversion is made.
+func CoerceValue(columnType ColumnType, value Value) (Value, error) {
+	switch v := value.(type) {
+	case int64:
+		if columnType == IntColumn {
+			return v, nil
+		}
+		if columnType == FloatColumn {
+			return float64(v), nil
+		}
+	case float64:
+		if columnType == FloatColumn {
+			return v, nil
+		}
+	case string:
+		if columnType == TextColumn {
+			return v, nil
+		}
+	}
+	if columnType == IntColumn {
+		return nil, fmt.Errorf("%v is not an int", FormatValue(value))
+	}
+	return nil, fmt.Errorf("%v is not a %v", FormatValue(value), columnType)
+}
+
+// BuildRow converts one literal per column to the types of the columns.
+func (schema *Schema) BuildRow(values []Value) (Row, error) {
+	if len(values) != len(schema.Columns) {
+		return nil, fmt.Errorf("expected %v values, got %v", len(schema.Columns), len(values))
+	}
+	row := make(Row, len(values))
+	for i, value := range values {
+		v, err := CoerceValue(schema.Columns[i].Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %v", schema.Columns[i].Name, err)
+		}
+		row[i] = v
+	}
+	return row, nil
+}
+
+// EncodeRow splits a row into the key and value it is stored under.
+func (schema *Schema) EncodeRow(row Row) (key int64, value []byte, err error) {
+	if len(row) != len(schema.Columns) {
+		return 0, nil, fmt.Errorf("expected %v values, got %v", len(schema.Columns), len(row))
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	value = make([]byte, 0)
+	for i, column := range schema.Columns {
+		switch v := row[i].(type) {
+		case int64:
+			if column.Type != IntColumn {
+				return 0, nil, fmt.Errorf("column %v: expected %v, got int", column.Name, column.Type)
+			}
+			if i == schema.Key {
+				key = v
+				continue
+			}
+			n := binary.PutVarint(buf, v)
+			value = append(value, buf[:n]...)
+		case float64:
+			if column.Type != FloatColumn {
+				return 0, nil, fmt.Errorf("column %v: expected %v, got float", column.Name, column.Type)
+			}
+			binary.BigEndian.PutUint64(buf, math.Float64bits(v))
+			value = append(value, buf[:8]...)
+		case string:
+			if column.Type != TextColumn {
+				return 0, nil, fmt.Errorf("column %v: expected %v, got text", column.Name, column.Type)
+			}
+			n := binary.PutUvarint(buf, uint64(len(v)))
+			value = append(value, buf[:n]...)
+			value = append(value, v...)
+		default:
+			return 0, nil, fmt.Errorf("column %v: unsupported value %v", column.Name, v)
+		}
+	}
+	return key, value, nil
+}
+
+// DecodeRow rebuilds the row stored under the given key and value.
+func (schema *Schema) DecodeRow(key int64, value []byte) (Row, error) {
+	corrupt := errors.New("row is corrupted")
+	row := make(Row, len(schema.Columns))
+	for i, column := range schema.Columns {
+		if i == schema.Key {
+			row[i] = key
+			continue
+		}
+		switch column.Type {
+		case IntColumn:
+			v, n := binary.Varint(value)
+			if n <= 0 {
+				return nil, corrupt
+			}
+			row[i], value = v, value[n:]
+		case FloatColumn:
+			if len(value) < 8 {
+				return nil, corrupt
+			}
+			row[i], value = math.Float64frombits(binary.BigEndian.Uint64(value)), value[8:]
+		case TextColumn:
+			length, n := binary.Uvarint(value)
+			if n <= 0 || uint64(len(value)-n) < length {
+				return nil, corrupt
+			}
+			row[i], value = string(value[n:n+int(length)]), value[n+int(length):]
+		}
+	}
+	if len(value) != 0 {
+		return nil, corrupt
+	}
+	return row, nil
+}
+
+// Tags of the types of values in a row written by AppendRow.
+const (
+	nullTag byte = iota
+	intTag
+	floatTag
+	textTag
+)
+
+// AppendRow appends a row to buf in a form ReadRow reads back. Unlike EncodeRow, it needs no
+// schema: each value is written with its type, so rows of any scope, including nulls, can be
+// written to temp files and read back.
+func AppendRow(buf []byte, row Row) ([]byte, error) {
+	scratch := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(scratch, uint64(len(row)))
+	buf = append(buf, scratch[:n]...)
+	for _, value := range row {
+		switch v := value.(type) {
+		case nil:
+			buf = append(buf, nullTag)
+		case int64:
+			n := binary.PutVarint(scratch, v)
+			buf = append(append(buf, intTag), scratch[:n]...)
+		case float64:
+			binary.BigEndian.PutUint64(scratch, math.Float64bits(v))
+			buf = append(append(buf, floatTag), scratch[:8]...)
+		case string:
+			n := binary.PutUvarint(scratch, uint64(len(v)))
+			buf = append(append(buf, textTag), scratch[:n]...)
+			buf = append(buf, v...)
+		default:
+			return nil, fmt.Errorf("cannot write %v", FormatValue(value))
+		}
+	}
+	return buf, nil
+}
+
+// ReadRow reads the row AppendRow wrote at the start of data, returning it and the number
+// of bytes it took up.
+func ReadRow(data []byte) (Row, int, error) {
+	corrupt := errors.New("row is corrupted")
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)) {
+		return nil, 0, corrupt
+	}
+	read := n
+	row := make(Row, length)
+	for i := range row {
+		if read >= len(data) {
+			return nil, 0, corrupt
+		}
+		tag := data[read]
+		read++
+		switch tag {
+		case nullTag:
+		case intTag:
+			v, n := binary.Varint(data[read:])
+			if n <= 0 {
+				return nil, 0, corrupt
+			}
+			row[i], read = v, read+n
+		case floatTag:
+			if len(data)-read < 8 {
+				return nil, 0, corrupt
+			}
+			row[i], read = math.Float64frombits(binary.BigEndian.Uint64(data[read:])), read+8
+		case textTag:
+			length, n := binary.Uvarint(data[read:])
+			if n <= 0 || uint64(len(data)-read-n) < length {
+				return nil, 0, corrupt
+			}
+			read += n
+			row[i], read = string(data[read:read+int(length)]), read+int(length)
+		default:
+			return nil, 0, corrupt
+		}
+	}
+	return row, read, nil
+}
+
+// FormatValue formats a value as it would be written in a row literal. A missing value,
+// such as the minimum of no values, is nil.
+func FormatValue(value Value) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// FormatRow formats a row as a parenthesized tuple.
+func FormatRow(row Row) string {
+	values := make([]string, len(row))
+	for i, value := range row {
+		values[i] = FormatValue(value)
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
@@ -0,0 +1,602 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// IndexedTable is a table with secondary indexes, stats or a bloom filter of its keys.
+// Inserts, updates and deletes go to the table's primary index and keep its secondary
+// indexes, stats and filter in sync. Implements Index.
+type IndexedTable struct {
+	Index               // The primary index, holding the table's entries.
+	schema      *Schema // Schema of the table, or nil for (key, value) pairs.
+	secondaries []*secondaryIndex
+	stats       *TableStats // Stats of the table, or nil if it hasn't been analyzed.
+	filter      *keyFilter  // Filter of the table's keys, or nil if it has none.
+}
+
+// A secondaryIndex files the keys of a table's entries under the value of one of their
+// columns. Each of its entries holds the sorted keys of the rows with that value.
+type secondaryIndex struct {
+	info   *IndexInfo
+	column int   // Position of the indexed column among the table's columns.
+	index  Index // Index from column values to lists of keys.
+	mtx    sync.Mutex
+}
+
+// Get the primary index of the table.
+func (table *IndexedTable) GetPrimary() Index {
+	return table.Index
+}
+
+// Get the secondary indexes of the table.
+func (table *IndexedTable) GetSecondaryIndexes() []Index {
+	indexes := make([]Index, len(table.secondaries))
+	for i, secondary := range table.secondaries {
+		indexes[i] = secondary.index
+	}
+	return indexes
+}
+
+// PrimaryIndex returns the index a table's entries are stored in.
+func PrimaryIndex(index Index) Index {
+	if table, ok := index.(*IndexedTable); ok {
+		return table.GetPrimary()
+	}
+	return index
+}
+
+// Closes the primary index, then the secondary indexes, writing the filter to its file.
+func (table *IndexedTable) Close() error {
+	err := table.Index.Close()
+	if table.filter != nil {
+		if curErr := table.filter.write(); err == nil {
+			err = curErr
+		}
+	}
+	for _, secondary := range table.secondaries {
+		if curErr := secondary.index.Close(); err == nil {
+			err = curErr
+		}
+	}
+	return err
+}
+
+// Insert given element.
+func (table *IndexedTable) Insert(key int64, value int64) error {
+	return table.insert(key, value, nil, false)
+}
+
+// Insert given element with a byte-slice value.
+func (table *IndexedTable) InsertBytes(key int64, value []byte) error {
+	return table.insert(key, 0, value, true)
+}
+
+// insert adds an entry to the primary index, then files its row in the secondary indexes.
+// If filing it fails, the entry is taken back out.
+func (table *IndexedTable) insert(key int64, value int64, bytes []byte, isBytes bool) (err error) {
+	row, err := table.rowOf(key, value, bytes, isBytes)
+	if err != nil {
+		return err
+	}
+	if isBytes {
+		err = table.Index.InsertBytes(key, bytes)
+	} else {
+		err = table.Index.Insert(key, value)
+	}
+	if err != nil {
+		return err
+	}
+	if table.filter != nil {
+		if err := table.filter.add(key, table.Index); err != nil {
+			table.Index.Delete(key)
+			return err
+		}
+	}
+	for i, secondary := range table.secondaries {
+		if err := secondary.add(row[secondary.column], key); err != nil {
+			refile(table.secondaries[:i+1], key, row, nil)
+			table.Index.Delete(key)
+			return err
+		}
+	}
+	if table.stats != nil {
+		table.stats.Add(row)
+	}
+	return nil
+}
+
+// Find the entry with the given key, without reading the primary index if the filter rules
+// the key out.
+func (table *IndexedTable) Find(key int64) (utils.Entry, error) {
+	if table.filter != nil && !table.filter.contains(key) {
+		return nil, utils.ErrNotFound
+	}
+	return table.Index.Find(key)
+}
+
+// Update given element.
+func (table *IndexedTable) Update(key int64, value int64) error {
+	return table.update(key, value, nil, false)
+}
+
+// Update given element to hold a byte-slice value.
+func (table *IndexedTable) UpdateBytes(key int64, value []byte) error {
+	return table.update(key, 0, value, true)
+}
+
+// update overwrites an entry of the primary index, then refiles its row in each
+// secondary index whose column changed. If refiling it fails, the old entry is put back.
+func (table *IndexedTable) update(key int64, value int64, bytes []byte, isBytes bool) (err error) {
+	row, err := table.rowOf(key, value, bytes, isBytes)
+	if err != nil {
+		return err
+	}
+	oldEntry, old, err := table.find(key)
+	if err != nil {
+		return err
+	}
+	if isBytes {
+		err = table.Index.UpdateBytes(key, bytes)
+	} else {
+		err = table.Index.Update(key, value)
+	}
+	if err != nil {
+		return err
+	}
+	for i, secondary := range table.secondaries {
+		if old[secondary.column] == row[secondary.column] {
+			continue
+		}
+		err := secondary.remove(old[secondary.column], key)
+		if err == nil {
+			err = secondary.add(row[secondary.column], key)
+		}
+		if err != nil {
+			refile(table.secondaries[:i+1], key, row, old)
+			table.put(oldEntry, true)
+			return err
+		}
+	}
+	if table.stats != nil {
+		table.stats.Replace(old, row)
+	}
+	return nil
+}
+
+// Delete given element, and remove its row from the secondary indexes. If removing it
+// fails, the entry is put back.
+func (table *IndexedTable) Delete(key int64) error {
+	oldEntry, old, err := table.find(key)
+	if err != nil {
+		return err
+	}
+	if err := table.Index.Delete(key); err != nil {
+		return err
+	}
+	for i, secondary := range table.secondaries {
+		if err := secondary.remove(old[secondary.column], key); err != nil {
+			table.put(oldEntry, false)
+			refile(table.secondaries[:i+1], key, nil, old)
+			return err
+		}
+	}
+	if table.stats != nil {
+		table.stats.Remove(old)
+	}
+	return nil
+}
+
+// Compact the files of the primary and secondary indexes.
+func (table *IndexedTable) Vacuum() (int64, error) {
+	reclaimed, err := table.Index.Vacuum()
+	if err != nil {
+		return reclaimed, err
+	}
+	for _, secondary := range table.secondaries {
+		n, err := secondary.index.Vacuum()
+		reclaimed += n
+		if err != nil {
+			return reclaimed, err
+		}
+	}
+	return reclaimed, nil
+}
+
+// rowOf returns the row stored under the given key and value; the value is bytes if isBytes.
+func (table *IndexedTable) rowOf(key int64, value int64, bytes []byte, isBytes bool) (Row, error) {
+	if isBytes {
+		return EntryRow(table.schema, utils.NewBytesEntry(key, bytes))
+	}
+	if table.schema != nil {
+		return nil, fmt.Errorf("entry %v does not hold a row", key)
+	}
+	return Row{key, value}, nil
+}
+
+// find returns the entry stored under the given key, and its row.
+func (table *IndexedTable) find(key int64) (utils.Entry, Row, error) {
+	entry, err := table.Find(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	row, err := EntryRow(table.schema, entry)
+	return entry, row, err
+}
+
+// put writes an entry back to the primary index, by insert or update, undoing a change
+// whose secondary indexes couldn't be kept in sync.
+func (table *IndexedTable) put(entry utils.Entry, update bool) error {
+	bytesEntry, isBytes := entry.(utils.BytesEntry)
+	switch {
+	case isBytes && update:
+		return table.Index.UpdateBytes(entry.GetKey(), bytesEntry.GetBytes())
+	case isBytes:
+		return table.Index.InsertBytes(entry.GetKey(), bytesEntry.GetBytes())
+	case update:
+		return table.Index.Update(entry.GetKey(), entry.GetValue())
+	default:
+		return table.Index.Insert(entry.GetKey(), entry.GetValue())
+	}
+}
+
+// refile moves a key in each of the given secondary indexes from the column value of one
+// row to that of another, either of which may be nil. It undoes a change that failed partway,
+// so errors are dropped in favor of the one that caused it.
+func refile(secondaries []*secondaryIndex, key int64, from Row, to Row) {
+	for _, secondary := range secondaries {
+		if from != nil {
+			secondary.remove(from[secondary.column], key)
+		}
+		if to != nil {
+			secondary.add(to[secondary.column], key)
+		}
+	}
+}
+
+// lookup returns the entries whose row holds the given value in the given column, in key
+// order, or false if no secondary index is on that column.
+func (table *IndexedTable) lookup(column int, value Value) ([]utils.Entry, bool, error) {
+	for _, secondary := range table.secondaries {
+		if secondary.column != column {
+			continue
+		}
+		keys, err := secondary.keys(indexKey(value))
+		if err != nil {
+			return nil, true, err
+		}
+		entries := make([]utils.Entry, 0, len(keys))
+		for _, key := range keys {
+			entry, err := table.Index.Find(key)
+			if err != nil {
+				return nil, true, err
+			}
+			// Values that don't fit a key share keys with others, so check the row.
+			row, err := EntryRow(table.schema, entry)
+			if err != nil {
+				return nil, true, err
+			}
+			if row[column] == value {
+				entries = append(entries, entry)
+			}
+		}
+		return entries, true, nil
+	}
+	return nil, false, nil
+}
+
+// indexKey returns the key a column value is filed under in a secondary index. Ints are
+// their own key and floats are keyed by their bits; text is keyed by its hash.
+func indexKey(value Value) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case float64:
+		if v == 0 {
+			// -0 equals 0, so it needs the same key.
+			v = 0
+		}
+		return int64(math.Float64bits(v))
+	case string:
+		hasher := fnv.New64a()
+		hasher.Write([]byte(v))
+		return int64(hasher.Sum64())
+	default:
+		return 0
+	}
+}
+
+// keys returns the keys filed under the given index key, or none if there are none.
+func (secondary *secondaryIndex) keys(indexKey int64) ([]int64, error) {
+	entry, err := secondary.index.Find(indexKey)
+	if err == utils.ErrNotFound {
+		return []int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	bytesEntry, ok := entry.(utils.BytesEntry)
+	if !ok {
+		return nil, fmt.Errorf("index %v is corrupted", secondary.info.Name)
+	}
+	return decodeKeys(bytesEntry.GetBytes())
+}
+
+// add files the given key under the given column value.
+func (secondary *secondaryIndex) add(value Value, key int64) error {
+	secondary.mtx.Lock()
+	defer secondary.mtx.Unlock()
+	indexKey := indexKey(value)
+	keys, err := secondary.keys(indexKey)
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(keys), func(i int) bool { return keys[i] >= key })
+	if i < len(keys) && keys[i] == key {
+		return nil
+	}
+	keys = append(keys, 0)
+	copy(keys[i+1:], keys[i:])
+	keys[i] = key
+	if len(keys) == 1 {
+		return secondary.index.InsertBytes(indexKey, encodeKeys(keys))
+	}
+	return secondary.index.UpdateBytes(indexKey, encodeKeys(keys))
+}
+
+// remove takes the given key out from under the given column value.
+func (secondary *secondaryIndex) remove(value Value, key int64) error {
+	secondary.mtx.Lock()
+	defer secondary.mtx.Unlock()
+	indexKey := indexKey(value)
+	keys, err := secondary.keys(indexKey)
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(keys), func(i int) bool { return keys[i] >= key })
+	if i == len(keys) || keys[i] != key {
+		return nil
+	}
+	keys = append(keys[:i], keys[i+1:]...)
+	if len(keys) == 0 {
+		return secondary.index.Delete(indexKey)
+	}
+	return secondary.index.UpdateBytes(indexKey, encodeKeys(keys))
+}
+
+// build files every entry of the given primary index.
+func (secondary *secondaryIndex) build(primary Index, schema *Schema) error {
+	cursor, err := primary.TableStart()
+	if err != nil {
+		return err
+	}
+	for {
+		if !cursor.IsEnd() {
+			entry, err := cursor.GetEntry()
+			if err != nil {
+				return err
+			}
+			row, err := EntryRow(schema, entry)
+			if err != nil {
+				return err
+			}
+			if err := secondary.add(row[secondary.column], entry.GetKey()); err != nil {
+				return err
+			}
+		}
+		if cursor.StepForward() {
+			break
+		}
+	}
+	return nil
+}
+
+// encodeKeys encodes a list of keys as varints.
+func encodeKeys(keys []int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	encoded := make([]byte, 0, len(keys)*binary.MaxVarintLen64)
+	for _, key := range keys {
+		n := binary.PutVarint(buf, key)
+		encoded = append(encoded, buf[:n]...)
+	}
+	return encoded
+}
+
+// decodeKeys decodes a list of keys encoded by encodeKeys.
+func decodeKeys(buf []byte) ([]int64, error) {
+	keys := make([]int64, 0)
+	for len(buf) > 0 {
+		key, n := binary.Varint(buf)
+		if n <= 0 {
+			return nil, errors.New("index entry is corrupted")
+		}
+		keys, buf = append(keys, key), buf[n:]
+	}
+	return keys, nil
+}
+
+// indexFiles returns the paths of the files a secondary index with the given name may have.
+func (db *Database) indexFiles(name string) []string {
+	return filesAt(filepath.Join(db.basepath, name) + ".idx")
+}
+
+// openSecondary opens the files of the given secondary index on the given table.
+func (db *Database) openSecondary(info *TableInfo, indexInfo *IndexInfo) (*secondaryIndex, error) {
+	column := columnPosition(info.Schema, indexInfo.Column)
+	if column < 0 {
+		return nil, fmt.Errorf("table %v has no column named %v", info.Name, indexInfo.Column)
+	}
+	indexPager, err := db.newPager(info.PageSize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open index %v: %v", indexInfo.Name, err)
+	}
+	path := filepath.Join(db.basepath, indexInfo.Name) + ".idx"
+	var index Index
+	switch indexInfo.Type {
+	case BTreeIndexType:
+		index, err = btree.OpenTableWithPager(path, indexPager)
+	case HashIndexType:
+		index, err = hash.OpenTableWithPager(path, indexPager)
+	default:
+		err = errors.New("invalid index type")
+	}
+	if err != nil {
+		// Give the pager's frames back to the pool.
+		indexPager.Close()
+		return nil, err
+	}
+	return &secondaryIndex{info: indexInfo, column: column, index: index}, nil
+}
+
+// CreateIndex creates a secondary index of the given type on a column of the given table,
+// and files the table's existing entries in it.
+func (db *Database) CreateIndex(name string, tableName string, column string, indexType IndexType) (err error) {
+	alphanumeric, _ := regexp.Compile(`\W`)
+	if alphanumeric.MatchString(name) {
+		return errors.New("index name must be alphanumeric")
+	}
+	// Indexes share a namespace with tables.
+	if _, ok := db.catalog.Tables[name]; ok {
+		return fmt.Errorf("%v is the name of a table", name)
+	}
+	if info, _ := db.catalog.findIndex(name); info != nil {
+		return errors.New("index already exists")
+	}
+	info, ok := db.catalog.Tables[tableName]
+	if !ok {
+		return errors.New("table not found")
+	}
+	if position := columnPosition(info.Schema, column); position < 0 {
+		return fmt.Errorf("no column named %q", column)
+	} else if position == keyColumn(info.Schema) {
+		return fmt.Errorf("column %v is the primary key", column)
+	}
+	for _, indexInfo := range info.Indexes {
+		if indexInfo.Column == column {
+			return fmt.Errorf("column %v already has index %v", column, indexInfo.Name)
+		}
+	}
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+	// Files of an index the catalog doesn't know are left from a drop that never finished.
+	if err := removeFiles(db.indexFiles(name)); err != nil {
+		return err
+	}
+	indexInfo := &IndexInfo{Name: name, Column: column, Type: indexType}
+	secondary, err := db.openSecondary(info, indexInfo)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			secondary.index.Close()
+			removeFiles(db.indexFiles(name))
+		}
+	}()
+	if err = secondary.build(PrimaryIndex(table), info.Schema); err != nil {
+		return err
+	}
+	info.Indexes = append(info.Indexes, indexInfo)
+	if err = db.catalog.write(db.basepath); err != nil {
+		info.Indexes = info.Indexes[:len(info.Indexes)-1]
+		return err
+	}
+	indexed := db.indexedTable(tableName)
+	indexed.secondaries = append(indexed.secondaries, secondary)
+	return nil
+}
+
+// DropIndex removes the secondary index with the given name and its files.
+func (db *Database) DropIndex(name string) error {
+	info, indexInfo := db.catalog.findIndex(name)
+	if info == nil {
+		return errors.New("index not found")
+	}
+	indexes := make([]*IndexInfo, 0, len(info.Indexes))
+	for _, other := range info.Indexes {
+		if other != indexInfo {
+			indexes = append(indexes, other)
+		}
+	}
+	previous := info.Indexes
+	info.Indexes = indexes
+	if err := db.catalog.write(db.basepath); err != nil {
+		info.Indexes = previous
+		return err
+	}
+	// Close the index if its table is open.
+	if indexed, ok := db.tables[info.Name].(*IndexedTable); ok {
+		secondaries := make([]*secondaryIndex, 0, len(indexed.secondaries))
+		for _, secondary := range indexed.secondaries {
+			if secondary.info == indexInfo {
+				secondary.index.Close()
+			} else {
+				secondaries = append(secondaries, secondary)
+			}
+		}
+		indexed.secondaries = secondaries
+	}
+	return removeFiles(db.indexFiles(name))
+}
+
+// Lookup returns the entries of the given table whose row holds the given value in the
+// given column, in key order. It reads them through the secondary index on the column if
+// there is one, and scans the table otherwise.
+func (db *Database) Lookup(tableName string, column string, value Value) ([]utils.Entry, error) {
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	schema := db.GetSchema(tableName)
+	position := columnPosition(schema, column)
+	if position < 0 {
+		return nil, fmt.Errorf("no column named %q", column)
+	}
+	// The key is looked up in the primary index.
+	if position == keyColumn(schema) {
+		key, ok := value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("key %v is not an int", FormatValue(value))
+		}
+		entry, err := table.Find(key)
+		if err != nil {
+			return []utils.Entry{}, nil
+		}
+		return []utils.Entry{entry}, nil
+	}
+	if indexed, ok := table.(*IndexedTable); ok {
+		if entries, ok, err := indexed.lookup(position, value); ok {
+			return entries, err
+		}
+	}
+	entries, err := table.Select()
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]utils.Entry, 0)
+	for _, entry := range entries {
+		row, err := EntryRow(schema, entry)
+		if err != nil {
+			return nil, err
+		}
+		if row[position] == value {
+			matches = append(matches, entry)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].GetKey() < matches[j].GetKey() })
+	return matches, nil
+}
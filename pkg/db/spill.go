@@ -0,0 +1,96 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// A SpillFile holds records that don't fit in memory in a temp file, such as a run being
+// sorted or a partition being hashed. Records are written, then the file is rewound and
+// they are read back in the order they were written. Each record is stored after its length.
+type SpillFile struct {
+	file    *os.File
+	writer  *bufio.Writer
+	reader  *bufio.Reader
+	records int64
+	size    int64 // Bytes written to the file.
+}
+
+// NewSpillFile creates an empty spill file.
+func NewSpillFile() (*SpillFile, error) {
+	name, err := GetTempDB()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(name, os.O_RDWR, 0666)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	return &SpillFile{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// Write appends a record to the file.
+func (spill *SpillFile) Write(data []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	if _, err := spill.writer.Write(buf[:n]); err != nil {
+		return err
+	}
+	if _, err := spill.writer.Write(data); err != nil {
+		return err
+	}
+	spill.records++
+	spill.size += int64(n + len(data))
+	return nil
+}
+
+// Rewind flushes the records written and starts reading them back from the first.
+func (spill *SpillFile) Rewind() error {
+	if err := spill.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := spill.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	spill.reader = bufio.NewReader(spill.file)
+	return nil
+}
+
+// Read returns the next record, or nil once every record has been read. Returns
+// io.ErrUnexpectedEOF if the file ends partway through a record.
+func (spill *SpillFile) Read() ([]byte, error) {
+	length, err := binary.ReadUvarint(spill.reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(spill.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Records returns the number of records written to the file.
+func (spill *SpillFile) Records() int64 {
+	return spill.records
+}
+
+// Size returns the number of bytes written to the file.
+func (spill *SpillFile) Size() int64 {
+	return spill.size
+}
+
+// Remove closes and deletes the file.
+func (spill *SpillFile) Remove() {
+	spill.file.Close()
+	os.Remove(spill.file.Name())
+}
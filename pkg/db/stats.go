@@ -0,0 +1,429 @@
+package db
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+)
+
+var ANALYZE_SAMPLE_SIZE int = 10000  // Rows analyze samples to build histograms
+var HISTOGRAM_BUCKETS int = 10       // Buckets in each column's equi-depth histogram
+var REANALYZE_FRACTION float64 = 0.2 // Fraction of a table's rows that may change before planning analyzes it again
+var REANALYZE_MIN_ROWS int64 = 100   // Rows that may change before planning analyzes a table again, however small
+
+// TableStats are statistics about the rows of a table. Analyze computes them, and inserts,
+// updates and deletes keep them up to date, though deletes can't shrink a column's range
+// or number of distinct values, so planning analyzes the table again once enough rows
+// have changed.
+type TableStats struct {
+	Rows          int64          `json:"rows"`
+	Modifications int64          `json:"modifications"` // Rows changed since the table was analyzed.
+	Columns       []*ColumnStats `json:"columns"`
+	mtx           sync.Mutex
+	dirty         bool // Whether the stats changed since the catalog was written.
+}
+
+// ColumnStats are statistics about the values of one column.
+type ColumnStats struct {
+	Name      string             `json:"name"`
+	Sketch    *HyperLogLog       `json:"sketch"` // Estimates the number of distinct values.
+	Min       StatValue          `json:"min"`    // Null if the table has no rows.
+	Max       StatValue          `json:"max"`
+	Histogram []*HistogramBucket `json:"histogram"`
+}
+
+// A HistogramBucket counts the rows whose value is at most its upper bound, and above the
+// upper bound of the bucket before it. The buckets of an equi-depth histogram each hold
+// about as many rows; rows with the same value are always in the same bucket.
+type HistogramBucket struct {
+	Upper StatValue `json:"upper"`
+	Rows  int64     `json:"rows"`
+}
+
+// A StatValue is a value that keeps its type when encoded as JSON.
+type StatValue struct {
+	Value Value
+}
+
+// MarshalJSON encodes the value as an object naming its type, or null if it is nil.
+func (v StatValue) MarshalJSON() ([]byte, error) {
+	switch value := v.Value.(type) {
+	case int64:
+		return json.Marshal(map[string]int64{"int": value})
+	case float64:
+		return json.Marshal(map[string]float64{"float": value})
+	case string:
+		return json.Marshal(map[string]string{"text": value})
+	default:
+		return []byte("null"), nil
+	}
+}
+
+// UnmarshalJSON decodes a value encoded by MarshalJSON.
+func (v *StatValue) UnmarshalJSON(data []byte) error {
+	var tagged struct {
+		Int   *int64   `json:"int"`
+		Float *float64 `json:"float"`
+		Text  *string  `json:"text"`
+	}
+	if err := json.Unmarshal(data, &tagged); err != nil {
+		return err
+	}
+	switch {
+	case tagged.Int != nil:
+		v.Value = *tagged.Int
+	case tagged.Float != nil:
+		v.Value = *tagged.Float
+	case tagged.Text != nil:
+		v.Value = *tagged.Text
+	default:
+		v.Value = nil
+	}
+	return nil
+}
+
+// MarshalJSON encodes the stats while holding their lock, so edits can't change them midway.
+func (stats *TableStats) MarshalJSON() ([]byte, error) {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	stats.dirty = false
+	type fields TableStats
+	return json.Marshal((*fields)(stats))
+}
+
+// newTableStats returns the stats of an empty table with the given columns.
+func newTableStats(columns []string) *TableStats {
+	stats := &TableStats{Columns: make([]*ColumnStats, len(columns))}
+	for i, name := range columns {
+		stats.Columns[i] = &ColumnStats{Name: name, Sketch: NewHyperLogLog(), Histogram: make([]*HistogramBucket, 0)}
+	}
+	return stats
+}
+
+// compareStatValues orders values by type, numbers before text, and then by value, so
+// that a column holding both ints and text, like the value of a plain table, is ordered.
+func compareStatValues(a Value, b Value) int {
+	_, aIsText := a.(string)
+	_, bIsText := b.(string)
+	if aIsText != bIsText {
+		if aIsText {
+			return 1
+		}
+		return -1
+	}
+	cmp, _ := CompareValues(a, b)
+	return cmp
+}
+
+// add updates the stats of a column for a new value.
+func (column *ColumnStats) add(value Value) {
+	column.Sketch.Add(value)
+	if column.Min.Value == nil || compareStatValues(value, column.Min.Value) < 0 {
+		column.Min.Value = value
+	}
+	if column.Max.Value == nil || compareStatValues(value, column.Max.Value) > 0 {
+		column.Max.Value = value
+	}
+	if len(column.Histogram) == 0 {
+		column.Histogram = append(column.Histogram, &HistogramBucket{Upper: StatValue{value}})
+	}
+	bucket := column.bucket(value)
+	if bucket == nil {
+		// The value is past the last bucket, which grows to hold it.
+		bucket = column.Histogram[len(column.Histogram)-1]
+		bucket.Upper.Value = value
+	}
+	bucket.Rows++
+}
+
+// remove updates the stats of a column for a value that is gone.
+func (column *ColumnStats) remove(value Value) {
+	if bucket := column.bucket(value); bucket != nil && bucket.Rows > 0 {
+		bucket.Rows--
+	}
+}
+
+// bucket returns the histogram bucket a value falls in, or nil if it is past the last one.
+func (column *ColumnStats) bucket(value Value) *HistogramBucket {
+	i := sort.Search(len(column.Histogram), func(i int) bool {
+		return compareStatValues(value, column.Histogram[i].Upper.Value) <= 0
+	})
+	if i == len(column.Histogram) {
+		return nil
+	}
+	return column.Histogram[i]
+}
+
+// buildHistogram builds an equi-depth histogram of the rows of a table from a sorted
+// sample of a column's values.
+func buildHistogram(values []Value, rows int64) []*HistogramBucket {
+	histogram := make([]*HistogramBucket, 0, HISTOGRAM_BUCKETS)
+	n := len(values)
+	depth := (n + HISTOGRAM_BUCKETS - 1) / HISTOGRAM_BUCKETS
+	counted := int64(0)
+	for start := 0; start < n; {
+		end := start + depth - 1
+		if end >= n {
+			end = n - 1
+		}
+		// Keep equal values in one bucket.
+		for end+1 < n && compareStatValues(values[end+1], values[end]) == 0 {
+			end++
+		}
+		// Scale the sample up to the table, so the buckets add up to its rows.
+		upTo := int64(end+1) * rows / int64(n)
+		histogram = append(histogram, &HistogramBucket{Upper: StatValue{values[end]}, Rows: upTo - counted})
+		counted = upTo
+		start = end + 1
+	}
+	return histogram
+}
+
+// Add updates the stats for an inserted row.
+func (stats *TableStats) Add(row Row) {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	stats.Rows++
+	stats.Modifications++
+	stats.dirty = true
+	for i, column := range stats.Columns {
+		column.add(row[i])
+	}
+}
+
+// Remove updates the stats for a deleted row.
+func (stats *TableStats) Remove(row Row) {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	stats.Rows--
+	stats.Modifications++
+	stats.dirty = true
+	for i, column := range stats.Columns {
+		column.remove(row[i])
+	}
+}
+
+// Replace updates the stats for an updated row.
+func (stats *TableStats) Replace(old Row, row Row) {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	stats.Modifications++
+	stats.dirty = true
+	for i, column := range stats.Columns {
+		column.remove(old[i])
+		column.add(row[i])
+	}
+}
+
+// stale checks whether enough rows changed since the table was analyzed that its stats
+// should be computed again.
+func (stats *TableStats) stale() bool {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	return stats.Modifications >= REANALYZE_MIN_ROWS && float64(stats.Modifications) >= REANALYZE_FRACTION*float64(stats.Rows)
+}
+
+// RowCount returns the number of rows in the table.
+func (stats *TableStats) RowCount() int64 {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	return stats.Rows
+}
+
+// Distinct estimates the number of distinct values in a column, which is at most the
+// number of rows.
+func (stats *TableStats) Distinct(column int) int64 {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	distinct := stats.Columns[column].Sketch.Estimate()
+	if distinct > stats.Rows {
+		distinct = stats.Rows
+	}
+	return distinct
+}
+
+// EstimateEqual estimates the rows holding a value in a column, assuming the column's
+// distinct values are spread evenly over the rows.
+func (stats *TableStats) EstimateEqual(column int, value Value) int64 {
+	stats.mtx.Lock()
+	columnStats := stats.Columns[column]
+	outside := columnStats.Min.Value == nil || compareStatValues(value, columnStats.Min.Value) < 0 ||
+		compareStatValues(value, columnStats.Max.Value) > 0
+	stats.mtx.Unlock()
+	if outside {
+		return 0
+	}
+	distinct := stats.Distinct(column)
+	if distinct == 0 {
+		return 0
+	}
+	return int64(math.Max(math.Round(float64(stats.RowCount())/float64(distinct)), 1))
+}
+
+// EstimateRange estimates the rows whose int value in a column lies between two bounds,
+// either of which may be nil, assuming values are spread evenly within each bucket of the
+// column's histogram.
+func (stats *TableStats) EstimateRange(column int, lower *btree.Bound, upper *btree.Bound) int64 {
+	stats.mtx.Lock()
+	defer stats.mtx.Unlock()
+	columnStats := stats.Columns[column]
+	from, ok := columnStats.Min.Value.(int64)
+	if !ok {
+		return stats.Rows
+	}
+	// Narrow the bounds to the ints they include.
+	low, high := int64(math.MinInt64), int64(math.MaxInt64)
+	if lower != nil {
+		if low = lower.Key; !lower.Inclusive {
+			low++
+		}
+	}
+	if upper != nil {
+		if high = upper.Key; !upper.Inclusive {
+			high--
+		}
+	}
+	rows := 0.0
+	for _, bucket := range columnStats.Histogram {
+		to, ok := bucket.Upper.Value.(int64)
+		if !ok {
+			break
+		}
+		// The bucket holds the ints from its lower edge up to its upper bound.
+		if overlap := minInt64(to, high) - maxInt64(from, low) + 1; overlap > 0 && to >= from {
+			rows += float64(bucket.Rows) * float64(overlap) / float64(to-from+1)
+		}
+		from = to + 1
+	}
+	return int64(math.Round(rows))
+}
+
+// estimatePathRows estimates the rows an access path reads from a table with the given
+// stats, or returns -1 if there are none.
+func estimatePathRows(stats *TableStats, schema *Schema, path *AccessPath) int64 {
+	if stats == nil {
+		return -1
+	}
+	switch path.Kind {
+	case KeySeek:
+		return stats.EstimateEqual(keyColumn(schema), path.Key)
+	case IndexSeek:
+		return stats.EstimateEqual(columnPosition(schema, path.Column), path.Value)
+	case RangeScan:
+		return stats.EstimateRange(keyColumn(schema), path.Lower, path.Upper)
+	default:
+		return stats.RowCount()
+	}
+}
+
+func minInt64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// GetStats returns the stats of a table, or nil if it hasn't been analyzed.
+func GetStats(table Index) *TableStats {
+	if indexed, ok := table.(*IndexedTable); ok {
+		return indexed.stats
+	}
+	return nil
+}
+
+// Analyze computes the stats of a table, reading every row to count them and find each
+// column's range and distinct values, and a sample of ANALYZE_SAMPLE_SIZE rows to build
+// each column's histogram. The stats are recorded in the catalog and kept up to date.
+func (db *Database) Analyze(tableName string) (*TableStats, error) {
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	info := db.catalog.Tables[tableName]
+	stats := newTableStats(tableColumns(info.Schema))
+	// Reservoir sample the rows, with a fixed seed so analyzing is repeatable.
+	random := rand.New(rand.NewSource(1))
+	sample := make([]Row, 0)
+	cursor, err := TableCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	for ; !cursor.IsEnd(); cursor.StepForward() {
+		entry, err := cursor.GetEntry()
+		if err != nil {
+			return nil, err
+		}
+		row, err := EntryRow(info.Schema, entry)
+		if err != nil {
+			return nil, err
+		}
+		stats.Rows++
+		for i, column := range stats.Columns {
+			column.Sketch.Add(row[i])
+			if column.Min.Value == nil || compareStatValues(row[i], column.Min.Value) < 0 {
+				column.Min.Value = row[i]
+			}
+			if column.Max.Value == nil || compareStatValues(row[i], column.Max.Value) > 0 {
+				column.Max.Value = row[i]
+			}
+		}
+		if len(sample) < ANALYZE_SAMPLE_SIZE {
+			sample = append(sample, row)
+		} else if i := random.Int63n(stats.Rows); i < int64(ANALYZE_SAMPLE_SIZE) {
+			sample[i] = row
+		}
+	}
+	values := make([]Value, len(sample))
+	for i, column := range stats.Columns {
+		for j, row := range sample {
+			values[j] = row[i]
+		}
+		sort.Slice(values, func(a, b int) bool { return compareStatValues(values[a], values[b]) < 0 })
+		column.Histogram = buildHistogram(values, stats.Rows)
+	}
+	previous := info.Stats
+	info.Stats = stats
+	if err := db.catalog.write(db.basepath); err != nil {
+		info.Stats = previous
+		return nil, err
+	}
+	// Edits keep the stats up to date through an indexed table.
+	db.indexedTable(tableName).stats = stats
+	return stats, nil
+}
+
+// refreshStats analyzes the given table again if it was analyzed, and its stats are stale.
+func (db *Database) refreshStats(tableName string, table Index) error {
+	if stats := GetStats(table); stats == nil || !stats.stale() {
+		return nil
+	}
+	_, err := db.Analyze(tableName)
+	return err
+}
+
+// writeStats writes the catalog if the stats of any table changed since it was last written.
+func (db *Database) writeStats() error {
+	for _, info := range db.catalog.Tables {
+		if info.Stats == nil {
+			continue
+		}
+		info.Stats.mtx.Lock()
+		dirty := info.Stats.dirty
+		info.Stats.mtx.Unlock()
+		if dirty {
+			return db.catalog.write(db.basepath)
+		}
+	}
+	return nil
+}
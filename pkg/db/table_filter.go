@@ -0,0 +1,193 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+var TABLE_FILTER_MIN_KEYS int64 = 1024         // Keys a table's bloom filter is sized for at least, so a small table's isn't rebuilt on every few inserts
+var DEFAULT_FALSE_POSITIVE_RATE float64 = 0.01 // Rate of false positives a table's bloom filter is sized for unless another is given
+
+// A keyFilter is a bloom filter of a table's keys, which lets finds of keys it rules out skip
+// the table's index. It is rebuilt at twice the size once it holds more keys than its rate of
+// false positives allows. Its bits are kept in a file while the table is closed; the file
+// is removed once read, so a table that isn't closed has its filter rebuilt when next opened.
+type keyFilter struct {
+	info    *FilterInfo
+	path    string // Path of the file the filter's bits are kept in.
+	filter  *BloomFilter
+	skipped int64 // Finds the filter ruled out, and that skipped the index.
+	mtx     sync.Mutex
+}
+
+// filterFile returns the path of the file a table's bloom filter is kept in.
+func filterFile(path string) string {
+	return path + ".bloom"
+}
+
+// openKeyFilter reads the filter of the given primary index's keys from its file, or builds
+// it if the file is missing, was left by a table that wasn't closed, or is corrupted.
+func openKeyFilter(info *FilterInfo, path string, primary Index) (*keyFilter, error) {
+	kf := &keyFilter{info: info, path: path}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		kf.filter, err = UnmarshalFilter(data)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err != nil {
+		if err := kf.build(primary, TABLE_FILTER_MIN_KEYS); err != nil {
+			return nil, err
+		}
+	}
+	return kf, nil
+}
+
+// contains checks whether the key may be in the table, counting the finds it rules out.
+func (kf *keyFilter) contains(key int64) bool {
+	kf.mtx.Lock()
+	found := kf.filter.Contains(key)
+	kf.mtx.Unlock()
+	if !found {
+		atomic.AddInt64(&kf.skipped, 1)
+	}
+	return found
+}
+
+// add adds a key inserted into the given primary index, rebuilding the filter at twice the
+// size if it has grown past its capacity.
+func (kf *keyFilter) add(key int64, primary Index) error {
+	kf.mtx.Lock()
+	defer kf.mtx.Unlock()
+	kf.filter.Insert(key)
+	if capacity := FilterCapacity(kf.filter.Size(), kf.info.FalsePositiveRate); kf.filter.Keys() > capacity {
+		return kf.build(primary, 2*capacity)
+	}
+	return nil
+}
+
+// build refills the filter from every key of the given primary index, sized for at least n
+// keys, or twice as many as the index has if that is more. Deleted keys are dropped.
+func (kf *keyFilter) build(primary Index, n int64) error {
+	if n < TABLE_FILTER_MIN_KEYS {
+		n = TABLE_FILTER_MIN_KEYS
+	}
+	for {
+		filter := NewOptimalFilter(n, kf.info.FalsePositiveRate)
+		cursor, err := TableCursor(primary)
+		if err != nil {
+			return err
+		}
+		for ; !cursor.IsEnd(); cursor.StepForward() {
+			entry, err := cursor.GetEntry()
+			if err != nil {
+				return err
+			}
+			filter.Insert(entry.GetKey())
+		}
+		if filter.Keys() <= n {
+			kf.filter = filter
+			return nil
+		}
+		n = 2 * filter.Keys()
+	}
+}
+
+// rebuild refills the filter from every key of the given primary index, for keys that
+// reached it without being added, such as those loaded in bulk.
+func (kf *keyFilter) rebuild(primary Index) error {
+	kf.mtx.Lock()
+	defer kf.mtx.Unlock()
+	return kf.build(primary, FilterCapacity(kf.filter.Size(), kf.info.FalsePositiveRate))
+}
+
+// write writes the filter's bits to its file.
+func (kf *keyFilter) write() error {
+	kf.mtx.Lock()
+	defer kf.mtx.Unlock()
+	return ioutil.WriteFile(kf.path, kf.filter.Marshal(), 0666)
+}
+
+// FilterStats is what a table's bloom filter holds, and what it saved.
+type FilterStats struct {
+	Size    int64 // Bits in the filter.
+	Hashes  int64 // Hashes each key sets a bit for.
+	Keys    int64 // Keys inserted since the filter was last built, deleted ones included.
+	Skipped int64 // Finds the filter ruled out since the table was opened.
+}
+
+// stats returns what the filter holds, and what it saved.
+func (kf *keyFilter) stats() FilterStats {
+	kf.mtx.Lock()
+	defer kf.mtx.Unlock()
+	return FilterStats{Size: kf.filter.Size(), Hashes: kf.filter.Hashes(), Keys: kf.filter.Keys(), Skipped: atomic.LoadInt64(&kf.skipped)}
+}
+
+// GetFilterStats returns what the given table's bloom filter holds, and what it saved since
+// the table was opened, or false if it has none.
+func (db *Database) GetFilterStats(tableName string) (FilterStats, bool, error) {
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return FilterStats{}, false, err
+	}
+	indexed, ok := table.(*IndexedTable)
+	if !ok || indexed.filter == nil {
+		return FilterStats{}, false, nil
+	}
+	return indexed.filter.stats(), true, nil
+}
+
+// CreateFilter gives the given table a bloom filter of its keys, sized for the given rate of
+// false positives, which lets finds of keys that aren't in it skip its index. A table that
+// has one has it rebuilt for the new rate.
+func (db *Database) CreateFilter(tableName string, falsePositiveRate float64) (err error) {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return errors.New("false positive rate must be between 0 and 1")
+	}
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+	info := db.catalog.Tables[tableName]
+	filterInfo := &FilterInfo{FalsePositiveRate: falsePositiveRate}
+	kf := &keyFilter{info: filterInfo, path: filterFile(filepath.Join(db.basepath, tableName))}
+	if err := kf.build(PrimaryIndex(table), TABLE_FILTER_MIN_KEYS); err != nil {
+		return err
+	}
+	previous := info.Filter
+	info.Filter = filterInfo
+	if err := db.catalog.write(db.basepath); err != nil {
+		info.Filter = previous
+		return err
+	}
+	// Inserts keep the filter up to date through an indexed table.
+	db.indexedTable(tableName).filter = kf
+	return nil
+}
+
+// DropFilter removes the given table's bloom filter.
+func (db *Database) DropFilter(tableName string) error {
+	info, ok := db.catalog.Tables[tableName]
+	if !ok {
+		return errors.New("table not found")
+	}
+	if info.Filter == nil {
+		return fmt.Errorf("table %v has no filter", tableName)
+	}
+	previous := info.Filter
+	info.Filter = nil
+	if err := db.catalog.write(db.basepath); err != nil {
+		info.Filter = previous
+		return err
+	}
+	if indexed, ok := db.tables[tableName].(*IndexedTable); ok {
+		indexed.filter = nil
+	}
+	return removeFiles([]string{filterFile(filepath.Join(db.basepath, tableName))})
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A TableSource runs a command that isn't SQL, such as a join, so a table can be created from
+// the rows it produces. It returns their columns, and a function that runs the command,
+// passing each row to visit; a row may not hold a null.
+type TableSource func(d *Database, command string) (columns []Column, run func(visit func(Row) error) error, err error)
+
+// Sources of tables, by the name of the command they run.
+var tableSources = make(map[string]TableSource)
+
+// RegisterTableSource lets create table <table> as <name> ... create a table from the rows
+// the named command produces.
+func RegisterTableSource(name string, source TableSource) {
+	tableSources[name] = source
+}
+
+// CreateTableAs creates a table with the given type holding the rows a command produces,
+// returning how many there are. Its primary key is an int id column numbering the rows in
+// the order they are produced, from 0, followed by their columns. If the command fails, the
+// table is dropped.
+func (db *Database) CreateTableAs(name string, indexType IndexType, command string) (rows int64, err error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("nothing to create table %v from", name)
+	}
+	source, ok := tableSources[fields[0]]
+	if !ok {
+		return 0, fmt.Errorf("cannot create a table from %v", fields[0])
+	}
+	columns, run, err := source(db, command)
+	if err != nil {
+		return 0, err
+	}
+	defs := append([]Column{{Name: "id", Type: IntColumn}}, columns...)
+	schema := &Schema{Columns: defs, Key: 0}
+	for i, column := range defs {
+		if schema.ColumnIndex(column.Name) != i {
+			return 0, fmt.Errorf("duplicate column %v", column.Name)
+		}
+	}
+	table, err := db.createTable(name, indexType, schema)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			db.DropTable(name)
+		}
+	}()
+	err = run(func(row Row) error {
+		values := append(Row{rows}, row...)
+		for i, value := range values {
+			if value == nil {
+				return fmt.Errorf("column %v: table %v can't hold a null", defs[i].Name, name)
+			}
+		}
+		key, _, bytes, _, err := rowPair(schema, values)
+		if err != nil {
+			return err
+		}
+		if err = table.InsertBytes(key, bytes); err != nil {
+			return err
+		}
+		rows++
+		return nil
+	})
+	return rows, err
+}
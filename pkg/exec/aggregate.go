@@ -0,0 +1,430 @@
+package exec
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// An AggregateFunc is an aggregate function of a group's rows: count, sum, min, max or avg
+// of an expression, or count of the rows themselves if the expression is nil.
+type AggregateFunc struct {
+	Name string
+	Arg  sql.Expr
+}
+
+// String formats the aggregate function as it is written.
+func (fn AggregateFunc) String() string {
+	if fn.Arg == nil {
+		return fn.Name + "(*)"
+	}
+	return fmt.Sprintf("%v(%v)", fn.Name, fn.Arg)
+}
+
+var AGGREGATE_MEMORY int = 4096  // Groups hash aggregation holds in memory before spilling rows
+var AGGREGATE_PARTITIONS int = 8 // Temp files hash aggregation spreads the rows of spilled groups over
+
+// aggregation is what hash and sort aggregation share: the expressions rows are grouped by,
+// the aggregate functions of each group, and the columns they produce, which are the group's
+// values of the expressions followed by the aggregate functions of its rows. Without
+// expressions to group by, every row is in one group, even if there are none.
+type aggregation struct {
+	child   Operator
+	exprs   []sql.Expr // The expressions to group by.
+	groupBy []db.Evaluator
+	funcs   []AggregateFunc
+	args    []db.Evaluator
+	scope   *db.Scope
+}
+
+// newAggregation compiles the expressions and aggregate functions of an aggregation.
+func newAggregation(child Operator, groupBy []sql.Expr, funcs []AggregateFunc) (aggregation, error) {
+	in := child.Scope()
+	aggregate := aggregation{child: child, exprs: groupBy, funcs: funcs, args: make([]db.Evaluator, len(funcs)), scope: &db.Scope{Keys: make(map[string]int)}}
+	for _, expr := range groupBy {
+		evaluator, err := in.Compile(expr)
+		if err != nil {
+			return aggregation{}, err
+		}
+		aggregate.groupBy = append(aggregate.groupBy, evaluator)
+		table, name := "", expr.String()
+		if ref, ok := expr.(*sql.ColumnRef); ok {
+			position, _ := in.Resolve(ref)
+			table, name = in.Tables[position], in.Columns[position]
+		}
+		aggregate.scope.Tables = append(aggregate.scope.Tables, table)
+		aggregate.scope.Columns = append(aggregate.scope.Columns, name)
+	}
+	for i, fn := range funcs {
+		switch fn.Name {
+		case "count", "sum", "min", "max", "avg":
+		default:
+			return aggregation{}, fmt.Errorf("unknown aggregate function %v", fn.Name)
+		}
+		if fn.Arg == nil && fn.Name != "count" {
+			return aggregation{}, fmt.Errorf("%v needs an argument", fn.Name)
+		}
+		if fn.Arg != nil {
+			var err error
+			if aggregate.args[i], err = in.Compile(fn.Arg); err != nil {
+				return aggregation{}, err
+			}
+		}
+		aggregate.scope.Tables = append(aggregate.scope.Tables, "")
+		aggregate.scope.Columns = append(aggregate.scope.Columns, fn.String())
+	}
+	return aggregate, nil
+}
+
+// A group is the rows of an aggregation with the same values of its expressions.
+type group struct {
+	values       db.Row
+	accumulators []accumulator
+}
+
+// groupOf returns the values a row is grouped by, and their key.
+func (aggregate *aggregation) groupOf(row db.Row) (db.Row, string, error) {
+	values := make(db.Row, len(aggregate.groupBy))
+	for i, evaluator := range aggregate.groupBy {
+		var err error
+		if values[i], err = evaluator(row); err != nil {
+			return nil, "", err
+		}
+	}
+	return values, groupKey(values), nil
+}
+
+// newGroup returns a group of no rows with the given values.
+func (aggregate *aggregation) newGroup(values db.Row) *group {
+	return &group{values: values, accumulators: make([]accumulator, len(aggregate.funcs))}
+}
+
+// add folds a row into a group.
+func (aggregate *aggregation) add(g *group, row db.Row) (err error) {
+	for i, fn := range aggregate.funcs {
+		// Count of the rows counts every row.
+		var value db.Value = true
+		if aggregate.args[i] != nil {
+			if value, err = aggregate.args[i](row); err != nil {
+				return err
+			}
+		}
+		if err = g.accumulators[i].add(fn.Name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// result returns the row a group produces.
+func (aggregate *aggregation) result(g *group) db.Row {
+	row := append(make(db.Row, 0, len(g.values)+len(aggregate.funcs)), g.values...)
+	for i, fn := range aggregate.funcs {
+		row = append(row, g.accumulators[i].result(fn.Name))
+	}
+	return row
+}
+
+func (aggregate *aggregation) Scope() *db.Scope {
+	return aggregate.scope
+}
+
+func (aggregate *aggregation) Children() []Operator {
+	return []Operator{aggregate.child}
+}
+
+// describe describes an aggregation of the given kind.
+func (aggregate *aggregation) describe(kind string) string {
+	funcs := make([]string, len(aggregate.funcs))
+	for i, fn := range aggregate.funcs {
+		funcs[i] = fn.String()
+	}
+	if len(aggregate.exprs) == 0 {
+		return fmt.Sprintf("%v aggregate %v", kind, strings.Join(funcs, ", "))
+	}
+	return fmt.Sprintf("%v aggregate %v group by %v", kind, strings.Join(funcs, ", "), formatExprs(aggregate.exprs))
+}
+
+// HashAggregate aggregates the rows of its child by keeping its groups in a hash table,
+// producing them in the order they are first seen. Once AGGREGATE_MEMORY groups are held,
+// rows of groups not yet seen are spilled to AGGREGATE_PARTITIONS temp files by the hash of
+// their group, and each file is aggregated in turn after the groups in memory are produced.
+type HashAggregate struct {
+	aggregation
+	rows    []db.Row          // The rows of the groups aggregated so far.
+	i       int               // The next of them to produce.
+	pending []*spillPartition // Spilled rows waiting to be aggregated.
+}
+
+// A spillPartition is a file of spilled rows, and how many times they have been spilled.
+type spillPartition struct {
+	file  *spillFile
+	depth int
+}
+
+// NewHashAggregate returns a hash aggregate of the child's rows.
+func NewHashAggregate(child Operator, groupBy []sql.Expr, funcs []AggregateFunc) (*HashAggregate, error) {
+	aggregate, err := newAggregation(child, groupBy, funcs)
+	if err != nil {
+		return nil, err
+	}
+	return &HashAggregate{aggregation: aggregate}, nil
+}
+
+func (aggregate *HashAggregate) Open() error {
+	if err := aggregate.child.Open(); err != nil {
+		return err
+	}
+	aggregate.pending = nil
+	return aggregate.aggregate(aggregate.child.Next, 0)
+}
+
+// aggregate aggregates the rows next reads that have been spilled depth times before,
+// spilling the rows of groups that don't fit in memory.
+func (aggregate *HashAggregate) aggregate(next func() (db.Row, error), depth int) (err error) {
+	groups := make(map[string]*group)
+	order := make([]*group, 0)
+	if len(aggregate.groupBy) == 0 {
+		order = append(order, aggregate.newGroup(nil))
+		groups[""] = order[0]
+	}
+	var partitions []*spillFile
+	defer func() {
+		for _, partition := range partitions {
+			if partition == nil {
+				continue
+			}
+			if partition.Records() > 0 && err == nil {
+				aggregate.pending = append(aggregate.pending, &spillPartition{file: partition, depth: depth + 1})
+			} else {
+				partition.Remove()
+			}
+		}
+	}()
+	for {
+		row, err := next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		values, key, err := aggregate.groupOf(row)
+		if err != nil {
+			return err
+		}
+		g, ok := groups[key]
+		if !ok && len(groups) >= AGGREGATE_MEMORY {
+			// Spread the groups that don't fit over the partitions, by a hash that differs
+			// each time rows are spilled again.
+			if partitions == nil {
+				partitions = make([]*spillFile, AGGREGATE_PARTITIONS)
+			}
+			hasher := fnv.New64a()
+			hasher.Write([]byte{byte(depth)})
+			hasher.Write([]byte(key))
+			i := hasher.Sum64() % uint64(len(partitions))
+			if partitions[i] == nil {
+				if partitions[i], err = newSpillFile(); err != nil {
+					return err
+				}
+			}
+			if err = partitions[i].write(row); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok {
+			g = aggregate.newGroup(values)
+			groups[key] = g
+			order = append(order, g)
+		}
+		if err = aggregate.add(g, row); err != nil {
+			return err
+		}
+	}
+	aggregate.rows, aggregate.i = make([]db.Row, len(order)), 0
+	for i, g := range order {
+		aggregate.rows[i] = aggregate.result(g)
+	}
+	return nil
+}
+
+func (aggregate *HashAggregate) Next() (db.Row, error) {
+	for aggregate.i >= len(aggregate.rows) {
+		if len(aggregate.pending) == 0 {
+			return nil, nil
+		}
+		partition := aggregate.pending[0]
+		aggregate.pending = aggregate.pending[1:]
+		err := partition.file.Rewind()
+		if err == nil {
+			err = aggregate.aggregate(partition.file.read, partition.depth)
+		}
+		partition.file.Remove()
+		if err != nil {
+			return nil, err
+		}
+	}
+	aggregate.i++
+	return aggregate.rows[aggregate.i-1], nil
+}
+
+func (aggregate *HashAggregate) Close() error {
+	aggregate.rows = nil
+	for _, partition := range aggregate.pending {
+		partition.file.Remove()
+	}
+	aggregate.pending = nil
+	return aggregate.child.Close()
+}
+
+func (aggregate *HashAggregate) String() string {
+	return aggregate.describe("hash")
+}
+
+// SortAggregate aggregates the rows of a child that produces the rows of each group
+// together, as sorting them by the expressions they are grouped by does. Only one group is
+// held in memory at a time, and groups are produced in the order the child produces them.
+type SortAggregate struct {
+	aggregation
+	next    db.Row // The first row of the next group, or nil if there are no more.
+	started bool   // Whether any group has been produced.
+}
+
+// NewSortAggregate returns a sort aggregate of the child's rows, which must be grouped.
+func NewSortAggregate(child Operator, groupBy []sql.Expr, funcs []AggregateFunc) (*SortAggregate, error) {
+	aggregate, err := newAggregation(child, groupBy, funcs)
+	if err != nil {
+		return nil, err
+	}
+	return &SortAggregate{aggregation: aggregate}, nil
+}
+
+func (aggregate *SortAggregate) Open() (err error) {
+	if err = aggregate.child.Open(); err != nil {
+		return err
+	}
+	aggregate.started = false
+	aggregate.next, err = aggregate.child.Next()
+	return err
+}
+
+func (aggregate *SortAggregate) Next() (db.Row, error) {
+	if aggregate.next == nil {
+		// Without a grouping, no rows still make one group.
+		if aggregate.started || len(aggregate.groupBy) > 0 {
+			return nil, nil
+		}
+		aggregate.started = true
+		return aggregate.result(aggregate.newGroup(nil)), nil
+	}
+	aggregate.started = true
+	values, key, err := aggregate.groupOf(aggregate.next)
+	if err != nil {
+		return nil, err
+	}
+	g := aggregate.newGroup(values)
+	for {
+		if err = aggregate.add(g, aggregate.next); err != nil {
+			return nil, err
+		}
+		if aggregate.next, err = aggregate.child.Next(); err != nil || aggregate.next == nil {
+			return aggregate.result(g), err
+		}
+		_, nextKey, err := aggregate.groupOf(aggregate.next)
+		if err != nil {
+			return nil, err
+		}
+		if nextKey != key {
+			return aggregate.result(g), nil
+		}
+	}
+}
+
+func (aggregate *SortAggregate) Close() error {
+	aggregate.next = nil
+	return aggregate.child.Close()
+}
+
+func (aggregate *SortAggregate) String() string {
+	return aggregate.describe("sort")
+}
+
+// An accumulator holds the running value of an aggregate function over a group.
+type accumulator struct {
+	count int64
+	value db.Value // The sum, min or max so far, or nil if no value has been seen.
+}
+
+// add folds a value into the accumulator.
+func (acc *accumulator) add(name string, value db.Value) error {
+	if value == nil {
+		return nil
+	}
+	acc.count++
+	if acc.value == nil {
+		if _, ok := value.(string); ok && (name == "sum" || name == "avg") {
+			return fmt.Errorf("cannot %v %v", name, db.FormatValue(value))
+		}
+		acc.value = value
+		return nil
+	}
+	switch name {
+	case "sum", "avg":
+		switch v := value.(type) {
+		case int64:
+			if sum, ok := acc.value.(int64); ok {
+				acc.value = sum + v
+			} else {
+				acc.value = acc.value.(float64) + float64(v)
+			}
+		case float64:
+			if sum, ok := acc.value.(int64); ok {
+				acc.value = float64(sum) + v
+			} else {
+				acc.value = acc.value.(float64) + v
+			}
+		default:
+			return fmt.Errorf("cannot %v %v", name, db.FormatValue(value))
+		}
+	case "min", "max":
+		cmp, err := db.CompareValues(value, acc.value)
+		if err != nil {
+			return err
+		}
+		if cmp < 0 && name == "min" || cmp > 0 && name == "max" {
+			acc.value = value
+		}
+	}
+	return nil
+}
+
+// result returns the value of the aggregate function.
+func (acc *accumulator) result(name string) db.Value {
+	switch name {
+	case "count":
+		return acc.count
+	case "avg":
+		switch sum := acc.value.(type) {
+		case int64:
+			return float64(sum) / float64(acc.count)
+		case float64:
+			return sum / float64(acc.count)
+		}
+	}
+	return acc.value
+}
+
+// groupKey encodes the values a group is grouped by as a string, telling apart values of
+// different types.
+func groupKey(values db.Row) string {
+	var key strings.Builder
+	for _, value := range values {
+		key.WriteString(fmt.Sprintf("%T:%v\x00", value, db.FormatValue(value)))
+	}
+	return key.String()
+}
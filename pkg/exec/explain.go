@@ -0,0 +1,143 @@
+package exec
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+)
+
+// A pageReader is an operator that reads pages of tables itself, rather than through
+// its children.
+type pageReader interface {
+	Pagers() []*pager.Pager
+}
+
+// Pagers returns the pagers of the table the operator reads and its secondary indexes.
+func (reader *pathReader) Pagers() []*pager.Pager {
+	table, err := reader.d.GetTable(reader.path.Table)
+	if err != nil {
+		return nil
+	}
+	pagers := []*pager.Pager{table.GetPager()}
+	if indexed, ok := table.(*db.IndexedTable); ok {
+		for _, secondary := range indexed.GetSecondaryIndexes() {
+			pagers = append(pagers, secondary.GetPager())
+		}
+	}
+	return pagers
+}
+
+// Profile measures an operator as it runs: the rows it produces, how often it is opened,
+// the time spent in it and the operators under it, and the pages it reads. Operators under
+// it are measured by their own profiles.
+type Profile struct {
+	op      Operator
+	pagers  []*pager.Pager // Pagers the operator reads through, if it reads tables itself.
+	rows    int64
+	loops   int64
+	elapsed time.Duration
+	pages   int64
+}
+
+// NewProfile returns a profile of an operator, which runs it in its place.
+func NewProfile(op Operator) *Profile {
+	profile := &Profile{op: op}
+	if reader, ok := op.(pageReader); ok {
+		profile.pagers = reader.Pagers()
+	}
+	return profile
+}
+
+// pagesRead counts the pages requested from the operator's pagers so far.
+func (profile *Profile) pagesRead() int64 {
+	n := int64(0)
+	for _, p := range profile.pagers {
+		stats := p.GetStats()
+		n += stats.Hits + stats.Misses
+	}
+	return n
+}
+
+// measure runs a call of the operator, adding its time and pages to the profile.
+func (profile *Profile) measure(call func() error) error {
+	start, pages := time.Now(), profile.pagesRead()
+	err := call()
+	profile.elapsed += time.Since(start)
+	profile.pages += profile.pagesRead() - pages
+	return err
+}
+
+func (profile *Profile) Open() error {
+	profile.loops++
+	return profile.measure(profile.op.Open)
+}
+
+func (profile *Profile) Next() (row db.Row, err error) {
+	err = profile.measure(func() error {
+		row, err = profile.op.Next()
+		return err
+	})
+	if row != nil {
+		profile.rows++
+	}
+	return row, err
+}
+
+func (profile *Profile) Close() error {
+	return profile.measure(profile.op.Close)
+}
+
+func (profile *Profile) Scope() *db.Scope {
+	return profile.op.Scope()
+}
+
+func (profile *Profile) Children() []Operator {
+	return profile.op.Children()
+}
+
+func (profile *Profile) String() string {
+	return profile.op.String()
+}
+
+// Rows returns the number of rows the operator produced.
+func (profile *Profile) Rows() int64 {
+	return profile.rows
+}
+
+// Elapsed returns the time spent in the operator and the operators under it.
+func (profile *Profile) Elapsed() time.Duration {
+	return profile.elapsed
+}
+
+// Pages returns the number of pages the operator and the profiled operators under it read.
+func (profile *Profile) Pages() int64 {
+	pages := profile.pages
+	for _, child := range profile.Children() {
+		if child, ok := child.(*Profile); ok {
+			pages += child.Pages()
+		}
+	}
+	return pages
+}
+
+// Explain prints a plan as a tree, one operator per line, each above the operators it
+// reads from. Profiled operators are followed by what was measured of them.
+func Explain(op Operator, w io.Writer) {
+	explain(op, w, 0)
+}
+
+func explain(op Operator, w io.Writer, depth int) {
+	line := strings.Repeat("  ", depth) + op.String()
+	if profile, ok := op.(*Profile); ok {
+		line += fmt.Sprintf(" (actual rows=%v loops=%v time=%.3fms pages=%v)",
+			profile.Rows(), profile.loops, float64(profile.Elapsed().Microseconds())/1000, profile.Pages())
+	}
+	io.WriteString(w, line+"\n")
+	for _, child := range op.Children() {
+		explain(child, w, depth+1)
+	}
+}
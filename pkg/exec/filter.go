@@ -0,0 +1,188 @@
+package exec
+
+import (
+	"fmt"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// Filter produces the rows of its child a condition holds for.
+type Filter struct {
+	child     Operator
+	expr      sql.Expr
+	condition func(db.Row) (bool, error)
+}
+
+// NewFilter returns a filter of the child's rows by a condition.
+func NewFilter(child Operator, condition sql.Expr) (*Filter, error) {
+	compiled, err := child.Scope().CompileCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{child: child, expr: condition, condition: compiled}, nil
+}
+
+func (filter *Filter) Open() error {
+	return filter.child.Open()
+}
+
+func (filter *Filter) Next() (db.Row, error) {
+	for {
+		row, err := filter.child.Next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+		if ok, err := filter.condition(row); err != nil || ok {
+			return row, err
+		}
+	}
+}
+
+func (filter *Filter) Close() error {
+	return filter.child.Close()
+}
+
+func (filter *Filter) Scope() *db.Scope {
+	return filter.child.Scope()
+}
+
+func (filter *Filter) Children() []Operator {
+	return []Operator{filter.child}
+}
+
+func (filter *Filter) String() string {
+	return fmt.Sprintf("filter %v", filter.expr)
+}
+
+// Project computes a list of expressions over each row of its child; * stands for every
+// column of the child.
+type Project struct {
+	child   Operator
+	exprs   []sql.Expr
+	columns []db.Evaluator
+	scope   *db.Scope
+}
+
+// NewProject returns a projection of the child's rows onto a list of expressions. Columns
+// keep their names, and other expressions are named as they are written.
+func NewProject(child Operator, exprs []sql.Expr) (*Project, error) {
+	in := child.Scope()
+	project := &Project{child: child, exprs: exprs, scope: &db.Scope{Keys: make(map[string]int)}}
+	addColumn := func(position int) {
+		column := len(project.columns)
+		// Keep the primary keys of the child's tables.
+		for table, key := range in.Keys {
+			if key == position {
+				if _, ok := project.scope.Keys[table]; !ok {
+					project.scope.Keys[table] = column
+				}
+			}
+		}
+		project.columns = append(project.columns, func(row db.Row) (db.Value, error) { return row[position], nil })
+		project.scope.Tables = append(project.scope.Tables, in.Tables[position])
+		project.scope.Columns = append(project.scope.Columns, in.Columns[position])
+	}
+	for _, expr := range exprs {
+		switch expr := expr.(type) {
+		case *sql.Star:
+			for i := range in.Columns {
+				addColumn(i)
+			}
+		case *sql.ColumnRef:
+			position, err := in.Resolve(expr)
+			if err != nil {
+				return nil, err
+			}
+			addColumn(position)
+		default:
+			column, err := in.Compile(expr)
+			if err != nil {
+				return nil, err
+			}
+			project.columns = append(project.columns, column)
+			project.scope.Tables = append(project.scope.Tables, "")
+			project.scope.Columns = append(project.scope.Columns, expr.String())
+		}
+	}
+	return project, nil
+}
+
+func (project *Project) Open() error {
+	return project.child.Open()
+}
+
+func (project *Project) Next() (db.Row, error) {
+	row, err := project.child.Next()
+	if err != nil || row == nil {
+		return nil, err
+	}
+	projected := make(db.Row, len(project.columns))
+	for i, column := range project.columns {
+		if projected[i], err = column(row); err != nil {
+			return nil, err
+		}
+	}
+	return projected, nil
+}
+
+func (project *Project) Close() error {
+	return project.child.Close()
+}
+
+func (project *Project) Scope() *db.Scope {
+	return project.scope
+}
+
+func (project *Project) Children() []Operator {
+	return []Operator{project.child}
+}
+
+func (project *Project) String() string {
+	return fmt.Sprintf("project %v", formatExprs(project.exprs))
+}
+
+// Limit produces at most a given number of rows of its child.
+type Limit struct {
+	child Operator
+	limit int64
+	n     int64
+}
+
+// NewLimit returns a limit of the child's rows to the given number.
+func NewLimit(child Operator, limit int64) *Limit {
+	return &Limit{child: child, limit: limit}
+}
+
+func (limit *Limit) Open() error {
+	limit.n = 0
+	return limit.child.Open()
+}
+
+func (limit *Limit) Next() (db.Row, error) {
+	// Stop before asking the child for rows that won't be used.
+	if limit.n >= limit.limit {
+		return nil, nil
+	}
+	row, err := limit.child.Next()
+	if row != nil {
+		limit.n++
+	}
+	return row, err
+}
+
+func (limit *Limit) Close() error {
+	return limit.child.Close()
+}
+
+func (limit *Limit) Scope() *db.Scope {
+	return limit.child.Scope()
+}
+
+func (limit *Limit) Children() []Operator {
+	return []Operator{limit.child}
+}
+
+func (limit *Limit) String() string {
+	return fmt.Sprintf("limit %v", limit.limit)
+}
@@ -0,0 +1,95 @@
+package exec
+
+import (
+	"fmt"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// NestedLoopJoin pairs each row of its left child with each row of its right child that a
+// condition holds for, producing the left row followed by the right row. The right child
+// is reopened for every left row.
+type NestedLoopJoin struct {
+	left      Operator
+	right     Operator
+	expr      sql.Expr
+	condition func(db.Row) (bool, error)
+	scope     *db.Scope
+	leftRow   db.Row // The left row being paired, or nil before the first.
+	rightOpen bool
+}
+
+// NewNestedLoopJoin returns a join of two children on a condition over their joined rows;
+// a nil condition pairs every row with every row.
+func NewNestedLoopJoin(left Operator, right Operator, condition sql.Expr) (*NestedLoopJoin, error) {
+	scope := left.Scope().Join(right.Scope())
+	compiled, err := scope.CompileCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	return &NestedLoopJoin{left: left, right: right, expr: condition, condition: compiled, scope: scope}, nil
+}
+
+func (join *NestedLoopJoin) Open() error {
+	join.leftRow = nil
+	return join.left.Open()
+}
+
+func (join *NestedLoopJoin) Next() (db.Row, error) {
+	for {
+		if join.leftRow == nil {
+			row, err := join.left.Next()
+			if err != nil || row == nil {
+				return nil, err
+			}
+			if join.rightOpen {
+				if err = join.right.Close(); err != nil {
+					return nil, err
+				}
+			}
+			if err = join.right.Open(); err != nil {
+				return nil, err
+			}
+			join.leftRow, join.rightOpen = row, true
+		}
+		rightRow, err := join.right.Next()
+		if err != nil {
+			return nil, err
+		}
+		if rightRow == nil {
+			join.leftRow = nil
+			continue
+		}
+		row := append(append(make(db.Row, 0, len(join.leftRow)+len(rightRow)), join.leftRow...), rightRow...)
+		if ok, err := join.condition(row); err != nil || ok {
+			return row, err
+		}
+	}
+}
+
+func (join *NestedLoopJoin) Close() error {
+	if join.rightOpen {
+		join.rightOpen = false
+		if err := join.right.Close(); err != nil {
+			join.left.Close()
+			return err
+		}
+	}
+	return join.left.Close()
+}
+
+func (join *NestedLoopJoin) Scope() *db.Scope {
+	return join.scope
+}
+
+func (join *NestedLoopJoin) Children() []Operator {
+	return []Operator{join.left, join.right}
+}
+
+func (join *NestedLoopJoin) String() string {
+	if join.expr == nil {
+		return "nested loop join"
+	}
+	return fmt.Sprintf("nested loop join on %v", join.expr)
+}
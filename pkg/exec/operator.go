@@ -0,0 +1,86 @@
+// Package exec runs queries as trees of operators. Each operator pulls rows from its
+// children one at a time, so rows stream through a plan without being collected unless an
+// operator, like a sort, needs to see all of them.
+package exec
+
+import (
+	"fmt"
+	"strings"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// An Operator produces rows. Open must be called before Next, and Close after; an operator
+// can be opened again after it is closed to produce its rows again.
+type Operator interface {
+	Open() error
+	Next() (db.Row, error) // Returns a nil row once every row has been produced.
+	Close() error
+	Scope() *db.Scope     // Names the columns of the rows produced.
+	Children() []Operator // The operators it reads rows from.
+	String() string       // Describes the operator in a plan.
+}
+
+// Run opens an operator and passes each of its rows to emit, then closes it.
+func Run(op Operator, emit func(db.Row) error) (err error) {
+	if err = op.Open(); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := op.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	for {
+		row, err := op.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		if err = emit(row); err != nil {
+			return err
+		}
+	}
+}
+
+// Collect runs an operator, returning all of its rows.
+func Collect(op Operator) ([]db.Row, error) {
+	rows := make([]db.Row, 0)
+	err := Run(op, func(row db.Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// formatExprs formats a list of expressions as they are written.
+func formatExprs(exprs []sql.Expr) string {
+	formatted := make([]string, len(exprs))
+	for i, expr := range exprs {
+		formatted[i] = expr.String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// FormatOrder formats the items of an order by clause as they are written.
+func FormatOrder(orderBy []sql.OrderItem) string {
+	formatted := make([]string, len(orderBy))
+	for i, item := range orderBy {
+		formatted[i] = item.Expr.String()
+		if item.Desc {
+			formatted[i] += " desc"
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// formatEstimate formats an estimated number of rows, or nothing if it is unknown.
+func formatEstimate(rows int64) string {
+	if rows < 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (est. %v rows)", rows)
+}
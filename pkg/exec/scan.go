@@ -0,0 +1,115 @@
+package exec
+
+import (
+	"errors"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// pathReader reads the rows of a table along an access path.
+type pathReader struct {
+	d      *db.Database
+	path   *db.AccessPath
+	desc   bool
+	schema *db.Schema
+	scope  *db.Scope
+	cursor utils.Cursor
+}
+
+func newPathReader(d *db.Database, path *db.AccessPath, desc bool) (pathReader, error) {
+	if _, err := d.GetTable(path.Table); err != nil {
+		return pathReader{}, err
+	}
+	schema := d.GetSchema(path.Table)
+	return pathReader{d: d, path: path, desc: desc, schema: schema, scope: db.TableScope(path.Table, schema)}, nil
+}
+
+func (reader *pathReader) Open() (err error) {
+	reader.cursor, err = reader.d.OpenAccessPath(reader.path, reader.desc)
+	return err
+}
+
+func (reader *pathReader) Next() (db.Row, error) {
+	if reader.cursor == nil {
+		return nil, errors.New("operator is not open")
+	}
+	if reader.cursor.IsEnd() {
+		return nil, nil
+	}
+	entry, err := reader.cursor.GetEntry()
+	if err != nil {
+		return nil, err
+	}
+	reader.cursor.StepForward()
+	return db.EntryRow(reader.schema, entry)
+}
+
+func (reader *pathReader) Close() error {
+	reader.cursor = nil
+	return nil
+}
+
+func (reader *pathReader) Scope() *db.Scope {
+	return reader.scope
+}
+
+func (reader *pathReader) Children() []Operator {
+	return nil
+}
+
+func (reader *pathReader) String() string {
+	if reader.desc && reader.path.Ordered() {
+		return reader.path.String() + " desc" + formatEstimate(reader.path.Rows)
+	}
+	return reader.path.String() + formatEstimate(reader.path.Rows)
+}
+
+// Path returns the access path the operator reads.
+func (reader *pathReader) Path() *db.AccessPath {
+	return reader.path
+}
+
+// Scan reads every row of a table, or those in a range of a btree table's keys, in key
+// order, or descending key order if desc is set, unless the table is a hash table.
+type Scan struct {
+	pathReader
+}
+
+// NewScan returns a scan along a full or range scan access path.
+func NewScan(d *db.Database, path *db.AccessPath, desc bool) (*Scan, error) {
+	if path.Kind != db.FullScan && path.Kind != db.RangeScan {
+		return nil, errors.New("a scan needs a full or range scan access path")
+	}
+	reader, err := newPathReader(d, path, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &Scan{pathReader: reader}, nil
+}
+
+// IndexSeek reads the rows of a table under one key, or holding one value in a column with
+// a secondary index, in key order, or descending key order if desc is set.
+type IndexSeek struct {
+	pathReader
+}
+
+// NewIndexSeek returns a seek along a key or index seek access path.
+func NewIndexSeek(d *db.Database, path *db.AccessPath, desc bool) (*IndexSeek, error) {
+	if path.Kind != db.KeySeek && path.Kind != db.IndexSeek {
+		return nil, errors.New("an index seek needs a key or index seek access path")
+	}
+	reader, err := newPathReader(d, path, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexSeek{pathReader: reader}, nil
+}
+
+// NewAccessPath returns the scan or index seek that reads along an access path.
+func NewAccessPath(d *db.Database, path *db.AccessPath, desc bool) (Operator, error) {
+	if path.Kind == db.KeySeek || path.Kind == db.IndexSeek {
+		return NewIndexSeek(d, path, desc)
+	}
+	return NewScan(d, path, desc)
+}
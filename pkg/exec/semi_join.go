@@ -0,0 +1,102 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// SemiJoin produces the rows of its child whose value of an expression is among the values
+// of its subquery, which produces rows of one column, or for an anti join, those whose value
+// is not. The subquery is run and its values hashed in memory when the join is opened. As
+// in SQL, a null is never among values, and no value is known not to be among values that
+// include a null.
+type SemiJoin struct {
+	child    Operator
+	subquery Operator
+	expr     sql.Expr
+	value    db.Evaluator
+	anti     bool
+	values   map[db.Value]bool // The subquery's values, numbers that are equal under the same key.
+	hasNull  bool              // Whether the subquery produced a null.
+}
+
+// NewSemiJoin returns a semi join of the child's rows with the subquery's, or an anti join
+// if anti is set.
+func NewSemiJoin(child Operator, expr sql.Expr, subquery Operator, anti bool) (*SemiJoin, error) {
+	if len(subquery.Scope().Columns) != 1 {
+		return nil, errors.New("a subquery must select one column")
+	}
+	value, err := child.Scope().Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &SemiJoin{child: child, subquery: subquery, expr: expr, value: value, anti: anti}, nil
+}
+
+// semiJoinKey returns the key a value is hashed under: ints and floats that are equal
+// share one.
+func semiJoinKey(value db.Value) db.Value {
+	if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return int64(f)
+	}
+	return value
+}
+
+func (join *SemiJoin) Open() error {
+	join.values, join.hasNull = make(map[db.Value]bool), false
+	err := Run(join.subquery, func(row db.Row) error {
+		if row[0] == nil {
+			join.hasNull = true
+		} else {
+			join.values[semiJoinKey(row[0])] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return join.child.Open()
+}
+
+func (join *SemiJoin) Next() (db.Row, error) {
+	for {
+		row, err := join.child.Next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+		value, err := join.value(row)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		if found := join.values[semiJoinKey(value)]; found != join.anti && (found || !join.hasNull) {
+			return row, nil
+		}
+	}
+}
+
+func (join *SemiJoin) Close() error {
+	join.values = nil
+	return join.child.Close()
+}
+
+func (join *SemiJoin) Scope() *db.Scope {
+	return join.child.Scope()
+}
+
+func (join *SemiJoin) Children() []Operator {
+	return []Operator{join.child, join.subquery}
+}
+
+func (join *SemiJoin) String() string {
+	if join.anti {
+		return fmt.Sprintf("hash anti join on %v", join.expr)
+	}
+	return fmt.Sprintf("hash semi join on %v", join.expr)
+}
@@ -0,0 +1,179 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+var SORT_FRAMES int64 = 8 // Pages of rows a sort holds in memory, and runs it merges through them
+
+// Sort produces the rows of its child ordered by a list of expressions, keeping rows that
+// tie in the order the child produced them. When opened, it sorts the child's rows with an
+// external merge sort: rows are held in memory until they would fill SORT_FRAMES pages, then
+// spilled as a sorted run, and runs are merged SORT_FRAMES-1 at a time, one page left for
+// the merged run, until SORT_FRAMES or fewer are left, which are merged as the rows are
+// produced. Rows that fit in memory are never spilled.
+type Sort struct {
+	child   Operator
+	orderBy []sql.OrderItem
+	keys    []db.Evaluator
+	desc    []bool
+	sorter  *db.ExternalSorter
+	stats   db.SortStats // The work the sort did when last opened.
+}
+
+// A keyedRow is a row with the values it is sorted by.
+type keyedRow struct {
+	row  db.Row
+	keys []db.Value
+}
+
+// NewSort returns a sort of the child's rows.
+func NewSort(child Operator, orderBy []sql.OrderItem) (*Sort, error) {
+	sorter := &Sort{child: child, orderBy: orderBy, keys: make([]db.Evaluator, len(orderBy)), desc: make([]bool, len(orderBy))}
+	for i, item := range orderBy {
+		var err error
+		if sorter.keys[i], err = child.Scope().Compile(item.Expr); err != nil {
+			return nil, err
+		}
+		sorter.desc[i] = item.Desc
+	}
+	return sorter, nil
+}
+
+// keyed evaluates the values a row is sorted by.
+func (sorter *Sort) keyed(row db.Row) (keyedRow, error) {
+	keys := make([]db.Value, len(sorter.keys))
+	for i, key := range sorter.keys {
+		var err error
+		if keys[i], err = key(row); err != nil {
+			return keyedRow{}, err
+		}
+	}
+	return keyedRow{row: row, keys: keys}, nil
+}
+
+// rowCodec orders a sort's keyed rows, and spills the rows without their keys.
+type rowCodec struct {
+	sorter *Sort
+}
+
+func (codec rowCodec) Compare(a interface{}, b interface{}) (int, error) {
+	return CompareKeys(a.(keyedRow).keys, b.(keyedRow).keys, codec.sorter.desc)
+}
+
+func (codec rowCodec) Encode(record interface{}) ([]byte, error) {
+	return db.AppendRow(nil, record.(keyedRow).row)
+}
+
+func (codec rowCodec) Decode(data []byte) (interface{}, error) {
+	row, _, err := db.ReadRow(data)
+	if err != nil {
+		return nil, err
+	}
+	return codec.sorter.keyed(row)
+}
+
+func (sorter *Sort) Open() (err error) {
+	if SORT_FRAMES < 3 {
+		return errors.New("a sort needs at least 3 frames")
+	}
+	if err = sorter.child.Open(); err != nil {
+		return err
+	}
+	if sorter.sorter != nil {
+		sorter.sorter.Close()
+	}
+	pageCapacity := pager.PAGESIZE - pager.PAGE_HEADER_SIZE
+	sorter.sorter = db.NewExternalSorter(rowCodec{sorter}, db.SortOptions{Bytes: SORT_FRAMES * pageCapacity, FanIn: int(SORT_FRAMES) - 1})
+	defer func() {
+		sorter.stats = sorter.sorter.Stats()
+		if err != nil {
+			sorter.sorter.Close()
+		}
+	}()
+	for {
+		row, err := sorter.child.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		keyed, err := sorter.keyed(row)
+		if err != nil {
+			return err
+		}
+		if err = sorter.sorter.Add(keyed); err != nil {
+			return err
+		}
+	}
+	return sorter.sorter.Sort()
+}
+
+// CompareKeys compares two lists of values in order, each descending if desc says so.
+func CompareKeys(a []db.Value, b []db.Value, desc []bool) (int, error) {
+	for i := range a {
+		cmp, err := db.CompareValues(a[i], b[i])
+		if err != nil {
+			return 0, err
+		}
+		if cmp != 0 {
+			if desc[i] {
+				return -cmp, nil
+			}
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+func (sorter *Sort) Next() (db.Row, error) {
+	if sorter.sorter == nil {
+		return nil, nil
+	}
+	record, err := sorter.sorter.Next()
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return record.(keyedRow).row, nil
+}
+
+func (sorter *Sort) Close() error {
+	if sorter.sorter != nil {
+		sorter.sorter.Close()
+		sorter.sorter = nil
+	}
+	return sorter.child.Close()
+}
+
+func (sorter *Sort) Scope() *db.Scope {
+	return sorter.child.Scope()
+}
+
+func (sorter *Sort) Children() []Operator {
+	return []Operator{sorter.child}
+}
+
+func (sorter *Sort) String() string {
+	if sorter.stats.Runs == 0 {
+		return fmt.Sprintf("external sort by %v", FormatOrder(sorter.orderBy))
+	}
+	return fmt.Sprintf("external sort by %v (runs=%v passes=%v run pages=%v)", FormatOrder(sorter.orderBy), sorter.stats.Runs, sorter.stats.Passes, (sorter.stats.Bytes+pager.PAGESIZE-1)/pager.PAGESIZE)
+}
+
+// Runs returns the number of runs spilled when the sort was last opened, or 0 if the rows fit
+// in memory.
+func (sorter *Sort) Runs() int64 {
+	return sorter.stats.Runs
+}
+
+// Passes returns the number of merge passes made over runs when the sort was last opened,
+// counting the merge as the rows are produced.
+func (sorter *Sort) Passes() int64 {
+	return sorter.stats.Passes
+}
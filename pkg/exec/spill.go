@@ -0,0 +1,39 @@
+package exec
+
+import (
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+)
+
+// A spillFile holds rows an operator can't keep in memory, in a db.SpillFile. Rows are
+// written, then the file is rewound and they are read back in the order they were written.
+type spillFile struct {
+	*db.SpillFile
+}
+
+// newSpillFile creates an empty spill file.
+func newSpillFile() (*spillFile, error) {
+	file, err := db.NewSpillFile()
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{file}, nil
+}
+
+// write appends a row to the file.
+func (spill *spillFile) write(row db.Row) error {
+	data, err := db.AppendRow(nil, row)
+	if err != nil {
+		return err
+	}
+	return spill.Write(data)
+}
+
+// read returns the next row, or nil once every row has been read.
+func (spill *spillFile) read() (db.Row, error) {
+	data, err := spill.Read()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	row, _, err := db.ReadRow(data)
+	return row, err
+}
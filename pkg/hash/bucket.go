@@ -50,26 +50,44 @@ func (bucket *HashBucket) Find(key int64) (utils.Entry, bool) {
 
 // Inserts the given key-value pair, splits if necessary.
 func (bucket *HashBucket) Insert(key int64, value int64) (bool, error) {
-	bucket.modifyEntry(bucket.numKeys, HashEntry{key, value})
+	return bucket.insert(HashEntry{key: key, value: value})
+}
+
+// insert adds the given entry, returning whether the bucket needs to split.
+func (bucket *HashBucket) insert(entry HashEntry) (bool, error) {
+	bucket.modifyEntry(bucket.numKeys, entry)
 	bucket.updateNumKeys(bucket.numKeys + 1)
-	return bucket.numKeys >= BUCKETSIZE, nil
+	return bucket.numKeys >= bucket.maxKeys(), nil
 	// panic("function not yet implemented")
 }
 
 // Update the given key-value pair, should never split.
 // Find the bucket we want based on key, then update the entry using updateValueAt.
 func (bucket *HashBucket) Update(key int64, value int64) error {
+	_, err := bucket.update(HashEntry{key: key, value: value})
+	return err
+}
+
+// update overwrites the entry with the given entry's key, returning the entry it replaced.
+func (bucket *HashBucket) update(entry HashEntry) (HashEntry, error) {
 	for i := int64(0); i < bucket.numKeys; i++ {
-		if bucket.getKeyAt(i) == key {
-			bucket.updateValueAt(i, value)
-			return nil
+		if bucket.getKeyAt(i) == entry.key {
+			replaced := bucket.getEntry(i)
+			bucket.modifyEntry(i, entry)
+			return replaced, nil
 		}
 	}
-	return errors.New("key not found, update aborted")
+	return HashEntry{}, errors.New("key not found, update aborted")
 }
 
 // Delete the given key-value pair, does not coalesce.
 func (bucket *HashBucket) Delete(key int64) error {
+	_, err := bucket.remove(key)
+	return err
+}
+
+// remove deletes the given key-value pair, returning it, and does not coalesce.
+func (bucket *HashBucket) remove(key int64) (HashEntry, error) {
 	index := int64(-1)
 	for i := int64(0); i < bucket.numKeys; i++ {
 		if bucket.getKeyAt(i) == key {
@@ -78,14 +96,15 @@ func (bucket *HashBucket) Delete(key int64) error {
 		}
 	}
 	if index == -1 {
-		return errors.New("key not found, delete aborted")
+		return HashEntry{}, errors.New("key not found, delete aborted")
 	}
+	removed := bucket.getEntry(index)
 	// Move all other keys left by one.
 	for i := index; i < bucket.numKeys; i++ {
 		bucket.modifyEntry(i, bucket.getEntry(i+1))
 	}
 	bucket.updateNumKeys(bucket.numKeys - 1)
-	return nil
+	return removed, nil
 }
 
 // Select all entries in this bucket.
@@ -71,5 +71,5 @@ func (cursor *HashCursor) GetEntry() (utils.Entry, error) {
 		return HashEntry{}, errors.New("getEntry: entry is non-existent")
 	}
 	entry := cursor.curBucket.getEntry(cursor.cellnum)
-	return entry, nil
+	return cursor.table.resolve(entry)
 }
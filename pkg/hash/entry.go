@@ -7,9 +7,11 @@ import (
 )
 
 // HashEntry is a single entry in a hashtable. Implements utils.Entry.
+// If ref is set, value is a reference to a byte-slice value in the table's values file.
 type HashEntry struct {
 	key   int64
 	value int64
+	ref   bool
 }
 
 // Get key.
@@ -43,15 +45,21 @@ func (entry HashEntry) Marshal() []byte {
 	bin = make([]byte, binary.MaxVarintLen64)
 	binary.PutVarint(bin, entry.GetValue())
 	newdata = append(newdata, bin...)
+	// Marshall the reference flag.
+	if entry.ref {
+		newdata = append(newdata, 1)
+	} else {
+		newdata = append(newdata, 0)
+	}
 	// Return the combined byte array.
 	return newdata
 }
 
 // unmarshalEntry deserializes a byte array into an entry.
 func unmarshalEntry(data []byte) (entry HashEntry) {
-	k, _ := binary.Varint(data[:len(data)/2])
-	v, _ := binary.Varint(data[len(data)/2:])
-	return HashEntry{key: k, value: v}
+	k, _ := binary.Varint(data[:binary.MaxVarintLen64])
+	v, _ := binary.Varint(data[binary.MaxVarintLen64 : 2*binary.MaxVarintLen64])
+	return HashEntry{key: k, value: v, ref: data[2*binary.MaxVarintLen64] == 1}
 }
 
 // Print this entry.
@@ -3,20 +3,35 @@ package hash
 import (
 	"io"
 
+	heap "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/heap"
 	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
 	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 )
 
 // HashIndex is an index that uses a HashTable as its datastructure. Implements db.Index.
 type HashIndex struct {
-	table *HashTable
-	pager *pager.Pager
+	table  *HashTable
+	pager  *pager.Pager
+	values *heap.Values // Holds the byte-slice values of the table.
 }
 
 // Opens the pager with the given table name.
 func OpenTable(filename string) (*HashIndex, error) {
+	return OpenTableWithOptions(filename, pager.DefaultOptions())
+}
+
+// Opens the pager with the given table name, sized by the given options.
+func OpenTableWithOptions(filename string, options pager.Options) (*HashIndex, error) {
 	// Create a pager for the table.
-	pager := pager.NewPager()
+	pager, err := pager.NewPagerWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return OpenTableWithPager(filename, pager)
+}
+
+// Opens the table with the given name through the given, not yet opened, pager.
+func OpenTableWithPager(filename string, pager *pager.Pager) (*HashIndex, error) {
 	err := pager.Open(filename)
 	if err != nil {
 		return nil, err
@@ -31,7 +46,7 @@ func OpenTable(filename string) (*HashIndex, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &HashIndex{table: table, pager: pager}, nil
+	return &HashIndex{table: table, pager: pager, values: heap.NewValues(pager)}, nil
 }
 
 // Get name.
@@ -44,6 +59,11 @@ func (table *HashIndex) GetPager() *pager.Pager {
 	return table.pager
 }
 
+// Get values file.
+func (index *HashIndex) GetValues() *heap.Values {
+	return index.values
+}
+
 // Get table.
 func (index *HashIndex) GetTable() *HashTable {
 	return index.table
@@ -51,12 +71,33 @@ func (index *HashIndex) GetTable() *HashTable {
 
 // Closes the table by closing the pager.
 func (index *HashIndex) Close() error {
-	return WriteHashTable(index.pager, index.table)
+	err := WriteHashTable(index.pager, index.table)
+	if valuesErr := index.values.Close(); err == nil {
+		err = valuesErr
+	}
+	return err
 }
 
 // Find element by key.
 func (index *HashIndex) Find(key int64) (utils.Entry, error) {
-	return index.table.Find(key)
+	entry, err := index.table.Find(key)
+	if err != nil {
+		return nil, err
+	}
+	return index.resolve(entry)
+}
+
+// resolve returns the given entry, with its value read in if it is a reference to a byte slice.
+func (index *HashIndex) resolve(entry utils.Entry) (utils.Entry, error) {
+	hashEntry, ok := entry.(HashEntry)
+	if !ok || !hashEntry.ref {
+		return entry, nil
+	}
+	value, err := index.values.Get(hashEntry.value)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewBytesEntry(hashEntry.key, value), nil
 }
 
 // Insert given element.
@@ -64,19 +105,133 @@ func (index *HashIndex) Insert(key int64, value int64) error {
 	return index.table.Insert(key, value)
 }
 
+// Insert given element with a byte-slice value.
+func (index *HashIndex) InsertBytes(key int64, value []byte) error {
+	ref, err := index.values.Put(value)
+	if err != nil {
+		return err
+	}
+	if err := index.table.insert(HashEntry{key: key, value: ref, ref: true}); err != nil {
+		index.values.Delete(ref)
+		return err
+	}
+	return nil
+}
+
 // Update given element.
 func (index *HashIndex) Update(key int64, value int64) error {
-	return index.table.Update(key, value)
+	return index.update(HashEntry{key: key, value: value})
 }
 
-// Delete given element.
+// Update given element to hold a byte-slice value.
+func (index *HashIndex) UpdateBytes(key int64, value []byte) error {
+	ref, err := index.values.Put(value)
+	if err != nil {
+		return err
+	}
+	if err := index.update(HashEntry{key: key, value: ref, ref: true}); err != nil {
+		index.values.Delete(ref)
+		return err
+	}
+	return nil
+}
+
+// update overwrites the given entry, freeing the byte-slice value it replaces. The entry
+// replaced is found under the same bucket lock that overwrites it, so no other update or
+// delete can free its value too.
+func (index *HashIndex) update(entry HashEntry) error {
+	replaced, err := index.table.update(entry)
+	if err != nil {
+		return err
+	}
+	return index.free(replaced)
+}
+
+// Delete given element, along with its byte-slice value.
 func (index *HashIndex) Delete(key int64) error {
-	return index.table.Delete(key)
+	removed, err := index.table.remove(key)
+	if err != nil {
+		return err
+	}
+	return index.free(removed)
+}
+
+// free gives back the byte-slice value of an entry that has been overwritten or removed.
+func (index *HashIndex) free(entry HashEntry) error {
+	if entry.ref {
+		return index.values.Delete(entry.value)
+	}
+	return nil
 }
 
 // Select all elements.
 func (index *HashIndex) Select() ([]utils.Entry, error) {
-	return index.table.Select()
+	entries, err := index.table.Select()
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if entries[i], err = index.resolve(entry); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Compact the table's file and its values file.
+func (index *HashIndex) Vacuum() (int64, error) {
+	reclaimed, err := index.vacuumValues()
+	if err != nil {
+		return 0, err
+	}
+	n, err := index.table.Vacuum()
+	return reclaimed + n, err
+}
+
+// entryRef locates an entry within a bucket.
+type entryRef struct {
+	bucketPN int64 // Page number of the bucket.
+	index    int64 // Position of the entry in the bucket.
+}
+
+// vacuumValues compacts the values file, repointing the entries that reference each moved
+// page of values.
+func (index *HashIndex) vacuumValues() (int64, error) {
+	table := index.table
+	table.WLock()
+	defer table.WUnlock()
+	// Find every entry referencing a page of values.
+	refs := make(map[int64][]entryRef)
+	seen := make(map[int64]bool)
+	for _, pn := range table.buckets {
+		if seen[pn] {
+			continue
+		}
+		seen[pn] = true
+		bucket, err := table.GetBucketByPN(pn)
+		if err != nil {
+			return 0, err
+		}
+		for i := int64(0); i < bucket.numKeys; i++ {
+			if entry := bucket.getEntry(i); entry.ref {
+				valuesPN := heap.RefPage(entry.value)
+				refs[valuesPN] = append(refs[valuesPN], entryRef{pn, i})
+			}
+		}
+		bucket.page.Put()
+	}
+	return index.values.Vacuum(func(from int64, to int64) error {
+		for _, ref := range refs[from] {
+			bucket, err := table.GetBucketByPN(ref.bucketPN)
+			if err != nil {
+				return err
+			}
+			entry := bucket.getEntry(ref.index)
+			bucket.modifyEntry(ref.index, HashEntry{key: entry.key, value: heap.MoveRef(entry.value, to), ref: true})
+			bucket.page.Put()
+		}
+		return nil
+	})
 }
 
 // Print all elements.
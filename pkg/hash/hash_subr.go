@@ -10,15 +10,25 @@ import (
 
 // Hash table variables
 var ROOT_PN int64 = 0
-var PAGESIZE int64 = pager.PAGESIZE
 var DIRECTORY_HEADER_SIZE int64 = binary.MaxVarintLen64 * 2 // Must store global depth and next pointer
 var DEPTH_OFFSET int64 = 0
 var DEPTH_SIZE int64 = binary.MaxVarintLen64
 var NUM_KEYS_OFFSET int64 = DEPTH_OFFSET + DEPTH_SIZE
 var NUM_KEYS_SIZE int64 = binary.MaxVarintLen64
 var BUCKET_HEADER_SIZE int64 = DEPTH_SIZE + NUM_KEYS_SIZE
-var ENTRYSIZE int64 = binary.MaxVarintLen64 * 2                    // int64 key, int64 value
-var BUCKETSIZE int64 = (PAGESIZE-BUCKET_HEADER_SIZE)/ENTRYSIZE - 1 // num entries
+var ENTRYSIZE int64 = binary.MaxVarintLen64*2 + 1 // int64 key, int64 value, reference flag
+var META_FRAMES int64 = 4                         // Frames used to read and write the .meta file
+var MIN_DEPTH int64 = 2                           // Global depth of a new table; the directory never shrinks below it
+
+// BucketSize returns the number of entries a bucket holds for the given page size.
+func BucketSize(pageSize int64) int64 {
+	return (pageSize-BUCKET_HEADER_SIZE)/ENTRYSIZE - 1
+}
+
+// metaOptions returns the options for the pager over a bucket pager's .meta file.
+func metaOptions(bucketPager *pager.Pager) pager.Options {
+	return pager.Options{NumFrames: META_FRAMES, PageSize: bucketPager.GetPageSize()}
+}
 
 // Lock Types
 type BucketLockType int
@@ -50,6 +60,13 @@ func MurmurHasher(key int64, size int64) uint {
 	return getHash(murmur3.Sum64, key, size)
 }
 
+// SeededHasher returns the MurmurHash3 hash of the given key under the given seed, bounded by
+// size. Keys that share a hash under one seed are spread apart by another; seed 0 is
+// MurmurHasher.
+func SeededHasher(key int64, seed uint32, size int64) uint {
+	return getHash(func(b []byte) uint64 { return murmur3.Sum64WithSeed(b, seed) }, key, size)
+}
+
 // Hasher returns the hash of a key, modded by 2^depth.
 func Hasher(key int64, depth int64) int64 {
 	return int64(XxHasher(key, powInt(2, depth)))
@@ -60,6 +77,16 @@ func entryPos(index int64) int64 {
 	return BUCKET_HEADER_SIZE + index*ENTRYSIZE
 }
 
+// Get the number of entries this bucket can hold.
+func (bucket *HashBucket) maxKeys() int64 {
+	return BucketSize(int64(len(*bucket.page.GetData())))
+}
+
+// Get the number of entries at or under which a bucket may be coalesced with its split image.
+func (bucket *HashBucket) coalesceThreshold() int64 {
+	return bucket.maxKeys() / 4
+}
+
 // Write the given entry into the given index.
 func (bucket *HashBucket) modifyEntry(index int64, entry HashEntry) {
 	newdata := entry.Marshal()
@@ -175,8 +202,11 @@ func (table *HashTable) GetAndLockBucket(hash int64, lock BucketLockType) (*Hash
 
 // Read hash table in from memory.
 func ReadHashTable(bucketPager *pager.Pager) (*HashTable, error) {
-	indexPager := pager.NewPager()
-	err := indexPager.Open(bucketPager.GetFileName() + ".meta")
+	indexPager, err := pager.NewPagerWithOptions(metaOptions(bucketPager))
+	if err != nil {
+		return nil, err
+	}
+	err = indexPager.Open(bucketPager.GetFilePath() + ".meta")
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +223,7 @@ func ReadHashTable(bucketPager *pager.Pager) (*HashTable, error) {
 	numHashes := powInt(2, depth)
 	buckets := make([]int64, numHashes)
 	for i := int64(0); i < numHashes; i++ {
-		if bytesRead+pnSize > PAGESIZE {
+		if bytesRead+pnSize > int64(len(*page.GetData())) {
 			page.Put()
 			metaPN++
 			page, err = indexPager.GetPage(metaPN)
@@ -214,12 +244,16 @@ func ReadHashTable(bucketPager *pager.Pager) (*HashTable, error) {
 // Write hash table out to memory.
 func WriteHashTable(bucketPager *pager.Pager, table *HashTable) error {
 	if bucketPager.HasFile() {
-		indexPager := pager.NewPager()
-		err := indexPager.Open(bucketPager.GetFileName() + ".meta")
+		indexPager, err := pager.NewPagerWithOptions(metaOptions(bucketPager))
+		if err != nil {
+			return err
+		}
+		err = indexPager.Open(bucketPager.GetFilePath() + ".meta")
 		if err != nil {
 			return err
 		}
-		metaPN := indexPager.GetFreePN()
+		// Overwrite the directory from the start of the file; it may have shrunk.
+		metaPN := int64(0)
 		page, err := indexPager.GetPage(metaPN)
 		if err != nil {
 			return err
@@ -234,9 +268,9 @@ func WriteHashTable(bucketPager *pager.Pager, table *HashTable) error {
 		pnSize := int64(binary.MaxVarintLen64)
 		pnData := make([]byte, pnSize)
 		for _, pn := range table.buckets {
-			if bytesWritten+pnSize > PAGESIZE {
+			if bytesWritten+pnSize > int64(len(*page.GetData())) {
 				page.Put()
-				metaPN = indexPager.GetFreePN()
+				metaPN++
 				page, err = indexPager.GetPage(metaPN)
 				if err != nil {
 					return err
@@ -0,0 +1,32 @@
+package hash
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// ReadLegacyEntries reads the entries of a hash table written before pages had headers,
+// from each bucket in file order. Every page of such a table is a bucket, so its directory
+// isn't needed.
+func ReadLegacyEntries(path string) ([]utils.Entry, error) {
+	entrySize := int64(2 * binary.MaxVarintLen64) // Legacy entries had no reference flag.
+	maxKeys := (pager.LEGACY_PAGESIZE - BUCKET_HEADER_SIZE) / entrySize
+	entries := make([]utils.Entry, 0)
+	err := pager.ReadLegacyPages(path, func(pagenum int64, data []byte) error {
+		numKeys, n := binary.Varint(data[NUM_KEYS_OFFSET : NUM_KEYS_OFFSET+NUM_KEYS_SIZE])
+		if n <= 0 || numKeys < 0 || numKeys > maxKeys {
+			return fmt.Errorf("page %v of %v is not a legacy hash bucket", pagenum, path)
+		}
+		for i := int64(0); i < numKeys; i++ {
+			pos := BUCKET_HEADER_SIZE + i*entrySize
+			key, _ := binary.Varint(data[pos : pos+binary.MaxVarintLen64])
+			value, _ := binary.Varint(data[pos+binary.MaxVarintLen64 : pos+entrySize])
+			entries = append(entries, HashEntry{key: key, value: value})
+		}
+		return nil
+	})
+	return entries, err
+}
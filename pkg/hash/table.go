@@ -1,7 +1,6 @@
 package hash
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -21,7 +20,7 @@ type HashTable struct {
 
 // Returns a new HashTable.
 func NewHashTable(pager *pager.Pager) (*HashTable, error) {
-	depth := int64(2)
+	depth := MIN_DEPTH
 	buckets := make([]int64, powInt(2, depth))
 	for i := range buckets {
 		bucket, err := NewHashBucket(pager, depth)
@@ -76,7 +75,7 @@ func (table *HashTable) Find(key int64) (utils.Entry, error) {
 	hash := Hasher(key, table.depth)
 	if hash < 0 || int(hash) >= len(table.buckets) {
 		table.RUnlock()
-		return nil, errors.New("not found")
+		return nil, utils.ErrNotFound
 	}
 	// Get the corresponding bucket.
 	bucket, err := table.GetAndLockBucket(hash, READ_LOCK)
@@ -91,7 +90,7 @@ func (table *HashTable) Find(key int64) (utils.Entry, error) {
 	entry, found := bucket.Find(key)
 	if !found {
 		bucket.RUnlock()
-		return nil, errors.New("not found")
+		return nil, utils.ErrNotFound
 	}
 	bucket.RUnlock()
 	return entry, nil
@@ -103,6 +102,21 @@ func (table *HashTable) ExtendTable() {
 	table.buckets = append(table.buckets, table.buckets...)
 }
 
+// ShrinkTable halves the directory while no bucket needs the full global depth.
+func (table *HashTable) ShrinkTable() {
+	for table.depth > MIN_DEPTH {
+		// Every bucket of a smaller local depth is pointed to from both halves.
+		half := powInt(2, table.depth-1)
+		for i := int64(0); i < half; i++ {
+			if table.buckets[i] != table.buckets[i+half] {
+				return
+			}
+		}
+		table.depth = table.depth - 1
+		table.buckets = table.buckets[:half]
+	}
+}
+
 // Split the given bucket into two, extending the table if necessary.
 func (table *HashTable) Split(bucket *HashBucket, hash int64) error { 
 	/* SOLUTION {{{ */
@@ -147,10 +161,10 @@ func (table *HashTable) Split(bucket *HashBucket, hash int64) error {
 		i += powInt(2, power)
 	}
 	// Check if recursive splitting is required
-	if oldNKeys >= BUCKETSIZE {
+	if oldNKeys >= bucket.maxKeys() {
 		return table.Split(bucket, oldHash)
 	}
-	if newNKeys >= BUCKETSIZE {
+	if newNKeys >= newBucket.maxKeys() {
 		return table.Split(newBucket, newHash)
 	}
 	return nil
@@ -160,6 +174,12 @@ func (table *HashTable) Split(bucket *HashBucket, hash int64) error {
 
 // Inserts the given key-value pair, splits if necessary.
 func (table *HashTable) Insert(key int64, value int64) error {  //+++++++++++++++++++++++++++++++++++++++++++++
+	return table.insert(HashEntry{key: key, value: value})
+}
+
+// insert adds the given entry, splitting if necessary.
+func (table *HashTable) insert(entry HashEntry) error {
+	key := entry.key
 	// We can either start by locking the lookup table with a write or read lock.
 	table.WLock()
 	/* SOLUTION {{{ */
@@ -174,14 +194,14 @@ func (table *HashTable) Insert(key int64, value int64) error {  //++++++++++++++
 		defer bucket.WUnlock()
 		defer bucket.page.Put()
 		// for insertion, if it is not full, then safe -> unlock
-		if bucket.numKeys < BUCKETSIZE - 1 {
+		if bucket.numKeys < bucket.maxKeys()-1 {
 			// safe, unlock now
 			table.WUnlock()
 		} else {
 			// not safe unlock before function return
 			//defer table.WUnlock()
 		}
-		split, err := bucket.Insert(key, value)
+		split, err := bucket.insert(entry)
 		if err != nil {
 			return err
 		}
@@ -197,34 +217,102 @@ func (table *HashTable) Insert(key int64, value int64) error {  //++++++++++++++
 
 // Update the given key-value pair.
 func (table *HashTable) Update(key int64, value int64) error {
+	_, err := table.update(HashEntry{key: key, value: value})
+	return err
+}
+
+// update overwrites the entry with the given entry's key, returning the entry it replaced.
+func (table *HashTable) update(entry HashEntry) (HashEntry, error) {
 	table.RLock()
-	hash := Hasher(key, table.depth)
+	hash := Hasher(entry.key, table.depth)
 	bucket, err := table.GetAndLockBucket(hash, WRITE_LOCK)
 	if err != nil {
 		table.RUnlock()
-		return err
+		return HashEntry{}, err
 	}
 	defer bucket.page.Put()
 	table.RUnlock()
 	defer bucket.WUnlock()
-	err2 := bucket.Update(key, value)
-	return err2
+	return bucket.update(entry)
 }
 
-// Delete the given key-value pair, does not coalesce.
+// Delete the given key-value pair, coalescing buckets if necessary.
 func (table *HashTable) Delete(key int64) error {
-	table.RLock()
+	_, err := table.remove(key)
+	return err
+}
+
+// remove deletes the given key-value pair, returning it, and coalesces buckets if necessary.
+func (table *HashTable) remove(key int64) (HashEntry, error) {
+	// Deleting may coalesce buckets, so lock the lookup table with a write lock.
+	table.WLock()
 	hash := Hasher(key, table.depth)
 	bucket, err := table.GetAndLockBucket(hash, WRITE_LOCK)
 	if err != nil {
-		table.RUnlock()
-		return err
+		table.WUnlock()
+		return HashEntry{}, err
 	}
 	defer bucket.page.Put()
-	table.RUnlock()
 	defer bucket.WUnlock()
-	err2 := bucket.Delete(key)
-	return err2
+	// If the bucket stays over the threshold, the directory won't change, so unlock now.
+	if bucket.depth <= MIN_DEPTH || bucket.numKeys-1 > bucket.coalesceThreshold() {
+		table.WUnlock()
+		return bucket.remove(key)
+	}
+	defer table.WUnlock()
+	removed, err := bucket.remove(key)
+	if err != nil {
+		return HashEntry{}, err
+	}
+	return removed, table.Coalesce(bucket, hash)
+}
+
+// Coalesce merges the given bucket with its split image while both are at or under the
+// threshold and share a local depth, then shrinks the directory if possible.
+// The table and the bucket should be write-locked by the caller.
+func (table *HashTable) Coalesce(bucket *HashBucket, hash int64) error {
+	// Buckets locked here, to be released once we are done.
+	images := make([]*HashBucket, 0)
+	defer func() {
+		for _, image := range images {
+			image.WUnlock()
+			image.page.Put()
+		}
+	}()
+	for bucket.depth > MIN_DEPTH && bucket.numKeys <= bucket.coalesceThreshold() {
+		// The split image differs from this bucket in the highest bit of its local depth.
+		imageHash := (hash % powInt(2, bucket.depth)) ^ powInt(2, bucket.depth-1)
+		image, err := table.GetAndLockBucket(imageHash, WRITE_LOCK)
+		if err != nil {
+			return err
+		}
+		images = append(images, image)
+		if image.depth != bucket.depth || image.numKeys > image.coalesceThreshold() {
+			break
+		}
+		// Keep the bucket on the lower page, so that page 0 is never given back.
+		survivor, victim := bucket, image
+		if image.page.GetPageNum() < bucket.page.GetPageNum() {
+			survivor, victim = image, bucket
+		}
+		// Move entries over to it.
+		for i := int64(0); i < victim.numKeys; i++ {
+			survivor.modifyEntry(survivor.numKeys+i, victim.getEntry(i))
+		}
+		survivor.updateNumKeys(survivor.numKeys + victim.numKeys)
+		survivor.updateDepth(survivor.depth - 1)
+		// Point both halves of the pair at the survivor.
+		for i := hash % powInt(2, survivor.depth); i < powInt(2, table.depth); {
+			table.buckets[i] = survivor.page.GetPageNum()
+			i += powInt(2, survivor.depth)
+		}
+		if err := table.pager.FreePage(victim.page.GetPageNum()); err != nil {
+			return err
+		}
+		bucket = survivor
+	}
+	table.ShrinkTable()
+	return nil
 }
 
 // Select all entries in this table.
@@ -254,6 +342,21 @@ func (table *HashTable) Select() ([]utils.Entry, error) { //++++++++++++++++++++
 	// panic("function not yet implemented")
 }
 
+// Vacuum compacts the table's file, moving buckets into free pages and truncating it.
+// Returns the number of pages reclaimed.
+func (table *HashTable) Vacuum() (int64, error) {
+	table.WLock()
+	defer table.WUnlock()
+	return table.pager.Vacuum(func(from int64, to int64) error {
+		for i, pn := range table.buckets {
+			if pn == from {
+				table.buckets[i] = to
+			}
+		}
+		return nil
+	})
+}
+
 // Print out each bucket.
 func (table *HashTable) Print(w io.Writer) {
 	table.RLock()
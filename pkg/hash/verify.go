@@ -6,26 +6,28 @@ func IsHash(index *HashIndex) (bool, error) {
 	for _, pn := range buckets {
 		// Get bucket
 		bucket, err := table.GetBucketByPN(pn)
-		d := bucket.GetDepth()
 		if err != nil {
 			return false, err
 		}
+		d := bucket.GetDepth()
 		// Get all entries
 		entries, err := bucket.Select()
+		bucket.GetPage().Put()
 		if err != nil {
-			//bucket.GetPage().Put()
 			return false, err
 		}
+		// Check that the local depth is in range.
+		if d > table.GetDepth() || d < 0 {
+			return false, nil
+		}
 		// Check that all entries should hash to this bucket.
 		for _, e := range entries {
 			key := e.GetKey()
 			hash := Hasher(key, d)
 			if pn != table.buckets[hash] {
-				//bucket.GetPage().Put()
 				return false, nil
 			}
 		}
-		//bucket.GetPage().Put()
 	}
 	return true, nil
 }
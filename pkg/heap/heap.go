@@ -0,0 +1,436 @@
+package heap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+)
+
+// A heap file stores byte-slice values on slotted data pages, and addresses each by a
+// reference packing its page number and slot number. Values too large for a quarter of a
+// page are kept on a chain of overflow pages instead, leaving a stub in their slot.
+
+// Page kinds.
+var DATA_PAGE byte = 1
+var OVERFLOW_PAGE byte = 2
+
+// Data page header constants.
+var KIND_OFFSET int64 = 0
+var KIND_SIZE int64 = 1
+var NUM_SLOTS_OFFSET int64 = KIND_OFFSET + KIND_SIZE
+var NUM_SLOTS_SIZE int64 = binary.MaxVarintLen32
+var FREE_END_OFFSET int64 = NUM_SLOTS_OFFSET + NUM_SLOTS_SIZE
+var FREE_END_SIZE int64 = binary.MaxVarintLen32
+var DATA_HEADER_SIZE int64 = KIND_SIZE + NUM_SLOTS_SIZE + FREE_END_SIZE
+
+// Slot constants. A slot holds the offset and length of its value within the page.
+var SLOT_OFFSET_SIZE int64 = binary.MaxVarintLen32
+var SLOT_LENGTH_SIZE int64 = binary.MaxVarintLen32
+var SLOT_SIZE int64 = SLOT_OFFSET_SIZE + SLOT_LENGTH_SIZE
+var DELETED_SLOT int64 = -1  // Length of a deleted slot.
+var OVERFLOW_SLOT int64 = -2 // Length of a slot holding an overflow stub.
+var STUB_SIZE int64 = binary.MaxVarintLen64 * 2
+
+// Overflow page header constants.
+var NEXT_PN_OFFSET int64 = KIND_OFFSET + KIND_SIZE
+var NEXT_PN_SIZE int64 = binary.MaxVarintLen64
+var CHUNK_SIZE_OFFSET int64 = NEXT_PN_OFFSET + NEXT_PN_SIZE
+var CHUNK_SIZE_SIZE int64 = binary.MaxVarintLen32
+var OVERFLOW_HEADER_SIZE int64 = KIND_SIZE + NEXT_PN_SIZE + CHUNK_SIZE_SIZE
+
+// HeapFile is a file of byte-slice values.
+type HeapFile struct {
+	pager   *pager.Pager // The page handler to read from files.
+	current int64        // Data page new values are placed on, or -1 if there is none.
+	mtx     sync.Mutex   // Serializes every operation on the file.
+}
+
+// OpenHeapFile returns the heap file with the given filename, read through the given, not yet opened, pager.
+func OpenHeapFile(filename string, pager *pager.Pager) (*HeapFile, error) {
+	err := pager.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	heap := &HeapFile{pager: pager, current: -1}
+	// Page 0 is always a data page, so that it is never freed as part of an overflow chain.
+	if pager.GetNumPages() == 0 {
+		page, err := heap.newDataPage()
+		if err != nil {
+			return nil, err
+		}
+		heap.current = page.GetPageNum()
+		page.Put()
+		return heap, nil
+	}
+	// Keep filling the last page if it holds values.
+	last := pager.GetNumPages() - 1
+	page, err := pager.GetPage(last)
+	if err != nil {
+		return nil, err
+	}
+	if (*page.GetData())[KIND_OFFSET] == DATA_PAGE {
+		heap.current = last
+	}
+	page.Put()
+	return heap, nil
+}
+
+// Get pager.
+func (heap *HeapFile) GetPager() *pager.Pager {
+	return heap.pager
+}
+
+// Close flushes all changes to disk.
+func (heap *HeapFile) Close() error {
+	return heap.pager.Close()
+}
+
+// MaxInlineSize returns the largest value kept on a data page for the given page size.
+func MaxInlineSize(pageSize int64) int64 {
+	return (pageSize - DATA_HEADER_SIZE) / 4
+}
+
+// Put stores a value, returning its reference.
+func (heap *HeapFile) Put(value []byte) (int64, error) {
+	heap.mtx.Lock()
+	defer heap.mtx.Unlock()
+	// Move large values out to overflow pages, storing a stub in their place.
+	length := int64(len(value))
+	if length > MaxInlineSize(heap.pageSize()) {
+		firstPN, err := heap.putOverflow(value)
+		if err != nil {
+			return 0, err
+		}
+		stub := make([]byte, STUB_SIZE)
+		binary.PutVarint(stub, firstPN)
+		binary.PutVarint(stub[binary.MaxVarintLen64:], length)
+		value, length = stub, OVERFLOW_SLOT
+	}
+	// Find a data page with room for the value and a slot.
+	var page *pager.Page
+	var err error
+	if heap.current >= 0 {
+		page, err = heap.pager.GetPage(heap.current)
+		if err != nil {
+			return 0, err
+		}
+		if freeSpace(page) < int64(len(value))+SLOT_SIZE {
+			page.Put()
+			page = nil
+		}
+	}
+	if page == nil {
+		page, err = heap.newDataPage()
+		if err != nil {
+			return 0, err
+		}
+		heap.current = page.GetPageNum()
+	}
+	defer page.Put()
+	// Write the value at the end of the free space, then its slot.
+	slot := getField(page, NUM_SLOTS_OFFSET)
+	offset := getField(page, FREE_END_OFFSET) - int64(len(value))
+	page.Update(value, offset, int64(len(value)))
+	setField(page, slotPos(slot), offset)
+	setField(page, slotPos(slot)+SLOT_OFFSET_SIZE, length)
+	setField(page, FREE_END_OFFSET, offset)
+	setField(page, NUM_SLOTS_OFFSET, slot+1)
+	return makeRef(page.GetPageNum(), slot), nil
+}
+
+// Get returns the value with the given reference.
+func (heap *HeapFile) Get(ref int64) ([]byte, error) {
+	heap.mtx.Lock()
+	defer heap.mtx.Unlock()
+	page, offset, length, err := heap.getSlot(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer page.Put()
+	if length == OVERFLOW_SLOT {
+		firstPN, totalLength := readStub(page, offset)
+		return heap.getOverflow(firstPN, totalLength)
+	}
+	value := make([]byte, length)
+	copy(value, (*page.GetData())[offset:offset+length])
+	return value, nil
+}
+
+// Delete removes the value with the given reference, giving back any pages it no longer needs.
+func (heap *HeapFile) Delete(ref int64) error {
+	heap.mtx.Lock()
+	defer heap.mtx.Unlock()
+	page, offset, length, err := heap.getSlot(ref)
+	if err != nil {
+		return err
+	}
+	defer page.Put()
+	if length == OVERFLOW_SLOT {
+		firstPN, _ := readStub(page, offset)
+		if err := heap.deleteOverflow(firstPN); err != nil {
+			return err
+		}
+	}
+	_, slot := splitRef(ref)
+	setField(page, slotPos(slot)+SLOT_OFFSET_SIZE, DELETED_SLOT)
+	// Once every slot is deleted, the page can be reused from scratch.
+	for i := int64(0); i < getField(page, NUM_SLOTS_OFFSET); i++ {
+		if getField(page, slotPos(i)+SLOT_OFFSET_SIZE) != DELETED_SLOT {
+			return nil
+		}
+	}
+	initDataPage(page)
+	if page.GetPageNum() == 0 || page.GetPageNum() == heap.current {
+		return nil
+	}
+	return heap.pager.FreePage(page.GetPageNum())
+}
+
+// Vacuum compacts the file, moving pages into free pages and truncating it. Moving a data
+// page changes the references of the values on it, so repoint is called with the page
+// numbers it moved from and to, for the index to rewrite them with MoveRef. Returns the
+// number of pages reclaimed.
+func (heap *HeapFile) Vacuum(repoint func(from int64, to int64) error) (int64, error) {
+	heap.mtx.Lock()
+	defer heap.mtx.Unlock()
+	// Find the page pointing at each overflow page: the data page stubbing its value, or the
+	// overflow page before it.
+	owners := make(map[int64]int64)
+	for pagenum := int64(0); pagenum < heap.pager.GetNumPages(); pagenum++ {
+		page, err := heap.pager.GetPage(pagenum)
+		if err != nil {
+			return 0, err
+		}
+		heap.own(page, owners)
+		page.Put()
+	}
+	return heap.pager.Vacuum(func(from int64, to int64) error {
+		page, err := heap.pager.GetPage(to)
+		if err != nil {
+			return err
+		}
+		defer page.Put()
+		heap.own(page, owners)
+		if (*page.GetData())[KIND_OFFSET] == DATA_PAGE {
+			if heap.current == from {
+				heap.current = to
+			}
+			return repoint(from, to)
+		}
+		// Repoint the stub or overflow page before a moved overflow page.
+		owner, err := heap.pager.GetPage(owners[from])
+		if err != nil {
+			return err
+		}
+		defer owner.Put()
+		if (*owner.GetData())[KIND_OFFSET] == OVERFLOW_PAGE {
+			setLongField(owner, NEXT_PN_OFFSET, to)
+			return nil
+		}
+		for slot := int64(0); slot < getField(owner, NUM_SLOTS_OFFSET); slot++ {
+			offset := getField(owner, slotPos(slot))
+			if getField(owner, slotPos(slot)+SLOT_OFFSET_SIZE) != OVERFLOW_SLOT {
+				continue
+			}
+			if firstPN, _ := readStub(owner, offset); firstPN == from {
+				setLongField(owner, offset, to)
+			}
+		}
+		return nil
+	})
+}
+
+// own records the given page as the owner of the overflow pages it points at.
+func (heap *HeapFile) own(page *pager.Page, owners map[int64]int64) {
+	switch (*page.GetData())[KIND_OFFSET] {
+	case DATA_PAGE:
+		for slot := int64(0); slot < getField(page, NUM_SLOTS_OFFSET); slot++ {
+			if getField(page, slotPos(slot)+SLOT_OFFSET_SIZE) == OVERFLOW_SLOT {
+				firstPN, _ := readStub(page, getField(page, slotPos(slot)))
+				owners[firstPN] = page.GetPageNum()
+			}
+		}
+	case OVERFLOW_PAGE:
+		if next := getLongField(page, NEXT_PN_OFFSET); next >= 0 {
+			owners[next] = page.GetPageNum()
+		}
+	}
+}
+
+// RefPage returns the page number of the data page the value with the given reference is on.
+func RefPage(ref int64) int64 {
+	pagenum, _ := splitRef(ref)
+	return pagenum
+}
+
+// MoveRef returns the reference of the value with the given reference once its data page is
+// moved to the given page number.
+func MoveRef(ref int64, pagenum int64) int64 {
+	_, slot := splitRef(ref)
+	return makeRef(pagenum, slot)
+}
+
+// getSlot returns the pinned page, value offset and length of the slot with the given reference.
+func (heap *HeapFile) getSlot(ref int64) (*pager.Page, int64, int64, error) {
+	pagenum, slot := splitRef(ref)
+	if pagenum < 0 || pagenum >= heap.pager.GetNumPages() {
+		return nil, 0, 0, fmt.Errorf("heap: no value with reference %v", ref)
+	}
+	page, err := heap.pager.GetPage(pagenum)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if (*page.GetData())[KIND_OFFSET] != DATA_PAGE || slot < 0 || slot >= getField(page, NUM_SLOTS_OFFSET) {
+		page.Put()
+		return nil, 0, 0, fmt.Errorf("heap: no value with reference %v", ref)
+	}
+	length := getField(page, slotPos(slot)+SLOT_OFFSET_SIZE)
+	if length == DELETED_SLOT {
+		page.Put()
+		return nil, 0, 0, fmt.Errorf("heap: value with reference %v was deleted", ref)
+	}
+	return page, getField(page, slotPos(slot)), length, nil
+}
+
+// putOverflow writes a value across a chain of overflow pages, returning the first page number.
+func (heap *HeapFile) putOverflow(value []byte) (int64, error) {
+	chunkSize := heap.pageSize() - OVERFLOW_HEADER_SIZE
+	// Write the chain back to front, so each page knows its successor.
+	nextPN := int64(-1)
+	for start := (int64(len(value)) - 1) / chunkSize * chunkSize; start >= 0; start -= chunkSize {
+		end := start + chunkSize
+		if end > int64(len(value)) {
+			end = int64(len(value))
+		}
+		page, err := heap.pager.GetPage(heap.pager.GetFreePN())
+		if err != nil {
+			return -1, err
+		}
+		page.Update(make([]byte, heap.pageSize()), 0, heap.pageSize())
+		page.Update([]byte{OVERFLOW_PAGE}, KIND_OFFSET, KIND_SIZE)
+		setLongField(page, NEXT_PN_OFFSET, nextPN)
+		setField(page, CHUNK_SIZE_OFFSET, end-start)
+		page.Update(value[start:end], OVERFLOW_HEADER_SIZE, end-start)
+		nextPN = page.GetPageNum()
+		page.Put()
+	}
+	return nextPN, nil
+}
+
+// getOverflow reads a value back from the chain of overflow pages starting at the given page.
+func (heap *HeapFile) getOverflow(pagenum int64, length int64) ([]byte, error) {
+	value := make([]byte, 0, length)
+	for pagenum >= 0 {
+		page, err := heap.pager.GetPage(pagenum)
+		if err != nil {
+			return nil, err
+		}
+		if (*page.GetData())[KIND_OFFSET] != OVERFLOW_PAGE {
+			page.Put()
+			return nil, fmt.Errorf("heap: page %v is not an overflow page", pagenum)
+		}
+		chunkSize := getField(page, CHUNK_SIZE_OFFSET)
+		value = append(value, (*page.GetData())[OVERFLOW_HEADER_SIZE:OVERFLOW_HEADER_SIZE+chunkSize]...)
+		pagenum = getLongField(page, NEXT_PN_OFFSET)
+		page.Put()
+	}
+	if int64(len(value)) != length {
+		return nil, errors.New("heap: overflow chain is truncated")
+	}
+	return value, nil
+}
+
+// deleteOverflow frees the chain of overflow pages starting at the given page.
+func (heap *HeapFile) deleteOverflow(pagenum int64) error {
+	for pagenum >= 0 {
+		page, err := heap.pager.GetPage(pagenum)
+		if err != nil {
+			return err
+		}
+		next := getLongField(page, NEXT_PN_OFFSET)
+		page.Put()
+		if err := heap.pager.FreePage(pagenum); err != nil {
+			return err
+		}
+		pagenum = next
+	}
+	return nil
+}
+
+// newDataPage returns a new, empty, pinned data page.
+func (heap *HeapFile) newDataPage() (*pager.Page, error) {
+	page, err := heap.pager.GetPage(heap.pager.GetFreePN())
+	if err != nil {
+		return nil, err
+	}
+	initDataPage(page)
+	return page, nil
+}
+
+// pageSize returns the number of bytes of each page available to the heap file.
+func (heap *HeapFile) pageSize() int64 {
+	return heap.pager.GetPageSize() - pager.PAGE_HEADER_SIZE
+}
+
+// initDataPage resets a page to an empty data page.
+func initDataPage(page *pager.Page) {
+	size := int64(len(*page.GetData()))
+	page.Update(make([]byte, size), 0, size)
+	page.Update([]byte{DATA_PAGE}, KIND_OFFSET, KIND_SIZE)
+	setField(page, NUM_SLOTS_OFFSET, 0)
+	setField(page, FREE_END_OFFSET, size)
+}
+
+// freeSpace returns the number of unused bytes between a data page's slots and values.
+func freeSpace(page *pager.Page) int64 {
+	return getField(page, FREE_END_OFFSET) - slotPos(getField(page, NUM_SLOTS_OFFSET))
+}
+
+// readStub returns the first page number and length of the overflow value stubbed at the given offset.
+func readStub(page *pager.Page, offset int64) (int64, int64) {
+	return getLongField(page, offset), getLongField(page, offset+binary.MaxVarintLen64)
+}
+
+// slotPos returns the byte position of the slot with the given index.
+func slotPos(slot int64) int64 {
+	return DATA_HEADER_SIZE + slot*SLOT_SIZE
+}
+
+// makeRef packs a page number and slot number into a reference.
+func makeRef(pagenum int64, slot int64) int64 {
+	return pagenum<<32 | slot
+}
+
+// splitRef unpacks a reference into its page number and slot number.
+func splitRef(ref int64) (int64, int64) {
+	return ref >> 32, ref & (1<<32 - 1)
+}
+
+// getField reads a 32-bit varint field at the given offset.
+func getField(page *pager.Page, offset int64) int64 {
+	value, _ := binary.Varint((*page.GetData())[offset : offset+binary.MaxVarintLen32])
+	return value
+}
+
+// setField writes a 32-bit varint field at the given offset.
+func setField(page *pager.Page, offset int64, value int64) {
+	data := make([]byte, binary.MaxVarintLen32)
+	binary.PutVarint(data, value)
+	page.Update(data, offset, binary.MaxVarintLen32)
+}
+
+// getLongField reads a 64-bit varint field at the given offset.
+func getLongField(page *pager.Page, offset int64) int64 {
+	value, _ := binary.Varint((*page.GetData())[offset : offset+binary.MaxVarintLen64])
+	return value
+}
+
+// setLongField writes a 64-bit varint field at the given offset.
+func setLongField(page *pager.Page, offset int64, value int64) {
+	data := make([]byte, binary.MaxVarintLen64)
+	binary.PutVarint(data, value)
+	page.Update(data, offset, binary.MaxVarintLen64)
+}
@@ -0,0 +1,125 @@
+package heap
+
+import (
+	"os"
+	"sync"
+
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+)
+
+// Number of frames for a values file whose index pager has no buffer pool.
+var VALUE_FRAMES int64 = 8
+
+// Values is the heap file holding an index's byte-slice values, stored next to the index's
+// own file with a .values suffix. It is only opened once a value is read or written. Pages
+// a logged edit changes are stamped with the LSN of the index's latest one.
+type Values struct {
+	indexPager *pager.Pager // The pager of the index the values belong to.
+	heap       *HeapFile    // The opened heap file, or nil.
+	mtx        sync.Mutex   // Guards opening the heap file.
+}
+
+// NewValues returns the values store of the index read through the given pager.
+func NewValues(indexPager *pager.Pager) *Values {
+	return &Values{indexPager: indexPager}
+}
+
+// Put stores a value, returning its reference.
+func (values *Values) Put(value []byte) (int64, error) {
+	heap, err := values.open()
+	if err != nil {
+		return 0, err
+	}
+	heap.pager.SetEditLSN(values.indexPager.GetEditLSN())
+	return heap.Put(value)
+}
+
+// Get returns the value with the given reference.
+func (values *Values) Get(ref int64) ([]byte, error) {
+	heap, err := values.open()
+	if err != nil {
+		return nil, err
+	}
+	return heap.Get(ref)
+}
+
+// Delete removes the value with the given reference.
+func (values *Values) Delete(ref int64) error {
+	heap, err := values.open()
+	if err != nil {
+		return err
+	}
+	heap.pager.SetEditLSN(values.indexPager.GetEditLSN())
+	return heap.Delete(ref)
+}
+
+// Vacuum compacts the values file, if there is one, calling repoint with the page numbers
+// each data page moved from and to. Returns the number of pages reclaimed.
+func (values *Values) Vacuum(repoint func(from int64, to int64) error) (int64, error) {
+	values.mtx.Lock()
+	opened := values.heap != nil
+	values.mtx.Unlock()
+	if _, err := os.Stat(values.indexPager.GetFilePath() + ".values"); !opened && os.IsNotExist(err) {
+		return 0, nil
+	}
+	heap, err := values.open()
+	if err != nil {
+		return 0, err
+	}
+	heap.pager.SetEditLSN(values.indexPager.GetEditLSN())
+	return heap.Vacuum(repoint)
+}
+
+// Flush writes every page of the values file to disk, if it was ever opened, holding off
+// updates while it does.
+func (values *Values) Flush() {
+	values.mtx.Lock()
+	defer values.mtx.Unlock()
+	if values.heap == nil {
+		return
+	}
+	values.heap.pager.LockAllUpdates()
+	values.heap.pager.FlushAllPages()
+	values.heap.pager.UnlockAllUpdates()
+}
+
+// Close flushes all changes to disk, if the values file was ever opened.
+func (values *Values) Close() error {
+	values.mtx.Lock()
+	defer values.mtx.Unlock()
+	if values.heap == nil {
+		return nil
+	}
+	err := values.heap.Close()
+	values.heap = nil
+	return err
+}
+
+// open returns the heap file, opening it on first use.
+func (values *Values) open() (*HeapFile, error) {
+	values.mtx.Lock()
+	defer values.mtx.Unlock()
+	if values.heap != nil {
+		return values.heap, nil
+	}
+	// Share the index's buffer pool if it has one.
+	var valuePager *pager.Pager
+	if pool := values.indexPager.GetPool(); pool != nil {
+		valuePager = pool.NewPager()
+	} else {
+		var err error
+		valuePager, err = pager.NewPagerWithOptions(pager.Options{
+			NumFrames: VALUE_FRAMES,
+			PageSize:  values.indexPager.GetPageSize(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	heap, err := OpenHeapFile(values.indexPager.GetFilePath()+".values", valuePager)
+	if err != nil {
+		return nil, err
+	}
+	values.heap = heap
+	return heap, nil
+}
@@ -0,0 +1,141 @@
+package pager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Every page on disk starts with a header holding a checksum of the rest of the page,
+// flags, the LSN of the last logged change to it, and a link in the free-page chain.
+// Callers only ever see the bytes after it.
+const (
+	CHECKSUM_OFFSET  int64 = 0
+	CHECKSUM_SIZE    int64 = 4
+	FLAGS_OFFSET     int64 = CHECKSUM_OFFSET + CHECKSUM_SIZE
+	FLAGS_SIZE       int64 = 4
+	LSN_OFFSET       int64 = FLAGS_OFFSET + FLAGS_SIZE
+	LSN_SIZE         int64 = 8
+	NEXT_FREE_OFFSET int64 = LSN_OFFSET + LSN_SIZE
+	NEXT_FREE_SIZE   int64 = 8
+	PAGE_HEADER_SIZE int64 = NEXT_FREE_OFFSET + NEXT_FREE_SIZE
+)
+
+// Page flags.
+const (
+	FREE_PAGE_FLAG uint32 = 1 // The page is on the free-page chain.
+)
+
+// CRC32C, which most CPUs compute in hardware.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptPageError reports a page whose contents do not match its checksum,
+// e.g. because a write to it was torn by a crash.
+type CorruptPageError struct {
+	File     string // Name of the file the page was read from.
+	PageNum  int64  // Position of the page in the file.
+	Stored   uint32 // Checksum found in the page header.
+	Computed uint32 // Checksum of the page as read.
+}
+
+func (err *CorruptPageError) Error() string {
+	return fmt.Sprintf("pager: page %d of %s is corrupt (checksum %08x, expected %08x)",
+		err.PageNum, err.File, err.Computed, err.Stored)
+}
+
+// frameChecksum computes the checksum of everything in the frame after the checksum itself.
+func frameChecksum(frame []byte) uint32 {
+	return crc32.Checksum(frame[CHECKSUM_OFFSET+CHECKSUM_SIZE:], castagnoli)
+}
+
+// sealPage writes the page's header into its frame before it goes to disk.
+func sealPage(page *Page) {
+	frame := *page.frame
+	var flags uint32
+	if page.free {
+		flags |= FREE_PAGE_FLAG
+	}
+	binary.LittleEndian.PutUint32(frame[FLAGS_OFFSET:FLAGS_OFFSET+FLAGS_SIZE], flags)
+	binary.LittleEndian.PutUint64(frame[LSN_OFFSET:LSN_OFFSET+LSN_SIZE], uint64(page.lsn))
+	binary.LittleEndian.PutUint64(frame[NEXT_FREE_OFFSET:NEXT_FREE_OFFSET+NEXT_FREE_SIZE], uint64(page.nextFree))
+	binary.LittleEndian.PutUint32(frame[CHECKSUM_OFFSET:CHECKSUM_OFFSET+CHECKSUM_SIZE], frameChecksum(frame))
+}
+
+// verifyPage checks a frame read from disk against its checksum and loads the page's header.
+// A frame of all zeroes is a page that was allocated but never written, and is valid.
+func verifyPage(page *Page) *CorruptPageError {
+	frame := *page.frame
+	stored := binary.LittleEndian.Uint32(frame[CHECKSUM_OFFSET : CHECKSUM_OFFSET+CHECKSUM_SIZE])
+	computed := frameChecksum(frame)
+	if stored != computed && !(stored == 0 && isZero(frame)) {
+		return &CorruptPageError{Stored: stored, Computed: computed}
+	}
+	flags := binary.LittleEndian.Uint32(frame[FLAGS_OFFSET : FLAGS_OFFSET+FLAGS_SIZE])
+	page.free = flags&FREE_PAGE_FLAG != 0
+	page.lsn = int64(binary.LittleEndian.Uint64(frame[LSN_OFFSET : LSN_OFFSET+LSN_SIZE]))
+	page.nextFree = int64(binary.LittleEndian.Uint64(frame[NEXT_FREE_OFFSET : NEXT_FREE_OFFSET+NEXT_FREE_SIZE]))
+	return nil
+}
+
+// isZero checks if every byte of the frame is zero.
+func isZero(frame []byte) bool {
+	for _, b := range frame {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Pages of files written before pages had headers were this many bytes, all of them data.
+const LEGACY_PAGESIZE int64 = 4096
+
+// IsLegacyFile checks whether the file at the given path was written before pages had
+// headers: it holds whole legacy pages, and its first page, read as one of the given size,
+// doesn't match its checksum. A file that doesn't exist isn't.
+func IsLegacyFile(path string, pageSize int64) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() == 0 || info.Size()%LEGACY_PAGESIZE != 0 {
+		return false, nil
+	}
+	frame := make([]byte, pageSize)
+	if _, err := file.ReadAt(frame, 0); err != nil && err != io.EOF {
+		return false, err
+	}
+	data := frame[PAGE_HEADER_SIZE:]
+	return verifyPage(&Page{frame: &frame, data: &data}) != nil, nil
+}
+
+// ReadLegacyPages calls visit with each page of a file written before pages had headers,
+// in order.
+func ReadLegacyPages(path string, visit func(pagenum int64, data []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	data := make([]byte, LEGACY_PAGESIZE)
+	for pagenum := int64(0); ; pagenum++ {
+		if _, err := io.ReadFull(file, data); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := visit(pagenum, data); err != nil {
+			return err
+		}
+	}
+}
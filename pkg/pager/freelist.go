@@ -0,0 +1,196 @@
+package pager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	list "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/list"
+)
+
+// Pages given back by an index are kept on a chain threaded through their headers.
+// The header of page 0, which always belongs to the index, holds the head of the chain,
+// so page number 0 also marks the end of it.
+
+// GetFreePN returns the next available page number: the head of the free-page chain,
+// or the first page number beyond the end of the file if the chain is empty.
+func (pager *Pager) GetFreePN() int64 {
+	pager.freeMtx.Lock()
+	defer pager.freeMtx.Unlock()
+	if pager.freeHead == 0 {
+		// Assign the first page number beyond the end of the file.
+		return pager.maxPageNum
+	}
+	// Unlink the head of the chain.
+	pagenum := pager.freeHead
+	page, err := pager.GetPage(pagenum)
+	if err != nil {
+		return pager.maxPageNum
+	}
+	next := page.nextFree
+	page.free = false
+	page.nextFree = 0
+	page.SetDirty(true)
+	page.Put()
+	if err := pager.setFreeHead(next); err != nil {
+		return pager.maxPageNum
+	}
+	return pagenum
+}
+
+// FreePage puts a page the caller no longer references on the free-page chain.
+// The page's data is zeroed, so it reads as an empty node or bucket until it is reused.
+func (pager *Pager) FreePage(pagenum int64) error {
+	if pagenum <= 0 || pagenum >= pager.maxPageNum {
+		return fmt.Errorf("pager: cannot free page %d", pagenum)
+	}
+	pager.freeMtx.Lock()
+	defer pager.freeMtx.Unlock()
+	page, err := pager.GetPage(pagenum)
+	if err != nil {
+		return err
+	}
+	if page.free {
+		page.Put()
+		return fmt.Errorf("pager: page %d is already free", pagenum)
+	}
+	page.Update(make([]byte, len(*page.data)), 0, int64(len(*page.data)))
+	page.free = true
+	page.nextFree = pager.freeHead
+	page.Put()
+	return pager.setFreeHead(pagenum)
+}
+
+// setFreeHead records a new head of the free-page chain in the header of page 0.
+// The freeMtx should be locked on entry.
+func (pager *Pager) setFreeHead(pagenum int64) error {
+	root, err := pager.GetPage(0)
+	if err != nil {
+		return err
+	}
+	root.nextFree = pagenum
+	root.SetDirty(true)
+	root.Put()
+	pager.freeHead = pagenum
+	return nil
+}
+
+// GetFreePages returns the page numbers on the free-page chain, in chain order.
+func (pager *Pager) GetFreePages() ([]int64, error) {
+	pager.freeMtx.Lock()
+	defer pager.freeMtx.Unlock()
+	return pager.freePages()
+}
+
+// freePages walks the free-page chain. The freeMtx should be locked on entry.
+func (pager *Pager) freePages() ([]int64, error) {
+	pages := make([]int64, 0)
+	for pagenum := pager.freeHead; pagenum != 0; {
+		if int64(len(pages)) >= pager.maxPageNum {
+			return nil, errors.New("pager: free-page chain has a cycle")
+		}
+		page, err := pager.GetPage(pagenum)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, pagenum)
+		pagenum = page.nextFree
+		page.Put()
+	}
+	return pages, nil
+}
+
+// Vacuum compacts the file: live pages past the end of the compacted file are copied into
+// free pages before it, then the file is truncated. relocate is called after each copy so
+// the index can repoint its references from the old page number to the new one.
+// No other operation may use the pager while it runs. Returns the number of pages reclaimed.
+func (pager *Pager) Vacuum(relocate func(from int64, to int64) error) (int64, error) {
+	pager.freeMtx.Lock()
+	defer pager.freeMtx.Unlock()
+	free, err := pager.freePages()
+	if err != nil {
+		return 0, err
+	}
+	if len(free) == 0 {
+		return 0, nil
+	}
+	// Pair the holes before the new end of file with the live pages after it.
+	numLive := pager.maxPageNum - int64(len(free))
+	isFree := make(map[int64]bool)
+	holes := make([]int64, 0)
+	for _, pagenum := range free {
+		isFree[pagenum] = true
+		if pagenum < numLive {
+			holes = append(holes, pagenum)
+		}
+	}
+	sort.Slice(holes, func(i, j int) bool { return holes[i] < holes[j] })
+	movers := make([]int64, 0)
+	for pagenum := numLive; pagenum < pager.maxPageNum; pagenum++ {
+		if !isFree[pagenum] {
+			movers = append(movers, pagenum)
+		}
+	}
+	// Move each live page into a hole.
+	for i, from := range movers {
+		to := holes[i]
+		if err := pager.copyPage(from, to); err != nil {
+			return 0, err
+		}
+		if err := relocate(from, to); err != nil {
+			return 0, err
+		}
+	}
+	// The chain is now empty.
+	if err := pager.setFreeHead(0); err != nil {
+		return 0, err
+	}
+	// Drop the pages past the new end of file from the buffer, then cut them off.
+	pager.ptMtx.Lock()
+	defer pager.ptMtx.Unlock()
+	for pagenum, link := range pager.pageTable {
+		if pagenum < numLive {
+			continue
+		}
+		if link.GetList() != pager.unpinnedList {
+			return 0, fmt.Errorf("pager: page %d is still pinned", pagenum)
+		}
+		pager.drop(link)
+	}
+	pager.FlushAllPages()
+	if err := pager.file.Truncate(numLive * pager.pageSize); err != nil {
+		return 0, err
+	}
+	pager.maxPageNum = numLive
+	return int64(len(free)), nil
+}
+
+// copyPage copies the data of one page over another, which leaves the free-page chain.
+func (pager *Pager) copyPage(from int64, to int64) error {
+	src, err := pager.GetPage(from)
+	if err != nil {
+		return err
+	}
+	defer src.Put()
+	dst, err := pager.GetPage(to)
+	if err != nil {
+		return err
+	}
+	defer dst.Put()
+	dst.Update(*src.data, 0, int64(len(*src.data)))
+	dst.lsn = src.lsn
+	dst.free = false
+	dst.nextFree = 0
+	return nil
+}
+
+// drop removes an unpinned page from the buffer without writing it back.
+// the ptMtx should be locked on entry
+func (pager *Pager) drop(link *list.Link) {
+	link.PopSelf()
+	page := link.GetKey().(*Page)
+	delete(pager.pageTable, page.pagenum)
+	pager.policy.Evict(page.pagenum)
+	page.dirty = false
+	pager.discard(page)
+}
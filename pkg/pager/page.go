@@ -18,6 +18,17 @@ type Page struct {
 	rwlock     sync.RWMutex // Readers-writers lock on the page itself
 	updateLock sync.Mutex   // Mutex for updating data in a page
 	data       *[]byte      // Serialized data.
+	frame      *[]byte      // The whole on-disk page: the header followed by data.
+	lsn        int64        // LSN of the last logged change to this page.
+	free       bool         // Whether the page is on the free-page chain.
+	nextFree   int64        // Next page on the free-page chain; on page 0, the head of the chain.
+	unpinnedAt uint64       // When the page was last released, for eviction across a pool.
+}
+
+// newFrame wraps an aligned buffer of one on-disk page in an empty Page.
+func newFrame(pager *Pager, frame []byte) *Page {
+	data := frame[PAGE_HEADER_SIZE:]
+	return &Page{pager: pager, pagenum: NOPAGE, data: &data, frame: &frame}
 }
 
 // Get the pager.
@@ -35,9 +46,12 @@ func (page *Page) IsDirty() bool {
 	return page.dirty
 }
 
-// Set dirty.
+// Set dirty; a page made dirty is stamped with the LSN of its pager's latest logged edit.
 func (page *Page) SetDirty(dirty bool) {
 	page.dirty = dirty
+	if dirty {
+		page.stampLSN()
+	}
 }
 
 // Get data.
@@ -45,6 +59,34 @@ func (page *Page) GetData() *[]byte {
 	return page.data
 }
 
+// Get the LSN of the last logged change to this page.
+func (page *Page) GetLSN() int64 {
+	return page.lsn
+}
+
+// Set the page LSN; it is written to disk with the page.
+func (page *Page) SetLSN(lsn int64) {
+	page.updateLock.Lock()
+	defer page.updateLock.Unlock()
+	page.dirty = true
+	page.lsn = lsn
+}
+
+// stampLSN raises the page LSN to that of its pager's latest logged edit.
+func (page *Page) stampLSN() {
+	if page.pager == nil {
+		return
+	}
+	if lsn := page.pager.GetEditLSN(); lsn > page.lsn {
+		page.lsn = lsn
+	}
+}
+
+// Is this page on the free-page chain?
+func (page *Page) IsFree() bool {
+	return page.free
+}
+
 // Increment the pincount.
 func (page *Page) Get() {
 	atomic.AddInt64(&page.pinCount, 1)
@@ -56,13 +98,17 @@ func (page *Page) Put() {
 	pager.ptMtx.Lock()
 	ret := atomic.AddInt64(&page.pinCount, -1)
 	// Check if we can unpin this page; if so, move from pinned to unpinned list.
-	if ret == 0 {
+	if ret == 0 && pager.released {
+		// The pager was closed while the page was pinned, so its frame goes back to the pool.
+		pager.drop(pager.pageTable[page.pagenum])
+	} else if ret == 0 {
 		link := pager.pageTable[page.pagenum]
 		link.PopSelf()
 		newLink := pager.unpinnedList.PushTail(page)
 		pager.pageTable[page.pagenum] = newLink
+		stampUnpinned(page)
 	}
-	page.pager.ptMtx.Unlock()
+	pager.ptMtx.Unlock()
 	if ret < 0 {
 		fmt.Println("ERROR: pinCount for page is < 0")
 	}
@@ -73,6 +119,7 @@ func (page *Page) Update(data []byte, offset int64, size int64) {
 	page.updateLock.Lock()
 	defer page.updateLock.Unlock()
 	page.dirty = true
+	page.stampLSN()
 	copy((*page.data)[offset:offset+size], data)
 }
 
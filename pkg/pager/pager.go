@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	config "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/config"
 	list "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/list"
@@ -15,45 +16,97 @@ import (
 	directio "github.com/ncw/directio"
 )
 
-// Page size - defaults to 4kb.
+// Default page size - defaults to 4kb.
 const PAGESIZE = int64(directio.BlockSize)
 
-// Number of pages.
+// Default number of frames.
 const NUMPAGES = config.NumPages
 
+// Options size a pager's frame arena.
+type Options struct {
+	NumFrames int64 // Number of frames in the buffer.
+	PageSize  int64 // Bytes per page; must be a multiple of the direct I/O block size.
+}
+
+// DefaultOptions returns the compile-time defaults.
+func DefaultOptions() Options {
+	return Options{NumFrames: NUMPAGES, PageSize: PAGESIZE}
+}
+
+// Validate checks that the options describe a usable frame arena.
+func (options Options) Validate() error {
+	if options.NumFrames <= 0 {
+		return errors.New("pager: number of frames must be positive")
+	}
+	if options.PageSize <= PAGE_HEADER_SIZE || options.PageSize%int64(directio.BlockSize) != 0 {
+		return fmt.Errorf("pager: page size must be a positive multiple of %d", directio.BlockSize)
+	}
+	return nil
+}
+
 // Pagers manage pages of data read from a file.
 type Pager struct {
 	file         *os.File             // File descriptor.
 	maxPageNum   int64                // The number of pages used by this database.
-	ptMtx        sync.Mutex           // Page table mutex.
+	ptMtx        *sync.Mutex          // Page table mutex; shared by every pager in a pool.
 	freeList     *list.List           // Free page list.
 	unpinnedList *list.List           // Unpinned page list.
 	pinnedList   *list.List           // Pinned page list.
 	pageTable    map[int64]*list.Link // Page table.
+	pageSize     int64                // Bytes per page.
+	numFrames    int64                // Number of frames in the buffer.
+	policy       ReplacementPolicy    // Chooses which unpinned page to evict.
+	stats        PagerStats           // Buffer hit/miss counters.
+	pool         *BufferPool          // Shared pool this pager draws frames from, if any.
+	freeHead     int64                // First page of the free-page chain, or 0 if it is empty.
+	freeMtx      sync.Mutex           // Serializes changes to the free-page chain.
+	editLSN      int64                // LSN of the latest logged edit to the file, which pages it dirties are stamped with.
+	released     bool                 // Whether the pager was closed and gave its frames back to its pool.
 }
 
-// Construct a new Pager.
+// PagerStats counts how well the buffer is serving page requests.
+type PagerStats struct {
+	Hits      int64 // Requests served from a resident frame.
+	Misses    int64 // Requests that had to bring the page in.
+	Evictions int64 // Resident pages dropped to make room.
+}
+
+// Construct a new Pager with the default options.
 func NewPager() *Pager {
-	var pager *Pager = &Pager{}
+	pager, _ := NewPagerWithOptions(DefaultOptions())
+	return pager
+}
+
+// Construct a new Pager whose frame arena is sized by the given options.
+func NewPagerWithOptions(options Options) (*Pager, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	var pager *Pager = newPager(options.PageSize, options.NumFrames, &sync.Mutex{})
+	pageSize := int(options.PageSize)
+	frames := directio.AlignedBlock(pageSize * int(options.NumFrames))
+	for i := 0; i < int(options.NumFrames); i++ {
+		pager.freeList.PushTail(newFrame(pager, frames[i*pageSize:(i+1)*pageSize]))
+	}
+	return pager, nil
+}
+
+// newPager constructs a pager without any frames.
+func newPager(pageSize int64, numFrames int64, ptMtx *sync.Mutex) *Pager {
+	var pager *Pager = &Pager{pageSize: pageSize, numFrames: numFrames, ptMtx: ptMtx}
 	pager.pageTable = make(map[int64]*list.Link)
 	pager.freeList = list.NewList()
 	pager.unpinnedList = list.NewList()
 	pager.pinnedList = list.NewList()
-	frames := directio.AlignedBlock(int(PAGESIZE * NUMPAGES))
-	for i := 0; i < NUMPAGES; i++ {
-		frame := frames[i*int(PAGESIZE) : (i+1)*int(PAGESIZE)]
-		page := Page{
-			pager:    pager,
-			pagenum:  NOPAGE,
-			pinCount: 0,
-			dirty:    false,
-			data:     &frame,
-		}
-		pager.freeList.PushTail(&page)
-	}
+	pager.policy = NewLRUPolicy()
 	return pager
 }
 
+// GetPool returns the buffer pool this pager draws frames from, or nil.
+func (pager *Pager) GetPool() *BufferPool {
+	return pager.pool
+}
+
 // HasFile checks if the pager is backed by disk.
 func (pager *Pager) HasFile() bool {
 	return pager.file != nil
@@ -64,15 +117,79 @@ func (pager *Pager) GetFileName() string {
 	return filepath.Base(pager.file.Name())
 }
 
+// GetFilePath returns the path the file was opened with.
+func (pager *Pager) GetFilePath() string {
+	return pager.file.Name()
+}
+
+// GetPageSize returns the number of bytes per page on disk, including the page header.
+func (pager *Pager) GetPageSize() int64 {
+	return pager.pageSize
+}
+
+// GetNumFrames returns the number of frames in the buffer.
+func (pager *Pager) GetNumFrames() int64 {
+	return pager.numFrames
+}
+
+// GetOptions returns the options this pager was constructed with.
+func (pager *Pager) GetOptions() Options {
+	return Options{NumFrames: pager.numFrames, PageSize: pager.pageSize}
+}
+
 // GetNumPages returns the number of pages.
 func (pager *Pager) GetNumPages() int64 {
 	return pager.maxPageNum
 }
 
-// GetFreePN returns the next available page number.
-func (pager *Pager) GetFreePN() int64 {
-	// Assign the first page number beyond the end of the file.
-	return pager.maxPageNum
+// GetReplacementPolicy returns the pager's replacement policy.
+func (pager *Pager) GetReplacementPolicy() ReplacementPolicy {
+	return pager.policy
+}
+
+// SetReplacementPolicy swaps in a new replacement policy, telling it about the resident pages.
+func (pager *Pager) SetReplacementPolicy(policy ReplacementPolicy) {
+	pager.ptMtx.Lock()
+	defer pager.ptMtx.Unlock()
+	pager.unpinnedList.Map(func(l *list.Link) {
+		policy.Touch(l.GetKey().(*Page).GetPageNum())
+	})
+	pager.pinnedList.Map(func(l *list.Link) {
+		policy.Touch(l.GetKey().(*Page).GetPageNum())
+	})
+	pager.policy = policy
+}
+
+// GetStats returns a snapshot of the pager's hit/miss counters.
+func (pager *Pager) GetStats() PagerStats {
+	pager.ptMtx.Lock()
+	defer pager.ptMtx.Unlock()
+	return pager.stats
+}
+
+// ResetStats zeroes the pager's hit/miss counters.
+func (pager *Pager) ResetStats() {
+	pager.ptMtx.Lock()
+	defer pager.ptMtx.Unlock()
+	pager.stats = PagerStats{}
+}
+
+// SetEditLSN records the LSN of a logged edit about to be made to the file. Each page dirtied
+// from then on is stamped with it, unless the page holds a later one. Edits made at once may
+// stamp a page with a later LSN than that of its own edit, which is safe, as the log of an
+// edit is written before it is made.
+func (pager *Pager) SetEditLSN(lsn int64) {
+	for {
+		current := atomic.LoadInt64(&pager.editLSN)
+		if lsn <= current || atomic.CompareAndSwapInt64(&pager.editLSN, current, lsn) {
+			return
+		}
+	}
+}
+
+// GetEditLSN returns the LSN of the latest logged edit to the file.
+func (pager *Pager) GetEditLSN() int64 {
+	return atomic.LoadInt64(&pager.editLSN)
 }
 
 // Open initializes our page with a given database file.
@@ -94,12 +211,22 @@ func (pager *Pager) Open(filename string) (err error) {
 	var len int64
 	if info, err = pager.file.Stat(); err == nil {
 		len = info.Size()
-		if len%PAGESIZE != 0 {
+		if len%pager.pageSize != 0 {
 			return errors.New("open: DB file has been corrupted")
 		}
 	}
 	// Set the number of pages and hand off initialization to someone else.
-	pager.maxPageNum = len / PAGESIZE
+	pager.maxPageNum = len / pager.pageSize
+	pager.freeHead = 0
+	// The header of page 0 holds the head of the free-page chain.
+	if pager.maxPageNum > 0 {
+		page, err := pager.GetPage(0)
+		if err != nil {
+			return err
+		}
+		pager.freeHead = page.nextFree
+		page.Put()
+	}
 	return nil
 }
 
@@ -114,6 +241,10 @@ func (pager *Pager) Close() (err error) {
 	}
 	// Cleanup.
 	pager.FlushAllPages()
+	// Give our frames back to the pool.
+	if pager.pool != nil {
+		pager.pool.release(pager)
+	}
 	if pager.file != nil {
 		err = pager.file.Close()
 	}
@@ -121,12 +252,17 @@ func (pager *Pager) Close() (err error) {
 	return err
 }
 
-// Populate a page's data field, given a pagenumber.
+// Populate a page's data field, given a pagenumber, checking the page against its checksum.
 func (pager *Pager) ReadPageFromDisk(page *Page, pagenum int64) error {
-	if _, err := pager.file.Seek(pagenum*PAGESIZE, 0); err != nil {
+	if _, err := pager.file.Seek(pagenum*pager.pageSize, 0); err != nil {
 		return err
 	}
-	if _, err := pager.file.Read(*page.data); err != nil && err != io.EOF {
+	if _, err := pager.file.Read(*page.frame); err != nil && err != io.EOF {
+		return err
+	}
+	if err := verifyPage(page); err != nil {
+		err.File = pager.file.Name()
+		err.PageNum = pagenum
 		return err
 	}
 	return nil
@@ -137,27 +273,27 @@ func (pager *Pager) ReadPageFromDisk(page *Page, pagenum int64) error {
 func (pager *Pager) NewPage(pagenum int64) (*Page, error) {
 	var page *Page = nil
 	var page_in_freelist = pager.freeList.PeekHead()
-	var page_in_unpinnedlist = pager.unpinnedList.PeekHead()
 	// return page from free list
 	if page_in_freelist != nil {
 		// delete it from free list to prevent get it repeately
 		page_in_freelist.PopSelf()
 		// assign value to page
-		// (*Page) is a type assertion, which asserts that the value retrieved from freeLink.GetKey() 
+		// (*Page) is a type assertion, which asserts that the value retrieved from freeLink.GetKey()
 		// 		is of type *Page. If it's not of that type, it will result in a runtime panic.
 		page = page_in_freelist.GetKey().(*Page)
-	} else if !pager.HasFile() { 
+	} else if !pager.HasFile() {
 		//  throw an error if there is no available page from the free list and the pager is not backed by disk
 		return page, errors.New("pager is not backed by disk")
-	} else if page_in_unpinnedlist != nil {
-		// no page in free list, evict a page from unpinned list and return clean page
-		page_in_unpinnedlist.PopSelf()
-		page = page_in_unpinnedlist.GetKey().(*Page)
-		// write page data to disk, and this page might be a dirty page
-		// we already removed it from unpinnedList, so we'd better to check whether it is dirty and need to write it to the disk
-		pager.FlushPage(page)
-		// page dne in unpinnedlist
-		delete(pager.pageTable, page.pagenum)
+	} else if pager.pool != nil {
+		// shared pool: it hands out a free frame or evicts one from whichever file should give it up
+		var err error
+		page, err = pager.pool.allocate(pager)
+		if err != nil {
+			return nil, err
+		}
+	} else if victim := pager.policy.Victim(pager.unpinnedList); victim != nil {
+		// no page in free list, the replacement policy decides which unpinned page is evicted
+		page = pager.evict(victim)
 	} else {
 		// no page in either list, throw error
 		return page, errors.New("no page in either list")
@@ -166,11 +302,43 @@ func (pager *Pager) NewPage(pagenum int64) (*Page, error) {
 	page.pagenum = pagenum
 	page.pinCount = 1
 	page.dirty = false
+	page.lsn = 0
+	page.free = false
+	page.nextFree = 0
 	return page, nil
 
 	// panic("function not yet implemented")
 }
 
+// evict removes an unpinned page from the buffer, writing it back if it is dirty.
+// the ptMtx should be locked on entry
+func (pager *Pager) evict(link *list.Link) *Page {
+	link.PopSelf()
+	page := link.GetKey().(*Page)
+	// write page data to disk, and this page might be a dirty page
+	// we already removed it from unpinnedList, so we'd better to check whether it is dirty and need to write it to the disk
+	pager.FlushPage(page)
+	// page dne in unpinnedlist
+	delete(pager.pageTable, page.pagenum)
+	pager.policy.Evict(page.pagenum)
+	pager.stats.Evictions++
+	page.pagenum = NOPAGE
+	return page
+}
+
+// discard hands back a frame that was allocated for a page that could not be read.
+// the ptMtx should be locked on entry
+func (pager *Pager) discard(page *Page) {
+	page.pagenum = NOPAGE
+	page.pinCount = 0
+	if pager.pool != nil {
+		page.pager = nil
+		pager.pool.freeList.PushTail(page)
+	} else {
+		pager.freeList.PushTail(page)
+	}
+}
+
 // getPage returns the page corresponding to the given pagenum.
 func (pager *Pager) GetPage(pagenum int64) (page *Page, err error) {
 	page = nil
@@ -200,8 +368,10 @@ func (pager *Pager) GetPage(pagenum int64) (page *Page, err error) {
 			pager.pageTable[pagenum] = new_page_in_pinnedList
 		}
 		page.Get()
+		pager.stats.Hits++
+		pager.policy.Touch(pagenum)
 		return page, nil
-	} 
+	}
 	// 3. if the new page is introduced to the system, you must update them
 	page, err = pager.NewPage(pagenum)
 	if err != nil {
@@ -211,6 +381,7 @@ func (pager *Pager) GetPage(pagenum int64) (page *Page, err error) {
 	if pagenum < pager.maxPageNum {
 		err = pager.ReadPageFromDisk(page, pagenum)
 		if err != nil {
+			pager.discard(page)
 			return nil, err
 		}
 	} else {
@@ -223,6 +394,8 @@ func (pager *Pager) GetPage(pagenum int64) (page *Page, err error) {
 	// 		(1) add this page to pinnedList
 	// 		(2) map the new page to its pagenum in pageTable
 	pager.pageTable[pagenum] = pager.pinnedList.PushTail(page)
+	pager.stats.Misses++
+	pager.policy.Touch(pagenum)
 	// pinCount = 1 here
 	return page, nil
 
@@ -233,9 +406,10 @@ func (pager *Pager) GetPage(pagenum int64) (page *Page, err error) {
 func (pager *Pager) FlushPage(page *Page) {
 	// We should only do this if the file exists and the page is dirty
 	if page.dirty && pager.HasFile() {
-		// *page.data: data we want to write
-		// page.pagenum * PAGESIZE: offset * page size
-		pager.file.WriteAt(*page.data, page.pagenum * PAGESIZE)
+		// *page.frame: header and data we want to write
+		// page.pagenum * pageSize: offset * page size
+		sealPage(page)
+		pager.file.WriteAt(*page.frame, page.pagenum*pager.pageSize)
 		page.dirty = false
 	}
 	// panic("function not yet implemented")
@@ -48,6 +48,12 @@ func PagerRepl() (*repl.REPL, error) {
 	r.AddCommand("pager_flushall", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandlePagerFlushAll(p, payload, replConfig.GetWriter())
 	}, "Flush all pages. usage: pager_flushall")
+	r.AddCommand("pager_policy", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandlePagerPolicy(p, payload, replConfig.GetWriter())
+	}, "Set the buffer replacement policy. usage: pager_policy <lru|clock|lru-k|2q>")
+	r.AddCommand("pager_stats", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandlePagerStats(p, payload, replConfig.GetWriter())
+	}, "Print buffer hit/miss counters. usage: pager_stats")
 	return r, nil
 }
 
@@ -61,6 +67,7 @@ func HandlePagerPrint(p *Pager, payload string, w io.Writer) (err error) {
 	}
 	// Print maxPageNum, freeList, unpinnedList, pinnedList, pageTable.
 	io.WriteString(w, fmt.Sprintf("maxPageNum: %v\n", p.maxPageNum))
+	io.WriteString(w, fmt.Sprintf("policy: %v\n", p.policy.Name()))
 	io.WriteString(w, "freeList: ")
 	p.freeList.Map(func(l *list.Link) {
 		io.WriteString(w, fmt.Sprintf("(pagenum: %v), ", l.GetKey().(*Page).GetPageNum()))
@@ -259,3 +266,48 @@ func HandlePagerFlushAll(p *Pager, payload string, w io.Writer) (err error) {
 	p.FlushAllPages()
 	return nil
 }
+
+// Function to set the replacement policy.
+func HandlePagerPolicy(p *Pager, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: pager_policy <lru|clock|lru-k|2q>
+	if numFields != 2 {
+		return fmt.Errorf("usage: pager_policy <lru|clock|lru-k|2q>")
+	}
+	policy, err := NewReplacementPolicy(fields[1], p.GetNumFrames())
+	if err != nil {
+		return err
+	}
+	p.SetReplacementPolicy(policy)
+	return nil
+}
+
+// Function to print the buffer hit/miss counters.
+func HandlePagerStats(p *Pager, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: pager_stats
+	if numFields != 1 {
+		return fmt.Errorf("usage: pager_stats")
+	}
+	io.WriteString(w, FormatStats(p.GetReplacementPolicy().Name(), p.GetStats()))
+	return nil
+}
+
+// FormatStats renders a policy's counters on a single line.
+func FormatStats(policy string, stats PagerStats) string {
+	hitRate := float64(0)
+	if total := stats.Hits + stats.Misses; total > 0 {
+		hitRate = float64(stats.Hits) / float64(total)
+	}
+	return fmt.Sprintf("policy: %v, hits: %v, misses: %v, evictions: %v, hit rate: %.4f\n",
+		policy, stats.Hits, stats.Misses, stats.Evictions, hitRate)
+}
+
+// FormatUsage renders the frames and counters of one file in a buffer pool on a single line.
+func FormatUsage(usage PoolUsage) string {
+	return fmt.Sprintf("%v: resident: %v, pinned: %v, dirty: %v, hits: %v, misses: %v, evictions: %v\n",
+		usage.Name, usage.Resident, usage.Pinned, usage.Dirty,
+		usage.Hits, usage.Misses, usage.Evictions)
+}
@@ -0,0 +1,322 @@
+package pager
+
+import (
+	"errors"
+	"strings"
+
+	list "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/list"
+)
+
+// Names of the available buffer replacement policies.
+const (
+	LRU_POLICY   = "lru"
+	CLOCK_POLICY = "clock"
+	LRUK_POLICY  = "lru-k"
+	TWOQ_POLICY  = "2q"
+)
+
+// Number of references LRU-K keeps per page.
+const LRUK_K = 2
+
+// ReplacementPolicy decides which unpinned page gets evicted when the pager runs out of frames.
+// All methods are called with the pager's ptMtx held.
+type ReplacementPolicy interface {
+	// Name returns the name of the policy.
+	Name() string
+	// Touch records a reference to the given page, on both hits and misses.
+	Touch(pagenum int64)
+	// Victim returns the link in the unpinned list that should be evicted next, or nil if there is none.
+	Victim(unpinned *list.List) *list.Link
+	// Evict tells the policy that the given page has left the buffer.
+	Evict(pagenum int64)
+}
+
+// NewReplacementPolicy constructs a replacement policy by name for a buffer of numFrames frames.
+func NewReplacementPolicy(name string, numFrames int64) (ReplacementPolicy, error) {
+	switch strings.ToLower(name) {
+	case LRU_POLICY, "":
+		return NewLRUPolicy(), nil
+	case CLOCK_POLICY:
+		return NewClockPolicy(), nil
+	case LRUK_POLICY, "lruk":
+		return NewLRUKPolicy(LRUK_K), nil
+	case TWOQ_POLICY:
+		return NewTwoQPolicy(numFrames), nil
+	default:
+		return nil, errors.New("unknown replacement policy: " + name)
+	}
+}
+
+// unpinnedLinks maps every page in the unpinned list to its link.
+func unpinnedLinks(unpinned *list.List) map[int64]*list.Link {
+	links := make(map[int64]*list.Link)
+	unpinned.Map(func(l *list.Link) {
+		links[l.GetKey().(*Page).GetPageNum()] = l
+	})
+	return links
+}
+
+/////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////// LRU /////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////
+
+// LRUPolicy evicts the page that was unpinned the longest time ago.
+type LRUPolicy struct{}
+
+// Construct a new LRUPolicy.
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{}
+}
+
+// Get name.
+func (policy *LRUPolicy) Name() string {
+	return LRU_POLICY
+}
+
+// Pages are appended to the unpinned list when released, so no bookkeeping is needed.
+func (policy *LRUPolicy) Touch(pagenum int64) {}
+
+// The head of the unpinned list is the least recently released page.
+func (policy *LRUPolicy) Victim(unpinned *list.List) *list.Link {
+	return unpinned.PeekHead()
+}
+
+// Nothing to forget.
+func (policy *LRUPolicy) Evict(pagenum int64) {}
+
+/////////////////////////////////////////////////////////////////////////////
+////////////////////////////////// CLOCK ////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////
+
+// ClockPolicy sweeps a hand over the resident pages, giving referenced pages a second chance.
+type ClockPolicy struct {
+	ring       []int64        // Resident pages in the order they were loaded.
+	referenced map[int64]bool // Reference bits.
+	hand       int            // Position of the clock hand in the ring.
+}
+
+// Construct a new ClockPolicy.
+func NewClockPolicy() *ClockPolicy {
+	return &ClockPolicy{ring: make([]int64, 0), referenced: make(map[int64]bool)}
+}
+
+// Get name.
+func (policy *ClockPolicy) Name() string {
+	return CLOCK_POLICY
+}
+
+// Set the reference bit, adding the page to the ring if it is new.
+func (policy *ClockPolicy) Touch(pagenum int64) {
+	if _, ok := policy.referenced[pagenum]; !ok {
+		policy.ring = append(policy.ring, pagenum)
+	}
+	policy.referenced[pagenum] = true
+}
+
+// Advance the hand until an unpinned page with a cleared reference bit is found.
+func (policy *ClockPolicy) Victim(unpinned *list.List) *list.Link {
+	links := unpinnedLinks(unpinned)
+	if len(links) == 0 || len(policy.ring) == 0 {
+		return unpinned.PeekHead()
+	}
+	// Two full sweeps are enough to clear every reference bit.
+	for i := 0; i <= 2*len(policy.ring); i++ {
+		policy.hand = policy.hand % len(policy.ring)
+		pagenum := policy.ring[policy.hand]
+		if link, ok := links[pagenum]; ok {
+			if !policy.referenced[pagenum] {
+				return link
+			}
+			policy.referenced[pagenum] = false
+		}
+		policy.hand++
+	}
+	return unpinned.PeekHead()
+}
+
+// Remove the page from the ring, keeping the hand on the following page.
+func (policy *ClockPolicy) Evict(pagenum int64) {
+	if _, ok := policy.referenced[pagenum]; !ok {
+		return
+	}
+	delete(policy.referenced, pagenum)
+	for i, pn := range policy.ring {
+		if pn == pagenum {
+			policy.ring = append(policy.ring[:i], policy.ring[i+1:]...)
+			if i < policy.hand {
+				policy.hand--
+			}
+			break
+		}
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+////////////////////////////////// LRU-K ////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////
+
+// LRUKPolicy evicts the page whose k-th most recent reference is the oldest.
+// Pages with fewer than k references are evicted first, in LRU order, which
+// keeps one-off scans from flushing frequently used pages.
+type LRUKPolicy struct {
+	k       int
+	clock   uint64
+	history map[int64][]uint64 // Most recent reference first.
+}
+
+// Construct a new LRUKPolicy.
+func NewLRUKPolicy(k int) *LRUKPolicy {
+	return &LRUKPolicy{k: k, history: make(map[int64][]uint64)}
+}
+
+// Get name.
+func (policy *LRUKPolicy) Name() string {
+	return LRUK_POLICY
+}
+
+// Record the reference in the page's history.
+func (policy *LRUKPolicy) Touch(pagenum int64) {
+	policy.clock++
+	hist := append([]uint64{policy.clock}, policy.history[pagenum]...)
+	if len(hist) > policy.k {
+		hist = hist[:policy.k]
+	}
+	policy.history[pagenum] = hist
+}
+
+// Pick the unpinned page with the largest backward k-distance.
+func (policy *LRUKPolicy) Victim(unpinned *list.List) *list.Link {
+	var victim *list.Link
+	var victimFull bool
+	var victimTime uint64
+	unpinned.Map(func(l *list.Link) {
+		hist := policy.history[l.GetKey().(*Page).GetPageNum()]
+		full := len(hist) >= policy.k
+		var time uint64
+		if full {
+			time = hist[policy.k-1]
+		} else if len(hist) > 0 {
+			time = hist[0]
+		}
+		// Infinite distances beat finite ones; otherwise the oldest time wins.
+		if victim == nil || (victimFull && !full) || (victimFull == full && time < victimTime) {
+			victim, victimFull, victimTime = l, full, time
+		}
+	})
+	return victim
+}
+
+// Forget the page's history.
+func (policy *LRUKPolicy) Evict(pagenum int64) {
+	delete(policy.history, pagenum)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+/////////////////////////////////// 2Q //////////////////////////////////////
+/////////////////////////////////////////////////////////////////////////////
+
+// TwoQPolicy is the full version of 2Q: first-time pages enter a FIFO (A1in),
+// pages referenced again after leaving it are promoted to an LRU queue (Am),
+// and A1out remembers the page numbers recently evicted from A1in.
+type TwoQPolicy struct {
+	kin   int
+	kout  int
+	a1in  *list.List
+	am    *list.List
+	a1out *list.List
+	links map[int64]*list.Link // Resident and ghost pages to their link.
+}
+
+// Construct a new TwoQPolicy sized for numFrames frames.
+func NewTwoQPolicy(numFrames int64) *TwoQPolicy {
+	kin := int(numFrames / 4)
+	if kin < 1 {
+		kin = 1
+	}
+	kout := int(numFrames / 2)
+	if kout < 1 {
+		kout = 1
+	}
+	return &TwoQPolicy{
+		kin:   kin,
+		kout:  kout,
+		a1in:  list.NewList(),
+		am:    list.NewList(),
+		a1out: list.NewList(),
+		links: make(map[int64]*list.Link),
+	}
+}
+
+// Get name.
+func (policy *TwoQPolicy) Name() string {
+	return TWOQ_POLICY
+}
+
+// Move the page between queues according to where it was found.
+func (policy *TwoQPolicy) Touch(pagenum int64) {
+	link, ok := policy.links[pagenum]
+	if !ok {
+		policy.links[pagenum] = policy.a1in.PushTail(pagenum)
+		return
+	}
+	switch link.GetList() {
+	case policy.am:
+		link.PopSelf()
+		policy.links[pagenum] = policy.am.PushTail(pagenum)
+	case policy.a1out:
+		link.PopSelf()
+		policy.links[pagenum] = policy.am.PushTail(pagenum)
+	}
+}
+
+// Evict from A1in while it is over its share, else from the LRU end of Am.
+func (policy *TwoQPolicy) Victim(unpinned *list.List) *list.Link {
+	links := unpinnedLinks(unpinned)
+	first := func(queue *list.List) *list.Link {
+		var victim *list.Link
+		queue.Find(func(l *list.Link) bool {
+			victim = links[l.GetKey().(int64)]
+			return victim != nil
+		})
+		return victim
+	}
+	if policy.length(policy.a1in) > policy.kin {
+		if victim := first(policy.a1in); victim != nil {
+			return victim
+		}
+	}
+	if victim := first(policy.am); victim != nil {
+		return victim
+	}
+	if victim := first(policy.a1in); victim != nil {
+		return victim
+	}
+	return unpinned.PeekHead()
+}
+
+// Pages leaving A1in are remembered in A1out; pages leaving Am are forgotten.
+func (policy *TwoQPolicy) Evict(pagenum int64) {
+	link, ok := policy.links[pagenum]
+	if !ok {
+		return
+	}
+	fromA1in := link.GetList() == policy.a1in
+	link.PopSelf()
+	delete(policy.links, pagenum)
+	if !fromA1in {
+		return
+	}
+	policy.links[pagenum] = policy.a1out.PushTail(pagenum)
+	if policy.length(policy.a1out) > policy.kout {
+		oldest := policy.a1out.PeekHead()
+		oldest.PopSelf()
+		delete(policy.links, oldest.GetKey().(int64))
+	}
+}
+
+// length counts the elements of a queue.
+func (policy *TwoQPolicy) length(queue *list.List) int {
+	n := 0
+	queue.Map(func(l *list.Link) { n++ })
+	return n
+}
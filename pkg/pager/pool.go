@@ -0,0 +1,176 @@
+package pager
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	list "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/list"
+
+	directio "github.com/ncw/directio"
+)
+
+// Number of frames a file keeps while other files have pages to give up.
+const POOL_RESERVED_FRAMES int64 = 4
+
+// Logical clock stamped on pages when they are unpinned.
+var unpinClock uint64
+
+// BufferPool is a set of frames shared by the pagers of several files.
+// Every pager in the pool shares the pool's mutex as its page table mutex.
+type BufferPool struct {
+	mtx       sync.Mutex // Page table mutex shared by all pagers in the pool.
+	pageSize  int64      // Bytes per page.
+	numFrames int64      // Number of frames in the pool.
+	freeList  *list.List // Frames not holding any page.
+	pagers    []*Pager   // Pagers drawing frames from this pool.
+}
+
+// PoolUsage describes the frames held by one file in a buffer pool.
+type PoolUsage struct {
+	Name     string // File name.
+	Resident int64  // Frames holding a page of this file.
+	Pinned   int64  // Resident pages that are pinned.
+	Dirty    int64  // Resident pages that must be written back.
+	PagerStats
+}
+
+// Construct a new BufferPool whose frames are sized by the given options.
+func NewBufferPool(options Options) (*BufferPool, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	pool := &BufferPool{
+		pageSize:  options.PageSize,
+		numFrames: options.NumFrames,
+		freeList:  list.NewList(),
+		pagers:    make([]*Pager, 0),
+	}
+	pageSize := int(options.PageSize)
+	frames := directio.AlignedBlock(pageSize * int(options.NumFrames))
+	for i := 0; i < int(options.NumFrames); i++ {
+		pool.freeList.PushTail(newFrame(nil, frames[i*pageSize:(i+1)*pageSize]))
+	}
+	return pool, nil
+}
+
+// NewPager constructs a pager that draws its frames from this pool.
+func (pool *BufferPool) NewPager() *Pager {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	pager := newPager(pool.pageSize, pool.numFrames, &pool.mtx)
+	pager.pool = pool
+	pool.pagers = append(pool.pagers, pager)
+	return pager
+}
+
+// GetNumFrames returns the number of frames in the pool.
+func (pool *BufferPool) GetNumFrames() int64 {
+	return pool.numFrames
+}
+
+// GetPageSize returns the number of bytes per page.
+func (pool *BufferPool) GetPageSize() int64 {
+	return pool.pageSize
+}
+
+// GetUsage returns how many frames each open file holds, sorted by file name.
+func (pool *BufferPool) GetUsage() []PoolUsage {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	usage := make([]PoolUsage, 0, len(pool.pagers))
+	for _, pager := range pool.pagers {
+		if !pager.HasFile() {
+			continue
+		}
+		u := PoolUsage{Name: pager.GetFileName(), PagerStats: pager.stats}
+		for _, link := range pager.pageTable {
+			page := link.GetKey().(*Page)
+			u.Resident++
+			if link.GetList() == pager.pinnedList {
+				u.Pinned++
+			}
+			if page.dirty {
+				u.Dirty++
+			}
+		}
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+	return usage
+}
+
+// allocate hands the requesting pager a frame, evicting a page from some file if none are free.
+// The pool mutex should be locked on entry.
+func (pool *BufferPool) allocate(requester *Pager) (*Page, error) {
+	if link := pool.freeList.PeekHead(); link != nil {
+		link.PopSelf()
+		page := link.GetKey().(*Page)
+		page.pager = requester
+		return page, nil
+	}
+	victim, link := pool.victim(requester)
+	if victim == nil {
+		return nil, errors.New("no unpinned page in the buffer pool")
+	}
+	page := victim.evict(link)
+	page.pager = requester
+	return page, nil
+}
+
+// victim picks the page to take a frame from: each file's replacement policy names its
+// candidate, and the one released the longest time ago is evicted, skipping files down to
+// their reserved frames. A policy that sweeps, like clock, keeps its sweep even if its
+// candidate is passed over, so it names the same page next time.
+func (pool *BufferPool) victim(requester *Pager) (*Pager, *list.Link) {
+	var victim, fallback *Pager
+	var victimLink *list.Link
+	var oldest uint64
+	for _, pager := range pool.pagers {
+		if pager.unpinnedList.PeekHead() == nil {
+			continue
+		}
+		if fallback == nil || pager == requester {
+			fallback = pager
+		}
+		if pager != requester && int64(len(pager.pageTable)) <= POOL_RESERVED_FRAMES {
+			continue
+		}
+		link := pager.policy.Victim(pager.unpinnedList)
+		if link == nil {
+			continue
+		}
+		unpinnedAt := link.GetKey().(*Page).unpinnedAt
+		if victim == nil || unpinnedAt < oldest {
+			victim, victimLink, oldest = pager, link, unpinnedAt
+		}
+	}
+	if victim == nil && fallback != nil {
+		return fallback, fallback.policy.Victim(fallback.unpinnedList)
+	}
+	return victim, victimLink
+}
+
+// release returns every unpinned frame of a closing pager to the pool and forgets the pager.
+// Frames of pages still pinned come back when they are put.
+// The pool mutex should be locked on entry.
+func (pool *BufferPool) release(pager *Pager) {
+	for link := pager.unpinnedList.PeekHead(); link != nil; link = pager.unpinnedList.PeekHead() {
+		page := pager.evict(link)
+		page.pager = nil
+		pool.freeList.PushTail(page)
+	}
+	pager.released = true
+	for i, p := range pool.pagers {
+		if p == pager {
+			pool.pagers = append(pool.pagers[:i], pool.pagers[i+1:]...)
+			break
+		}
+	}
+}
+
+// stampUnpinned records when a page was last released.
+func stampUnpinned(page *Page) {
+	page.unpinnedAt = atomic.AddUint64(&unpinClock, 1)
+}
@@ -0,0 +1,213 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	exec "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/exec"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// JoinStats counts the work a join does. Joins count into the stats their context
+// carries, if it carries any.
+type JoinStats struct {
+	PartitionsProbed int64 // Pairs of partitions grace hash join probed.
+	Repartitions     int64 // Partitions grace hash join split again, as they didn't fit in memory.
+	FilterPositives  int64 // Entries a partition's bloom filter said may have a match.
+	FalsePositives   int64 // Entries a partition's bloom filter said may have a match, but had none.
+	IndexProbes      int64 // Entries index nested loop join looked up in the inner table.
+	TempPages        int64 // Pages grace hash join wrote to and read from its partition files.
+}
+
+type joinStatsKey struct{}
+
+// WithJoinStats returns a context that has joins count their work into the given stats.
+func WithJoinStats(ctx context.Context, stats *JoinStats) context.Context {
+	return context.WithValue(ctx, joinStatsKey{}, stats)
+}
+
+// joinStatsOf returns the stats a context carries, or stats no one reads if it has none.
+func joinStatsOf(ctx context.Context) *JoinStats {
+	if stats, ok := ctx.Value(joinStatsKey{}).(*JoinStats); ok {
+		return stats
+	}
+	return &JoinStats{}
+}
+
+// Names of the join algorithms in a plan, put before the name of the join type.
+var joinAlgorithmDescriptions = map[JoinAlgorithm]string{
+	SortMerge:       "sort-merge",
+	IndexNestedLoop: "index nested loop",
+	BlockNestedLoop: "block nested loop",
+	GraceHash:       "hash",
+}
+
+// Names of the join types in a plan.
+var joinTypeDescriptions = map[JoinType]string{
+	InnerJoin:      "join",
+	LeftOuterJoin:  "left outer join",
+	RightOuterJoin: "right outer join",
+	FullOuterJoin:  "full outer join",
+	SemiJoin:       "semi join",
+	AntiJoin:       "anti join",
+}
+
+// Handle explain.
+func HandleExplain(d *db.Database, payload string, w io.Writer) (err error) {
+	fields := strings.Fields(payload)
+	// Usage: explain [analyze] <select|find|join ...>
+	usage := fmt.Errorf("usage: explain [analyze] <select|find|join ...>")
+	if len(fields) < 2 {
+		return usage
+	}
+	analyze := fields[1] == "analyze"
+	statement := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(payload), fields[0]))
+	if analyze {
+		statement = strings.TrimSpace(strings.TrimPrefix(statement, fields[1]))
+	}
+	parsed, err := sql.Parse(statement)
+	if err != nil {
+		return fmt.Errorf("explain error: %v", err)
+	}
+	var selectStatement *sql.SelectStmt
+	switch parsed := parsed.(type) {
+	case *sql.JoinStmt:
+		spec, err := planJoin(d, parsed)
+		if err != nil {
+			return err
+		}
+		if err = explainJoin(spec, analyze, w); err != nil {
+			return fmt.Errorf("explain error: %v", err)
+		}
+		return nil
+	case *sql.SelectStmt:
+		selectStatement = parsed
+	case *sql.FindStmt:
+		selectStatement = &sql.SelectStmt{Table: parsed.Table, Where: parsed.Where, Limit: -1}
+	default:
+		return usage
+	}
+	if !analyze {
+		plan, err := Plan(d, selectStatement)
+		if err != nil {
+			return fmt.Errorf("explain error: %v", err)
+		}
+		exec.Explain(plan, w)
+		return nil
+	}
+	plan, err := PlanProfiled(d, selectStatement)
+	if err != nil {
+		return fmt.Errorf("explain error: %v", err)
+	}
+	if err = exec.Run(plan, func(db.Row) error { return nil }); err != nil {
+		return fmt.Errorf("explain error: %v", err)
+	}
+	exec.Explain(plan, w)
+	return nil
+}
+
+// explainJoin prints the plan of a left-deep join: each join, above the join before it, or
+// a scan of the first table, and a scan of its table. The algorithm of a join but the first
+// is only known once the rows before it are, unless the command names one. If analyze is
+// set, the join is run, and what each join did, and the algorithm it used, is printed too.
+func explainJoin(spec *joinSpec, analyze bool, w io.Writer) error {
+	tables := spec.tables()
+	var runs []joinRun
+	pages := make([]int64, len(tables))
+	if analyze {
+		for i, table := range tables {
+			pages[i] = pagesRead(table.GetPager())
+		}
+		var err error
+		if runs, err = runJoins(context.Background(), spec, func([]utils.Entry) error { return nil }); err != nil {
+			return err
+		}
+		for i, table := range tables {
+			pages[i] = pagesRead(table.GetPager()) - pages[i]
+		}
+	}
+	// Estimate the rows of each join, and how many distinct entries of the table before the
+	// next one those rows are joined on.
+	rows := make([]int64, len(spec.steps))
+	for i, step := range spec.steps {
+		if i == 0 {
+			rows[0] = EstimateJoinRows(spec.first, step.table, step.onPrevKey, step.onKey, step.joinType)
+			continue
+		}
+		l, r := float64(rows[i-1]), float64(EstimateCardinality(step.table))
+		leftDistinct := math.Min(l, float64(estimateDistinct(tables[i], step.onPrevKey)))
+		rows[i] = estimateJoinRows(l, r, leftDistinct, float64(estimateDistinct(step.table, step.onKey)), step.joinType)
+	}
+	names := spec.names()
+	var explainStep func(i int, indent string) string
+	explainStep = func(i int, indent string) string {
+		step := spec.steps[i]
+		line := fmt.Sprintf("%v %v %v = %v %v", joinTypeDescriptions[step.joinType],
+			names[i], joinAttribute(step.onPrevKey), step.name, joinAttribute(step.onKey))
+		switch {
+		case analyze:
+			line = fmt.Sprintf("%v %v (est. cost %.0f pages, est. %v rows)", joinAlgorithmDescriptions[runs[i].algorithm], line, runs[i].cost, rows[i])
+		case i == 0:
+			cost := JoinCosts(spec.first, step.table, step.onPrevKey, step.onKey, step.joinType)[spec.algorithm]
+			line = fmt.Sprintf("%v %v (est. cost %.0f pages, est. %v rows)", joinAlgorithmDescriptions[spec.algorithm], line, cost, rows[i])
+		case spec.using:
+			line = fmt.Sprintf("%v %v (est. %v rows)", joinAlgorithmDescriptions[spec.algorithm], line, rows[i])
+		default:
+			line = fmt.Sprintf("%v (algorithm chosen when run, est. %v rows)", line, rows[i])
+		}
+		if analyze {
+			run := runs[i]
+			line += fmt.Sprintf(" (actual rows=%v time=%.3fms", run.rows, float64(run.elapsed.Microseconds())/1000)
+			switch run.algorithm {
+			case GraceHash:
+				line += fmt.Sprintf(" partitions probed=%v repartitions=%v filter positives=%v false positives=%v temp pages=%v",
+					run.stats.PartitionsProbed, run.stats.Repartitions, run.stats.FilterPositives, run.stats.FalsePositives, run.stats.TempPages)
+			case IndexNestedLoop:
+				line += fmt.Sprintf(" index probes=%v", run.stats.IndexProbes)
+			}
+			if run.spilled > 0 {
+				line += fmt.Sprintf(" spilled rows=%v", run.spilled)
+			}
+			line += ")"
+		}
+		lines := indent + line + "\n"
+		if i == 0 {
+			lines += explainScan(spec.firstName, spec.first, analyze, pages[0], indent+"  ")
+		} else {
+			lines += explainStep(i-1, indent+"  ")
+		}
+		return lines + explainScan(step.name, step.table, analyze, pages[i+1], indent+"  ")
+	}
+	io.WriteString(w, explainStep(len(spec.steps)-1, ""))
+	return nil
+}
+
+// explainScan prints the line of a plan that scans a table, with the pages read from it if
+// the plan was run.
+func explainScan(name string, table db.Index, analyze bool, pages int64, indent string) string {
+	line := fmt.Sprintf("%vscan %v (est. %v rows)", indent, name, EstimateCardinality(table))
+	if analyze {
+		line += fmt.Sprintf(" (actual pages=%v)", pages)
+	}
+	return line + "\n"
+}
+
+// joinAttribute names the attribute a table is joined on.
+func joinAttribute(useKey bool) string {
+	if useKey {
+		return "key"
+	}
+	return "val"
+}
+
+// pagesRead counts the pages requested from a pager so far.
+func pagesRead(p *pager.Pager) int64 {
+	stats := p.GetStats()
+	return stats.Hits + stats.Misses
+}
@@ -1,74 +1,152 @@
 package query
 
 import (
+	"bytes"
 	"context"
-	"errors"
-	"os"
+	"sync/atomic"
 
 	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
 	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
 	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 
 	errgroup "golang.org/x/sync/errgroup"
 )
 
-var DEFAULT_FILTER_SIZE int64 = 1024
+var HASH_JOIN_PARTITIONS int = 16             // Partitions grace hash join splits each table, or a partition too large to probe, into
+var HASH_JOIN_MEMORY int = 4096               // Entries of a left partition grace hash join holds in memory to probe it
+var HASH_JOIN_MAX_DEPTH int = 3               // Times a partition is split again before it is probed a block at a time
+var FILTER_FALSE_POSITIVE_RATE float64 = 0.01 // Rate of false positives a partition's bloom filter is sized for
 
-// Entry pair struct - output of a join.
+// Entry pair struct - output of a join. The side an outer, semi or anti join has no entry
+// for is nil, which is printed as null.
 type EntryPair struct {
 	l utils.Entry
 	r utils.Entry
 }
 
-// Int pair struct - to keep track of seen bucket pairs.
-type pair struct {
-	l int64
-	r int64
+// A partition is a spill file of the entries of a table, keyed by the attribute they are
+// joined on, whose keys share a hash.
+type partition struct {
+	file  *db.SpillFile
+	stats *JoinStats // Counts the pages of the file written and read.
 }
 
-// buildHashIndex constructs a temporary hash table for all the entries in the given sourceTable.
-func buildHashIndex(
-	sourceTable db.Index,
-	useKey bool,
-) (tempIndex *hash.HashIndex, dbName string, err error) {
-	// Get a temporary db file.
-	dbName, err = db.GetTempDB()
+// newPartition creates an empty partition.
+func newPartition(stats *JoinStats) (*partition, error) {
+	file, err := db.NewSpillFile()
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	// Init the temporary hash table.
-	tempIndex, err = hash.OpenTable(dbName)
-	if err != nil {
-		return nil, "", err
+	return &partition{file: file, stats: stats}, nil
+}
+
+// write adds an entry to the partition.
+func (part *partition) write(entry utils.Entry) error {
+	var buf bytes.Buffer
+	if _, err := db.WriteEntry(&buf, entry); err != nil {
+		return err
 	}
-	// Build the hash index.
-	var cur, e1 = sourceTable.TableStart()
-	if e1 != nil {
-		return nil, "", e1
+	return part.file.Write(buf.Bytes())
+}
+
+// entries returns the number of entries written to the partition.
+func (part *partition) entries() int64 {
+	return part.file.Records()
+}
+
+// finish flushes the entries written to the partition's file.
+func (part *partition) finish() error {
+	part.countPages()
+	return part.file.Rewind()
+}
+
+// countPages counts a pass over the partition's file into its stats.
+func (part *partition) countPages() {
+	atomic.AddInt64(&part.stats.TempPages, (part.file.Size()+pager.PAGESIZE-1)/pager.PAGESIZE)
+}
+
+// scan visits every entry of the partition, in the order they were written.
+func (part *partition) scan(visit func(utils.Entry) error) error {
+	if err := part.file.Rewind(); err != nil {
+		return err
 	}
-	// iterate all of entries
+	part.countPages()
 	for {
-		if cur.IsEnd() && cur.StepForward() {
-			break
-		} else if (!cur.IsEnd()) {
-			// get current entry
-			var entry, e2 = cur.GetEntry()
-			if e2 != nil {
-				return nil, "", e2
+		data, err := part.file.Read()
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			return nil
+		}
+		entry, err := db.ReadEntry(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if err := visit(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// removePartitions closes and deletes the files of the given partitions.
+func removePartitions(partitions []*partition) {
+	for _, part := range partitions {
+		if part != nil {
+			part.file.Remove()
+		}
+	}
+}
+
+// scanJoinEntries returns a function that visits every entry of a table, keyed by the
+// attribute it is joined on.
+func scanJoinEntries(table db.Index, useKey bool) func(func(utils.Entry) error) error {
+	return func(visit func(utils.Entry) error) error {
+		cursor, err := joinCursor(table, useKey)
+		if err != nil {
+			return err
+		}
+		for ; !cursor.IsEnd(); cursor.StepForward() {
+			entry, err := cursor.GetEntry()
+			if err != nil {
+				return err
 			}
-			// using key or value to join
-			if !useKey {
-				tempIndex.Insert(entry.GetValue(), entry.GetKey())
-			} else if useKey {
-				tempIndex.Insert(entry.GetKey(), entry.GetValue())
+			if err := visit(entry); err != nil {
+				return err
 			}
 		}
-		if cur.StepForward() {
-			break
+		return nil
+	}
+}
+
+// partitionEntries splits the entries scan visits into HASH_JOIN_PARTITIONS partitions by
+// the hash of their keys under the given seed. Seeds from 1 on are used, so the partitions
+// are independent of the hashes of the bloom filter, which derives them from xxhash and seed 0.
+func partitionEntries(scan func(func(utils.Entry) error) error, seed uint32, stats *JoinStats) (partitions []*partition, err error) {
+	partitions = make([]*partition, HASH_JOIN_PARTITIONS)
+	defer func() {
+		if err != nil {
+			removePartitions(partitions)
+		}
+	}()
+	for i := range partitions {
+		if partitions[i], err = newPartition(stats); err != nil {
+			return nil, err
+		}
+	}
+	err = scan(func(entry utils.Entry) error {
+		return partitions[hash.SeededHasher(entry.GetKey(), seed, int64(len(partitions)))].write(entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range partitions {
+		if err = part.finish(); err != nil {
+			return nil, err
 		}
 	}
-	return tempIndex, dbName, nil
-	// panic("function not yet implemented")
+	return partitions, nil
 }
 
 // sendResult attempts to send a single join result to the resultsChan channel as long as the errgroup hasn't been cancelled.
@@ -85,76 +163,144 @@ func sendResult(
 	}
 }
 
-// See which entries in rBucket have a match in lBucket.
-func probeBuckets(
+// joinPartitions joins a left partition with the right partition whose keys share its hash,
+// split depth times already. A left partition too large to hold in memory is split again,
+// along with the right one, by their hash under the next seed, unless it has been split
+// HASH_JOIN_MAX_DEPTH times, or splitting it again didn't make it smaller, as when every
+// entry shares one key; then it's probed a block at a time.
+func joinPartitions(
 	ctx context.Context,
-	resultsChan chan EntryPair,
-	lBucket *hash.HashBucket,
-	rBucket *hash.HashBucket,
+	emitter joinEmitter,
+	left *partition,
+	right *partition,
+	depth int,
 	joinOnLeftKey bool,
 	joinOnRightKey bool,
 ) error {
-	defer lBucket.GetPage().Put()
-	defer rBucket.GetPage().Put()
-	// Probe buckets.
-	// get entries from lBucket and rBucket
-	var entriesInL, err1 = lBucket.Select()
-	if err1 != nil {
-		return err1
-	}
-	var entriesInR, err2 = rBucket.Select()
-	if err2 != nil {
-		return err2
-	}
-	if int(lBucket.GetDepth()) != int(rBucket.GetDepth()) {
-		return errors.New("the size of lBucket is not equal with the size of rBucket")
-	}
-	// get the bloom filter, and add entriesInL's key in it
-	var bf = CreateFilter(DEFAULT_FILTER_SIZE)
-	for i := 0; i < len(entriesInL); i++{
-		var key = entriesInL[i].GetKey()
-		bf.Insert(key)
-	}
-	// start to iterate entries in right bucket
-	var rightRet hash.HashEntry
-	var leftRet hash.HashEntry
-	for i := 0; i < len(entriesInR); i++ {
-		// find a corresponding key in right bucket
-		if bf.Contains(entriesInR[i].GetKey()) {
-			// start to iterate left bucket
-			for j := 0; j < len(entriesInL); j++ {
-				if entriesInL[j].GetKey() == entriesInR[i].GetKey() {
-					// to see we need to join on left key or right key
-					if joinOnLeftKey {
-						leftRet.SetKey(entriesInL[j].GetKey())
-						leftRet.SetValue(entriesInL[j].GetValue())
-					} else {
-						leftRet.SetKey(entriesInL[j].GetValue())
-						leftRet.SetValue(entriesInL[j].GetKey())
-					}
-					if joinOnRightKey {
-						rightRet.SetKey(entriesInR[i].GetKey())
-						rightRet.SetValue(entriesInR[i].GetValue())
-					} else {
-						rightRet.SetKey(entriesInR[i].GetValue())
-						rightRet.SetValue(entriesInR[i].GetKey())
-					}
-					var pair = EntryPair{l: leftRet, r: rightRet}
-					var e = sendResult(ctx, resultsChan, pair)
-					if e != nil {
-						return e
-					}
+	if left.entries() == 0 && right.entries() == 0 {
+		return nil
+	}
+	if left.entries() <= int64(HASH_JOIN_MEMORY) || depth >= HASH_JOIN_MAX_DEPTH {
+		return probePartitions(ctx, emitter, left, right, joinOnLeftKey, joinOnRightKey)
+	}
+	stats := joinStatsOf(ctx)
+	atomic.AddInt64(&stats.Repartitions, 1)
+	seed := uint32(depth + 2)
+	lefts, err := partitionEntries(left.scan, seed, stats)
+	if err != nil {
+		return err
+	}
+	defer removePartitions(lefts)
+	rights, err := partitionEntries(right.scan, seed, stats)
+	if err != nil {
+		return err
+	}
+	defer removePartitions(rights)
+	for i := range lefts {
+		next := depth + 1
+		if lefts[i].entries() == left.entries() {
+			next = HASH_JOIN_MAX_DEPTH
+		}
+		if err := joinPartitions(ctx, emitter, lefts[i], rights[i], next, joinOnLeftKey, joinOnRightKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probePartitions reads a left partition into memory, a block of HASH_JOIN_MEMORY entries at
+// a time, hashed by key, then reads the right partition to probe each block, producing what
+// a join of the emitter's type does. Right entries whose keys a block's bloom filter rules
+// out are skipped, unless the join produces them without a match. If there is more than one
+// block, which right entries have a match is only known after the last, so if the join
+// produces them either way, the right partition is read once more.
+func probePartitions(
+	ctx context.Context,
+	emitter joinEmitter,
+	left *partition,
+	right *partition,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+) error {
+	stats := joinStatsOf(ctx)
+	atomic.AddInt64(&stats.PartitionsProbed, 1)
+	useFilter := !emitter.joinType.keepsRight()
+	oneBlock := left.entries() <= int64(HASH_JOIN_MEMORY)
+	rightMatched := make([]bool, right.entries())
+	entries, block := make([]utils.Entry, 0), make(map[int64][]int)
+	probe := func() error {
+		var filter *BloomFilter
+		if useFilter {
+			filter = db.NewOptimalFilter(int64(len(block)), FILTER_FALSE_POSITIVE_RATE)
+			for key := range block {
+				filter.Insert(key)
+			}
+		}
+		matched := make([]bool, len(entries))
+		i := 0
+		err := right.scan(func(entry utils.Entry) error {
+			defer func() { i++ }()
+			if useFilter {
+				if !filter.Contains(entry.GetKey()) {
+					return nil
+				}
+				atomic.AddInt64(&stats.FilterPositives, 1)
+			}
+			rightEntry := restoreEntry(entry, joinOnRightKey)
+			for _, j := range block[entry.GetKey()] {
+				matched[j], rightMatched[i] = true, true
+				if err := emitter.match(entries[j], rightEntry); err != nil {
+					return err
 				}
 			}
-		} else {
-			continue
+			if useFilter && len(block[entry.GetKey()]) == 0 {
+				atomic.AddInt64(&stats.FalsePositives, 1)
+			}
+			if oneBlock {
+				return emitter.right(rightEntry, rightMatched[i])
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// then the left entries, now that it's known which have a match
+		for j, entry := range entries {
+			if err := emitter.left(entry, matched[j]); err != nil {
+				return err
+			}
 		}
+		entries, block = entries[:0], make(map[int64][]int)
+		return nil
 	}
-	return nil
-	// panic("function not yet implemented")
+	err := left.scan(func(entry utils.Entry) error {
+		block[entry.GetKey()] = append(block[entry.GetKey()], len(entries))
+		entries = append(entries, restoreEntry(entry, joinOnLeftKey))
+		if len(entries) == HASH_JOIN_MEMORY {
+			return probe()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// With no left entries, the right ones are still produced if the join keeps them.
+	if len(entries) > 0 || (left.entries() == 0 && emitter.joinType.keepsRight()) {
+		if err := probe(); err != nil {
+			return err
+		}
+	}
+	if oneBlock || !emitter.joinType.keepsRight() {
+		return nil
+	}
+	i := 0
+	return right.scan(func(entry utils.Entry) error {
+		defer func() { i++ }()
+		return emitter.right(restoreEntry(entry, joinOnRightKey), rightMatched[i])
+	})
 }
 
-// Join leftTable on rightTable using Grace Hash Join.
+// Join leftTable on rightTable using Grace Hash Join, producing the pairs that match.
 func Join(
 	ctx context.Context,
 	leftTable db.Index,
@@ -162,60 +308,43 @@ func Join(
 	joinOnLeftKey bool,
 	joinOnRightKey bool,
 ) (chan EntryPair, context.Context, *errgroup.Group, func(), error) {
-	leftHashIndex, leftDbName, err := buildHashIndex(leftTable, joinOnLeftKey)
+	return GraceHashJoin(ctx, leftTable, rightTable, joinOnLeftKey, joinOnRightKey, InnerJoin)
+}
+
+// Join leftTable on rightTable using Grace Hash Join, producing what a join of the given
+// type does. Both tables are split into partitions by the hash of the attribute they are
+// joined on, and each left partition is probed, in parallel, with the one right partition
+// its entries can match, so each entry's match, or lack of one, is found in one place.
+func GraceHashJoin(
+	ctx context.Context,
+	leftTable db.Index,
+	rightTable db.Index,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	joinType JoinType,
+) (chan EntryPair, context.Context, *errgroup.Group, func(), error) {
+	stats := joinStatsOf(ctx)
+	lefts, err := partitionEntries(scanJoinEntries(leftTable, joinOnLeftKey), 1, stats)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
-	rightHashIndex, rightDbName, err := buildHashIndex(rightTable, joinOnRightKey)
+	rights, err := partitionEntries(scanJoinEntries(rightTable, joinOnRightKey), 1, stats)
 	if err != nil {
-		os.Remove(leftDbName)
-		os.Remove(leftDbName + ".meta")
+		removePartitions(lefts)
 		return nil, nil, nil, nil, err
 	}
 	cleanupCallback := func() {
-		os.Remove(leftDbName)
-		os.Remove(leftDbName + ".meta")
-		os.Remove(rightDbName)
-		os.Remove(rightDbName + ".meta")
-	}
-	// Make both hash indices the same global size.
-	leftHashTable := leftHashIndex.GetTable()
-	rightHashTable := rightHashIndex.GetTable()
-	for leftHashTable.GetDepth() != rightHashTable.GetDepth() {
-		if leftHashTable.GetDepth() < rightHashTable.GetDepth() {
-			// Split the left table
-			leftHashTable.ExtendTable()
-		} else {
-			// Split the right table
-			rightHashTable.ExtendTable()
-		}
-	}
-	// Probe phase: match buckets to buckets and emit entries that match.
+		removePartitions(lefts)
+		removePartitions(rights)
+	}
+	// Probe phase: match partitions to partitions and emit entries that match.
 	group, ctx := errgroup.WithContext(ctx)
 	resultsChan := make(chan EntryPair, 1024)
-	// Iterate through hash buckets, keeping track of pairs we've seen before.
-	leftBuckets := leftHashTable.GetBuckets()
-	rightBuckets := rightHashTable.GetBuckets()
-	seenList := make(map[pair]bool)
-	for i, lBucketPN := range leftBuckets {
-		rBucketPN := rightBuckets[i]
-		bucketPair := pair{l: lBucketPN, r: rBucketPN}
-		if _, seen := seenList[bucketPair]; seen {
-			continue
-		}
-		seenList[bucketPair] = true
-
-		lBucket, err := leftHashTable.GetBucketByPN(lBucketPN)
-		if err != nil {
-			return nil, nil, nil, cleanupCallback, err
-		}
-		rBucket, err := rightHashTable.GetBucketByPN(rBucketPN)
-		if err != nil {
-			lBucket.GetPage().Put()
-			return nil, nil, nil, cleanupCallback, err
-		}
+	emitter := joinEmitter{ctx: ctx, resultsChan: resultsChan, joinType: joinType}
+	for i := range lefts {
+		left, right := lefts[i], rights[i]
 		group.Go(func() error {
-			return probeBuckets(ctx, resultsChan, lBucket, rBucket, joinOnLeftKey, joinOnRightKey)
+			return joinPartitions(ctx, emitter, left, right, 0, joinOnLeftKey, joinOnRightKey)
 		})
 	}
 	return resultsChan, ctx, group, cleanupCallback, nil
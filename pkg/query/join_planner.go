@@ -0,0 +1,203 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+
+	errgroup "golang.org/x/sync/errgroup"
+)
+
+var PAGE_FILL_FACTOR float64 = 2.0 / 3 // How full pages are assumed to be when estimating cardinality
+var CARDINALITY_SCAN_PAGES int64 = 8   // Tables with at most this many pages are counted, not estimated
+
+// A JoinAlgorithm is a way to join two tables.
+type JoinAlgorithm int
+
+const (
+	SortMerge JoinAlgorithm = iota
+	IndexNestedLoop
+	BlockNestedLoop
+	GraceHash
+)
+
+var joinAlgorithmNames = map[JoinAlgorithm]string{SortMerge: "merge", IndexNestedLoop: "index", BlockNestedLoop: "block", GraceHash: "hash"}
+
+// String returns the name of the join algorithm.
+func (algorithm JoinAlgorithm) String() string {
+	return joinAlgorithmNames[algorithm]
+}
+
+// ParseJoinAlgorithm returns the join algorithm with the given name.
+func ParseJoinAlgorithm(name string) (JoinAlgorithm, error) {
+	for algorithm, algorithmName := range joinAlgorithmNames {
+		if algorithmName == name {
+			return algorithm, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown join algorithm %v", name)
+}
+
+// A JoinFunc joins leftTable on rightTable, sending each pair of entries a join of the
+// given type produces on the returned channel until the returned group is done.
+type JoinFunc func(
+	ctx context.Context,
+	leftTable db.Index,
+	rightTable db.Index,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	joinType JoinType,
+) (chan EntryPair, context.Context, *errgroup.Group, func(), error)
+
+// Func returns the function that joins with the algorithm.
+func (algorithm JoinAlgorithm) Func() JoinFunc {
+	switch algorithm {
+	case SortMerge:
+		return SortMergeJoin
+	case IndexNestedLoop:
+		return IndexNestedLoopJoin
+	case BlockNestedLoop:
+		return BlockNestedLoopJoin
+	default:
+		return GraceHashJoin
+	}
+}
+
+// EstimateCardinality estimates the number of entries in a table: its row count if it has
+// been analyzed, and otherwise from its number of pages. Small tables, whose few pages may
+// be mostly empty, are counted instead.
+func EstimateCardinality(table db.Index) int64 {
+	if stats := db.GetStats(table); stats != nil {
+		return stats.RowCount()
+	}
+	p := table.GetPager()
+	if p.GetNumPages() <= CARDINALITY_SCAN_PAGES {
+		if cursor, err := db.TableCursor(table); err == nil {
+			n := int64(0)
+			for ; !cursor.IsEnd(); cursor.StepForward() {
+				n++
+			}
+			return n
+		}
+	}
+	perPage := hash.BucketSize(p.GetPageSize())
+	if _, isBTree := db.PrimaryIndex(table).(*btree.BTreeIndex); isBTree {
+		perPage = btree.EntriesPerLeafNode(p.GetPageSize())
+	}
+	return int64(math.Ceil(float64(p.GetNumPages()*perPage) * PAGE_FILL_FACTOR))
+}
+
+// estimateDistinct estimates the number of distinct keys or values of a table's entries:
+// from its stats if it has been analyzed, and otherwise assuming no two are the same.
+func estimateDistinct(table db.Index, useKey bool) int64 {
+	stats := db.GetStats(table)
+	// Only the values of tables of (key, value) pairs are a column.
+	if stats == nil || (!useKey && len(stats.Columns) != 2) {
+		return EstimateCardinality(table)
+	}
+	if useKey {
+		return stats.Distinct(0)
+	}
+	return stats.Distinct(1)
+}
+
+// EstimateJoinRows estimates the pairs of entries a join of the given type produces,
+// assuming each key or value on the side with fewer distinct ones matches on the other
+// side, and that entries are spread evenly over the distinct keys or values.
+func EstimateJoinRows(leftTable db.Index, rightTable db.Index, joinOnLeftKey bool, joinOnRightKey bool, joinType JoinType) int64 {
+	l, r := float64(EstimateCardinality(leftTable)), float64(EstimateCardinality(rightTable))
+	leftDistinct := float64(estimateDistinct(leftTable, joinOnLeftKey))
+	rightDistinct := float64(estimateDistinct(rightTable, joinOnRightKey))
+	return estimateJoinRows(l, r, leftDistinct, rightDistinct, joinType)
+}
+
+// estimateJoinRows estimates the pairs a join of the given type produces from the entries
+// of each side, and their distinct keys or values.
+func estimateJoinRows(l float64, r float64, leftDistinct float64, rightDistinct float64, joinType JoinType) int64 {
+	// The pairs that match, and the entries of either side without a match.
+	inner, leftUnmatched, rightUnmatched := 0.0, l, r
+	if leftDistinct > 0 && rightDistinct > 0 {
+		matching := math.Min(leftDistinct, rightDistinct)
+		inner = l * r / math.Max(leftDistinct, rightDistinct)
+		leftUnmatched = l * (leftDistinct - matching) / leftDistinct
+		rightUnmatched = r * (rightDistinct - matching) / rightDistinct
+	}
+	rows := inner
+	switch joinType {
+	case LeftOuterJoin:
+		rows = inner + leftUnmatched
+	case RightOuterJoin:
+		rows = inner + rightUnmatched
+	case FullOuterJoin:
+		rows = inner + leftUnmatched + rightUnmatched
+	case SemiJoin:
+		rows = l - leftUnmatched
+	case AntiJoin:
+		rows = leftUnmatched
+	}
+	return int64(math.Round(rows))
+}
+
+// probeCost estimates the pages read to look a key up in a table: one bucket of a hash
+// table, or one node per level of a btree table.
+func probeCost(table db.Index) float64 {
+	p := table.GetPager()
+	if _, isBTree := db.PrimaryIndex(table).(*btree.BTreeIndex); !isBTree {
+		return 1
+	}
+	fanout := float64(btree.KeysPerInternalNode(p.GetPageSize())) * PAGE_FILL_FACTOR
+	return 1 + math.Ceil(math.Log(math.Max(float64(p.GetNumPages()), 1))/math.Log(fanout))
+}
+
+// JoinCosts estimates the pages each algorithm that can join two tables with a join of the
+// given type reads and writes.
+func JoinCosts(leftTable db.Index, rightTable db.Index, joinOnLeftKey bool, joinOnRightKey bool, joinType JoinType) map[JoinAlgorithm]float64 {
+	l, r := float64(EstimateCardinality(leftTable)), float64(EstimateCardinality(rightTable))
+	lPages, rPages := float64(leftTable.GetPager().GetNumPages()), float64(rightTable.GetPager().GetNumPages())
+	// Sorting a table that doesn't fit in memory writes and reads back its runs.
+	sortCost := func(table db.Index, useKey bool, n float64, pages float64) float64 {
+		if isSorted(table, useKey) || n <= float64(db.LOAD_RUN_SIZE) {
+			return pages
+		}
+		return 3 * pages
+	}
+	costs := map[JoinAlgorithm]float64{
+		// Both tables are read, written to partition files, and read back.
+		GraceHash: 3 * (lPages + rPages),
+		SortMerge: sortCost(leftTable, joinOnLeftKey, l, lPages) + sortCost(rightTable, joinOnRightKey, r, rPages),
+	}
+	// The smaller table is the outer one, and the larger is read once more if its entries
+	// without a match are produced, or those with one are.
+	outerPages, innerPages, outerRows, keepsInner := lPages, rPages, l, joinType.keepsRight()
+	if l > r {
+		outerPages, innerPages, outerRows, keepsInner = rPages, lPages, r, joinType.keepsLeft() || joinType == SemiJoin
+	}
+	costs[BlockNestedLoop] = outerPages + math.Ceil(outerRows/float64(JOIN_BLOCK_SIZE))*innerPages
+	if keepsInner {
+		costs[BlockNestedLoop] += innerPages
+	}
+	if probeRight, err := indexJoinDirection(leftTable, rightTable, joinOnLeftKey, joinOnRightKey, joinType); err == nil && probeRight {
+		costs[IndexNestedLoop] = lPages + l*probeCost(rightTable)
+	} else if err == nil {
+		costs[IndexNestedLoop] = rPages + r*probeCost(leftTable)
+	}
+	return costs
+}
+
+// ChooseJoin picks the algorithm estimated to join two tables with a join of the given type
+// most cheaply, from their cardinality and index types.
+func ChooseJoin(leftTable db.Index, rightTable db.Index, joinOnLeftKey bool, joinOnRightKey bool, joinType JoinType) JoinAlgorithm {
+	costs := JoinCosts(leftTable, rightTable, joinOnLeftKey, joinOnRightKey, joinType)
+	best := GraceHash
+	// Ties go to grace hash join, which probes partitions in parallel, then in this order.
+	for _, algorithm := range []JoinAlgorithm{SortMerge, IndexNestedLoop, BlockNestedLoop} {
+		if cost, ok := costs[algorithm]; ok && cost < costs[best] {
+			best = algorithm
+		}
+	}
+	return best
+}
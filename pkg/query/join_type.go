@@ -0,0 +1,90 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+// A JoinType is which pairs a join produces. Besides the pairs that match, outer joins
+// produce each entry of the outer side without a match, paired with null, which is a nil
+// entry. Semi and anti joins produce the left entries with and without a match, each once
+// and paired with null: the left entries whose key or value is in, or not in, the other
+// table.
+type JoinType int
+
+const (
+	InnerJoin JoinType = iota
+	LeftOuterJoin
+	RightOuterJoin
+	FullOuterJoin
+	SemiJoin
+	AntiJoin
+)
+
+var joinTypeNames = map[JoinType]string{InnerJoin: "inner", LeftOuterJoin: "left", RightOuterJoin: "right", FullOuterJoin: "full", SemiJoin: "semi", AntiJoin: "anti"}
+
+// String returns the name of the join type.
+func (joinType JoinType) String() string {
+	return joinTypeNames[joinType]
+}
+
+// ParseJoinType returns the join type with the given name.
+func ParseJoinType(name string) (JoinType, error) {
+	for joinType, typeName := range joinTypeNames {
+		if typeName == name {
+			return joinType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown join type %v", name)
+}
+
+// keepsLeft checks whether the join produces left entries without a match.
+func (joinType JoinType) keepsLeft() bool {
+	return joinType == LeftOuterJoin || joinType == FullOuterJoin || joinType == AntiJoin
+}
+
+// keepsRight checks whether the join produces right entries without a match. Such a join
+// can't skip a right entry because no left entry may match it.
+func (joinType JoinType) keepsRight() bool {
+	return joinType == RightOuterJoin || joinType == FullOuterJoin
+}
+
+// pairsMatches checks whether the join produces the pairs that match, rather than only
+// left entries.
+func (joinType JoinType) pairsMatches() bool {
+	return joinType != SemiJoin && joinType != AntiJoin
+}
+
+// A joinEmitter sends what a join of some type produces for the entries it has matched,
+// or found no match for, to the results channel.
+type joinEmitter struct {
+	ctx         context.Context
+	resultsChan chan EntryPair
+	joinType    JoinType
+}
+
+// match is called with each pair of entries that match.
+func (emitter joinEmitter) match(l utils.Entry, r utils.Entry) error {
+	if !emitter.joinType.pairsMatches() {
+		return nil
+	}
+	return sendResult(emitter.ctx, emitter.resultsChan, EntryPair{l: l, r: r})
+}
+
+// left is called once with each left entry, once whether it has a match is known.
+func (emitter joinEmitter) left(l utils.Entry, matched bool) error {
+	if (matched && emitter.joinType == SemiJoin) || (!matched && emitter.joinType.keepsLeft()) {
+		return sendResult(emitter.ctx, emitter.resultsChan, EntryPair{l: l})
+	}
+	return nil
+}
+
+// right is called once with each right entry, once whether it has a match is known.
+func (emitter joinEmitter) right(r utils.Entry, matched bool) error {
+	if !matched && emitter.joinType.keepsRight() {
+		return sendResult(emitter.ctx, emitter.resultsChan, EntryPair{r: r})
+	}
+	return nil
+}
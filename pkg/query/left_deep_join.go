@@ -0,0 +1,384 @@
+package query
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+)
+
+var LEFT_DEEP_JOIN_MEMORY int = 4096 // Rows each join of a left-deep join but the last holds in memory for the next, before spilling the rest to a temp file
+
+// A joinRun is what one join of a left-deep join did.
+type joinRun struct {
+	algorithm JoinAlgorithm
+	cost      float64 // The pages the algorithm was estimated to read and write.
+	rows      int64
+	spilled   int64 // Rows it produced that were spilled to a temp file for the next join.
+	elapsed   time.Duration
+	stats     JoinStats
+}
+
+// joinRows are the rows a join of a left-deep join produces for the next, of a fixed number of
+// entries. The first LEFT_DEEP_JOIN_MEMORY are held in memory, and the rest spilled to a temp
+// file, each entry as a byte that is 0 if it is null, then the entry as db.WriteEntry writes
+// it. The offset of each spilled row is kept so it can be read back by its position.
+type joinRows struct {
+	width   int // Entries in each row.
+	memory  [][]utils.Entry
+	file    *os.File
+	writer  *bufio.Writer
+	offsets []int64 // Offsets of the spilled rows in the file.
+	size    int64   // Bytes spilled to the file.
+}
+
+// add adds a row, spilling it if those in memory are full.
+func (rows *joinRows) add(row []utils.Entry) error {
+	if len(rows.memory) < LEFT_DEEP_JOIN_MEMORY {
+		rows.memory = append(rows.memory, row)
+		return nil
+	}
+	if rows.file == nil {
+		name, err := db.GetTempDB()
+		if err != nil {
+			return err
+		}
+		if rows.file, err = os.OpenFile(name, os.O_RDWR, 0666); err != nil {
+			os.Remove(name)
+			return err
+		}
+		rows.writer = bufio.NewWriter(rows.file)
+	}
+	rows.offsets = append(rows.offsets, rows.size)
+	for _, entry := range row {
+		present := byte(1)
+		if entry == nil {
+			present = 0
+		}
+		if err := rows.writer.WriteByte(present); err != nil {
+			return err
+		}
+		rows.size++
+		if entry != nil {
+			n, err := db.WriteEntry(rows.writer, entry)
+			rows.size += int64(n)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spilled returns the number of rows spilled to the file.
+func (rows *joinRows) spilled() int64 {
+	return int64(len(rows.offsets))
+}
+
+// finish flushes the rows spilled to the file, so they can be read back.
+func (rows *joinRows) finish() error {
+	if rows.writer == nil {
+		return nil
+	}
+	return rows.writer.Flush()
+}
+
+// read reads a spilled row.
+func (rows *joinRows) read(reader *bufio.Reader) ([]utils.Entry, error) {
+	row := make([]utils.Entry, rows.width)
+	for i := range row {
+		present, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if present == 0 {
+			continue
+		}
+		if row[i], err = db.ReadEntry(reader); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+// get returns the row at the given position.
+func (rows *joinRows) get(position int64) ([]utils.Entry, error) {
+	if position < int64(len(rows.memory)) {
+		return rows.memory[position], nil
+	}
+	position -= int64(len(rows.memory))
+	end := rows.size
+	if position+1 < rows.spilled() {
+		end = rows.offsets[position+1]
+	}
+	offset := rows.offsets[position]
+	return rows.read(bufio.NewReader(io.NewSectionReader(rows.file, offset, end-offset)))
+}
+
+// scan returns a function that returns each row in turn, and nil once there are no more.
+func (rows *joinRows) scan() func() ([]utils.Entry, error) {
+	position := 0
+	var reader *bufio.Reader
+	return func() ([]utils.Entry, error) {
+		if position < len(rows.memory) {
+			position++
+			return rows.memory[position-1], nil
+		}
+		if position == len(rows.memory)+len(rows.offsets) {
+			return nil, nil
+		}
+		if reader == nil {
+			reader = bufio.NewReader(io.NewSectionReader(rows.file, 0, rows.size))
+		}
+		position++
+		return rows.read(reader)
+	}
+}
+
+// remove closes and deletes the file rows were spilled to.
+func (rows *joinRows) remove() {
+	if rows.file != nil {
+		rows.file.Close()
+		os.Remove(rows.file.Name())
+	}
+}
+
+// runJoins runs a left-deep join, passing each row it produces, an entry per table, or nil
+// where a table has none, to emit. The rows each join but the last produces are held as
+// joinRows, and joined with the next table through a temporary btree table of the entries
+// they are joined on, keyed by their position; its algorithm is chosen once the rows are
+// known, unless the command names one. Returns what each join did.
+func runJoins(ctx context.Context, spec *joinSpec, emit func([]utils.Entry) error) ([]joinRun, error) {
+	runs := make([]joinRun, len(spec.steps))
+	var rows *joinRows
+	defer func() {
+		if rows != nil {
+			rows.remove()
+		}
+	}()
+	for i := range spec.steps {
+		next := &joinRows{width: i + 2}
+		produce := func(row []utils.Entry) error {
+			runs[i].rows++
+			if i == len(spec.steps)-1 {
+				return emit(row)
+			}
+			return next.add(row)
+		}
+		start := time.Now()
+		var err error
+		if i == 0 {
+			step := spec.steps[0]
+			runs[0].algorithm = spec.algorithm
+			runs[0].cost = JoinCosts(spec.first, step.table, step.onPrevKey, step.onKey, step.joinType)[spec.algorithm]
+			err = runJoin(WithJoinStats(ctx, &runs[0].stats), spec.algorithm, spec.first, step.table, step.onPrevKey, step.onKey, step.joinType, func(pair EntryPair) error {
+				return produce([]utils.Entry{pair.l, pair.r})
+			})
+		} else {
+			err = joinRowsWith(ctx, spec, i, rows, &runs[i], produce)
+		}
+		if err == nil {
+			err = next.finish()
+		}
+		runs[i].elapsed, runs[i].spilled = time.Since(start), next.spilled()
+		if rows != nil {
+			rows.remove()
+		}
+		rows = next
+		if err != nil {
+			return runs, err
+		}
+	}
+	return runs, nil
+}
+
+// joinRowsWith runs the i-th join of a left-deep join, of the rows the joins before produced
+// with its table, passing each row it produces to produce.
+func joinRowsWith(ctx context.Context, spec *joinSpec, i int, rows *joinRows, run *joinRun, produce func([]utils.Entry) error) error {
+	step := spec.steps[i]
+	extend := func(row []utils.Entry, entry utils.Entry) []utils.Entry {
+		return append(append(make([]utils.Entry, 0, len(row)+1), row...), entry)
+	}
+	// A row without an entry of the table before, which is null, has no match.
+	scan, position, prevTable := rows.scan(), int64(-1), spec.tables()[i]
+	rowIndex, cleanup, err := buildRowIndex(&scanCursor{next: func() (utils.Entry, error) {
+		for {
+			row, err := scan()
+			if row == nil || err != nil {
+				return nil, err
+			}
+			position++
+			if row[i] != nil {
+				var entry hash.HashEntry
+				entry.SetKey(position)
+				if step.onPrevKey {
+					entry.SetValue(row[i].GetKey())
+				} else if err := checkJoinable(prevTable, row[i]); err != nil {
+					return nil, err
+				} else {
+					entry.SetValue(row[i].GetValue())
+				}
+				return entry, nil
+			}
+			if step.joinType.keepsLeft() {
+				if err := produce(extend(row, nil)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	costs := JoinCosts(rowIndex, step.table, false, step.onKey, step.joinType)
+	run.algorithm = spec.algorithm
+	if !spec.using {
+		run.algorithm = ChooseJoin(rowIndex, step.table, false, step.onKey, step.joinType)
+	}
+	run.cost = costs[run.algorithm]
+	return runJoin(WithJoinStats(ctx, &run.stats), run.algorithm, rowIndex, step.table, false, step.onKey, step.joinType, func(pair EntryPair) error {
+		if pair.l == nil {
+			return produce(extend(make([]utils.Entry, i+1), pair.r))
+		}
+		row, err := rows.get(pair.l.GetKey())
+		if err != nil {
+			return err
+		}
+		return produce(extend(row, pair.r))
+	})
+}
+
+// A scanCursor is a cursor over the entries next returns, until it returns nil. An error
+// next returns is returned by GetEntry.
+type scanCursor struct {
+	next    func() (utils.Entry, error)
+	entry   utils.Entry
+	err     error
+	started bool
+}
+
+func (cursor *scanCursor) start() {
+	if !cursor.started {
+		cursor.started = true
+		cursor.entry, cursor.err = cursor.next()
+	}
+}
+
+// StepForward moves the cursor ahead by one entry. Returns true at the end.
+func (cursor *scanCursor) StepForward() bool {
+	cursor.start()
+	if cursor.err == nil && cursor.entry != nil {
+		cursor.entry, cursor.err = cursor.next()
+	}
+	return cursor.IsEnd()
+}
+
+// IsEnd returns true if at end.
+func (cursor *scanCursor) IsEnd() bool {
+	cursor.start()
+	return cursor.entry == nil && cursor.err == nil
+}
+
+// GetEntry returns the entry currently pointed to by the cursor.
+func (cursor *scanCursor) GetEntry() (utils.Entry, error) {
+	cursor.start()
+	if cursor.err != nil {
+		return nil, cursor.err
+	}
+	return cursor.entry, nil
+}
+
+// buildRowIndex loads the entries of a cursor, sorted by key, into a temporary btree table,
+// returning it and a function that removes it.
+func buildRowIndex(cursor utils.Cursor) (*btree.BTreeIndex, func(), error) {
+	dbName, err := db.GetTempDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	rowIndex, err := btree.OpenTable(dbName)
+	if err != nil {
+		os.Remove(dbName)
+		return nil, nil, err
+	}
+	cleanup := func() {
+		rowIndex.Close()
+		os.Remove(dbName)
+	}
+	if err = btree.BulkLoad(rowIndex, cursor, 1); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return rowIndex, cleanup, nil
+}
+
+// joinColumns names and types the columns of the rows a left-deep join produces, as a table
+// holds them: the columns of each table's entry, after the name of the table, numbered from
+// its second appearance on. Those of a table with a schema are the columns of its rows, and
+// those of any other an int key and value. A table a semi or anti join is with has none, as
+// its entry is always null.
+func joinColumns(d *db.Database, spec *joinSpec) []db.Column {
+	columns := make([]db.Column, 0)
+	seen := make(map[string]int)
+	schemas := spec.schemas(d)
+	for i, name := range spec.names() {
+		seen[name]++
+		if i > 0 && !spec.steps[i-1].joinType.pairsMatches() {
+			continue
+		}
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%v_%v", name, seen[name])
+		}
+		if schemas[i] == nil {
+			columns = append(columns, db.Column{Name: name + "_key", Type: db.IntColumn}, db.Column{Name: name + "_value", Type: db.IntColumn})
+			continue
+		}
+		for _, column := range schemas[i].Columns {
+			columns = append(columns, db.Column{Name: name + "_" + column.Name, Type: column.Type})
+		}
+	}
+	return columns
+}
+
+// joinTableSource runs a join command so a table can be created from the rows it produces,
+// the columns of each of their entries.
+func joinTableSource(d *db.Database, command string) ([]db.Column, func(func(db.Row) error) error, error) {
+	spec, err := parseJoin(d, command)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, schemas := joinColumns(d, spec), spec.schemas(d)
+	run := func(visit func(db.Row) error) error {
+		_, err := runJoins(context.Background(), spec, func(entries []utils.Entry) error {
+			row := make(db.Row, 0, len(columns))
+			for i, entry := range entries {
+				if i > 0 && !spec.steps[i-1].joinType.pairsMatches() {
+					continue
+				}
+				if entry == nil {
+					width := 2
+					if schemas[i] != nil {
+						width = len(schemas[i].Columns)
+					}
+					row = append(row, make(db.Row, width)...)
+					continue
+				}
+				values, err := db.EntryRow(schemas[i], entry)
+				if err != nil {
+					return err
+				}
+				row = append(row, values...)
+			}
+			return visit(row)
+		})
+		return err
+	}
+	return columns, run, nil
+}
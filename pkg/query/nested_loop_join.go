@@ -0,0 +1,208 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+
+	errgroup "golang.org/x/sync/errgroup"
+)
+
+var JOIN_BLOCK_SIZE int = 4096 // Entries of the outer table block nested loop join holds in memory at a time
+
+// indexJoinDirection decides which table index nested loop join looks entries up in, which
+// must be joined on its key: the right table, unless only the left one is joined on its
+// key, or both are and the left one is larger. Outer, semi and anti joins must read every
+// entry of the side they keep entries of without a match, so they look entries up in the
+// other side, and a full outer join can't be done by looking entries up.
+func indexJoinDirection(
+	leftTable db.Index,
+	rightTable db.Index,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	joinType JoinType,
+) (probeRight bool, err error) {
+	switch {
+	case joinType == FullOuterJoin:
+		return false, errors.New("index nested loop join can't do a full outer join")
+	case joinType == RightOuterJoin:
+		if !joinOnLeftKey {
+			return false, errors.New("index nested loop join needs the left table joined on its key for a right outer join")
+		}
+		return false, nil
+	case joinType != InnerJoin:
+		if !joinOnRightKey {
+			return false, fmt.Errorf("index nested loop join needs the right table joined on its key for a %v join", joinType)
+		}
+		return true, nil
+	case !joinOnLeftKey && !joinOnRightKey:
+		return false, errors.New("index nested loop join needs a table joined on its key")
+	}
+	return joinOnRightKey && (!joinOnLeftKey || EstimateCardinality(leftTable) <= EstimateCardinality(rightTable)), nil
+}
+
+// Join leftTable on rightTable using Index Nested Loop Join: each entry of one table is
+// looked up in the other, which must be joined on its key. If both tables are joined on
+// their keys, entries of the smaller one are looked up in the larger.
+func IndexNestedLoopJoin(
+	ctx context.Context,
+	leftTable db.Index,
+	rightTable db.Index,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	joinType JoinType,
+) (chan EntryPair, context.Context, *errgroup.Group, func(), error) {
+	probeRight, err := indexJoinDirection(leftTable, rightTable, joinOnLeftKey, joinOnRightKey, joinType)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	outerTable, innerTable, joinOnOuterKey := leftTable, rightTable, joinOnLeftKey
+	if !probeRight {
+		outerTable, innerTable, joinOnOuterKey = rightTable, leftTable, joinOnRightKey
+	}
+	outer, err := joinCursor(outerTable, joinOnOuterKey)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	stats := joinStatsOf(ctx)
+	group, ctx := errgroup.WithContext(ctx)
+	resultsChan := make(chan EntryPair, 1024)
+	emitter := joinEmitter{ctx: ctx, resultsChan: resultsChan, joinType: joinType}
+	group.Go(func() error {
+		for ; !outer.IsEnd(); outer.StepForward() {
+			entry, err := outer.GetEntry()
+			if err != nil {
+				return err
+			}
+			// Find errors if there is no entry under the key.
+			atomic.AddInt64(&stats.IndexProbes, 1)
+			match, findErr := innerTable.Find(entry.GetKey())
+			matched := findErr == nil
+			entry = restoreEntry(entry, joinOnOuterKey)
+			if probeRight {
+				if matched {
+					if err := emitter.match(entry, match); err != nil {
+						return err
+					}
+				}
+				if err := emitter.left(entry, matched); err != nil {
+					return err
+				}
+			} else {
+				if matched {
+					if err := emitter.match(match, entry); err != nil {
+						return err
+					}
+				}
+				if err := emitter.right(entry, matched); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return resultsChan, ctx, group, func() {}, nil
+}
+
+// Join leftTable on rightTable using Block Nested Loop Join: the smaller table is read in
+// blocks of JOIN_BLOCK_SIZE entries, hashed in memory by the attribute they are joined on,
+// and the larger table is read once per block to probe them. Which entries of the larger
+// table have a match is only known after the last block, so if the join produces them
+// either way, the larger table is read once more at the end.
+func BlockNestedLoopJoin(
+	ctx context.Context,
+	leftTable db.Index,
+	rightTable db.Index,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	joinType JoinType,
+) (chan EntryPair, context.Context, *errgroup.Group, func(), error) {
+	leftOuter := EstimateCardinality(leftTable) <= EstimateCardinality(rightTable)
+	outerTable, innerTable, joinOnOuterKey, joinOnInnerKey := leftTable, rightTable, joinOnLeftKey, joinOnRightKey
+	if !leftOuter {
+		outerTable, innerTable, joinOnOuterKey, joinOnInnerKey = rightTable, leftTable, joinOnRightKey, joinOnLeftKey
+	}
+	outer, err := joinCursor(outerTable, joinOnOuterKey)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	group, ctx := errgroup.WithContext(ctx)
+	resultsChan := make(chan EntryPair, 1024)
+	emitter := joinEmitter{ctx: ctx, resultsChan: resultsChan, joinType: joinType}
+	// emit produces a pair of outer and inner entries that match, and emitOuter and
+	// emitInner an entry of either side once whether it has a match is known.
+	emit, emitOuter, emitInner := emitter.match, emitter.left, emitter.right
+	if !leftOuter {
+		emit = func(outer utils.Entry, inner utils.Entry) error { return emitter.match(inner, outer) }
+		emitOuter, emitInner = emitter.right, emitter.left
+	}
+	keepsInner := (leftOuter && joinType.keepsRight()) || (!leftOuter && (joinType.keepsLeft() || joinType == SemiJoin))
+	group.Go(func() error {
+		// Whether each entry of the inner table has a match, in the order it is read.
+		innerMatched := make([]bool, 0)
+		for !outer.IsEnd() {
+			// Read in the next block.
+			entries, matched := make([]utils.Entry, 0), make([]bool, 0)
+			block := make(map[int64][]int)
+			for n := 0; n < JOIN_BLOCK_SIZE && !outer.IsEnd(); n++ {
+				entry, err := outer.GetEntry()
+				if err != nil {
+					return err
+				}
+				block[entry.GetKey()] = append(block[entry.GetKey()], len(entries))
+				entries, matched = append(entries, restoreEntry(entry, joinOnOuterKey)), append(matched, false)
+				outer.StepForward()
+			}
+			// Probe it with every entry of the inner table.
+			inner, err := joinCursor(innerTable, joinOnInnerKey)
+			if err != nil {
+				return err
+			}
+			for i := 0; !inner.IsEnd(); i++ {
+				entry, err := inner.GetEntry()
+				if err != nil {
+					return err
+				}
+				if i == len(innerMatched) {
+					innerMatched = append(innerMatched, false)
+				}
+				for _, j := range block[entry.GetKey()] {
+					matched[j], innerMatched[i] = true, true
+					if err := emit(entries[j], restoreEntry(entry, joinOnInnerKey)); err != nil {
+						return err
+					}
+				}
+				inner.StepForward()
+			}
+			for j, entry := range entries {
+				if err := emitOuter(entry, matched[j]); err != nil {
+					return err
+				}
+			}
+		}
+		if !keepsInner {
+			return nil
+		}
+		// Read the inner table once more for the entries that had a match, or didn't.
+		inner, err := joinCursor(innerTable, joinOnInnerKey)
+		if err != nil {
+			return err
+		}
+		for i := 0; !inner.IsEnd(); i++ {
+			entry, err := inner.GetEntry()
+			if err != nil {
+				return err
+			}
+			if err := emitInner(restoreEntry(entry, joinOnInnerKey), i < len(innerMatched) && innerMatched[i]); err != nil {
+				return err
+			}
+			inner.StepForward()
+		}
+		return nil
+	})
+	return resultsChan, ctx, group, func() {}, nil
+}
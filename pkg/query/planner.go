@@ -0,0 +1,149 @@
+package query
+
+import (
+	"fmt"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	exec "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/exec"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+// Plan compiles a select statement into a tree of operators: a scan or index seek along
+// the best access path of the table, a filter by the where clause, an aggregation if rows
+// are grouped or aggregate functions are selected, an external sort, a limit and a
+// projection onto the selected columns. Conditions of the where clause that an operand is,
+// or is not, in a subquery are planned as semi or anti joins with the subquery's plan
+// rather than filters. Rows ordered by the table's key alone aren't sorted if the access
+// path already reads them in key order, and rows grouped by the key alone are aggregated as
+// they are read in key order rather than hashed.
+func Plan(d *db.Database, statement *sql.SelectStmt) (exec.Operator, error) {
+	return plan(d, statement, func(op exec.Operator) exec.Operator { return op })
+}
+
+// PlanProfiled plans a select statement like Plan, putting a profile in place of each
+// operator so that running the plan measures it.
+func PlanProfiled(d *db.Database, statement *sql.SelectStmt) (exec.Operator, error) {
+	return plan(d, statement, func(op exec.Operator) exec.Operator { return exec.NewProfile(op) })
+}
+
+// plan plans a select statement, passing each operator through wrap as it is added.
+func plan(d *db.Database, statement *sql.SelectStmt, wrap func(exec.Operator) exec.Operator) (exec.Operator, error) {
+	where, subqueries := splitSubqueries(statement.Where)
+	path, err := d.ChooseAccessPath(statement.Table, where)
+	if err != nil {
+		return nil, err
+	}
+	scope := db.TableScope(statement.Table, d.GetSchema(statement.Table))
+	isKey := func(expr sql.Expr) bool {
+		ref, ok := expr.(*sql.ColumnRef)
+		if !ok {
+			return false
+		}
+		position, err := scope.Resolve(ref)
+		return err == nil && position == scope.Key(statement.Table)
+	}
+	funcs := aggregateFuncs(statement)
+	aggregated := len(statement.GroupBy) > 0 || len(funcs) > 0
+	sortAggregate := aggregated && len(statement.GroupBy) == 1 && isKey(statement.GroupBy[0]) && path.Ordered()
+	orderedByKey := len(statement.OrderBy) == 1 && isKey(statement.OrderBy[0].Expr)
+	sorted := len(statement.OrderBy) == 0 || (orderedByKey && path.Ordered() && (!aggregated || sortAggregate))
+	desc := sorted && orderedByKey && statement.OrderBy[0].Desc
+	var op exec.Operator
+	if op, err = exec.NewAccessPath(d, path, desc); err != nil {
+		return nil, err
+	}
+	op = wrap(op)
+	if where != nil {
+		if op, err = exec.NewFilter(op, where); err != nil {
+			return nil, err
+		}
+		op = wrap(op)
+	}
+	for _, in := range subqueries {
+		subquery, err := plan(d, in.Subquery, wrap)
+		if err != nil {
+			return nil, err
+		}
+		if op, err = exec.NewSemiJoin(op, in.Expr, subquery, in.Not); err != nil {
+			return nil, err
+		}
+		op = wrap(op)
+	}
+	if aggregated {
+		if sortAggregate {
+			op, err = exec.NewSortAggregate(op, statement.GroupBy, funcs)
+		} else {
+			op, err = exec.NewHashAggregate(op, statement.GroupBy, funcs)
+		}
+		if err != nil {
+			return nil, err
+		}
+		op = wrap(op)
+		for _, column := range statement.Columns {
+			if ref, ok := column.(*sql.ColumnRef); ok {
+				if _, err := op.Scope().Resolve(ref); err != nil {
+					return nil, fmt.Errorf("column %v must be grouped by or aggregated", ref)
+				}
+			}
+		}
+	}
+	if !sorted {
+		if op, err = exec.NewSort(op, statement.OrderBy); err != nil {
+			return nil, err
+		}
+		op = wrap(op)
+	}
+	if statement.Limit >= 0 {
+		op = wrap(exec.NewLimit(op, statement.Limit))
+	}
+	if len(statement.Columns) > 0 {
+		if op, err = exec.NewProject(op, statement.Columns); err != nil {
+			return nil, err
+		}
+		op = wrap(op)
+	}
+	return op, nil
+}
+
+// splitSubqueries splits the conditions of a where clause that an operand is, or is not, in
+// a subquery from the rest, which are returned anded together.
+func splitSubqueries(where sql.Expr) (sql.Expr, []*sql.InExpr) {
+	rest, subqueries := sql.Expr(nil), make([]*sql.InExpr, 0)
+	for _, conjunct := range sql.Conjuncts(where) {
+		in, ok := conjunct.(*sql.InExpr)
+		if not, isNot := conjunct.(*sql.NotExpr); isNot {
+			if negated, isIn := not.Expr.(*sql.InExpr); isIn {
+				in, ok = &sql.InExpr{Expr: negated.Expr, Subquery: negated.Subquery, Not: !negated.Not}, true
+			}
+		}
+		if ok {
+			subqueries = append(subqueries, in)
+		} else if rest == nil {
+			rest = conjunct
+		} else {
+			rest = &sql.BinaryExpr{Op: "and", Left: rest, Right: conjunct}
+		}
+	}
+	if len(subqueries) == 0 {
+		return where, subqueries
+	}
+	return rest, subqueries
+}
+
+// aggregateFuncs returns the aggregate functions a select statement selects or orders by,
+// each once.
+func aggregateFuncs(statement *sql.SelectStmt) []exec.AggregateFunc {
+	exprs := append([]sql.Expr{}, statement.Columns...)
+	for _, item := range statement.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	funcs := make([]exec.AggregateFunc, 0)
+	seen := make(map[string]bool)
+	for _, expr := range exprs {
+		if call, ok := expr.(*sql.FuncCall); ok && !seen[call.String()] {
+			seen[call.String()] = true
+			funcs = append(funcs, exec.AggregateFunc{Name: call.Name, Arg: call.Arg})
+		}
+	}
+	return funcs
+}
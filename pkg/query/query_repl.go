@@ -2,69 +2,269 @@ package query
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 
 	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	exec "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/exec"
 	repl "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/repl"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 )
 
+// create table <table> as join ... creates a table from the rows of a join.
+func init() {
+	db.RegisterTableSource("join", joinTableSource)
+}
+
 // Query REPL.
 func QueryRepl(d *db.Database) *repl.REPL {
 	r := repl.NewRepl()
+	r.AddCommand("find", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleFind(d, payload, replConfig.GetWriter())
+	}, "Find an element by its key, or the elements a condition holds for. usage: find <key> from <table> | find from <table> where <condition>")
+	r.AddCommand("select", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleSelect(d, payload, replConfig.GetWriter())
+	}, "Select elements from a table, or count, sum, min, max or avg them by group. usage: select [<column>, ...] from <table> [where <condition>] [group by <column>, ...] [order by <column> [asc|desc], ...] [limit <n>]")
 	r.AddCommand("join", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleJoin(d, payload, replConfig.GetWriter())
-	}, "Create a table. usage: create table <table>")
+	}, "Join tables on their keys or values, each with what the joins before it produce, with the cheapest algorithm unless one is named; outer joins pair entries without a match with null, and semi and anti joins find the entries with and without one. "+joinUsage)
+	r.AddCommand("explain", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleExplain(d, payload, replConfig.GetWriter())
+	}, "Print the plan of a select, find or join, or run it and print what each step did. usage: explain [analyze] <select|find|join ...>")
 	return r
 }
 
-// Handle join.
-func HandleJoin(d *db.Database, payload string, w io.Writer) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: join <table1> <key/val for table1> on <table2> <key/val for table2>
-	if numFields != 6 || fields[3] != "on" || (fields[2] != "key" && fields[2] != "val") || (fields[5] != "key" && fields[5] != "val") {
-		return fmt.Errorf("usage: join <table1> <key/val for table1> on <table2> <key/val for table2>")
-	}
-	table1Name := fields[1]
-	table1, err := d.GetTable(table1Name)
+// Handle find.
+func HandleFind(d *db.Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
 	if err != nil {
 		return fmt.Errorf("find error: %v", err)
 	}
-	table2Name := fields[4]
-	table2, err := d.GetTable(table2Name)
+	find, ok := statement.(*sql.FindStmt)
+	if !ok {
+		return fmt.Errorf("usage: find <key> from <table> | find from <table> where <condition>")
+	}
+	plan, err := Plan(d, &sql.SelectStmt{Table: find.Table, Where: find.Where, Limit: -1})
+	if err != nil {
+		return fmt.Errorf("find error: %v", err)
+	}
+	found := false
+	err = exec.Run(plan, func(row db.Row) error {
+		found = true
+		_, err := io.WriteString(w, fmt.Sprintf("found entry: %v\n", db.FormatRow(row)))
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("find error: %v", err)
 	}
-	joinOnLeftKey := fields[2] == "key"
-	joinOnRightKey := fields[5] == "key"
-	ctx, cancelCtx := context.WithCancel(context.Background())
+	if !found {
+		return fmt.Errorf("find error: no entry where %v", find.Where)
+	}
+	return nil
+}
+
+// Handle select.
+func HandleSelect(d *db.Database, payload string, w io.Writer) (err error) {
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("select error: %v", err)
+	}
+	selectStatement, ok := statement.(*sql.SelectStmt)
+	if !ok {
+		return fmt.Errorf("usage: select [<column>, ...] from <table> [where <condition>] [group by <column>, ...] [order by <column> [asc|desc], ...] [limit <n>]")
+	}
+	plan, err := Plan(d, selectStatement)
+	if err != nil {
+		return fmt.Errorf("select error: %v", err)
+	}
+	err = exec.Run(plan, func(row db.Row) error {
+		_, err := io.WriteString(w, db.FormatRow(row)+"\n")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("select error: %v", err)
+	}
+	return nil
+}
+
+// A joinStep is one join of a left-deep join: of what the joins before it produce with a
+// table, on the entry of the table before.
+type joinStep struct {
+	name      string
+	table     db.Index
+	onPrevKey bool // Whether the table before is joined on its key.
+	onKey     bool // Whether the table is joined on its key.
+	joinType  JoinType
+}
+
+// A joinSpec is a join the join command asks for: a left-deep join of its first table with
+// the second, then of the pairs they produce with the third, and so on.
+type joinSpec struct {
+	firstName string
+	first     db.Index
+	steps     []joinStep
+	algorithm JoinAlgorithm // The algorithm of the first join.
+	using     bool          // Whether the command names the algorithm, which every join then uses.
+}
+
+// names returns the names of the tables joined, in order.
+func (spec *joinSpec) names() []string {
+	names := []string{spec.firstName}
+	for _, step := range spec.steps {
+		names = append(names, step.name)
+	}
+	return names
+}
+
+// schemas returns the schemas of the tables joined, in order, or nil for those that hold
+// (key, value) pairs.
+func (spec *joinSpec) schemas(d *db.Database) []*db.Schema {
+	schemas := make([]*db.Schema, 0)
+	for _, name := range spec.names() {
+		schemas = append(schemas, d.GetSchema(name))
+	}
+	return schemas
+}
+
+// tables returns the tables joined, in order.
+func (spec *joinSpec) tables() []db.Index {
+	tables := []db.Index{spec.first}
+	for _, step := range spec.steps {
+		tables = append(tables, step.table)
+	}
+	return tables
+}
+
+// joinUsage is how the join command is used.
+var joinUsage = "usage: join <table1> <key/val for table1> [left|right|full|semi|anti] on <table2> <key/val for table2> [<key/val for table3>] [[left|right|full|semi|anti] on <table3> <key/val for table3> ...] [using <merge|index|block|hash>]"
+
+// parseJoin parses a join command and plans it.
+func parseJoin(d *db.Database, payload string) (*joinSpec, error) {
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return nil, fmt.Errorf("join error: %v", err)
+	}
+	joinStatement, ok := statement.(*sql.JoinStmt)
+	if !ok {
+		return nil, errors.New(joinUsage)
+	}
+	return planJoin(d, joinStatement)
+}
+
+// planJoin plans a join statement, picking the cheapest algorithm for the first join unless
+// it names one.
+func planJoin(d *db.Database, statement *sql.JoinStmt) (*joinSpec, error) {
+	spec := &joinSpec{firstName: statement.Table}
+	for _, clause := range statement.Joins {
+		joinType := InnerJoin
+		if clause.Type != "" {
+			var err error
+			if joinType, err = ParseJoinType(clause.Type); err != nil {
+				return nil, fmt.Errorf("join error: %v", err)
+			}
+		}
+		if len(spec.steps) > 0 && !spec.steps[len(spec.steps)-1].joinType.pairsMatches() {
+			return nil, fmt.Errorf("join error: a semi or anti join must be the last join")
+		}
+		spec.steps = append(spec.steps, joinStep{name: clause.Table, onPrevKey: clause.PrevOnKey, onKey: clause.OnKey, joinType: joinType})
+	}
+	var err error
+	if spec.first, err = d.GetTable(spec.firstName); err != nil {
+		return nil, fmt.Errorf("find error: %v", err)
+	}
+	for i := range spec.steps {
+		if spec.steps[i].table, err = d.GetTable(spec.steps[i].name); err != nil {
+			return nil, fmt.Errorf("find error: %v", err)
+		}
+	}
+	first := spec.steps[0]
+	spec.algorithm = ChooseJoin(spec.first, first.table, first.onPrevKey, first.onKey, first.joinType)
+	if statement.Using != "" {
+		if spec.algorithm, err = ParseJoinAlgorithm(statement.Using); err != nil {
+			return nil, fmt.Errorf("join error: %v", err)
+		}
+		spec.using = true
+	}
+	return spec, nil
+}
+
+// runJoin joins two tables with an algorithm, passing each pair of entries it produces to
+// emit.
+func runJoin(
+	ctx context.Context,
+	algorithm JoinAlgorithm,
+	left db.Index,
+	right db.Index,
+	onLeftKey bool,
+	onRightKey bool,
+	joinType JoinType,
+	emit func(EntryPair) error,
+) error {
+	ctx, cancelCtx := context.WithCancel(ctx)
 	defer cancelCtx()
-	resultsChan, _, group, cleanupCallback, err := Join(ctx, table1, table2, joinOnLeftKey, joinOnRightKey)
+	resultsChan, _, group, cleanupCallback, err := algorithm.Func()(ctx, left, right, onLeftKey, onRightKey, joinType)
 	if cleanupCallback != nil {
 		defer cleanupCallback()
 	}
 	if err != nil {
 		return err
 	}
-	done := make(chan bool)
+	done := make(chan error)
 	go func() {
-		for {
-			pair, valid := <-resultsChan
-			if !valid {
-				break
+		var emitErr error
+		for pair := range resultsChan {
+			if emitErr == nil {
+				if emitErr = emit(pair); emitErr != nil {
+					cancelCtx()
+				}
 			}
-			io.WriteString(w, fmt.Sprintf("{(%v, %v), (%v, %v)}\n",
-				pair.l.GetKey(), pair.l.GetValue(), pair.r.GetKey(), pair.r.GetValue()))
 		}
-		done <- true
+		done <- emitErr
 	}()
 	err = group.Wait()
 	close(resultsChan)
-	<-done
+	if emitErr := <-done; err == nil {
+		err = emitErr
+	}
+	return err
+}
+
+// Handle join.
+func HandleJoin(d *db.Database, payload string, w io.Writer) (err error) {
+	spec, err := parseJoin(d, payload)
+	if err != nil {
+		return err
+	}
+	schemas := spec.schemas(d)
+	_, err = runJoins(context.Background(), spec, func(row []utils.Entry) error {
+		formatted := make([]string, len(row))
+		for i, entry := range row {
+			var err error
+			if formatted[i], err = formatEntry(schemas[i], entry); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "{"+strings.Join(formatted, ", ")+"}\n")
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("join error: %v", err)
 	}
 	return nil
 }
+
+// formatEntry formats an entry a join produced of a table with the given schema as the row
+// it holds, or null if there is none.
+func formatEntry(schema *db.Schema, entry utils.Entry) (string, error) {
+	if entry == nil {
+		return "null", nil
+	}
+	row, err := db.EntryRow(schema, entry)
+	if err != nil {
+		return "", err
+	}
+	return db.FormatRow(row), nil
+}
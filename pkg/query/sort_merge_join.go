@@ -0,0 +1,224 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
+
+	errgroup "golang.org/x/sync/errgroup"
+)
+
+// swappedCursor reads the entries of a cursor with their keys and values swapped.
+type swappedCursor struct {
+	utils.Cursor
+}
+
+func (cursor swappedCursor) GetEntry() (utils.Entry, error) {
+	entry, err := cursor.Cursor.GetEntry()
+	if err != nil {
+		return nil, err
+	}
+	return swapEntry(entry), nil
+}
+
+// swapEntry returns an entry with the key and value of the given one swapped.
+func swapEntry(entry utils.Entry) utils.Entry {
+	var swapped hash.HashEntry
+	swapped.SetKey(entry.GetValue())
+	swapped.SetValue(entry.GetKey())
+	return swapped
+}
+
+// intCursor reads the entries of a table's cursor, erroring at one whose value is a byte
+// slice, which a join on values can't compare.
+type intCursor struct {
+	utils.Cursor
+	table db.Index
+}
+
+func (cursor intCursor) GetEntry() (utils.Entry, error) {
+	entry, err := cursor.Cursor.GetEntry()
+	if err != nil {
+		return nil, err
+	}
+	return entry, checkJoinable(cursor.table, entry)
+}
+
+// checkJoinable errors if a table's entry has a value that is a byte slice.
+func checkJoinable(table db.Index, entry utils.Entry) error {
+	if _, err := utils.IntValue(entry); err != nil {
+		return fmt.Errorf("cannot join table %v on its values: %v", table.GetName(), err)
+	}
+	return nil
+}
+
+// joinCursor returns a cursor over every entry of a table, keyed by the attribute it is
+// joined on. A table joined on its keys may have values that are byte slices, which are
+// carried along with their keys.
+func joinCursor(table db.Index, useKey bool) (utils.Cursor, error) {
+	cursor, err := db.TableCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	if useKey {
+		return cursor, nil
+	}
+	return swappedCursor{intCursor{cursor, table}}, nil
+}
+
+// restoreEntry undoes the swap joinCursor made to an entry.
+func restoreEntry(entry utils.Entry, useKey bool) utils.Entry {
+	if useKey {
+		return entry
+	}
+	return swapEntry(entry)
+}
+
+// isSorted checks whether a table's own cursor reads it in order of the attribute it is
+// joined on.
+func isSorted(table db.Index, useKey bool) bool {
+	_, isBTree := db.PrimaryIndex(table).(*btree.BTreeIndex)
+	return isBTree && useKey
+}
+
+// sortedJoinCursor returns a cursor over every entry of a table, keyed by and in order of
+// the attribute it is joined on, sorting them if the table isn't already in that order.
+func sortedJoinCursor(table db.Index, useKey bool) (utils.Cursor, func(), error) {
+	cursor, err := joinCursor(table, useKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isSorted(table, useKey) {
+		return cursor, func() {}, nil
+	}
+	return db.SortEntries(cursor)
+}
+
+// Join leftTable on rightTable using Sort-Merge Join. A btree table joined on its key is
+// read in order; any other table is sorted first with an external merge sort.
+func SortMergeJoin(
+	ctx context.Context,
+	leftTable db.Index,
+	rightTable db.Index,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	joinType JoinType,
+) (chan EntryPair, context.Context, *errgroup.Group, func(), error) {
+	left, leftCleanup, err := sortedJoinCursor(leftTable, joinOnLeftKey)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	right, rightCleanup, err := sortedJoinCursor(rightTable, joinOnRightKey)
+	if err != nil {
+		leftCleanup()
+		return nil, nil, nil, nil, err
+	}
+	cleanupCallback := func() {
+		leftCleanup()
+		rightCleanup()
+	}
+	group, ctx := errgroup.WithContext(ctx)
+	resultsChan := make(chan EntryPair, 1024)
+	group.Go(func() error {
+		return mergeSorted(ctx, resultsChan, left, right, joinOnLeftKey, joinOnRightKey, joinType)
+	})
+	return resultsChan, ctx, group, cleanupCallback, nil
+}
+
+// mergeSorted steps through two cursors in key order, pairing every left entry with every
+// right entry under the same key, and producing what a join of the given type does for
+// them.
+func mergeSorted(
+	ctx context.Context,
+	resultsChan chan EntryPair,
+	left utils.Cursor,
+	right utils.Cursor,
+	joinOnLeftKey bool,
+	joinOnRightKey bool,
+	joinType JoinType,
+) error {
+	emitter := joinEmitter{ctx: ctx, resultsChan: resultsChan, joinType: joinType}
+	for !left.IsEnd() && !right.IsEnd() {
+		l, err := left.GetEntry()
+		if err != nil {
+			return err
+		}
+		r, err := right.GetEntry()
+		if err != nil {
+			return err
+		}
+		if l.GetKey() < r.GetKey() {
+			if err := emitter.left(restoreEntry(l, joinOnLeftKey), false); err != nil {
+				return err
+			}
+			left.StepForward()
+			continue
+		}
+		if l.GetKey() > r.GetKey() {
+			if err := emitter.right(restoreEntry(r, joinOnRightKey), false); err != nil {
+				return err
+			}
+			right.StepForward()
+			continue
+		}
+		// Hold the left entries under this key while stepping through the right ones.
+		key := l.GetKey()
+		group := make([]utils.Entry, 0)
+		for !left.IsEnd() {
+			l, err := left.GetEntry()
+			if err != nil {
+				return err
+			}
+			if l.GetKey() != key {
+				break
+			}
+			group = append(group, restoreEntry(l, joinOnLeftKey))
+			left.StepForward()
+		}
+		for !right.IsEnd() {
+			r, err := right.GetEntry()
+			if err != nil {
+				return err
+			}
+			if r.GetKey() != key {
+				break
+			}
+			r = restoreEntry(r, joinOnRightKey)
+			for _, l := range group {
+				if err := emitter.match(l, r); err != nil {
+					return err
+				}
+			}
+			right.StepForward()
+		}
+		for _, l := range group {
+			if err := emitter.left(l, true); err != nil {
+				return err
+			}
+		}
+	}
+	// Whatever is left of either table has no match.
+	for ; !left.IsEnd() && joinType.keepsLeft(); left.StepForward() {
+		l, err := left.GetEntry()
+		if err != nil {
+			return err
+		}
+		if err := emitter.left(restoreEntry(l, joinOnLeftKey), false); err != nil {
+			return err
+		}
+	}
+	for ; !right.IsEnd() && joinType.keepsRight(); right.StepForward() {
+		r, err := right.GetEntry()
+		if err != nil {
+			return err
+		}
+		if err := emitter.right(restoreEntry(r, joinOnRightKey), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package recovery
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"regexp"
@@ -16,7 +17,13 @@ import (
 	 TABLE log -- create a table;
 	 < create tblType table tblName >
 
-   EDIT log -- actions that modify database state;
+   DDL log -- drop, rename or truncate a table;
+   < drop table tblName >
+   < rename table tblName to newName >
+   < truncate table tblName >
+
+   EDIT log -- actions that modify database state; values that are byte slices are
+   written in hex, as x'...', an absent one as x'';
    < Tx, table, INSERT|DELETE|UPDATE, key, oldval, newval >
 
    START log -- start of a transaction:
@@ -44,6 +51,29 @@ func (tl *tableLog) toString() string {
 	return fmt.Sprintf("< create %s table %s >\n", tl.tblType, tl.tblName)
 }
 
+// The type of DDL action
+type DDLAction string
+
+const (
+	DROP_ACTION     DDLAction = "drop"
+	RENAME_ACTION   DDLAction = "rename"
+	TRUNCATE_ACTION DDLAction = "truncate"
+)
+
+// Log for dropping, renaming or truncating a table.
+type ddlLog struct {
+	action  DDLAction // The type of DDL action taken
+	tblName string    // The name of the table acted on
+	newName string    // The new name of the table, for renames only
+}
+
+func (dl *ddlLog) toString() string {
+	if dl.action == RENAME_ACTION {
+		return fmt.Sprintf("< rename table %s to %s >\n", dl.tblName, dl.newName)
+	}
+	return fmt.Sprintf("< %s table %s >\n", dl.action, dl.tblName)
+}
+
 // The type of edit action
 type Action string
 
@@ -61,12 +91,32 @@ type editLog struct {
 	key       int64     // The key of the tuple that was edited
 	oldval    int64     // The old value before the edit
 	newval    int64     // The new value after the edit
+	isBytes   bool      // Whether the values are byte slices, kept in oldBytes and newBytes
+	oldBytes  []byte    // The old byte-slice value before the edit
+	newBytes  []byte    // The new byte-slice value after the edit
 }
 
 func (el *editLog) toString() string {
+	if el.isBytes {
+		return fmt.Sprintf("< %s, %s, %s, %v, x'%x', x'%x' >\n", el.id.String(), el.tablename, el.action, el.key, el.oldBytes, el.newBytes)
+	}
 	return fmt.Sprintf("< %s, %s, %s, %v, %v, %v >\n", el.id.String(), el.tablename, el.action, el.key, el.oldval, el.newval)
 }
 
+// inverse returns the log of the edit that undoes this one.
+func (el *editLog) inverse() *editLog {
+	inverse := *el
+	inverse.oldval, inverse.newval = el.newval, el.oldval
+	inverse.oldBytes, inverse.newBytes = el.newBytes, el.oldBytes
+	switch el.action {
+	case INSERT_ACTION:
+		inverse.action = DELETE_ACTION
+	case DELETE_ACTION:
+		inverse.action = INSERT_ACTION
+	}
+	return &inverse
+}
+
 // Log for starting a transaction.
 type startLog struct {
 	id uuid.UUID // The id of the transaction
@@ -108,7 +158,10 @@ const uuidPattern string = "[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9
 // Returns an error if the string could not be parsed into a log.
 func FromString(s string) (Log, error) {
 	tableExp, _ := regexp.Compile(fmt.Sprintf("< create (?P<tblType>\\w+) table (?P<tblName>\\w+) >"))
+	ddlExp, _ := regexp.Compile("< (?P<action>drop|truncate) table (?P<tblName>\\w+) >")
+	renameExp, _ := regexp.Compile("< rename table (?P<tblName>\\w+) to (?P<newName>\\w+) >")
 	editExp, _ := regexp.Compile(fmt.Sprintf("< (?P<uuid>%s), (?P<table>\\w+), (?P<action>UPDATE|INSERT|DELETE), (?P<key>\\d+), (?P<oldval>\\d+), (?P<newval>\\d+) >", uuidPattern))
+	editBytesExp, _ := regexp.Compile(fmt.Sprintf("< (?P<uuid>%s), (?P<table>\\w+), (?P<action>UPDATE|INSERT|DELETE), (?P<key>\\d+), x'(?P<oldval>[0-9a-f]*)', x'(?P<newval>[0-9a-f]*)' >", uuidPattern))
 	startExp, _ := regexp.Compile(fmt.Sprintf("< (%s) start >", uuidPattern))
 	commitExp, _ := regexp.Compile(fmt.Sprintf("< (%s) commit >", uuidPattern))
 	checkpointExp, _ := regexp.Compile(fmt.Sprintf("< (%s,?\\s)*checkpoint >", uuidPattern))
@@ -122,6 +175,19 @@ func FromString(s string) (Log, error) {
 			tblType: tblType,
 			tblName: tblName,
 		}, nil
+	case ddlExp.MatchString(s):
+		expStrs := ddlExp.FindStringSubmatch(s)
+		return &ddlLog{
+			action:  DDLAction(expStrs[1]),
+			tblName: expStrs[2],
+		}, nil
+	case renameExp.MatchString(s):
+		expStrs := renameExp.FindStringSubmatch(s)
+		return &ddlLog{
+			action:  RENAME_ACTION,
+			tblName: expStrs[1],
+			newName: expStrs[2],
+		}, nil
 	case editExp.MatchString(s):
 		expStrs := editExp.FindStringSubmatch(s)
 		uuid := uuid.MustParse(expStrs[1])
@@ -136,6 +202,26 @@ func FromString(s string) (Log, error) {
 			oldval:    int64(oldval),
 			newval:    int64(newval),
 		}, nil
+	case editBytesExp.MatchString(s):
+		expStrs := editBytesExp.FindStringSubmatch(s)
+		key, _ := strconv.Atoi(expStrs[4])
+		oldBytes, err := hex.DecodeString(expStrs[5])
+		if err != nil {
+			return nil, err
+		}
+		newBytes, err := hex.DecodeString(expStrs[6])
+		if err != nil {
+			return nil, err
+		}
+		return &editLog{
+			id:        uuid.MustParse(expStrs[1]),
+			tablename: expStrs[2],
+			action:    Action(expStrs[3]),
+			key:       int64(key),
+			isBytes:   true,
+			oldBytes:  oldBytes,
+			newBytes:  newBytes,
+		}, nil
 	case startExp.MatchString(s):
 		uuid := uuid.MustParse(uuidExp.FindString(s))
 		return &startLog{id: uuid}, nil
@@ -20,6 +20,7 @@ type RecoveryManager struct {
 	tm      *concurrency.TransactionManager
 	txStack map[uuid.UUID]([]Log)
 	fd      *os.File
+	lsn     int64 // Length of the log file; a log's LSN is the offset just past it.
 	mtx     sync.Mutex
 }
 
@@ -33,17 +34,24 @@ func NewRecoveryManager(
 	if err != nil {
 		return nil, err
 	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
 	return &RecoveryManager{
 		d:       d,
 		tm:      tm,
 		txStack: make(map[uuid.UUID][]Log),
 		fd:      fd,
+		lsn:     info.Size(),
 	}, nil
 }
 
 // Write the string `s` to the log file. Expects rm.mtx to be locked
 func (rm *RecoveryManager) writeToBuffer(s string) error {
-	_, err := rm.fd.WriteString(s)
+	n, err := rm.fd.WriteString(s)
+	rm.lsn += int64(n)
 	if err != nil {
 		return err
 	}
@@ -62,17 +70,53 @@ func (rm *RecoveryManager) Table(tblType string, tblName string) {
 	rm.writeToBuffer(tl.toString())
 }
 
+// Write a DDL log. newName is only used by renames.
+func (rm *RecoveryManager) DDL(action DDLAction, tblName string, newName string) {
+	rm.mtx.Lock()
+	defer rm.mtx.Unlock()
+	dl := ddlLog{
+		action:  action,
+		tblName: tblName,
+		newName: newName,
+	}
+	rm.writeToBuffer(dl.toString())
+}
+
 // Write an Edit log.
 func (rm *RecoveryManager) Edit(clientId uuid.UUID, table db.Index, action Action, key int64, oldval int64, newval int64) {
 	rm.mtx.Lock()
 	defer rm.mtx.Unlock()
 	// create editLog and write it to buffer
 	var log = editLog{id: clientId, tablename: table.GetName(), action: action, key: key, oldval: oldval, newval: newval}
+	rm.writeEdit(table, &log)
+
+	// panic("function not yet implemented")
+}
+
+// Write an edit log, whose values may be byte slices. Expects rm.mtx to be locked.
+func (rm *RecoveryManager) writeEdit(table db.Index, log *editLog) {
 	rm.writeToBuffer(log.toString())
+	stampEdit(table, rm.lsn)
 	// put it in txStack
-	rm.txStack[clientId] = append(rm.txStack[clientId], &log)
+	rm.txStack[log.id] = append(rm.txStack[log.id], log)
+}
 
-	// panic("function not yet implemented")
+// Write an edit log, whose values may be byte slices.
+func (rm *RecoveryManager) logEdit(table db.Index, log *editLog) {
+	rm.mtx.Lock()
+	defer rm.mtx.Unlock()
+	rm.writeEdit(table, log)
+}
+
+// stampEdit has the pages of a table, and of its secondary indexes, that a logged edit is
+// about to change stamped with the edit's LSN.
+func stampEdit(table db.Index, lsn int64) {
+	table.GetPager().SetEditLSN(lsn)
+	if indexed, ok := table.(*db.IndexedTable); ok {
+		for _, index := range indexed.GetSecondaryIndexes() {
+			index.GetPager().SetEditLSN(lsn)
+		}
+	}
 }
 
 // Write a transaction start log.
@@ -97,9 +141,8 @@ func (rm *RecoveryManager) Commit(clientId uuid.UUID) {
 	// When a transaction commits, you can delete all of its data in the txStack map.
 	// delete it from txStack because it is already committed, noting to do with it
 	delete(rm.txStack, clientId)
+	// A committed transaction is no longer running, so checkpoints must not list it.
 	rm.writeToBuffer(log.toString())
-	// put it in txStack
-	rm.txStack[clientId] = append(rm.txStack[clientId], &log)
 
 	// panic("function not yet implemented")
 }
@@ -117,6 +160,17 @@ func (rm *RecoveryManager) Checkpoint() {
 		p.LockAllUpdates()
 		p.FlushAllPages()
 		p.UnlockAllUpdates()
+		// Byte-slice values are kept in a file of their own.
+		value.GetValues().Flush()
+		// A table's secondary indexes have pagers of their own.
+		if indexed, ok := value.(*db.IndexedTable); ok {
+			for _, index := range indexed.GetSecondaryIndexes() {
+				index.GetPager().LockAllUpdates()
+				index.GetPager().FlushAllPages()
+				index.GetPager().UnlockAllUpdates()
+				index.GetValues().Flush()
+			}
+		}
 	}
 	// Write the log AFTER flushing to disk!
 	// CHECKPOINT log -- lists the currently running transactions
@@ -144,7 +198,19 @@ func (rm *RecoveryManager) Redo(log Log) error {
 		if err != nil {
 			return err
 		}
+	case *ddlLog:
+		switch log.action {
+		case DROP_ACTION:
+			return rm.d.DropTable(log.tblName)
+		case RENAME_ACTION:
+			return rm.d.RenameTable(log.tblName, log.newName)
+		case TRUNCATE_ACTION:
+			return rm.d.TruncateTable(log.tblName)
+		}
 	case *editLog:
+		if log.isBytes {
+			return rm.redoBytes(log)
+		}
 		switch log.action {
 		case INSERT_ACTION:
 			payload := fmt.Sprintf("insert %v %v into %s", log.key, log.newval, log.tablename)
@@ -181,10 +247,31 @@ func (rm *RecoveryManager) Redo(log Log) error {
 	return nil
 }
 
+// redoBytes redoes an edit whose values are byte slices, which commands can't spell, by
+// making it directly. Like other edits, an insert of a key that is already there updates
+// it, and an update of one that isn't inserts it.
+func (rm *RecoveryManager) redoBytes(log *editLog) error {
+	table, err := rm.d.GetTable(log.tablename)
+	if err != nil {
+		return err
+	}
+	edit := db.Edit{Action: db.DeleteEdit, Key: log.key}
+	if log.action != DELETE_ACTION {
+		edit = db.Edit{Action: db.InsertEdit, Key: log.key, Bytes: log.newBytes, IsBytes: true}
+		if _, err := table.Find(log.key); err == nil {
+			edit.Action = db.UpdateEdit
+		}
+	}
+	return db.ApplyEdit(table, edit)
+}
+
 // Undo a given log's action.
 func (rm *RecoveryManager) Undo(log Log) error {
 	switch log := log.(type) {
 	case *editLog:
+		if log.isBytes {
+			return rm.undoBytes(log)
+		}
 		switch log.action {
 		case INSERT_ACTION:
 			payload := fmt.Sprintf("delete %v from %s", log.key, log.tablename)
@@ -211,6 +298,24 @@ func (rm *RecoveryManager) Undo(log Log) error {
 	return nil
 }
 
+// undoBytes undoes an edit whose values are byte slices by making, and logging, the edit
+// that reverses it.
+func (rm *RecoveryManager) undoBytes(log *editLog) error {
+	table, err := rm.d.GetTable(log.tablename)
+	if err != nil {
+		return err
+	}
+	inverse := log.inverse()
+	edit := db.Edit{Action: db.DeleteEdit, Key: log.key}
+	switch inverse.action {
+	case INSERT_ACTION:
+		edit = db.Edit{Action: db.InsertEdit, Key: log.key, Bytes: inverse.newBytes, IsBytes: true}
+	case UPDATE_ACTION:
+		edit = db.Edit{Action: db.UpdateEdit, Key: log.key, Bytes: inverse.newBytes, IsBytes: true}
+	}
+	return rm.applyEdit(rm.tm, table, edit, log.id)
+}
+
 // Do a full recovery to the most recent checkpoint on startup.
 func (rm *RecoveryManager) Recover() error {
 	// Seek backwards through the logs to the most recent checkpoint and note which transactions are currently active.
@@ -226,9 +331,11 @@ func (rm *RecoveryManager) Recover() error {
 		// var currentLog = 
 		// Replay all actions from the most recent checkpoint to the end of the log, keeping track of which transactions are active.
 		switch logType := log[ptr].(type) {
-		// only tableLog and editLog call Redo()
+		// only tableLog, ddlLog and editLog call Redo()
 		case *tableLog: 
 			rm.Redo(logType)
+		case *ddlLog:
+			rm.Redo(logType)
 		case *checkpointLog:
 			// checkpointLog contains the current running txns
 			for _, txn := range logType.ids {
@@ -325,7 +432,7 @@ func (rm *RecoveryManager) Rollback(clientId uuid.UUID) error {
 }
 
 // Primes the database for recovery
-func Prime(folder string) (*db.Database, error) {
+func Prime(folder string, opts ...db.Option) (*db.Database, error) {
 	// Ensure folder is of the form */
 	base := strings.TrimSuffix(folder, "/")
 	recoveryFolder := base + "-recovery/"
@@ -336,13 +443,13 @@ func Prime(folder string) (*db.Database, error) {
 			if err != nil {
 				return nil, err
 			}
-			return db.Open(dbFolder)
+			return db.Open(dbFolder, opts...)
 		}
 		return nil, err
 	}
 	if _, err := os.Stat(recoveryFolder); err != nil {
 		if os.IsNotExist(err) {
-			return db.Open(dbFolder)
+			return db.Open(dbFolder, opts...)
 		}
 		return nil, err
 	}
@@ -351,7 +458,7 @@ func Prime(folder string) (*db.Database, error) {
 	if err != nil {
 		return nil, err
 	}
-	return db.Open(dbFolder)
+	return db.Open(dbFolder, opts...)
 }
 
 // Should be called at end of Checkpoint.
@@ -4,13 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 
 	concurrency "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/concurrency"
 	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
 	query "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/query"
 	repl "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/repl"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 
 	uuid "github.com/google/uuid"
 )
@@ -20,25 +21,34 @@ func RecoveryREPL(d *db.Database, tm *concurrency.TransactionManager, rm *Recove
 	r := repl.NewRepl()
 	r.AddCommand("create", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleCreateTable(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Create a table. usage: create <btree|hash> table <table>")
+	}, "Create a table. usage: create [btree|hash] table <table>")
+	r.AddCommand("drop", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleDrop(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Delete a table and its files. usage: drop table <table>")
+	r.AddCommand("rename", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleRename(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Rename a table. usage: rename table <table> to <new name>")
+	r.AddCommand("truncate", func(payload string, replConfig *repl.REPLConfig) error {
+		return HandleTruncate(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
+	}, "Delete every entry of a table. usage: truncate table <table>")
 	r.AddCommand("find", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleFind(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Find an element. usage: find <key> from <table>")
+	}, "Find an element by its key, or the elements a condition holds for. usage: find <key> from <table> | find from <table> where <condition>")
 	r.AddCommand("insert", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleInsert(d, tm, rm, payload, replConfig.GetAddr())
-	}, "Insert an element. usage: insert <key> <value> into <table>")
+	}, "Insert an element. usage: insert into <table> [(<column>, ...)] values (<value>, ...) | insert <key> <value> into <table>")
 	r.AddCommand("update", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleUpdate(d, tm, rm, payload, replConfig.GetAddr())
-	}, "Update en element. usage: update <table> <key> <value>")
+	}, "Update the elements a condition holds for, or replace one by its key. usage: update <table> set <column> = <value>, ... [where <condition>] | update <table> <key> <value>")
 	r.AddCommand("delete", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleDelete(d, tm, rm, payload, replConfig.GetAddr())
-	}, "Delete an element. usage: delete <key> from <table>")
+	}, "Delete the elements a condition holds for, or one by its key. usage: delete from <table> [where <condition>] | delete <key> from <table>")
 	r.AddCommand("select", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleSelect(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Select elements from a table. usage: select from <table>")
+	}, "Select elements from a table, or count, sum, min, max or avg them by group. usage: select [<column>, ...] from <table> [where <condition>] [group by <column>, ...] [order by <column> [asc|desc], ...] [limit <n>]")
 	r.AddCommand("join", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleJoin(d, tm, payload, replConfig.GetWriter(), replConfig.GetAddr())
-	}, "Joins two tables together on either their keys or values. usage: join <table1> <key/val for table1> on <table2> <key/val for table2>")
+	}, "Joins tables together on either their keys or values, each with what the joins before it produce. Outer joins pair entries without a match with null, and semi and anti joins find the entries with and without one. usage: join <table1> <key/val for table1> [left|right|full|semi|anti] on <table2> <key/val for table2> [<key/val for table3>] [[left|right|full|semi|anti] on <table3> <key/val for table3> ...] [using <merge|index|block|hash>]")
 	r.AddCommand("transaction", func(payload string, replConfig *repl.REPLConfig) error {
 		return HandleTransaction(d, tm, rm, payload, replConfig.GetWriter(), replConfig.GetAddr())
 	}, "Handle transactions. usage: transaction <begin|commit>")
@@ -89,135 +99,140 @@ func HandleTransaction(d *db.Database, tm *concurrency.TransactionManager, rm *R
 
 // Handle create table.
 func HandleCreateTable(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: create <type> table <table>
-	if numFields != 4 || fields[2] != "table" || (fields[1] != "btree" && fields[1] != "hash") {
-		return fmt.Errorf("usage: create <btree|hash> table <table>")
+	statement, err := sql.Parse(payload)
+	if err != nil {
+		return fmt.Errorf("create error: %v", err)
 	}
-	rm.Table(fields[1], fields[3])
+	// Usage: create [btree|hash] table <table>; table logs don't record columns, or the rows
+	// of a table created from a command.
+	create, ok := statement.(*sql.CreateTableStmt)
+	if !ok || len(create.Columns) != 0 || create.As != "" {
+		return fmt.Errorf("usage: create [btree|hash] table <table>")
+	}
+	rm.Table(create.Type, create.Table)
 	return db.HandleCreateTable(d, payload, w)
 }
 
-// Handle find.
-func HandleFind(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
-	return concurrency.HandleFind(d, tm, payload, w, clientId)
-}
-
-// Handle insert.
-func HandleInsert(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, clientId uuid.UUID) (err error) {
+// Handle drop table.
+func HandleDrop(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
 	fields := strings.Fields(payload)
 	numFields := len(fields)
-	// Usage: insert <key> <value> into <table>
-	var key, newval int
-	var table db.Index
-	if numFields != 5 || fields[3] != "into" {
-		return fmt.Errorf("usage: insert <key> <value> into <table>")
-	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	if newval, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	if table, err = d.GetTable(fields[4]); err != nil {
-		return fmt.Errorf("insert error: %v", err)
-	}
-	// First, check that the desired value doesn't exist.
-	_, err = table.Find(int64(key))
-	if err == nil {
-		return errors.New("insert error: key already exists")
+	// Usage: drop table <table>
+	if numFields != 3 || fields[1] != "table" {
+		return fmt.Errorf("usage: drop table <table>")
 	}
-	// Log.
-	rm.Edit(clientId, table, INSERT_ACTION, int64(key), 0, int64(newval))
-	// Run transaction insert.
-	err = concurrency.HandleInsert(d, tm, payload, clientId)
-	if err != nil {
-		// Add a log to mark this insert as a no-op.
-		rm.Edit(clientId, table, DELETE_ACTION, int64(key), int64(newval), int64(0))
-		// Then pop the last two actions from the transaction stack because
-		// these last two actions were no-ops.
-		stack := rm.txStack[clientId]
-		rm.txStack[clientId] = stack[:len(stack)-2]
-		rberr := rm.Rollback(clientId)
-		if rberr != nil {
-			return rberr
-		}
+	if err = tm.CheckIdle("drop"); err != nil {
+		return err
 	}
-	return err
+	rm.DDL(DROP_ACTION, fields[2], "")
+	return db.HandleDrop(d, payload, w)
 }
 
-// Handle update.
-func HandleUpdate(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, clientId uuid.UUID) (err error) {
+// Handle rename table.
+func HandleRename(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
 	fields := strings.Fields(payload)
 	numFields := len(fields)
-	// Usage: update <table> <key> <value>
-	var key, newval int
-	var table db.Index
-	if numFields != 4 {
-		return fmt.Errorf("usage: update <table> <key> <value>")
+	// Usage: rename table <table> to <new name>
+	if numFields != 5 || fields[1] != "table" || fields[3] != "to" {
+		return fmt.Errorf("usage: rename table <table> to <new name>")
 	}
-	if key, err = strconv.Atoi(fields[2]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+	if err = tm.CheckIdle("rename"); err != nil {
+		return err
 	}
-	if newval, err = strconv.Atoi(fields[3]); err != nil {
-		return fmt.Errorf("update error: %v", err)
-	}
-	if table, err = d.GetTable(fields[1]); err != nil {
-		return fmt.Errorf("update error: %v", err)
+	rm.DDL(RENAME_ACTION, fields[2], fields[4])
+	return db.HandleRename(d, payload, w)
+}
+
+// Handle truncate table.
+func HandleTruncate(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	fields := strings.Fields(payload)
+	numFields := len(fields)
+	// Usage: truncate table <table>
+	if numFields != 3 || fields[1] != "table" {
+		return fmt.Errorf("usage: truncate table <table>")
 	}
-	// First, check that the desired value exists.
-	oldval, err := table.Find(int64(key))
-	if err != nil {
-		return errors.New("update error: key doesn't exists")
+	if err = tm.CheckIdle("truncate"); err != nil {
+		return err
 	}
-	// Log.
-	rm.Edit(clientId, table, UPDATE_ACTION, int64(key), oldval.GetValue(), int64(newval))
-	// Run transaction insert.
-	err = concurrency.HandleUpdate(d, tm, payload, clientId)
-	if err != nil {
-		// Add a log to mark this update as a no-op.
-		rm.Edit(clientId, table, UPDATE_ACTION, int64(key), int64(newval), oldval.GetValue())
-		// Then pop the last two actions from the transaction stack because
-		// these last two actions were no-ops.
-		stack := rm.txStack[clientId]
-		rm.txStack[clientId] = stack[:len(stack)-2]
-		rberr := rm.Rollback(clientId)
-		if rberr != nil {
-			return rberr
-		}
-	}
-	return err
+	rm.DDL(TRUNCATE_ACTION, fields[2], "")
+	return db.HandleTruncate(d, payload, w)
+}
+
+// Handle find.
+func HandleFind(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
+	return concurrency.HandleFind(d, tm, payload, w, clientId)
+}
+
+// Handle insert.
+func HandleInsert(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, clientId uuid.UUID) (err error) {
+	return handleEdit(d, tm, rm, "insert", payload, clientId)
+}
+
+// Handle update.
+func HandleUpdate(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, clientId uuid.UUID) (err error) {
+	return handleEdit(d, tm, rm, "update", payload, clientId)
 }
 
 // Handle delete.
 func HandleDelete(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: delete <key> from <table>
-	var key int
-	var table db.Index
-	if numFields != 4 || fields[2] != "from" {
-		return fmt.Errorf("usage: delete <key> from <table>")
+	return handleEdit(d, tm, rm, "delete", payload, clientId)
+}
+
+// handleEdit runs an insert, update or delete, logging each edit before making it.
+func handleEdit(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, command string, payload string, clientId uuid.UUID) (err error) {
+	tableName, edits, err := db.ParseEdits(d, command, payload)
+	if err != nil {
+		return err
 	}
-	if key, err = strconv.Atoi(fields[1]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	var table db.Index
+	if table, err = d.GetTable(tableName); err != nil {
+		return fmt.Errorf("%s error: %v", command, err)
 	}
-	if table, err = d.GetTable(fields[3]); err != nil {
-		return fmt.Errorf("delete error: %v", err)
+	for _, edit := range edits {
+		if err = rm.applyEdit(tm, table, edit, clientId); err != nil {
+			return err
+		}
 	}
-	// First, check that the desired value exists.
-	oldval, err := table.Find(int64(key))
-	if err != nil {
+	return nil
+}
+
+// applyEdit logs an edit, then makes it. If the edit fails, the log is marked as a no-op
+// and the transaction is rolled back.
+func (rm *RecoveryManager) applyEdit(tm *concurrency.TransactionManager, table db.Index, edit db.Edit, clientId uuid.UUID) (err error) {
+	// First, check that the desired value exists, or doesn't for an insert.
+	var old utils.Entry
+	entry, err := table.Find(edit.Key)
+	switch {
+	case edit.Action == db.InsertEdit && err == nil:
+		return errors.New("insert error: key already exists")
+	case edit.Action == db.UpdateEdit && err != nil:
+		return errors.New("update error: key doesn't exists")
+	case edit.Action == db.DeleteEdit && err != nil:
 		return errors.New("delete error: key doesn't exists")
+	case err == nil:
+		old = entry
+	}
+	// Log, along with the log that undoes it if the edit fails. Values that are byte slices
+	// are logged as such.
+	log := &editLog{id: clientId, tablename: table.GetName(), action: DELETE_ACTION, key: edit.Key, isBytes: edit.IsBytes}
+	if bytesEntry, isBytes := old.(utils.BytesEntry); isBytes {
+		log.isBytes, log.oldBytes = true, bytesEntry.GetBytes()
+	} else if old != nil {
+		log.oldval = old.GetValue()
+	}
+	switch edit.Action {
+	case db.InsertEdit:
+		log.action, log.newval, log.newBytes = INSERT_ACTION, edit.Value, edit.Bytes
+	case db.UpdateEdit:
+		log.action, log.newval, log.newBytes = UPDATE_ACTION, edit.Value, edit.Bytes
 	}
-	// Log.
-	rm.Edit(clientId, table, DELETE_ACTION, int64(key), oldval.GetValue(), 0)
-	// Run transaction insert.
-	err = concurrency.HandleDelete(d, tm, payload, clientId)
+	rm.logEdit(table, log)
+	undo := func() { rm.logEdit(table, log.inverse()) }
+	// Run transaction edit.
+	err = concurrency.ApplyEdit(tm, table, edit, clientId)
 	if err != nil {
-		// Add a log to mark this delete as a no-op.
-		rm.Edit(clientId, table, INSERT_ACTION, int64(key), 0, oldval.GetValue())
+		// Add a log to mark this edit as a no-op.
+		undo()
 		// Then pop the last two actions from the transaction stack because
 		// these last two actions were no-ops.
 		stack := rm.txStack[clientId]
@@ -232,25 +247,13 @@ func HandleDelete(d *db.Database, tm *concurrency.TransactionManager, rm *Recove
 
 // Handle select.
 func HandleSelect(d *db.Database, tm *concurrency.TransactionManager, rm *RecoveryManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: select from <table>
-	if numFields != 3 || fields[1] != "from" {
-		return fmt.Errorf("usage: select from <table>")
-	}
 	// NOTE: Select is unsafe; not locking anything. May provide an inconsistent view of the database.
-	err = db.HandleSelect(d, payload, w)
-	return err
+	return query.HandleSelect(d, payload, w)
 }
 
 // Handle join.
 func HandleJoin(d *db.Database, tm *concurrency.TransactionManager, payload string, w io.Writer, clientId uuid.UUID) (err error) {
-	fields := strings.Fields(payload)
-	numFields := len(fields)
-	// Usage: join <table1> <key/val for table1> on <table2> <key/val for table2>
-	if numFields != 6 || fields[3] != "on" || (fields[2] != "key" && fields[2] != "val") || (fields[5] != "key" && fields[5] != "val") {
-		return fmt.Errorf("usage: join <table1> <key/val for table1> on <table2> <key/val for table2>")
-	}
+	// query.HandleJoin checks the command's usage.
 	// NOTE: Join is unsafe; not locking anything. May provide an inconsistent view of the database.
 	err = query.HandleJoin(d, payload, w)
 	return err
@@ -1,11 +1,21 @@
 package test
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	btree "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/btree"
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+	query "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/query"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 )
 
 // Set to some other value
@@ -27,6 +37,17 @@ func TestBTreeTA(t *testing.T) {
 	t.Run("TestBTreeDeleteTen", testBTreeDeleteTen)
 	t.Run("TestBTreeUpdateTenNoWrite", testBTreeUpdateTenNoWrite)
 	t.Run("TestBTreeUpdateTen", testBTreeUpdateTen)
+	t.Run("TestBTreeLargePagesFewFrames", testBTreeLargePagesFewFrames)
+	t.Run("TestBTreeDeleteRebalance", testBTreeDeleteRebalance)
+	t.Run("TestBTreeBulkLoad", testBTreeBulkLoad)
+	t.Run("TestBTreeBulkLoadFailed", testBTreeBulkLoadFailed)
+	t.Run("TestBTreeLoadUnsorted", testBTreeLoadUnsorted)
+	t.Run("TestBTreeLoadFailedRun", testBTreeLoadFailedRun)
+	t.Run("TestBTreeRangeCursor", testBTreeRangeCursor)
+	t.Run("TestBTreeBytesValues", testBTreeBytesValues)
+	t.Run("TestBTreeConcurrentBytesEdits", testBTreeConcurrentBytesEdits)
+	t.Run("TestBTreeVacuumValues", testBTreeVacuumValues)
+	t.Run("TestBTreeQuotedValues", testBTreeQuotedValues)
 }
 
 func testBTreeInsertTenNoWrite(t *testing.T) {
@@ -352,3 +373,708 @@ func testBTreeUpdateTen(t *testing.T) {
 	}
 	index.Close()
 }
+
+func testBTreeLargePagesFewFrames(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	options := pager.Options{NumFrames: 8, PageSize: pager.PAGESIZE * 2}
+
+	// Init the database
+	index, err := btree.OpenTableWithOptions(dbName, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Insert enough entries to split many times
+	n := 4 * btree.EntriesPerLeafNode(options.PageSize)
+	for i := int64(0); i < n; i++ {
+		err = index.Insert(i, i%btree_salt)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	// Close and reopen the database
+	index.Close()
+	index, err = btree.OpenTableWithOptions(dbName, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.GetPager().GetPageSize() != options.PageSize {
+		t.Error("table was reopened with the wrong page size")
+	}
+	// Retrieve entries
+	for i := int64(0); i < n; i++ {
+		entry, err := index.Find(i)
+		if err != nil || entry.GetValue() != i%btree_salt {
+			t.Errorf("entry %d could not be found", i)
+		}
+	}
+	index.Close()
+}
+
+// Deleting most of a multi-level tree should borrow, merge, and collapse nodes,
+// keeping the tree valid and giving pages back to be vacuumed.
+func testBTreeDeleteRebalance(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	index, err := btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 40 * btree.EntriesPerLeafNode(pager.PAGESIZE-pager.PAGE_HEADER_SIZE)
+	keys := rand.Perm(int(n))
+	for _, k := range keys {
+		if err := index.Insert(int64(k), int64(k)%btree_salt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	peakPages := index.GetPager().GetNumPages()
+	// Delete all but every tenth key, in random order.
+	rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	for i, k := range keys {
+		if k%10 == 0 {
+			continue
+		}
+		if err := index.Delete(int64(k)); err != nil {
+			t.Fatal(err)
+		}
+		if i%500 == 0 {
+			if _, _, ok, err := btree.IsBTree(index); err != nil || !ok {
+				t.Fatalf("tree is invalid after %d deletes", i)
+			}
+		}
+	}
+	if _, _, ok, err := btree.IsBTree(index); err != nil || !ok {
+		t.Fatal("tree is invalid after deleting")
+	}
+	reclaimed, err := index.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed == 0 || index.GetPager().GetNumPages() >= peakPages/2 {
+		t.Errorf("expected the file to shrink from %d pages, has %d", peakPages, index.GetPager().GetNumPages())
+	}
+	// Close, reopen, and check what is left.
+	index.Close()
+	index, err = btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok, err := btree.IsBTree(index); err != nil || !ok {
+		t.Fatal("tree is invalid after vacuum")
+	}
+	entries, err := index.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(entries)) != (n+9)/10 {
+		t.Errorf("expected %d entries, found %d", (n+9)/10, len(entries))
+	}
+	for i, entry := range entries {
+		if entry.GetKey() != int64(i*10) {
+			t.Fatalf("entry %d has key %d", i, entry.GetKey())
+		}
+	}
+	// Deleting everything collapses the tree back into a single leaf.
+	for i := int64(0); i < n; i += 10 {
+		if err := index.Delete(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := index.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	if index.GetPager().GetNumPages() != 1 {
+		t.Errorf("expected an empty tree to fit in its root, has %d pages", index.GetPager().GetNumPages())
+	}
+	index.Close()
+}
+
+// Bulk loading sorted entries should build a valid tree at any size and fill factor,
+// packing leaves tighter than inserting one key at a time.
+func testBTreeBulkLoad(t *testing.T) {
+	perLeaf := btree.EntriesPerLeafNode(pager.PAGESIZE - pager.PAGE_HEADER_SIZE)
+	for _, n := range []int64{0, 1, perLeaf, perLeaf + 1, 250 * perLeaf} {
+		for _, fillFactor := range []float64{0.1, 0.7, 1} {
+			t.Run(fmt.Sprintf("%v entries at %v", n, fillFactor), func(t *testing.T) {
+				dbName := getTempBTreeDB(t)
+				defer os.Remove(dbName)
+				index, err := btree.OpenTable(dbName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer index.Close()
+				// Load the even keys.
+				entries := make([]utils.Entry, n)
+				for i := range entries {
+					entries[i] = btree.NewBTreeEntry(int64(2*i), int64(i)%btree_salt)
+				}
+				if err := btree.BulkLoadEntries(index, entries, fillFactor); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, ok, err := btree.IsBTree(index); err != nil || !ok {
+					t.Fatal("tree is invalid after bulk load")
+				}
+				if fillFactor == 1 && index.GetPager().GetNumPages() > n/perLeaf+n/perLeaf/100+3 {
+					t.Errorf("%d entries took %d pages", n, index.GetPager().GetNumPages())
+				}
+				selected, err := index.Select()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(len(selected)) != n {
+					t.Fatalf("expected %d entries, found %d", n, len(selected))
+				}
+				for i, entry := range selected {
+					if entry.GetKey() != int64(2*i) || entry.GetValue() != int64(i)%btree_salt {
+						t.Fatalf("entry %d is (%d, %d)", i, entry.GetKey(), entry.GetValue())
+					}
+				}
+				// The tree takes inserts in between the loaded keys.
+				for i := int64(0); i < n; i += 7 {
+					if err := index.Insert(2*i+1, i); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, _, ok, err := btree.IsBTree(index); err != nil || !ok {
+					t.Fatal("tree is invalid after inserting into it")
+				}
+			})
+		}
+	}
+	// Loading out of order, or into a table with entries, fails.
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	index, err := btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	unsorted := []utils.Entry{btree.NewBTreeEntry(2, 0), btree.NewBTreeEntry(1, 0)}
+	if err := btree.BulkLoadEntries(index, unsorted, 1); err == nil {
+		t.Error("loaded entries out of order")
+	}
+	if err := index.Insert(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := btree.BulkLoadEntries(index, []utils.Entry{btree.NewBTreeEntry(2, 0)}, 1); err == nil {
+		t.Error("loaded into a table with entries")
+	}
+}
+
+// A bulk load that fails should give back the pages and values it wrote, so loading the
+// same entries afterwards takes no more space than loading them into a new table.
+func testBTreeBulkLoadFailed(t *testing.T) {
+	n := 3 * btree.EntriesPerLeafNode(pager.PAGESIZE-pager.PAGE_HEADER_SIZE)
+	entries := make([]utils.Entry, n)
+	for i := range entries {
+		value := []byte(fmt.Sprintf("value %v", i))
+		if i%10 == 0 {
+			value = []byte(strings.Repeat(fmt.Sprintf("big %v ", i), 2*int(pager.PAGESIZE)/8))
+		}
+		entries[i] = utils.NewBytesEntry(int64(i), value)
+	}
+	load := func(fail bool) (int64, int64) {
+		dbName := getTempBTreeDB(t)
+		defer os.Remove(dbName)
+		defer os.Remove(dbName + ".values")
+		index, err := btree.OpenTable(dbName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fail {
+			if err := btree.BulkLoadEntries(index, append(entries, btree.NewBTreeEntry(0, 0)), 1); err == nil {
+				t.Fatal("loaded entries out of order")
+			}
+			free, err := index.GetPager().GetFreePages()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pages := index.GetPager().GetNumPages(); int64(len(free)) != pages-1 {
+				t.Errorf("%d of %d pages are free after a failed load, expected all but the root", len(free), pages)
+			}
+		}
+		if err := btree.BulkLoadEntries(index, entries, 1); err != nil {
+			t.Fatal(err)
+		}
+		pages := index.GetPager().GetNumPages()
+		if err := index.Close(); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(dbName + ".values")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pages, info.Size()
+	}
+	// The values file keeps its first page, which holds its free-page chain, once emptied.
+	pages, size := load(false)
+	if failedPages, failedSize := load(true); failedPages != pages || failedSize > size+pager.PAGESIZE {
+		t.Errorf("after a failed load, took %d pages and %d bytes of values, expected %d and at most %d", failedPages, failedSize, pages, size+pager.PAGESIZE)
+	}
+}
+
+// Loading unsorted lines should sort them through spilled runs, then bulk load them.
+func testBTreeLoadUnsorted(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	index, err := btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	defer func(runSize int) { db.LOAD_RUN_SIZE = runSize }(db.LOAD_RUN_SIZE)
+	db.LOAD_RUN_SIZE = 100
+	n := 2500
+	var input strings.Builder
+	for _, k := range rand.Perm(n) {
+		input.WriteString(fmt.Sprintf("%d %d\n", k, int64(k)%btree_salt))
+	}
+	loaded, err := db.LoadEntries(index, nil, strings.NewReader(input.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != int64(n) {
+		t.Errorf("expected %d entries loaded, got %d", n, loaded)
+	}
+	if _, _, ok, err := btree.IsBTree(index); err != nil || !ok {
+		t.Fatal("tree is invalid after load")
+	}
+	for k := int64(0); k < int64(n); k++ {
+		entry, err := index.Find(k)
+		if err != nil || entry.GetValue() != k%btree_salt {
+			t.Fatalf("entry %d could not be found", k)
+		}
+	}
+}
+
+// truncatingReader reads its input, then cuts the last byte off each run that was spilled
+// while it was read, so that reading the runs back fails partway.
+type truncatingReader struct {
+	t      *testing.T
+	input  io.Reader
+	before map[string]bool // Temp files there were before reading started.
+}
+
+func (r *truncatingReader) Read(p []byte) (int, error) {
+	n, err := r.input.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	runs, _ := filepath.Glob("db-*")
+	for _, run := range runs {
+		if r.before[run] {
+			continue
+		}
+		info, statErr := os.Stat(run)
+		if statErr != nil {
+			r.t.Fatal(statErr)
+		}
+		if truncErr := os.Truncate(run, info.Size()-1); truncErr != nil {
+			r.t.Fatal(truncErr)
+		}
+	}
+	return n, err
+}
+
+// A load whose runs can't be read back should fail, and leave the table empty.
+func testBTreeLoadFailedRun(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	index, err := btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	defer func(runSize int) { db.LOAD_RUN_SIZE = runSize }(db.LOAD_RUN_SIZE)
+	db.LOAD_RUN_SIZE = 100
+	var input strings.Builder
+	for _, k := range rand.Perm(2500) {
+		input.WriteString(fmt.Sprintf("%d %d\n", k, k))
+	}
+	before := make(map[string]bool)
+	files, _ := filepath.Glob("db-*")
+	for _, file := range files {
+		before[file] = true
+	}
+	reader := &truncatingReader{t: t, input: strings.NewReader(input.String()), before: before}
+	if _, err := db.LoadEntries(index, nil, reader); err == nil {
+		t.Fatal("loaded entries from runs that were cut short")
+	}
+	entries, err := index.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("failed load left %d entries", len(entries))
+	}
+	free, err := index.GetPager().GetFreePages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := index.GetPager().GetNumPages(); int64(len(free)) != pages-1 {
+		t.Errorf("%d of %d pages are free after a failed load, expected all but the root", len(free), pages)
+	}
+}
+
+// Cursors should step backward across leaves, and range cursors should respect their bounds
+// in both directions.
+func testBTreeRangeCursor(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	index, err := btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	// Insert the even keys below 2n, in random order, over many leaves.
+	n := 10 * btree.EntriesPerLeafNode(pager.PAGESIZE-pager.PAGE_HEADER_SIZE)
+	for _, k := range rand.Perm(int(n)) {
+		if err := index.Insert(int64(2*k), int64(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, ok, err := btree.IsBTree(index); err != nil || !ok {
+		t.Fatal("tree is invalid after inserting")
+	}
+	// Walk the whole table backward.
+	end, err := index.TableEnd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := end.(*btree.BTreeCursor)
+	for k := n - 1; k >= 0; k-- {
+		entry, err := cursor.GetEntry()
+		if err != nil || entry.GetKey() != 2*k {
+			t.Fatalf("expected key %d stepping backward, got %v", 2*k, entry)
+		}
+		if atStart := cursor.StepBackward(); atStart != (k == 0) {
+			t.Fatalf("StepBackward at key %d returned %v", 2*k, atStart)
+		}
+	}
+	// Check ranges with every combination of bounds.
+	bounds := []*btree.Bound{nil, {Key: -5}, {Key: 0, Inclusive: true}, {Key: 101}, {Key: 100},
+		{Key: 100, Inclusive: true}, {Key: 2*n - 2}, {Key: 2*n - 2, Inclusive: true}, {Key: 3 * n}}
+	inRange := func(key int64, lower *btree.Bound, upper *btree.Bound) bool {
+		if lower != nil && (key < lower.Key || key == lower.Key && !lower.Inclusive) {
+			return false
+		}
+		return upper == nil || key < upper.Key || key == upper.Key && upper.Inclusive
+	}
+	for _, lower := range bounds {
+		for _, upper := range bounds {
+			for _, reverse := range []bool{false, true} {
+				expected := make([]int64, 0)
+				for k := int64(0); k < n; k++ {
+					if inRange(2*k, lower, upper) {
+						expected = append(expected, 2*k)
+					}
+				}
+				if reverse {
+					for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+						expected[i], expected[j] = expected[j], expected[i]
+					}
+				}
+				cursor, err := index.TableRange(lower, upper, reverse)
+				if err != nil {
+					t.Fatal(err)
+				}
+				found := make([]int64, 0)
+				for !cursor.IsEnd() {
+					entry, err := cursor.GetEntry()
+					if err != nil {
+						t.Fatal(err)
+					}
+					found = append(found, entry.GetKey())
+					cursor.StepForward()
+				}
+				if fmt.Sprint(found) != fmt.Sprint(expected) {
+					t.Fatalf("range %v to %v (reverse %v): expected %d keys, found %d",
+						lower, upper, reverse, len(expected), len(found))
+				}
+			}
+		}
+	}
+	// A range past the last key ends at the last key.
+	entries, err := index.TableFindRange(2*n-10, 3*n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("expected 5 entries at the end of the table, found %d", len(entries))
+	}
+}
+
+func testBTreeBytesValues(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + ".values")
+
+	// Init the database
+	index, err := btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Insert small values, values larger than a page, and plain integers
+	value := func(i int64) []byte {
+		if i%10 == 0 {
+			return []byte(strings.Repeat(fmt.Sprintf("big %v ", i), 2*int(pager.PAGESIZE)/8))
+		}
+		return []byte(fmt.Sprintf("value %v", i))
+	}
+	n := int64(500)
+	for i := int64(0); i < n; i++ {
+		if i%7 == 0 {
+			err = index.Insert(i, i)
+		} else {
+			err = index.InsertBytes(i, value(i))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(i int64, want []byte) {
+		entry, err := index.Find(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == nil {
+			if _, ok := entry.(utils.BytesEntry); ok || entry.GetValue() != i {
+				t.Errorf("entry %v should hold the integer %v", i, i)
+			}
+			return
+		}
+		bytesEntry, ok := entry.(utils.BytesEntry)
+		if !ok || string(bytesEntry.GetBytes()) != string(want) {
+			t.Errorf("entry %v has the wrong value", i)
+		}
+	}
+	expected := func(i int64) []byte {
+		if i%7 == 0 {
+			return nil
+		}
+		return value(i)
+	}
+	for i := int64(0); i < n; i++ {
+		check(i, expected(i))
+	}
+	// Overwrite some values and delete others
+	for i := int64(0); i < n; i += 3 {
+		if err = index.UpdateBytes(i, []byte(fmt.Sprintf("updated %v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(1); i < n; i += 3 {
+		if err = index.Delete(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Close and reopen the database
+	index.Close()
+	index, err = btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	entries, err := index.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := n - (n+1)/3; int64(len(entries)) != want {
+		t.Errorf("selected %v entries, expected %v", len(entries), want)
+	}
+	for i := int64(0); i < n; i++ {
+		switch i % 3 {
+		case 0:
+			check(i, []byte(fmt.Sprintf("updated %v", i)))
+		case 1:
+			if entry, err := index.Find(i); entry != nil || err == nil {
+				t.Error("Could find deleted entry")
+			}
+		default:
+			check(i, expected(i))
+		}
+	}
+}
+
+// A valuesIndex is an index of byte-slice values that can be vacuumed.
+type valuesIndex interface {
+	InsertBytes(key int64, value []byte) error
+	Delete(key int64) error
+	Find(key int64) (utils.Entry, error)
+	Vacuum() (int64, error)
+	Close() error
+}
+
+// checkVacuumValues fills the index in the given file with small values and values larger
+// than a page, deletes most of them, and checks that vacuuming shrinks its values file and
+// leaves the rest readable, also once the index is reopened.
+func checkVacuumValues(t *testing.T, dbName string, open func() (valuesIndex, error)) {
+	index, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := func(i int64) []byte {
+		if i%10 == 0 {
+			return []byte(strings.Repeat(fmt.Sprintf("big %v ", i), 2*int(pager.PAGESIZE)/8))
+		}
+		return []byte(fmt.Sprintf("value %v", i))
+	}
+	n := int64(2000)
+	for i := int64(0); i < n; i++ {
+		if err := index.InsertBytes(i, value(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(0); i < n; i++ {
+		if i%7 != 0 {
+			if err := index.Delete(i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	before, err := os.Stat(dbName + ".values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(dbName + ".values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size()/2 {
+		t.Errorf("expected the values file to shrink from %d bytes, has %d", before.Size(), after.Size())
+	}
+	check := func() {
+		for i := int64(0); i < n; i += 7 {
+			entry, err := index.Find(i)
+			if err != nil {
+				t.Fatalf("key %d: %v", i, err)
+			}
+			if bytesEntry, ok := entry.(utils.BytesEntry); !ok || string(bytesEntry.GetBytes()) != string(value(i)) {
+				t.Fatalf("key %d has the wrong value after vacuum", i)
+			}
+		}
+	}
+	check()
+	// Values put after vacuuming don't overwrite the moved ones.
+	for i := n; i < n+100; i++ {
+		if err := index.InsertBytes(i, value(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check()
+	index.Close()
+	if index, err = open(); err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	check()
+}
+
+func testBTreeVacuumValues(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + ".values")
+	checkVacuumValues(t, dbName, func() (valuesIndex, error) {
+		return btree.OpenTable(dbName)
+	})
+}
+
+// checkConcurrentBytesEdits updates and deletes each of a table's byte-slice values from
+// several goroutines at once, then checks that values put afterwards don't share space with
+// each other, as they would if a value had been freed twice.
+func checkConcurrentBytesEdits(t *testing.T, index db.Index) {
+	value := func(i int64) []byte {
+		return []byte(fmt.Sprintf("value %v", i))
+	}
+	n := int64(200)
+	for i := int64(0); i < n; i++ {
+		if err := index.InsertBytes(i, value(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := int64(0); i < n; i++ {
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func(i int64) {
+				defer wg.Done()
+				index.UpdateBytes(i, value(-i))
+				index.Delete(i)
+			}(i)
+		}
+	}
+	wg.Wait()
+	for i := n; i < 3*n; i++ {
+		if err := index.InsertBytes(i, value(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(0); i < 3*n; i++ {
+		entry, err := index.Find(i)
+		if i < n {
+			if err == nil {
+				t.Errorf("could find deleted entry %v", i)
+			}
+			continue
+		}
+		bytesEntry, ok := entry.(utils.BytesEntry)
+		if err != nil || !ok || string(bytesEntry.GetBytes()) != string(value(i)) {
+			t.Errorf("entry %v has the wrong value", i)
+		}
+	}
+}
+
+func testBTreeConcurrentBytesEdits(t *testing.T) {
+	dbName := getTempBTreeDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + ".values")
+	index, err := btree.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	checkConcurrentBytesEdits(t, index)
+}
+
+func testBTreeQuotedValues(t *testing.T) {
+	dir, err := ioutil.TempDir(".", "db-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err = db.HandleCreateTable(d, "create btree table t", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{
+		`insert 1 "hello, world" into t`,
+		`insert 2 "tab\tand \"quotes\"" into t`,
+		`insert 3 42 into t`,
+	} {
+		if err = db.HandleInsert(d, payload); err != nil {
+			t.Fatalf("%v: %v", payload, err)
+		}
+	}
+	if err = db.HandleUpdate(d, `update t 3 ""`); err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{`insert 4 "unterminated into t`, `insert 4 "a"b into t`} {
+		if err = db.HandleInsert(d, payload); err == nil {
+			t.Errorf("%v: expected an error", payload)
+		}
+	}
+	var out strings.Builder
+	if err = query.HandleSelect(d, "select from t", &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "(1, \"hello, world\")\n(2, \"tab\\tand \\\"quotes\\\"\")\n(3, \"\")\n"; out.String() != want {
+		t.Errorf("select printed %q, expected %q", out.String(), want)
+	}
+}
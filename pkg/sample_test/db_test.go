@@ -0,0 +1,1125 @@
+package test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+	query "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/query"
+)
+
+func getTempDBDir(t *testing.T) string {
+	dir, err := ioutil.TempDir(".", "db-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// runCommands runs each command against the database, failing the test on any error.
+func runCommands(t *testing.T, d *db.Database, commands ...string) string {
+	var out strings.Builder
+	for _, command := range commands {
+		var err error
+		switch strings.Fields(command)[0] {
+		case "create":
+			err = db.HandleCreateTable(d, command, &out)
+		case "insert":
+			err = db.HandleInsert(d, command)
+		case "update":
+			err = db.HandleUpdate(d, command)
+		case "delete":
+			err = db.HandleDelete(d, command)
+		case "find":
+			err = query.HandleFind(d, command, &out)
+		case "select":
+			err = query.HandleSelect(d, command, &out)
+		case "drop":
+			err = db.HandleDrop(d, command, &out)
+		case "rename":
+			err = db.HandleRename(d, command, &out)
+		case "truncate":
+			err = db.HandleTruncate(d, command, &out)
+		case "analyze":
+			err = db.HandleAnalyze(d, command, &out)
+		case "filter":
+			err = db.HandleFilter(d, command, &out)
+		case "describe":
+			err = db.HandleDescribe(d, command, &out)
+		case "load":
+			err = db.HandleLoad(d, command, &out)
+		default:
+			t.Fatalf("unknown command %v", command)
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", command, err)
+		}
+	}
+	return out.String()
+}
+
+func TestDatabase(t *testing.T) {
+	t.Run("TestDBSchema", testDBSchema)
+	t.Run("TestDBSchemaErrors", testDBSchemaErrors)
+	t.Run("TestDBCatalog", testDBCatalog)
+	t.Run("TestDBDropRenameTruncate", testDBDropRenameTruncate)
+	t.Run("TestDBInterruptedRename", testDBInterruptedRename)
+	t.Run("TestDBFailedOpen", testDBFailedOpen)
+	t.Run("TestDBLegacyMigration", testDBLegacyMigration)
+	t.Run("TestDBUncataloged", testDBUncataloged)
+	t.Run("TestDBSecondaryIndex", testDBSecondaryIndex)
+	t.Run("TestDBSecondaryIndexUndo", testDBSecondaryIndexUndo)
+	t.Run("TestDBSQL", testDBSQL)
+	t.Run("TestDBLoad", testDBLoad)
+	t.Run("TestDBAnalyze", testDBAnalyze)
+	t.Run("TestDBBloomFilter", testDBBloomFilter)
+	t.Run("TestDBTableFilter", testDBTableFilter)
+}
+
+func testDBSchema(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d,
+		"create btree table t (name text, id int primary key, score float)",
+		`insert "ann" 2 3.5 into t`,
+		`insert "bob, jr." 1 -0.25 into t`,
+		`insert "" 3 1e6 into t`,
+		`update t "carl" 3 7`,
+	)
+	d.Close()
+	// The schema survives reopening the database
+	d, err = db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	out := runCommands(t, d,
+		"find 1 from t",
+		"select from t",
+		"select id, name from t where id between 2 and 3",
+		"select score from t where key between 1 and 3 desc limit 2",
+	)
+	want := `found entry: ("bob, jr.", 1, -0.25)
+("bob, jr.", 1, -0.25)
+("ann", 2, 3.5)
+("carl", 3, 7)
+(2, "ann")
+(3, "carl")
+(7)
+(3.5)
+`
+	if out != want {
+		t.Errorf("got output\n%v\nexpected\n%v", out, want)
+	}
+	if schema := d.GetSchema("t"); schema == nil || schema.String() != "(name text, id int primary key, score float)" {
+		t.Errorf("wrong schema %v", schema)
+	}
+}
+
+func testDBSchemaErrors(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, definition := range []string{
+		"(id int, name text)",
+		"(id text primary key)",
+		"(id int primary key, id float)",
+		"(id int primary key, a int primary key)",
+		"(id int primary key, name string)",
+		"id int primary key",
+	} {
+		if err := db.HandleCreateTable(d, "create btree table bad "+definition, ioutil.Discard); err == nil {
+			t.Errorf("created a table with columns %v", definition)
+		}
+	}
+	runCommands(t, d, "create btree table t (id int primary key, n int)")
+	for _, command := range []string{
+		`insert 1 "one" into t`,
+		"insert 1 into t",
+		"insert 1 2 3 into t",
+		"insert 1.5 2 into t",
+	} {
+		if err := db.HandleInsert(d, command); err == nil {
+			t.Errorf("%v: expected an error", command)
+		}
+	}
+	if err := query.HandleSelect(d, "select nope from t", ioutil.Discard); err == nil {
+		t.Error("selected a column that does not exist")
+	}
+}
+
+func testDBCatalog(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir, db.WithGlobalFrames(0), db.WithPageSize(2*pager.PAGESIZE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d,
+		"create hash table h",
+		"create btree table b (id int primary key, name text)",
+	)
+	for i := 0; i < 500; i++ {
+		runCommands(t, d,
+			fmt.Sprintf("insert %v %v into h", i, i*i),
+			fmt.Sprintf(`insert %v "%v" into b`, i, i),
+		)
+	}
+	d.Close()
+	// The hash table's directory is kept with the table, not in the working directory
+	if _, err := os.Stat(filepath.Join(dir, "h.meta")); err != nil {
+		t.Error("hash table directory is not in the database folder")
+	}
+	if _, err := os.Stat("h.meta"); err == nil {
+		os.Remove("h.meta")
+		t.Error("hash table directory was written to the working directory")
+	}
+	// Reopening the database opens each table with the index type and page size it was created with
+	d, err = db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	out := runCommands(t, d, "find 499 from h", "find 7 from b")
+	if want := "found entry: (499, 249001)\nfound entry: (7, \"7\")\n"; out != want {
+		t.Errorf("got output %q, expected %q", out, want)
+	}
+	table, err := d.GetTable("h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := hash.IsHash(table.(*hash.HashIndex)); err != nil || !ok {
+		t.Error("hash table was not reopened as a hash table")
+	}
+	var listing strings.Builder
+	if err := db.HandleShowTables(d, "show tables", &listing); err != nil {
+		t.Fatal(err)
+	}
+	if want := "b (btree)\nh (hash)\n"; listing.String() != want {
+		t.Errorf("show tables printed %q, expected %q", listing.String(), want)
+	}
+	var description strings.Builder
+	if err := db.HandleDescribe(d, "describe b", &description); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("btree table b, %v byte pages\nid int primary key\nname text\n", 2*pager.PAGESIZE); description.String() != want {
+		t.Errorf("describe printed %q, expected %q", description.String(), want)
+	}
+	if err := db.HandleDescribe(d, "describe nope", ioutil.Discard); err == nil {
+		t.Error("described a table that does not exist")
+	}
+	if _, err := d.GetTable("nope"); err == nil {
+		t.Error("opened a table that does not exist")
+	}
+}
+
+func testDBDropRenameTruncate(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d,
+		"create hash table h (id int primary key, name text)",
+		"create btree table b",
+	)
+	for i := 0; i < 300; i++ {
+		runCommands(t, d,
+			fmt.Sprintf(`insert %v "name %v" into h`, i, i),
+			fmt.Sprintf("insert %v %v into b", i, i),
+		)
+	}
+	// Renaming moves the table's files and catalog entry
+	runCommands(t, d, "rename table h to g")
+	for _, file := range []string{"h", "h.meta", "h.values"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			t.Errorf("%s was left behind by the rename", file)
+		}
+	}
+	for _, file := range []string{"g", "g.meta", "g.values"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("%s was not created by the rename", file)
+		}
+	}
+	if _, err := d.GetTable("h"); err == nil {
+		t.Error("renamed table is still reachable under its old name")
+	}
+	if err := db.HandleRename(d, "rename table g to b", ioutil.Discard); err == nil {
+		t.Error("renamed a table over an existing table")
+	}
+	// Names are checked as create checks them.
+	if err := db.HandleRename(d, "rename table g to select", ioutil.Discard); err == nil {
+		t.Error("renamed a table to a reserved word")
+	}
+	if err := db.HandleDrop(d, "drop table g.meta", ioutil.Discard); err == nil {
+		t.Error("dropped a table by a name create would reject")
+	}
+	// Truncating empties the table but keeps its schema
+	runCommands(t, d, "truncate table b")
+	if out := runCommands(t, d, "select from b"); out != "" {
+		t.Errorf("truncated table still has entries: %q", out)
+	}
+	runCommands(t, d, "insert 1 2 into b")
+	// Dropping removes the files and the catalog entry
+	runCommands(t, d, "drop table g")
+	for _, file := range []string{"g", "g.meta", "g.values"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			t.Errorf("%s was left behind by the drop", file)
+		}
+	}
+	if err := db.HandleDrop(d, "drop table g", ioutil.Discard); err == nil {
+		t.Error("dropped a table that does not exist")
+	}
+	d.Close()
+	// The changes survive reopening the database, and a dropped name can be reused
+	d, err = db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if names := d.GetCatalog().GetNames(); len(names) != 1 || names[0] != "b" {
+		t.Errorf("catalog lists %v after reopening, expected [b]", names)
+	}
+	out := runCommands(t, d, "select from b", "create btree table g", "select from g")
+	if want := "(1, 2)\nbtree table g created.\n"; out != want {
+		t.Errorf("got output %q, expected %q", out, want)
+	}
+}
+
+// A table whose file can't be opened gives its pager back to the buffer pool.
+func testDBFailedOpen(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir, db.WithGlobalFrames(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d, "create table t")
+	d.Close()
+	file, err := os.OpenFile(filepath.Join(dir, "t"), os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0})
+	file.Close()
+	d, err = db.Open(dir, db.WithGlobalFrames(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.GetTable("t"); err == nil {
+		t.Fatal("expected a corrupted table to fail to open")
+	}
+	if usage := d.GetPool().GetUsage(); len(usage) != 0 {
+		t.Errorf("failed table is still in the pool: %+v", usage)
+	}
+}
+
+func testDBInterruptedRename(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d, "create btree table a (id int primary key, name text)")
+	for i := 0; i < 100; i++ {
+		runCommands(t, d, fmt.Sprintf(`insert %v "name %v" into a`, i, i))
+	}
+	d.Close()
+	// A crash part way through renaming a to b leaves the rename recorded in the catalog,
+	// with some of the files moved
+	path := filepath.Join(dir, db.CATALOG_FILE)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var catalog db.Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	catalog.Tables["a"].RenamingTo = "b"
+	if data, err = json.Marshal(&catalog); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "a"), filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	// Opening the database finishes the rename, and replaying it from the log keeps the rows
+	if d, err = db.Open(dir, db.WithGlobalFrames(0)); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.RenameTable("a", "b"); err == nil {
+		t.Error("renamed a table that was already renamed")
+	}
+	if names := d.GetCatalog().GetNames(); len(names) != 1 || names[0] != "b" {
+		t.Errorf("catalog lists %v after the interrupted rename, expected [b]", names)
+	}
+	if out := runCommands(t, d, "find 42 from b"); out != "found entry: (42, \"name 42\")\n" {
+		t.Errorf("renamed table printed %q", out)
+	}
+	for _, file := range []string{"a", "a.values"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			t.Errorf("%s was left behind by the rename", file)
+		}
+	}
+}
+
+// legacyPage returns a page written before pages had headers, with the given varint
+// header fields at the given offsets, and entries of key 10*i and value i from an offset.
+func legacyPage(fields map[int]int64, from int, keys []int64) []byte {
+	page := make([]byte, 4096)
+	for offset, field := range fields {
+		binary.PutVarint(page[offset:], field)
+	}
+	for i, key := range keys {
+		pos := from + 2*i*binary.MaxVarintLen64
+		binary.PutVarint(page[pos:], key)
+		binary.PutVarint(page[pos+binary.MaxVarintLen64:], key/10)
+	}
+	return page
+}
+
+// writeLegacyTables writes a btree table b of 200 entries and a hash table h of 150 in the
+// format used before pages had headers, with key 10*i and value i.
+func writeLegacyTables(t *testing.T, dir string) {
+	keys := func(from, to int64) []int64 {
+		keys := make([]int64, 0)
+		for i := from; i < to; i++ {
+			keys = append(keys, 10*i)
+		}
+		return keys
+	}
+	// A btree node had a type byte, 1 for leaves, and its number of keys; a leaf then its
+	// right sibling. A hash bucket had its depth and number of keys.
+	root := legacyPage(map[int]int64{1: 1}, 11, nil)
+	leaf, sibling := legacyPage(map[int]int64{1: 100, 11: 2}, 21, keys(0, 100)), legacyPage(map[int]int64{1: 100}, 21, keys(100, 200))
+	leaf[0], sibling[0] = 1, 1
+	files := map[string][][]byte{
+		"b": {root, leaf, sibling},
+		"h": {legacyPage(map[int]int64{0: 1, 10: 100}, 20, keys(0, 100)), legacyPage(map[int]int64{0: 1, 10: 50}, 20, keys(100, 150))},
+	}
+	for name, pages := range files {
+		path := filepath.Join(dir, name)
+		os.Remove(path + ".meta")
+		os.Remove(path + ".values")
+		var data []byte
+		for _, page := range pages {
+			data = append(data, page...)
+		}
+		if err := ioutil.WriteFile(path, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkLegacyTables checks that the tables writeLegacyTables wrote hold their entries, and
+// were migrated.
+func checkLegacyTables(t *testing.T, d *db.Database, dir string) {
+	for name, n := range map[string]int64{"b": 200, "h": 150} {
+		table, err := d.GetTable(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < n; i++ {
+			entry, err := table.Find(10 * i)
+			if err != nil {
+				t.Fatalf("key %d of %v: %v", 10*i, name, err)
+			}
+			if entry.GetValue() != i {
+				t.Errorf("key %d of %v has value %d, expected %d", 10*i, name, entry.GetValue(), i)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, name+".legacy")); !os.IsNotExist(err) {
+			t.Errorf("legacy file of %v was not removed", name)
+		}
+	}
+}
+
+func testDBLegacyMigration(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d, "create btree table b", "create hash table h")
+	d.Close()
+	writeLegacyTables(t, dir)
+
+	// Opening each table rewrites it in the current format.
+	d, err = db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLegacyTables(t, d, dir)
+	runCommands(t, d, "insert 5 5 into b", "insert 5 5 into h")
+	d.Close()
+	// The migrated tables stay migrated.
+	d, err = db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	out := runCommands(t, d, "find 5 from b", "find 1990 from b", "find 5 from h", "find 1490 from h")
+	want := "found entry: (5, 5)\nfound entry: (1990, 199)\nfound entry: (5, 5)\nfound entry: (1490, 149)\n"
+	if out != want {
+		t.Errorf("got output\n%v\nexpected\n%v", out, want)
+	}
+}
+
+// A folder written before databases kept a catalog has one made from its table files, a
+// table with a .meta file being a hash table.
+func testDBUncataloged(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	writeLegacyTables(t, dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "h.meta"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	catalog := d.GetCatalog()
+	if names := catalog.GetNames(); strings.Join(names, " ") != "b h" {
+		t.Fatalf("cataloged tables %v, expected b and h", names)
+	}
+	if catalog.Tables["b"].Type != db.BTreeIndexType || catalog.Tables["h"].Type != db.HashIndexType {
+		t.Errorf("b is a %v table and h a %v table", catalog.Tables["b"].Type, catalog.Tables["h"].Type)
+	}
+	checkLegacyTables(t, d, dir)
+	if _, err := os.Stat(filepath.Join(dir, db.CATALOG_FILE)); err != nil {
+		t.Errorf("catalog was not written: %v", err)
+	}
+}
+
+func testDBSecondaryIndex(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d,
+		"create btree table p",
+		"create hash table people (id int primary key, name text, age int)",
+	)
+	// Rows inserted before the index is created are filed in it too.
+	for i := 0; i < 200; i++ {
+		runCommands(t, d,
+			fmt.Sprintf("insert %v %v into p", i, i%10),
+			fmt.Sprintf(`insert %v "person %v" %v into people`, i, i%7, i%5),
+		)
+	}
+	runCommands(t, d,
+		"create index pv on p(value) using btree",
+		"create index names on people (name) using hash",
+		"create index ages on people(age) using btree",
+	)
+	for i := 200; i < 300; i++ {
+		runCommands(t, d,
+			fmt.Sprintf("insert %v %v into p", i, i%10),
+			fmt.Sprintf(`insert %v "person %v" %v into people`, i, i%7, i%5),
+		)
+	}
+	// Keep the indexes in sync through updates and deletes.
+	for i := 0; i < 300; i += 3 {
+		runCommands(t, d, fmt.Sprintf("update p %v %v", i, 10+i%2))
+	}
+	for i := 1; i < 300; i += 3 {
+		runCommands(t, d, fmt.Sprintf("delete %v from p", i))
+	}
+	runCommands(t, d, `update people 7 "someone else" 9`, "delete 14 from people")
+	check := func() {
+		for value := 0; value < 12; value++ {
+			var want strings.Builder
+			for i := 0; i < 300; i++ {
+				switch {
+				case i%3 == 0 && 10+i%2 == value, i%3 == 2 && i%10 == value:
+					want.WriteString(fmt.Sprintf("(%v, %v)\n", i, value))
+				}
+			}
+			out := runCommands(t, d, fmt.Sprintf("select from p where value = %v", value))
+			if out != want.String() {
+				t.Errorf("select where value = %v printed %q, expected %q", value, out, want.String())
+			}
+		}
+		out := runCommands(t, d, `select id from people where name = "someone else"`, "select id from people where age = 9")
+		if want := "(7)\n(7)\n"; out != want {
+			t.Errorf("got output %q, expected %q", out, want)
+		}
+		out = runCommands(t, d, `find from people where name = "person 0"`)
+		if n := strings.Count(out, "found entry"); n != 41 {
+			t.Errorf("found %v people named person 0, expected 41", n)
+		}
+		if strings.Contains(out, "(7,") || strings.Contains(out, "(14,") {
+			t.Errorf("found an entry that was updated or deleted: %q", out)
+		}
+	}
+	check()
+	// The indexes are reopened with their tables.
+	d.Close()
+	d, err = db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	check()
+	var description strings.Builder
+	if err := db.HandleDescribe(d, "describe people", &description); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(description.String(), "index names on name using hash\nindex ages on age using btree\n") {
+		t.Errorf("describe printed %q, expected it to list the indexes", description.String())
+	}
+	// Columns without an index, and the key, can be looked up too.
+	out := runCommands(t, d, "select from people where id = 3", "find from p where key = 5")
+	if want := "(3, \"person 3\", 3)\nfound entry: (5, 5)\n"; out != want {
+		t.Errorf("got output %q, expected %q", out, want)
+	}
+	for _, command := range []string{
+		"create index pv on people(age) using hash",
+		"create index people on p(value) using hash",
+		"create index k on p(key) using hash",
+		"create index v on p(nope) using hash",
+		"create index v2 on p(value) using hash",
+	} {
+		if err := db.HandleCreateTable(d, command, ioutil.Discard); err == nil {
+			t.Errorf("%v did not fail", command)
+		}
+	}
+	// Dropping an index removes its files; dropping a table removes its indexes.
+	runCommands(t, d, "drop index pv")
+	if _, err := os.Stat(filepath.Join(dir, "pv.idx")); err == nil {
+		t.Error("dropped index left its file behind")
+	}
+	runCommands(t, d, "drop table people")
+	if _, err := os.Stat(filepath.Join(dir, "names.idx")); err == nil {
+		t.Error("dropped table left its index behind")
+	}
+	runCommands(t, d, "create index names on p(value) using btree")
+}
+
+// A change that can't be made to every secondary index is undone in the table and the
+// indexes it was made to.
+func testDBSecondaryIndexUndo(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	runCommands(t, d,
+		"create btree table t (id int primary key, v int, w int)",
+		"create index tv on t(v) using btree",
+		"create index tw on t(w) using hash",
+		"insert 1 10 10 into t",
+	)
+	// Corrupt the keys filed under w = 10, so changes to them fail.
+	table, _ := d.GetTable("t")
+	for _, index := range table.(*db.IndexedTable).GetSecondaryIndexes() {
+		if strings.HasPrefix(index.GetName(), "tw") {
+			if err := index.Update(10, 7); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, command := range []string{"insert 2 10 10 into t", "update t 1 20 30", "delete 1 from t"} {
+		var err error
+		switch strings.Fields(command)[0] {
+		case "insert":
+			err = db.HandleInsert(d, command)
+		case "update":
+			err = db.HandleUpdate(d, command)
+		case "delete":
+			err = db.HandleDelete(d, command)
+		}
+		if err == nil {
+			t.Fatalf("%v: expected an error", command)
+		}
+		out := runCommands(t, d, "select from t", "select id from t where v = 10", "select id from t where v = 20")
+		if want := "(1, 10, 10)\n(1)\n"; out != want {
+			t.Errorf("after %v, got output %q, expected %q", command, out, want)
+		}
+	}
+}
+
+func testDBSQL(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	runCommands(t, d,
+		"create table s (id int primary key, name text, score float)",
+		"create hash table h",
+		"create index names on s(name) using hash",
+	)
+	for i := 0; i < 50; i++ {
+		runCommands(t, d,
+			fmt.Sprintf("insert into s (score, name, id) values (%v, 'n%v', %v)", i%7, i%5, i),
+			fmt.Sprintf("insert into h values (%v, %v)", i, i%3),
+		)
+	}
+	runCommands(t, d,
+		"update s set score = score, name = 'five' where id > 40 and name = 'n0'",
+		"update h set value = -1 where value = 2 and key < 10",
+		"delete from s where id between 10 and 39 or score = 6",
+		"delete from h where key >= 12",
+	)
+	out := runCommands(t, d,
+		"select id, name, score from s where name = 'five' order by id desc",
+		"select id from s where score >= 5 order by score, id desc limit 3",
+		"select * from s where id < 4 and not name = 'n1'",
+		"select from h where value < 0 order by key desc limit 2",
+		"select key from h where value = 1 order by value, key",
+		"find from s where name = 'n0' and id < 10",
+	)
+	want := `(45, "five", 3)
+(47)
+(40)
+(5)
+(0, "n0", 0)
+(2, "n2", 2)
+(3, "n3", 3)
+(8, -1)
+(5, -1)
+(1)
+(4)
+(7)
+(10)
+found entry: (0, "n0", 0)
+found entry: (5, "n0", 5)
+`
+	if out != want {
+		t.Errorf("got output\n%v\nexpected\n%v", out, want)
+	}
+	for command, want := range map[string]string{
+		"select from s where nope = 1":          `select error: no column named "nope"`,
+		"select from s where id = 1 limit":      "select error: syntax error at position 33: expected a row count, found end of input",
+		"select from s where name < 3":          `select error: cannot compare "n0" with 3`,
+		"insert into s values (100, 1.5, 2)":    "insert error: column name: 1.5 is not a text",
+		"insert into s (id, id) values (1, 2)":  "insert error: expected a value for each of the 3 columns, got 2",
+		"insert into s values (0, 'x', 1)":      "insert error: key already in table",
+		"insert into h values (1, 1.5)":         "insert error: column value: 1.5 is not an int",
+		"update s set id = 3 where id = 1":      "update error: cannot update the primary key id",
+		"update s set score = 'x' where id = 1": `update error: column score: "x" is not a float`,
+		"delete from s where id":                "delete error: syntax error at position 23: expected a comparison, found end of input",
+		"find 100 from s":                       "find error: no entry where (key = 100)",
+	} {
+		var err error
+		switch strings.Fields(command)[0] {
+		case "select":
+			err = query.HandleSelect(d, command, ioutil.Discard)
+		case "insert":
+			err = db.HandleInsert(d, command)
+		case "update":
+			err = db.HandleUpdate(d, command)
+		case "delete":
+			err = db.HandleDelete(d, command)
+		case "find":
+			err = query.HandleFind(d, command, ioutil.Discard)
+		}
+		if err == nil || err.Error() != want {
+			t.Errorf("%v: got error %v, expected %v", command, err, want)
+		}
+	}
+}
+
+// histogramRows sums the rows in the buckets of a column's histogram.
+func histogramRows(column *db.ColumnStats) int64 {
+	n := int64(0)
+	for _, bucket := range column.Histogram {
+		n += bucket.Rows
+	}
+	return n
+}
+
+// Loading a file fills a table without a schema with its (key, value) pairs, and a table
+// with one with its rows, each line listing a row's values.
+func testDBLoad(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	load := func(table string, lines ...string) error {
+		file := filepath.Join(dir, table+".txt")
+		if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return db.HandleLoad(d, "load "+file+" into "+table, ioutil.Discard)
+	}
+	runCommands(t, d, "create btree table p", "create btree table s (name text, id int primary key, score float)")
+	if err := load("p", "2 20", "", `1 "one"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := load("s", `"bob, jr." 2 -0.25`, `'ann' 1 3`); err != nil {
+		t.Fatal(err)
+	}
+	out := runCommands(t, d, "select from p", "select from s", "select name from s where score > 0")
+	want := `(1, "one")
+(2, 20)
+("ann", 1, 3)
+("bob, jr.", 2, -0.25)
+("ann")
+`
+	if out != want {
+		t.Errorf("got output\n%v\nexpected\n%v", out, want)
+	}
+	// Lines that don't fit the table's columns fail the load, and leave the table empty.
+	runCommands(t, d, "create btree table e (id int primary key, name text)")
+	for _, line := range []string{`1 "x" 2`, `"x" 1`, "1 x"} {
+		if err := load("e", "2 \"y\"", line); err == nil {
+			t.Errorf("loaded %q into a table of (int, text) rows", line)
+		}
+		if out := runCommands(t, d, "select from e"); out != "" {
+			t.Errorf("failed load of %q left rows %v", line, out)
+		}
+	}
+}
+
+func testDBAnalyze(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d, "create btree table s (id int primary key, grp int, name text)")
+	for i := 0; i < 2000; i++ {
+		runCommands(t, d, fmt.Sprintf(`insert into s values (%v, %v, "n%v")`, i, i%50, i%10))
+	}
+	if err := db.HandleAnalyze(d, "analyze s where", ioutil.Discard); err == nil {
+		t.Error("analyzed a table by a name create would reject")
+	}
+	runCommands(t, d, "analyze s")
+	table, err := d.GetTable("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := db.GetStats(table)
+	if stats == nil {
+		t.Fatal("analyzed table has no stats")
+	}
+	// The row count is exact, and distinct values are estimated closely
+	if stats.RowCount() != 2000 {
+		t.Errorf("got %v rows, expected 2000", stats.RowCount())
+	}
+	for i, want := range []int64{2000, 50, 10} {
+		if got := stats.Distinct(i); got < want*95/100 || got > want*105/100 {
+			t.Errorf("column %v: estimated %v distinct values, expected about %v", stats.Columns[i].Name, got, want)
+		}
+	}
+	id := stats.Columns[0]
+	if id.Min.Value != int64(0) || id.Max.Value != int64(1999) {
+		t.Errorf("id ranges from %v to %v, expected 0 to 1999", id.Min.Value, id.Max.Value)
+	}
+	if name := stats.Columns[2]; name.Min.Value != "n0" || name.Max.Value != "n9" {
+		t.Errorf("name ranges from %v to %v, expected n0 to n9", name.Min.Value, name.Max.Value)
+	}
+	// Histograms cover every row, in buckets of about the same depth
+	for _, column := range stats.Columns {
+		if n := histogramRows(column); n != 2000 {
+			t.Errorf("column %v: histogram holds %v rows, expected 2000", column.Name, n)
+		}
+		if len(column.Histogram) > db.HISTOGRAM_BUCKETS {
+			t.Errorf("column %v: histogram has %v buckets", column.Name, len(column.Histogram))
+		}
+	}
+	for _, bucket := range id.Histogram {
+		if bucket.Rows < 150 || bucket.Rows > 250 {
+			t.Errorf("id bucket up to %v holds %v rows, expected about 200", bucket.Upper.Value, bucket.Rows)
+		}
+	}
+	// Edits keep the stats up to date
+	for i := 2000; i < 2010; i++ {
+		runCommands(t, d, fmt.Sprintf(`insert into s values (%v, 0, "n0")`, i))
+	}
+	runCommands(t, d, "delete from s where id < 5", "update s set grp = 99 where id = 100")
+	if stats.RowCount() != 2005 {
+		t.Errorf("got %v rows after edits, expected 2005", stats.RowCount())
+	}
+	if id.Max.Value != int64(2009) || stats.Columns[1].Max.Value != int64(99) {
+		t.Errorf("maximums are %v and %v after edits, expected 2009 and 99", id.Max.Value, stats.Columns[1].Max.Value)
+	}
+	if n := histogramRows(id); n != 2005 {
+		t.Errorf("histogram holds %v rows after edits, expected 2005", n)
+	}
+	// The join planner counts the table's rows from its stats
+	if n := query.EstimateCardinality(table); n != 2005 {
+		t.Errorf("planner estimated %v rows, expected 2005", n)
+	}
+	d.Close()
+	// Stats are kept in the catalog, along with the edits made since analyzing
+	d, err = db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if table, err = d.GetTable("s"); err != nil {
+		t.Fatal(err)
+	}
+	stats = db.GetStats(table)
+	if stats == nil || stats.RowCount() != 2005 || stats.Modifications != 16 {
+		t.Fatalf("stats were not kept across reopening: %+v", stats)
+	}
+	if max := stats.Columns[0].Max.Value; max != int64(2009) {
+		t.Errorf("id maximum is %v after reopening, expected 2009", max)
+	}
+	if got := stats.Distinct(2); got != 10 {
+		t.Errorf("estimated %v distinct names after reopening, expected 10", got)
+	}
+	// Once enough rows change, planning a query analyzes the table again, shrinking ranges
+	// deletes can't
+	runCommands(t, d, "delete from s where id >= 1500", "select * from s where id = 1")
+	if stats = db.GetStats(table); stats.RowCount() != 1495 || stats.Modifications != 0 {
+		t.Errorf("got %v rows and %v modifications after reanalyzing, expected 1495 and 0", stats.RowCount(), stats.Modifications)
+	}
+	if max := stats.Columns[0].Max.Value; max != int64(1499) {
+		t.Errorf("id maximum is %v after reanalyzing, expected 1499", max)
+	}
+	// Truncating empties the stats
+	runCommands(t, d, "truncate table s")
+	if table, err = d.GetTable("s"); err != nil {
+		t.Fatal(err)
+	}
+	if stats = db.GetStats(table); stats == nil || stats.RowCount() != 0 {
+		t.Error("truncated table does not have empty stats")
+	}
+	out := runCommands(t, d, "insert into s values (1, 2, \"x\")", "analyze s")
+	if want := "1 rows in table s.\nid: 1 distinct, min 1, max 1\n  histogram: <= 1: 1\n"; !strings.HasPrefix(out, want) {
+		t.Errorf("analyze printed %q, expected it to start with %q", out, want)
+	}
+}
+
+// falsePositiveRate returns the rate of keys from n on that a filter of the keys below n contains.
+func falsePositiveRate(filter *db.BloomFilter, n int64) float64 {
+	falsePositives := 0
+	for i := n; i < n+20000; i++ {
+		if filter.Contains(i) {
+			falsePositives++
+		}
+	}
+	return float64(falsePositives) / 20000
+}
+
+func testDBBloomFilter(t *testing.T) {
+	// A filter sized for a rate of false positives has about that rate, with any number of
+	// hashes, though the best number has the fewest
+	filter := db.NewOptimalFilter(1000, 0.01)
+	if filter.Size() != db.FilterSize(1000, 0.01) || filter.Hashes() != 7 {
+		t.Errorf("optimal filter has %v bits and %v hashes, expected %v and 7", filter.Size(), filter.Hashes(), db.FilterSize(1000, 0.01))
+	}
+	rates := make(map[int64]float64)
+	for _, hashes := range []int64{1, 3, 7} {
+		filter := db.NewBloomFilter(db.FilterSize(1000, 0.01), hashes)
+		for i := int64(0); i < 1000; i++ {
+			filter.Insert(i)
+		}
+		for i := int64(0); i < 1000; i++ {
+			if !filter.Contains(i) {
+				t.Fatalf("filter with %v hashes does not contain inserted key %v", hashes, i)
+			}
+		}
+		rates[hashes] = falsePositiveRate(filter, 1000)
+	}
+	if rates[7] > 0.015 || rates[7] >= rates[3] || rates[3] >= rates[1] {
+		t.Errorf("false positive rates by number of hashes are %v, expected about 0.01 with 7", rates)
+	}
+	// Unions contain the keys of either filter, and intersections those of both
+	evens, thirds := db.NewOptimalFilter(1000, 0.01), db.NewOptimalFilter(1000, 0.01)
+	for i := int64(0); i < 1000; i++ {
+		evens.Insert(2 * i)
+		thirds.Insert(3 * i)
+	}
+	encoded := evens.Marshal()
+	union, err := db.UnmarshalFilter(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intersection, _ := db.UnmarshalFilter(encoded)
+	if err := union.Union(thirds); err != nil {
+		t.Fatal(err)
+	}
+	if err := intersection.Intersect(thirds); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 3000; i++ {
+		if ((i%2 == 0 && i < 2000) || i%3 == 0) && !union.Contains(i) {
+			t.Fatalf("union does not contain %v", i)
+		}
+		if i%6 == 0 && i < 2000 && !intersection.Contains(i) {
+			t.Fatalf("intersection does not contain %v", i)
+		}
+	}
+	if union.Keys() != 2000 || intersection.Keys() != 1000 {
+		t.Errorf("union and intersection hold %v and %v keys, expected 2000 and 1000", union.Keys(), intersection.Keys())
+	}
+	if err := union.Union(db.NewBloomFilter(union.Size(), 3)); err == nil {
+		t.Error("union of filters with different hashes did not fail")
+	}
+	// A filter survives being encoded, and a damaged encoding is refused
+	decoded, err := db.UnmarshalFilter(evens.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Size() != evens.Size() || decoded.Hashes() != evens.Hashes() || decoded.Keys() != 1000 {
+		t.Errorf("decoded filter has %v bits, %v hashes and %v keys", decoded.Size(), decoded.Hashes(), decoded.Keys())
+	}
+	for i := int64(0); i < 4000; i++ {
+		if decoded.Contains(i) != evens.Contains(i) {
+			t.Fatalf("decoded filter disagrees about %v", i)
+		}
+	}
+	if _, err := db.UnmarshalFilter(encoded[:len(encoded)-1]); err == nil {
+		t.Error("truncated filter was decoded")
+	}
+}
+
+func testDBTableFilter(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	defer func(minKeys int64) { db.TABLE_FILTER_MIN_KEYS = minKeys }(db.TABLE_FILTER_MIN_KEYS)
+	db.TABLE_FILTER_MIN_KEYS = 64
+
+	d, err := db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d, "create btree table s (id int primary key, v int)")
+	for i := 0; i < 100; i++ {
+		runCommands(t, d, fmt.Sprintf("insert into s values (%v, %v)", 2*i, i))
+	}
+	if err := db.HandleFilter(d, "filter on s.values", ioutil.Discard); err == nil {
+		t.Error("filtered a table by a name create would reject")
+	}
+	runCommands(t, d, "filter on s 0.01")
+	// Inserts past the filter's capacity grow it, without losing any key
+	for i := 100; i < 1000; i++ {
+		runCommands(t, d, fmt.Sprintf("insert into s values (%v, %v)", 2*i, i))
+	}
+	stats, ok, err := d.GetFilterStats("s")
+	if err != nil || !ok {
+		t.Fatalf("table has no filter: %v", err)
+	}
+	if stats.Size < db.FilterSize(1000, 0.01) || stats.Keys != 1000 {
+		t.Errorf("filter of 1000 keys has %v bits and %v keys", stats.Size, stats.Keys)
+	}
+	table, err := d.GetTable("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 1000; i++ {
+		if _, err := table.Find(2 * i); err != nil {
+			t.Fatalf("key %v not found: %v", 2*i, err)
+		}
+	}
+	// Finds of absent keys mostly skip the table's index
+	table.GetPager().ResetStats()
+	for i := int64(0); i < 1000; i++ {
+		if _, err := table.Find(2*i + 1); err == nil {
+			t.Fatalf("absent key %v found", 2*i+1)
+		}
+	}
+	stats, _, _ = d.GetFilterStats("s")
+	pages := table.GetPager().GetStats()
+	if stats.Skipped < 950 || pages.Hits+pages.Misses > 200 {
+		t.Errorf("finds of 1000 absent keys skipped %v and read %v pages", stats.Skipped, pages.Hits+pages.Misses)
+	}
+	d.Close()
+	// The filter is kept in a file while the table is closed, which is removed once read
+	bloom := filepath.Join(dir, "s.bloom")
+	if _, err := os.Stat(bloom); err != nil {
+		t.Fatalf("closed table's filter was not written: %v", err)
+	}
+	if d, err = db.Open(dir, db.WithGlobalFrames(0)); err != nil {
+		t.Fatal(err)
+	}
+	if kept, _, err := d.GetFilterStats("s"); err != nil || kept.Size != stats.Size || kept.Keys != 1000 {
+		t.Fatalf("filter was not kept across reopening: %+v, %v", kept, err)
+	}
+	if _, err := os.Stat(bloom); !os.IsNotExist(err) {
+		t.Error("open table's filter file was not removed")
+	}
+	// A table that wasn't closed has its filter rebuilt
+	d, err = db.Open(dir, db.WithGlobalFrames(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	out := runCommands(t, d, "find 1998 from s", "describe s")
+	if !strings.Contains(out, "found entry: (1998, 999)") || !strings.Contains(out, "for a false positive rate of 0.01: 1000 keys, 0 finds skipped") {
+		t.Errorf("rebuilt filter printed %q", out)
+	}
+	// Truncating empties the filter, and dropping it removes its file
+	runCommands(t, d, "truncate table s")
+	if stats, _, _ := d.GetFilterStats("s"); stats.Keys != 0 {
+		t.Errorf("truncated table's filter holds %v keys", stats.Keys)
+	}
+	// Loading files the loaded keys in the filter
+	file := filepath.Join(dir, "load.txt")
+	var lines strings.Builder
+	for i := 0; i < 100; i++ {
+		lines.WriteString(fmt.Sprintf("%v %v\n", i, i))
+	}
+	if err := ioutil.WriteFile(file, []byte(lines.String()), 0666); err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, d, "create btree table l", "filter on l", "load "+file+" into l")
+	if stats, _, _ := d.GetFilterStats("l"); stats.Keys != 100 {
+		t.Errorf("filter holds %v keys after loading 100", stats.Keys)
+	}
+	loaded, err := d.GetTable("l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 100; i++ {
+		if _, err := loaded.Find(i); err != nil {
+			t.Fatalf("loaded key %v not found: %v", i, err)
+		}
+	}
+	runCommands(t, d, "delete 42 from l")
+	runCommands(t, d, "filter off s", "insert into s values (1, 1)", "find 1 from s")
+	if _, ok, _ := d.GetFilterStats("s"); ok {
+		t.Error("table still has a filter")
+	}
+}
@@ -0,0 +1,473 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	exec "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/exec"
+	query "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/query"
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+func TestExec(t *testing.T) {
+	t.Run("TestExecScan", testExecScan)
+	t.Run("TestExecPipeline", testExecPipeline)
+	t.Run("TestExecAggregate", testExecAggregate)
+	t.Run("TestExecAggregateSpill", testExecAggregateSpill)
+	t.Run("TestExecExternalSort", testExecExternalSort)
+	t.Run("TestExecJoin", testExecJoin)
+	t.Run("TestExecSemiJoin", testExecSemiJoin)
+}
+
+// setupExec opens a database with a btree table s of students and a hash table h.
+func setupExec(t *testing.T, rows int) (*db.Database, func()) {
+	dir := getTempDBDir(t)
+	d, err := db.Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	runCommands(t, d,
+		"create table s (id int primary key, name text, score float)",
+		"create hash table h",
+		"create index names on s(name) using btree",
+	)
+	for i := 0; i < rows; i++ {
+		runCommands(t, d,
+			fmt.Sprintf("insert into s values (%v, 'n%v', %v)", i, i%4, float64(i%5)/2),
+			fmt.Sprintf("insert into h values (%v, %v)", i, i%3),
+		)
+	}
+	return d, func() {
+		d.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// parseExpr parses the where clause of a select from t.
+func parseExpr(t *testing.T, condition string) sql.Expr {
+	statement, err := sql.Parse("select from t where " + condition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return statement.(*sql.SelectStmt).Where
+}
+
+// formatRows formats rows one per line.
+func formatRows(rows []db.Row) string {
+	out := ""
+	for _, row := range rows {
+		out += db.FormatRow(row) + "\n"
+	}
+	return out
+}
+
+func testExecScan(t *testing.T) {
+	d, cleanup := setupExec(t, 600)
+	defer cleanup()
+	// A hash table's scan reads every entry exactly once, across all of its buckets.
+	path, err := d.ChooseAccessPath("h", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan, err := exec.NewScan(d, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pass := 0; pass < 2; pass++ {
+		rows, err := exec.Collect(scan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[int64]bool)
+		for _, row := range rows {
+			key := row[0].(int64)
+			if seen[key] || row[1].(int64) != key%3 {
+				t.Fatalf("scanned %v twice or with the wrong value", db.FormatRow(row))
+			}
+			seen[key] = true
+		}
+		if len(seen) != 600 {
+			t.Fatalf("scanned %v of 600 entries", len(seen))
+		}
+	}
+	// A range of a btree table's keys is read in descending order.
+	path, err = d.ChooseAccessPath("s", parseExpr(t, "id > 595 and 598 >= key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Kind != db.RangeScan {
+		t.Fatalf("chose %v, expected a range scan", path)
+	}
+	scan, err = exec.NewScan(d, path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := exec.Collect(scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatRows(rows); got != "(598, \"n2\", 1.5)\n(597, \"n1\", 1)\n(596, \"n0\", 0.5)\n" {
+		t.Errorf("range scanned\n%v", got)
+	}
+	// Seeks read the rows under a key or a value of an indexed column.
+	for condition, want := range map[string]string{
+		"key = 7 and id > 3":      "(7, \"n3\", 1)\n",
+		"name = 'n3' and id < 12": "(3, \"n3\", 1.5)\n(7, \"n3\", 1)\n(11, \"n3\", 0.5)\n",
+	} {
+		path, err := d.ChooseAccessPath("s", parseExpr(t, condition))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seek, err := exec.NewIndexSeek(d, path, false)
+		if err != nil {
+			t.Fatalf("%v: %v", condition, err)
+		}
+		filter, err := exec.NewFilter(seek, parseExpr(t, condition))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := exec.Collect(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatRows(rows); got != want {
+			t.Errorf("%v: sought\n%v, expected\n%v", condition, got, want)
+		}
+	}
+	if _, err := exec.NewScan(d, &db.AccessPath{Table: "s", Kind: db.KeySeek}, false); err == nil {
+		t.Error("expected an error scanning along a key seek")
+	}
+}
+
+func testExecPipeline(t *testing.T) {
+	d, cleanup := setupExec(t, 40)
+	defer cleanup()
+	path, err := d.ChooseAccessPath("s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan exec.Operator
+	if plan, err = exec.NewScan(d, path, false); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = exec.NewFilter(plan, parseExpr(t, "score >= 1.5 and name != 'n0'")); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = exec.NewSort(plan, []sql.OrderItem{{Expr: &sql.ColumnRef{Name: "score"}, Desc: true}, {Expr: &sql.ColumnRef{Name: "name"}}}); err != nil {
+		t.Fatal(err)
+	}
+	plan = exec.NewLimit(plan, 4)
+	columns := []sql.Expr{&sql.ColumnRef{Table: "s", Name: "name"}, &sql.ColumnRef{Name: "key"}, parseExpr(t, "score > 1.5")}
+	if plan, err = exec.NewProject(plan, columns); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(plan.Scope().Columns); got != "[name id (score > 1.5)]" {
+		t.Errorf("projected columns %v", got)
+	}
+	if plan.Scope().Key("s") != 1 {
+		t.Errorf("projected key of s to column %v", plan.Scope().Key("s"))
+	}
+	// Rows with the same score and name keep the order of their keys.
+	want := "(\"n1\", 9, true)\n(\"n1\", 29, true)\n(\"n2\", 14, true)\n(\"n2\", 34, true)\n"
+	for pass := 0; pass < 2; pass++ {
+		rows, err := exec.Collect(plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatRows(rows); got != want {
+			t.Errorf("pass %v produced\n%v, expected\n%v", pass, got, want)
+		}
+	}
+	// Errors are reported when an operator is built or run.
+	scan, err := exec.NewScan(d, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.NewFilter(scan, parseExpr(t, "nope = 1")); err == nil {
+		t.Error("expected an error filtering by a missing column")
+	}
+	if _, err := exec.NewProject(scan, []sql.Expr{&sql.ColumnRef{Table: "h", Name: "id"}}); err == nil {
+		t.Error("expected an error projecting a column of another table")
+	}
+	filter, err := exec.NewFilter(scan, parseExpr(t, "name < 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.Collect(filter); err == nil {
+		t.Error("expected an error comparing text with an int")
+	}
+}
+
+func testExecAggregate(t *testing.T) {
+	d, cleanup := setupExec(t, 20)
+	defer cleanup()
+	path, err := d.ChooseAccessPath("s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan, err := exec.NewScan(d, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sql.ColumnRef{Name: "score"}
+	funcs := []exec.AggregateFunc{{Name: "count"}, {Name: "sum", Arg: score}, {Name: "min", Arg: &sql.ColumnRef{Name: "id"}}, {Name: "max", Arg: score}, {Name: "avg", Arg: &sql.ColumnRef{Name: "id"}}}
+	aggregate, err := exec.NewHashAggregate(scan, []sql.Expr{&sql.ColumnRef{Name: "name"}}, funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(aggregate.Scope().Columns); got != "[name count(*) sum(score) min(id) max(score) avg(id)]" {
+		t.Errorf("aggregated columns %v", got)
+	}
+	rows, err := exec.Collect(aggregate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "(\"n0\", 5, 5, 0, 2, 8)\n(\"n1\", 5, 5, 1, 2, 9)\n(\"n2\", 5, 5, 2, 2, 10)\n(\"n3\", 5, 5, 3, 2, 11)\n"
+	if got := formatRows(rows); got != want {
+		t.Errorf("aggregated\n%v, expected\n%v", got, want)
+	}
+	// Without a grouping, no rows still make one group.
+	filter, err := exec.NewFilter(scan, parseExpr(t, "id < 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aggregate, err = exec.NewHashAggregate(filter, nil, funcs); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err = exec.Collect(aggregate); err != nil {
+		t.Fatal(err)
+	}
+	if got := formatRows(rows); got != "(0, null, null, null, null)\n" {
+		t.Errorf("aggregated no rows to %v", got)
+	}
+	if aggregate, err = exec.NewHashAggregate(scan, nil, []exec.AggregateFunc{{Name: "sum", Arg: &sql.ColumnRef{Name: "name"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.Collect(aggregate); err == nil {
+		t.Error("expected an error summing text")
+	}
+	if _, err := exec.NewHashAggregate(scan, nil, []exec.AggregateFunc{{Name: "median", Arg: score}}); err == nil {
+		t.Error("expected an error for an unknown aggregate function")
+	}
+}
+
+func testExecAggregateSpill(t *testing.T) {
+	d, cleanup := setupExec(t, 500)
+	defer cleanup()
+	tempFiles, _ := filepath.Glob("db-*")
+	// Hold only a few groups in memory, so most rows are spilled, some more than once.
+	defer func(memory int, partitions int) {
+		exec.AGGREGATE_MEMORY, exec.AGGREGATE_PARTITIONS = memory, partitions
+	}(exec.AGGREGATE_MEMORY, exec.AGGREGATE_PARTITIONS)
+	exec.AGGREGATE_MEMORY, exec.AGGREGATE_PARTITIONS = 7, 3
+	funcs := []exec.AggregateFunc{{Name: "count"}, {Name: "sum", Arg: &sql.ColumnRef{Name: "score"}}, {Name: "max", Arg: &sql.ColumnRef{Name: "id"}}}
+	aggregate := func(sorted bool, groupBy string) []db.Row {
+		path, err := d.ChooseAccessPath("s", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan, err := exec.NewScan(d, path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var op exec.Operator
+		group := []sql.Expr{&sql.ColumnRef{Name: groupBy}}
+		if sorted {
+			op, err = exec.NewSortAggregate(scan, group, funcs)
+		} else {
+			op, err = exec.NewHashAggregate(scan, group, funcs)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := exec.Collect(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	// Grouping by the key makes one group per row, read in key order.
+	hashed, sorted := aggregate(false, "id"), aggregate(true, "id")
+	if len(hashed) != 500 || len(sorted) != 500 {
+		t.Fatalf("got %v and %v groups of 500 keys", len(hashed), len(sorted))
+	}
+	for i, row := range sorted {
+		if want := fmt.Sprint(db.Row{int64(i), int64(1), float64(i%5) / 2, int64(i)}); fmt.Sprint(row) != want {
+			t.Fatalf("sort aggregate produced %v, expected %v", row, want)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, row := range hashed {
+		seen[fmt.Sprint(row)] = true
+	}
+	for _, row := range sorted {
+		if !seen[fmt.Sprint(row)] {
+			t.Errorf("hash aggregate is missing group %v", row)
+		}
+	}
+	// Spilled rows of a group are folded into it, not into a new group.
+	counts := make(map[string]int64)
+	for _, row := range aggregate(false, "score") {
+		if _, ok := counts[fmt.Sprint(row[0])]; ok {
+			t.Errorf("group %v produced twice", row[0])
+		}
+		counts[fmt.Sprint(row[0])] = row[1].(int64)
+	}
+	if len(counts) != 5 || counts["0"] != 100 || counts["2"] != 100 {
+		t.Errorf("counted %v rows per score, expected 100 of each of 5", counts)
+	}
+	// Spill files are removed once the aggregation is done.
+	if files, _ := filepath.Glob("db-*"); len(files) != len(tempFiles) {
+		t.Errorf("aggregation left %v temp files behind", len(files)-len(tempFiles))
+	}
+	// Select plans aggregations: by the key as it is read in order, and otherwise by hashing.
+	out := runCommands(t, d,
+		"select name, count(*), max(score) from s where id < 100 group by name order by count(*) desc, name limit 2",
+		"select id, count(*) from s group by id order by id desc limit 2",
+	)
+	if want := "(\"n0\", 25, 2)\n(\"n1\", 25, 2)\n(499, 1)\n(498, 1)\n"; out != want {
+		t.Errorf("grouped selects printed\n%v, expected\n%v", out, want)
+	}
+	if err := query.HandleSelect(d, "select name, id, count(*) from s group by name", ioutil.Discard); err == nil {
+		t.Error("selected a column that is neither grouped nor aggregated")
+	}
+}
+
+func testExecExternalSort(t *testing.T) {
+	d, cleanup := setupExec(t, 3000)
+	defer cleanup()
+	tempFiles, _ := filepath.Glob("db-*")
+	// Sort in 3 frames, so there are more runs than can be merged at once.
+	defer func(frames int64) { exec.SORT_FRAMES = frames }(exec.SORT_FRAMES)
+	exec.SORT_FRAMES = 3
+	path, err := d.ChooseAccessPath("s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan, err := exec.NewScan(d, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := exec.Collect(scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorter, err := exec.NewSort(scan, []sql.OrderItem{{Expr: &sql.ColumnRef{Name: "score"}, Desc: true}, {Expr: &sql.ColumnRef{Name: "name"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted, err := exec.Collect(sorter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sorter.Runs() <= exec.SORT_FRAMES || sorter.Passes() < 2 {
+		t.Errorf("sort spilled %v runs in %v passes, expected more than %v runs in several passes", sorter.Runs(), sorter.Passes(), exec.SORT_FRAMES)
+	}
+	// Rows that tie stay in key order.
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i][2].(float64) != rows[j][2].(float64) {
+			return rows[i][2].(float64) > rows[j][2].(float64)
+		}
+		return rows[i][1].(string) < rows[j][1].(string)
+	})
+	if formatRows(sorted) != formatRows(rows) {
+		t.Error("external sort produced rows out of order")
+	}
+	// Run files are removed once the sort is closed.
+	if files, _ := filepath.Glob("db-*"); len(files) != len(tempFiles) {
+		t.Errorf("sort left %v temp files behind", len(files)-len(tempFiles))
+	}
+	// Select sorts a hash table by value, and by key descending.
+	out := runCommands(t, d,
+		"select from h order by value desc, key limit 3",
+		"select key from h where value = 1 order by key desc limit 2",
+	)
+	if want := "(2, 2)\n(5, 2)\n(8, 2)\n(2998)\n(2995)\n"; out != want {
+		t.Errorf("ordered selects printed\n%v, expected\n%v", out, want)
+	}
+}
+
+func testExecJoin(t *testing.T) {
+	d, cleanup := setupExec(t, 12)
+	defer cleanup()
+	open := func(table string, where string) exec.Operator {
+		var condition sql.Expr
+		if where != "" {
+			condition = parseExpr(t, where)
+		}
+		path, err := d.ChooseAccessPath(table, condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		op, err := exec.NewAccessPath(d, path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return op
+	}
+	join, err := exec.NewNestedLoopJoin(open("s", "id < 3"), open("h", ""), parseExpr(t, "s.key = h.value and h.key < 6"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := exec.NewFilter(join, parseExpr(t, "s.id < 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorter, err := exec.NewSort(filter, []sql.OrderItem{{Expr: &sql.ColumnRef{Table: "s", Name: "key"}}, {Expr: &sql.ColumnRef{Table: "h", Name: "key"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := exec.Collect(sorter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "(0, \"n0\", 0, 0, 0)\n(0, \"n0\", 0, 3, 0)\n(1, \"n1\", 0.5, 1, 1)\n(1, \"n1\", 0.5, 4, 1)\n(2, \"n2\", 1, 2, 2)\n(2, \"n2\", 1, 5, 2)\n"
+	if got := formatRows(rows); got != want {
+		t.Errorf("joined\n%v, expected\n%v", got, want)
+	}
+	if _, err := exec.NewNestedLoopJoin(open("h", ""), open("h", ""), parseExpr(t, "key = 1")); err == nil {
+		t.Error("expected an error for an ambiguous key")
+	}
+}
+
+func testExecSemiJoin(t *testing.T) {
+	d, cleanup := setupExec(t, 20)
+	defer cleanup()
+	out := runCommands(t, d,
+		"select id from s where id in (select key from h where value = 0) and id < 10",
+		"select id from s where id < 10 and not id in (select key from h where value != 0)",
+		// Ints and floats that are equal match.
+		"select key from h where key in (select score from s) order by key",
+		// Nothing is known not to be in values that include null.
+		"select id from s where id not in (select max(key) from h where key > 100)",
+		"select id from s where id in (select id from s where name in (select name from s where id = 1)) limit 2",
+	)
+	if want := "(0)\n(3)\n(6)\n(9)\n(0)\n(3)\n(6)\n(9)\n(0)\n(1)\n(2)\n(1)\n(5)\n"; out != want {
+		t.Errorf("selects with subqueries printed\n%v, expected\n%v", out, want)
+	}
+	var plan strings.Builder
+	if err := query.HandleExplain(d, "explain select id from s where id not in (select key from h)", &plan); err != nil {
+		t.Fatal(err)
+	}
+	if want := "project id\n  hash anti join on id\n    scan s\n    project key\n      scan h\n"; plan.String() != want {
+		t.Errorf("explain printed\n%v, expected\n%v", plan.String(), want)
+	}
+	for _, command := range []string{
+		"select from s where id in (select from h)",
+		"select from s where id in (select key from h) or id = 1",
+	} {
+		if err := query.HandleSelect(d, command, ioutil.Discard); err == nil {
+			t.Errorf("%v: expected an error", command)
+		}
+	}
+	if err := db.HandleDelete(d, "delete from s where id in (select key from h)"); err == nil {
+		t.Error("deleted where a subquery holds")
+	}
+}
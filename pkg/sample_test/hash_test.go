@@ -1,12 +1,15 @@
 package test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
 
 	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
+	utils "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/utils"
 )
 
 type hash_kv struct {
@@ -49,6 +52,10 @@ func TestHashTA(t *testing.T) {
 	t.Run("TestHashDeleteTen", testHashDeleteTen)
 	t.Run("TestHashUpdateTenNoWrite", testHashUpdateTenNoWrite)
 	t.Run("TestHashUpdateTen", testHashUpdateTen)
+	t.Run("TestHashDeleteCoalesce", testHashDeleteCoalesce)
+	t.Run("TestHashBytesValues", testHashBytesValues)
+	t.Run("TestHashConcurrentBytesEdits", testHashConcurrentBytesEdits)
+	t.Run("TestHashVacuumValues", testHashVacuumValues)
 }
 
 func testHashInsertTenNoWrite(t *testing.T) {
@@ -380,3 +387,158 @@ func testHashUpdateTen(t *testing.T) {
 	}
 	index.Close()
 }
+
+func testHashDeleteCoalesce(t *testing.T) {
+	dbName := getTempHashDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + ".meta")
+
+	// Init the database
+	index, err := hash.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Insert enough entries to grow the directory
+	entries, _ := genRandomHashEntries(2000)
+	for _, e := range entries {
+		if err = index.Insert(e.key, e.val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	peakDepth := index.GetTable().GetDepth()
+	peakPages := index.GetTable().GetPager().GetNumPages()
+	// Delete all but a few entries, checking the table as we go
+	kept := entries[:10]
+	for i, e := range entries[10:] {
+		if err = index.Delete(e.key); err != nil {
+			t.Fatal(err)
+		}
+		if i%100 == 0 {
+			if ok, err := hash.IsHash(index); err != nil || !ok {
+				t.Fatalf("invalid hash table after %v deletes (%v)", i+1, err)
+			}
+		}
+	}
+	if ok, err := hash.IsHash(index); err != nil || !ok {
+		t.Fatal("invalid hash table after deletes")
+	}
+	if depth := index.GetTable().GetDepth(); depth >= peakDepth {
+		t.Errorf("directory did not shrink: depth %v, was %v", depth, peakDepth)
+	}
+	// Vacuum gives the coalesced buckets back
+	if _, err = index.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	if pages := index.GetTable().GetPager().GetNumPages(); pages >= peakPages {
+		t.Errorf("vacuum did not shrink the file: %v pages, was %v", pages, peakPages)
+	}
+	// Close and reopen the database
+	index.Close()
+	index, err = hash.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := hash.IsHash(index); err != nil || !ok {
+		t.Fatal("invalid hash table after reopening")
+	}
+	for _, e := range kept {
+		entry, err := index.Find(e.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.GetValue() != e.val {
+			t.Error("Entry found has the wrong value")
+		}
+	}
+	for _, e := range entries[10:20] {
+		if entry, err := index.Find(e.key); entry != nil || err == nil {
+			t.Error("Could find deleted entry")
+		}
+	}
+	index.Close()
+}
+
+func testHashBytesValues(t *testing.T) {
+	dbName := getTempHashDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + ".meta")
+	defer os.Remove(dbName + ".values")
+
+	// Init the database
+	index, err := hash.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Insert small values and values larger than a page
+	entries, _ := genRandomHashEntries(300)
+	value := func(e hash_kv) []byte {
+		if e.val%5 == 0 {
+			return []byte(strings.Repeat(fmt.Sprint(e.val), 1000))
+		}
+		return []byte(fmt.Sprint(e.val))
+	}
+	for _, e := range entries {
+		if err = index.InsertBytes(e.key, value(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Overwrite half the values with integers, and delete a few
+	for _, e := range entries[:150] {
+		if err = index.Update(e.key, e.val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, e := range entries[150:200] {
+		if err = index.Delete(e.key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Close and reopen the database
+	index.Close()
+	index, err = hash.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	for i, e := range entries {
+		entry, err := index.Find(e.key)
+		switch {
+		case i < 150:
+			if err != nil || entry.GetValue() != e.val {
+				t.Error("Entry found has the wrong value")
+			}
+		case i < 200:
+			if err == nil {
+				t.Error("Could find deleted entry")
+			}
+		default:
+			bytesEntry, ok := entry.(utils.BytesEntry)
+			if err != nil || !ok || string(bytesEntry.GetBytes()) != string(value(e)) {
+				t.Error("Entry found has the wrong value")
+			}
+		}
+	}
+}
+
+func testHashVacuumValues(t *testing.T) {
+	dbName := getTempHashDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + ".meta")
+	defer os.Remove(dbName + ".values")
+	checkVacuumValues(t, dbName, func() (valuesIndex, error) {
+		return hash.OpenTable(dbName)
+	})
+}
+
+func testHashConcurrentBytesEdits(t *testing.T) {
+	dbName := getTempHashDB(t)
+	defer os.Remove(dbName)
+	defer os.Remove(dbName + ".meta")
+	defer os.Remove(dbName + ".values")
+	index, err := hash.OpenTable(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	checkConcurrentBytesEdits(t, index)
+}
@@ -0,0 +1,503 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pager "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/pager"
+)
+
+var policies = []string{pager.LRU_POLICY, pager.CLOCK_POLICY, pager.LRUK_POLICY, pager.TWOQ_POLICY}
+
+func getTempPagerDB(t *testing.T) string {
+	tmpfile, err := ioutil.TempFile(".", "db-*")
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpfile.Close()
+	return tmpfile.Name()
+}
+
+func TestPagerTA(t *testing.T) {
+	t.Run("TestPagerPoliciesRoundTrip", testPagerPoliciesRoundTrip)
+	t.Run("TestPagerStats", testPagerStats)
+	t.Run("TestPagerScanResistance", testPagerScanResistance)
+	t.Run("TestPagerUnknownPolicy", testPagerUnknownPolicy)
+	t.Run("TestPagerOptions", testPagerOptions)
+	t.Run("TestBufferPoolShared", testBufferPoolShared)
+	t.Run("TestBufferPoolClosedPinned", testBufferPoolClosedPinned)
+	t.Run("TestBufferPoolVictim", testBufferPoolVictim)
+	t.Run("TestPagerChecksum", testPagerChecksum)
+	t.Run("TestPagerEditLSN", testPagerEditLSN)
+	t.Run("TestPagerFreeList", testPagerFreeList)
+	t.Run("TestPagerVacuum", testPagerVacuum)
+}
+
+// Open a pager on a fresh file with the given policy.
+func openPolicyPager(t *testing.T, dbName string, name string) *pager.Pager {
+	p := pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := pager.NewReplacementPolicy(name, pager.NUMPAGES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetReplacementPolicy(policy)
+	return p
+}
+
+// Write more pages than there are frames, then read them all back.
+func testPagerPoliciesRoundTrip(t *testing.T) {
+	for _, name := range policies {
+		dbName := getTempPagerDB(t)
+		defer os.Remove(dbName)
+		p := openPolicyPager(t, dbName, name)
+		n := int64(pager.NUMPAGES * 3)
+		for i := int64(0); i < n; i++ {
+			page, err := p.GetPage(i)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			page.Update([]byte{byte(i)}, 0, 1)
+			page.Put()
+		}
+		for i := int64(0); i < n; i++ {
+			page, err := p.GetPage(i)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if (*page.GetData())[0] != byte(i) {
+				t.Errorf("%s: page %d has the wrong data", name, i)
+			}
+			page.Put()
+		}
+		p.Close()
+	}
+}
+
+// Hits and misses should add up to the number of requests.
+func testPagerStats(t *testing.T) {
+	dbName := getTempPagerDB(t)
+	defer os.Remove(dbName)
+	p := openPolicyPager(t, dbName, pager.LRU_POLICY)
+	for i := int64(0); i < 4; i++ {
+		page, _ := p.GetPage(i)
+		page.Put()
+	}
+	for i := int64(0); i < 4; i++ {
+		page, _ := p.GetPage(i)
+		page.Put()
+	}
+	stats := p.GetStats()
+	if stats.Misses != 4 || stats.Hits != 4 || stats.Evictions != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	p.Close()
+}
+
+// Touch page 0 a few times, then scan pages [start, end).
+func touchThenScan(p *pager.Pager, start int64, end int64) {
+	for i := 0; i < 3; i++ {
+		page, _ := p.GetPage(0)
+		page.Put()
+	}
+	for i := start; i < end; i++ {
+		page, _ := p.GetPage(i)
+		page.Put()
+	}
+}
+
+// A page referenced again after leaving the buffer should survive a long scan under LRU-K and 2Q.
+func testPagerScanResistance(t *testing.T) {
+	for _, name := range []string{pager.LRUK_POLICY, pager.TWOQ_POLICY} {
+		dbName := getTempPagerDB(t)
+		defer os.Remove(dbName)
+		p := openPolicyPager(t, dbName, name)
+		touchThenScan(p, 1, pager.NUMPAGES+2)
+		touchThenScan(p, pager.NUMPAGES+2, pager.NUMPAGES*6)
+		p.ResetStats()
+		page, _ := p.GetPage(0)
+		page.Put()
+		if p.GetStats().Hits != 1 {
+			t.Errorf("%s: hot page was evicted by a scan", name)
+		}
+		p.Close()
+	}
+}
+
+func testPagerUnknownPolicy(t *testing.T) {
+	if _, err := pager.NewReplacementPolicy("mru", pager.NUMPAGES); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func testPagerOptions(t *testing.T) {
+	if _, err := pager.NewPagerWithOptions(pager.Options{NumFrames: 4, PageSize: 1000}); err == nil {
+		t.Error("expected an error for an unaligned page size")
+	}
+	if _, err := pager.NewPagerWithOptions(pager.Options{NumFrames: 0, PageSize: pager.PAGESIZE}); err == nil {
+		t.Error("expected an error for an empty frame arena")
+	}
+	p, err := pager.NewPagerWithOptions(pager.Options{NumFrames: 4, PageSize: pager.PAGESIZE * 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetNumFrames() != 4 || p.GetPageSize() != pager.PAGESIZE*4 {
+		t.Error("pager was not sized by its options")
+	}
+}
+
+// Two files share a small pool: the busy one borrows frames from the idle one,
+// data survives eviction, and closing a file hands its frames back.
+func testBufferPoolShared(t *testing.T) {
+	hotName, coldName := getTempPagerDB(t), getTempPagerDB(t)
+	defer os.Remove(hotName)
+	defer os.Remove(coldName)
+	pool, err := pager.NewBufferPool(pager.Options{NumFrames: 16, PageSize: pager.PAGESIZE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot, cold := pool.NewPager(), pool.NewPager()
+	if err := hot.Open(hotName); err != nil {
+		t.Fatal(err)
+	}
+	if err := cold.Open(coldName); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 12; i++ {
+		page, _ := cold.GetPage(i)
+		page.Update([]byte{byte(i)}, 0, 1)
+		page.Put()
+	}
+	for i := int64(0); i < 40; i++ {
+		page, err := hot.GetPage(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.Update([]byte{byte(i)}, 0, 1)
+		page.Put()
+	}
+	usage := pool.GetUsage()
+	if len(usage) != 2 {
+		t.Fatalf("expected usage for 2 files, got %d", len(usage))
+	}
+	resident := map[string]int64{}
+	for _, u := range usage {
+		resident[u.Name] = u.Resident
+	}
+	hotBase, coldBase := filepath.Base(hotName), filepath.Base(coldName)
+	if resident[hotBase]+resident[coldBase] != 16 {
+		t.Errorf("pool frames are not all in use: %+v", usage)
+	}
+	if resident[coldBase] != pager.POOL_RESERVED_FRAMES {
+		t.Errorf("idle file should keep its reserved frames, has %d", resident[coldBase])
+	}
+	for i := int64(0); i < 12; i++ {
+		page, _ := cold.GetPage(i)
+		if (*page.GetData())[0] != byte(i) {
+			t.Errorf("page %d of the idle file has the wrong data", i)
+		}
+		page.Put()
+	}
+	cold.Close()
+	if usage := pool.GetUsage(); len(usage) != 1 || usage[0].Name != hotBase {
+		t.Errorf("closed file is still in the pool: %+v", usage)
+	}
+	for i := int64(0); i < 40; i++ {
+		page, _ := hot.GetPage(i)
+		if (*page.GetData())[0] != byte(i) {
+			t.Errorf("page %d of the busy file has the wrong data", i)
+		}
+		page.Put()
+	}
+	if u := pool.GetUsage()[0]; u.Resident != 16 || u.Pinned != 0 {
+		t.Errorf("busy file should own every frame once the other closes: %+v", u)
+	}
+	hot.Close()
+}
+
+// openPoolPagers opens n pagers of the pool, each on a fresh file.
+func openPoolPagers(t *testing.T, pool *pager.BufferPool, n int) []*pager.Pager {
+	pagers := make([]*pager.Pager, n)
+	for i := range pagers {
+		pagers[i] = pool.NewPager()
+		if err := pagers[i].Open(getTempPagerDB(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pagers
+}
+
+// removePoolPagers removes the files of pagers opened by openPoolPagers.
+func removePoolPagers(pagers []*pager.Pager) {
+	for _, p := range pagers {
+		os.Remove(p.GetFilePath())
+	}
+}
+
+// A file closed with pages still pinned hands their frames back once they are put.
+func testBufferPoolClosedPinned(t *testing.T) {
+	pool, err := pager.NewBufferPool(pager.Options{NumFrames: 4, PageSize: pager.PAGESIZE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pagers := openPoolPagers(t, pool, 2)
+	defer removePoolPagers(pagers)
+	closed, open := pagers[0], pagers[1]
+	pinned := make([]*pager.Page, 0)
+	for i := int64(0); i < 2; i++ {
+		page, err := closed.GetPage(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pinned = append(pinned, page)
+	}
+	closed.Close()
+	for _, page := range pinned {
+		page.Put()
+	}
+	for i := int64(0); i < 4; i++ {
+		if _, err := open.GetPage(i); err != nil {
+			t.Fatalf("frame of a closed file was not handed back: %v", err)
+		}
+	}
+}
+
+// The page evicted across files is the oldest of the ones their policies would evict.
+func testBufferPoolVictim(t *testing.T) {
+	pool, err := pager.NewBufferPool(pager.Options{NumFrames: 10, PageSize: pager.PAGESIZE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pagers := openPoolPagers(t, pool, 3)
+	defer removePoolPagers(pagers)
+	lruk, lru, requester := pagers[0], pagers[1], pagers[2]
+	policy, _ := pager.NewReplacementPolicy(pager.LRUK_POLICY, 10)
+	lruk.SetReplacementPolicy(policy)
+	touch := func(p *pager.Pager, pagenum int64) {
+		page, err := p.GetPage(pagenum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.Put()
+	}
+	// LRU-K would evict its page referenced once, which was released after every page of
+	// the LRU file, so the LRU file's oldest page goes instead.
+	for i := int64(0); i < 4; i++ {
+		touch(lruk, i)
+		touch(lruk, i)
+	}
+	for i := int64(0); i < 5; i++ {
+		touch(lru, i)
+	}
+	touch(lruk, 4)
+	touch(requester, 0)
+	resident := map[string]int64{}
+	for _, u := range pool.GetUsage() {
+		resident[u.Name] = u.Resident
+	}
+	if got := resident[lruk.GetFileName()]; got != 5 {
+		t.Errorf("LRU-K file should keep all 5 frames, has %d", got)
+	}
+	if got := resident[lru.GetFileName()]; got != 4 {
+		t.Errorf("LRU file should give up a frame, has %d", got)
+	}
+	for _, p := range pagers {
+		p.Close()
+	}
+}
+
+// A flipped byte on disk should be reported as a corrupt page, not handed to the caller.
+func testPagerChecksum(t *testing.T) {
+	dbName := getTempPagerDB(t)
+	defer os.Remove(dbName)
+	p := pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 4; i++ {
+		page, _ := p.GetPage(i)
+		page.Update([]byte{byte(i + 1)}, 0, 1)
+		page.SetLSN(100 + i)
+		page.Put()
+	}
+	p.Close()
+	// Flip a byte in the middle of page 2.
+	file, err := os.OpenFile(dbName, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte{0xff}, 2*pager.PAGESIZE+pager.PAGESIZE/2)
+	file.Close()
+	p = pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, i := range []int64{0, 1, 3} {
+		page, err := p.GetPage(i)
+		if err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		if (*page.GetData())[0] != byte(i+1) || page.GetLSN() != 100+i {
+			t.Errorf("page %d did not round-trip", i)
+		}
+		page.Put()
+	}
+	_, err = p.GetPage(2)
+	var corrupt *pager.CorruptPageError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("expected a corrupt page error, got %v", err)
+	}
+	if corrupt.PageNum != 2 || filepath.Base(corrupt.File) != filepath.Base(dbName) {
+		t.Errorf("corrupt page error names the wrong page: %v", err)
+	}
+}
+
+// Write n pages, each holding its own page number in its first byte.
+func writeNumberedPages(t *testing.T, p *pager.Pager, n int64) {
+	for i := int64(0); i < n; i++ {
+		page, err := p.GetPage(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.Update([]byte{byte(i)}, 0, 1)
+		page.Put()
+	}
+}
+
+// Freed pages are handed out again, most recently freed first, even after a reopen.
+func testPagerFreeList(t *testing.T) {
+	dbName := getTempPagerDB(t)
+	defer os.Remove(dbName)
+	p := pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	writeNumberedPages(t, p, 10)
+	if err := p.FreePage(0); err == nil {
+		t.Error("page 0 should never be freed")
+	}
+	for _, pn := range []int64{3, 5, 7} {
+		if err := p.FreePage(pn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.FreePage(5); err == nil {
+		t.Error("freeing a page twice should fail")
+	}
+	if pn := p.GetFreePN(); pn != 7 {
+		t.Errorf("expected page 7 to be reused, got %d", pn)
+	}
+	p.Close()
+	p = pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	free, err := p.GetFreePages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(free) != 2 || free[0] != 5 || free[1] != 3 {
+		t.Errorf("free-page chain did not survive a reopen: %v", free)
+	}
+	page, _ := p.GetPage(5)
+	if !page.IsFree() || (*page.GetData())[0] != 0 {
+		t.Error("a free page should be marked and zeroed")
+	}
+	page.Put()
+	for _, want := range []int64{5, 3, 10} {
+		if pn := p.GetFreePN(); pn != want {
+			t.Errorf("expected free page %d, got %d", want, pn)
+		}
+		page, _ := p.GetPage(want)
+		page.Put()
+	}
+}
+
+// Vacuum moves the last live pages into the holes and truncates the file.
+func testPagerVacuum(t *testing.T) {
+	dbName := getTempPagerDB(t)
+	defer os.Remove(dbName)
+	p := pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	writeNumberedPages(t, p, 10)
+	for _, pn := range []int64{2, 4, 9} {
+		if err := p.FreePage(pn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	moves := make(map[int64]int64)
+	reclaimed, err := p.Vacuum(func(from int64, to int64) error {
+		moves[from] = to
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed != 3 || p.GetNumPages() != 7 {
+		t.Errorf("expected 3 pages reclaimed and 7 left, got %d and %d", reclaimed, p.GetNumPages())
+	}
+	if len(moves) != 2 || moves[7] != 2 || moves[8] != 4 {
+		t.Errorf("unexpected moves: %v", moves)
+	}
+	for pn, want := range map[int64]byte{1: 1, 2: 7, 4: 8, 6: 6} {
+		page, _ := p.GetPage(pn)
+		if (*page.GetData())[0] != want || page.IsFree() {
+			t.Errorf("page %d has the wrong data after vacuum", pn)
+		}
+		page.Put()
+	}
+	if pn := p.GetFreePN(); pn != 7 {
+		t.Errorf("free-page chain should be empty after vacuum, got %d", pn)
+	}
+	info, _ := os.Stat(dbName)
+	if info.Size() != 7*pager.PAGESIZE {
+		t.Errorf("file was not truncated: %d bytes", info.Size())
+	}
+}
+
+// Pages a logged edit dirties carry its LSN to disk, and never go back to an earlier one.
+func testPagerEditLSN(t *testing.T) {
+	dbName := getTempPagerDB(t)
+	defer os.Remove(dbName)
+	p := pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 3; i++ {
+		p.SetEditLSN(100 * (i + 1))
+		page, _ := p.GetPage(i)
+		page.Update([]byte{byte(i + 1)}, 0, 1)
+		page.Put()
+	}
+	// An earlier LSN is ignored.
+	p.SetEditLSN(50)
+	page, _ := p.GetPage(0)
+	page.Update([]byte{9}, 0, 1)
+	page.Put()
+	p.Close()
+	p = pager.NewPager()
+	if err := p.Open(dbName); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i, want := range []int64{300, 200, 300} {
+		page, err := p.GetPage(int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.GetLSN() != want {
+			t.Errorf("page %d has LSN %d, expected %d", i, page.GetLSN(), want)
+		}
+		page.Put()
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
 	hash "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/hash"
 	"github.com/csci1270-fall-2023/dbms-projects-handout/pkg/query"
 )
@@ -136,3 +140,597 @@ func testFilterInsertAndCheckSmall(t *testing.T) {
 		}
 	}
 }
+
+func TestJoinAlgorithms(t *testing.T) {
+	t.Run("TestJoinAlgorithmsAgree", testJoinAlgorithmsAgree)
+	t.Run("TestJoinPlanner", testJoinPlanner)
+	t.Run("TestJoinTypes", testJoinTypes)
+	t.Run("TestLeftDeepJoin", testLeftDeepJoin)
+	t.Run("TestJoinBytesValues", testJoinBytesValues)
+	t.Run("TestHashJoinSkew", testHashJoinSkew)
+	t.Run("TestFilterSize", testFilterSize)
+}
+
+// joinLines runs a join command, returning its output lines in sorted order.
+func joinLines(t *testing.T, d *db.Database, command string) []string {
+	var out strings.Builder
+	if err := query.HandleJoin(d, command, &out); err != nil {
+		t.Fatalf("%v: %v", command, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if lines[0] == "" {
+		lines = lines[:0]
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func testJoinAlgorithmsAgree(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	// Spill sort runs and read several blocks.
+	defer func(runSize int, blockSize int) { db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE = runSize, blockSize }(db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE)
+	db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE = 64, 50
+	runCommands(t, d, "create btree table b", "create hash table h")
+	for i := int64(0); i < 400; i++ {
+		runCommands(t, d, fmt.Sprintf("insert %v %v into b", i*3%401, i%37))
+		if i%2 == 0 {
+			runCommands(t, d, fmt.Sprintf("insert %v %v into h", i, i%29))
+		}
+	}
+	for _, on := range []string{"b key on h key", "b val on h val", "b key on h val", "h val on b key", "h key on h key", "b val on b key"} {
+		// The naive join is block nested loop join with every entry in one block.
+		query.JOIN_BLOCK_SIZE = 1 << 20
+		want := joinLines(t, d, "join "+on+" using block")
+		query.JOIN_BLOCK_SIZE = 50
+		if len(want) == 0 {
+			t.Fatalf("join %v found no pairs", on)
+		}
+		for _, algorithm := range []string{"merge", "index", "block", "hash"} {
+			if algorithm == "index" && !strings.Contains(on, "key") {
+				continue
+			}
+			got := joinLines(t, d, "join "+on+" using "+algorithm)
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("join %v using %v found %v pairs, expected %v", on, algorithm, len(got), len(want))
+			}
+		}
+	}
+	if err := query.HandleJoin(d, "join b val on h val using index", ioutil.Discard); err == nil {
+		t.Error("expected an error for index nested loop join without a key")
+	}
+	if err := query.HandleJoin(d, "join b val on h val using nested", ioutil.Discard); err == nil {
+		t.Error("expected an error for an unknown join algorithm")
+	}
+}
+
+func testJoinPlanner(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	// Memory holds a few hundred entries.
+	defer func(runSize int, blockSize int) { db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE = runSize, blockSize }(db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE)
+	db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE = 1000, 500
+	runCommands(t, d, "create btree table big", "create btree table big2", "create hash table small", "create hash table large", "create hash table large2")
+	for i := int64(0); i < 5000; i++ {
+		runCommands(t, d, fmt.Sprintf("insert %v %v into big", i, i), fmt.Sprintf("insert %v %v into big2", i, i))
+		runCommands(t, d, fmt.Sprintf("insert %v %v into large", i, i), fmt.Sprintf("insert %v %v into large2", i, i))
+	}
+	for i := int64(0); i < 10; i++ {
+		runCommands(t, d, fmt.Sprintf("insert %v %v into small", i, i*100))
+	}
+	table := func(name string) db.Index {
+		index, err := d.GetTable(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+	for _, c := range []struct {
+		left, right           string
+		onLeftKey, onRightKey bool
+		want                  query.JoinAlgorithm
+	}{
+		{"big", "big2", true, true, query.SortMerge},            // Both are read in key order.
+		{"small", "big", false, true, query.IndexNestedLoop},    // A few lookups into a btree.
+		{"big", "small", true, false, query.IndexNestedLoop},    // Either side can be looked up.
+		{"small", "large", false, false, query.BlockNestedLoop}, // The small table fits in a block.
+		{"large", "large2", false, false, query.GraceHash},      // Neither is sorted or small.
+	} {
+		got := query.ChooseJoin(table(c.left), table(c.right), c.onLeftKey, c.onRightKey, query.InnerJoin)
+		if got != c.want {
+			t.Errorf("joining %v on %v chose %v join, expected %v join; costs %v", c.left, c.right, got, c.want,
+				query.JoinCosts(table(c.left), table(c.right), c.onLeftKey, c.onRightKey, query.InnerJoin))
+		}
+	}
+	if estimate := query.EstimateCardinality(table("big")); estimate < 2500 || estimate > 10000 {
+		t.Errorf("estimated %v entries in a table of 5000", estimate)
+	}
+}
+
+func testJoinTypes(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	// Spill sort runs and the rows of each join for the next, and read several blocks.
+	defer func(runSize int, blockSize int, memory int) {
+		db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE, query.LEFT_DEEP_JOIN_MEMORY = runSize, blockSize, memory
+	}(db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE, query.LEFT_DEEP_JOIN_MEMORY)
+	db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE, query.LEFT_DEEP_JOIN_MEMORY = 16, 10, 5
+	runCommands(t, d, "create btree table b", "create hash table h")
+	entries := map[string][][2]int64{}
+	for i := int64(0); i < 60; i++ {
+		runCommands(t, d, fmt.Sprintf("insert %v %v into b", i*7%61, i%11))
+		entries["b"] = append(entries["b"], [2]int64{i * 7 % 61, i % 11})
+		if i%2 == 0 {
+			runCommands(t, d, fmt.Sprintf("insert %v %v into h", i, i%13))
+			entries["h"] = append(entries["h"], [2]int64{i, i % 13})
+		}
+	}
+	format := func(entry *[2]int64) string {
+		if entry == nil {
+			return "null"
+		}
+		return fmt.Sprintf("(%v, %v)", entry[0], entry[1])
+	}
+	for _, on := range [][4]string{{"b", "key", "h", "key"}, {"b", "val", "h", "val"}, {"h", "val", "b", "key"}} {
+		left, right := entries[on[0]], entries[on[2]]
+		attribute := func(entry [2]int64, side string) int64 {
+			if side == "key" {
+				return entry[0]
+			}
+			return entry[1]
+		}
+		for _, joinType := range []string{"left", "right", "full", "semi", "anti"} {
+			// The naive join compares every pair.
+			want := make([]string, 0)
+			rightMatched := make([]bool, len(right))
+			for _, l := range left {
+				l := l
+				matched := false
+				for j, r := range right {
+					r := r
+					if attribute(l, on[1]) == attribute(r, on[3]) {
+						matched, rightMatched[j] = true, true
+						if joinType != "semi" && joinType != "anti" {
+							want = append(want, fmt.Sprintf("{%v, %v}", format(&l), format(&r)))
+						}
+					}
+				}
+				if (matched && joinType == "semi") || (!matched && (joinType == "left" || joinType == "full" || joinType == "anti")) {
+					want = append(want, fmt.Sprintf("{%v, null}", format(&l)))
+				}
+			}
+			for j, r := range right {
+				r := r
+				if !rightMatched[j] && (joinType == "right" || joinType == "full") {
+					want = append(want, fmt.Sprintf("{null, %v}", format(&r)))
+				}
+			}
+			sort.Strings(want)
+			command := fmt.Sprintf("join %v %v %v on %v %v using ", on[0], on[1], joinType, on[2], on[3])
+			for _, algorithm := range []string{"merge", "index", "block", "hash"} {
+				// Looking entries up needs the side without outer entries joined on its key.
+				if algorithm == "index" {
+					probeLeft, probeRight := on[1] == "key" && joinType == "right", on[3] == "key" && joinType != "right" && joinType != "full"
+					if !probeLeft && !probeRight {
+						if err := query.HandleJoin(d, command+algorithm, ioutil.Discard); err == nil {
+							t.Errorf("%v: expected an error", command+algorithm)
+						}
+						continue
+					}
+				}
+				got := joinLines(t, d, command+algorithm)
+				if strings.Join(got, "\n") != strings.Join(want, "\n") {
+					t.Errorf("%v produced %v pairs, expected %v", command+algorithm, len(got), len(want))
+				}
+			}
+		}
+	}
+	// Outer joins keep the unmatched entries the bloom filter would have skipped, so they
+	// don't use one.
+	for joinType, used := range map[string]bool{"": true, "left ": true, "right ": false, "full ": false} {
+		line := explainLines(t, d, "explain analyze join h key "+joinType+"on b key using hash")[0]
+		if strings.Contains(line, "filter positives=0 ") == used {
+			t.Errorf("%vjoin used the bloom filter: %v, expected %v", joinType, line, used)
+		}
+	}
+	if err := query.HandleJoin(d, "join b key sideways on h key", ioutil.Discard); err == nil {
+		t.Error("expected an error for an unknown join type")
+	}
+}
+
+// Joins refuse tables whose values are byte slices, rather than joining their lengths.
+func testJoinBytesValues(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	// Spill sort runs and the rows of the first of several joins.
+	defer func(runSize int, memory int) {
+		db.LOAD_RUN_SIZE, query.LEFT_DEEP_JOIN_MEMORY = runSize, memory
+	}(db.LOAD_RUN_SIZE, query.LEFT_DEEP_JOIN_MEMORY)
+	db.LOAD_RUN_SIZE, query.LEFT_DEEP_JOIN_MEMORY = 4, 3
+	runCommands(t, d, "create btree table b", "create hash table s")
+	wantPairs, wantTriples := make([]string, 0), make([]string, 0)
+	for i := 0; i < 20; i++ {
+		value := strings.Repeat("x", i)
+		runCommands(t, d, fmt.Sprintf("insert %v 3 into b", i), fmt.Sprintf(`insert %v "%v" into s`, i, value))
+		wantPairs = append(wantPairs, fmt.Sprintf(`{(%v, 3), (%v, "%v")}`, i, i, value))
+		wantTriples = append(wantTriples, fmt.Sprintf(`{(%v, "%v"), (%v, 3), (%v, 3)}`, i, value, i, i))
+	}
+	sort.Strings(wantPairs)
+	sort.Strings(wantTriples)
+	for _, using := range []string{" using merge", " using index", " using block", " using hash"} {
+		// A join on keys carries values that are byte slices along.
+		if got := joinLines(t, d, "join b key on s key"+using); strings.Join(got, "\n") != strings.Join(wantPairs, "\n") {
+			t.Errorf("join b key on s key%v printed %q", using, got)
+		}
+		if got := joinLines(t, d, "join s key on b key on b key"+using); strings.Join(got, "\n") != strings.Join(wantTriples, "\n") {
+			t.Errorf("join s key on b key on b key%v printed %q", using, got)
+		}
+		// A join on values can't compare them.
+		for _, command := range []string{"join b val on s val", "join s val on b val", "join b key on s key val on b key", "join b key on b key on s val"} {
+			// Index nested loop join needs a table joined on its key.
+			if using == " using index" && strings.HasSuffix(command, "val") {
+				continue
+			}
+			err := query.HandleJoin(d, command+using, ioutil.Discard)
+			if err == nil || !strings.Contains(err.Error(), "byte slice") {
+				t.Errorf("%v returned %v, expected an error about byte slices", command+using, err)
+			}
+		}
+	}
+}
+
+func testLeftDeepJoin(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	// Spill sort runs and the rows of each join for the next, and read several blocks.
+	defer func(runSize int, blockSize int, memory int) {
+		db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE, query.LEFT_DEEP_JOIN_MEMORY = runSize, blockSize, memory
+	}(db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE, query.LEFT_DEEP_JOIN_MEMORY)
+	db.LOAD_RUN_SIZE, query.JOIN_BLOCK_SIZE, query.LEFT_DEEP_JOIN_MEMORY = 16, 10, 5
+	runCommands(t, d, "create btree table b", "create hash table h", "create btree table c")
+	entries := map[string][][2]int64{}
+	insert := func(table string, key int64, value int64) {
+		runCommands(t, d, fmt.Sprintf("insert %v %v into %v", key, value, table))
+		entries[table] = append(entries[table], [2]int64{key, value})
+	}
+	for i := int64(0); i < 40; i++ {
+		insert("b", i, i%9)
+		if i%2 == 0 {
+			insert("h", i/2, i*5%23)
+		}
+		if i%3 == 0 {
+			insert("c", i, i%7)
+		}
+	}
+	attribute := func(entry *[2]int64, side string) int64 {
+		if side == "key" {
+			return entry[0]
+		}
+		return entry[1]
+	}
+	// The naive join of rows with a table, on the entry of their last table, compares every pair.
+	joinNaive := func(rows [][]*[2]int64, prevSide string, table string, side string, joinType string) [][]*[2]int64 {
+		joined := make([][]*[2]int64, 0)
+		extend := func(row []*[2]int64, entry *[2]int64) []*[2]int64 {
+			return append(append([]*[2]int64{}, row...), entry)
+		}
+		rightMatched := make([]bool, len(entries[table]))
+		for _, row := range rows {
+			matched := false
+			for j := range entries[table] {
+				r := &entries[table][j]
+				if prev := row[len(row)-1]; prev != nil && attribute(prev, prevSide) == attribute(r, side) {
+					matched, rightMatched[j] = true, true
+					if joinType != "semi" && joinType != "anti" {
+						joined = append(joined, extend(row, r))
+					}
+				}
+			}
+			if (matched && joinType == "semi") || (!matched && (joinType == "left" || joinType == "full" || joinType == "anti")) {
+				joined = append(joined, extend(row, nil))
+			}
+		}
+		for j := range entries[table] {
+			if !rightMatched[j] && (joinType == "right" || joinType == "full") {
+				joined = append(joined, extend(make([]*[2]int64, len(rows[0])), &entries[table][j]))
+			}
+		}
+		return joined
+	}
+	format := func(rows [][]*[2]int64) []string {
+		lines := make([]string, 0)
+		for _, row := range rows {
+			formatted := make([]string, len(row))
+			for i, entry := range row {
+				formatted[i] = "null"
+				if entry != nil {
+					formatted[i] = fmt.Sprintf("(%v, %v)", entry[0], entry[1])
+				}
+			}
+			lines = append(lines, "{"+strings.Join(formatted, ", ")+"}")
+		}
+		sort.Strings(lines)
+		return lines
+	}
+	first := make([][]*[2]int64, 0)
+	for i := range entries["b"] {
+		first = append(first, []*[2]int64{&entries["b"][i]})
+	}
+	for _, types := range [][2]string{{"", ""}, {"left", "left"}, {"", "right"}, {"full", "full"}, {"right", "left"}, {"left", "semi"}, {"", "anti"}} {
+		// b's value matches h's key, and h's value c's value.
+		want := format(joinNaive(joinNaive(first, "val", "h", "key", types[0]), "val", "c", "val", types[1]))
+		command := fmt.Sprintf("join b val %v on h key val %v on c val", types[0], types[1])
+		command = strings.Join(strings.Fields(command), " ")
+		for _, using := range []string{"", " using merge", " using block", " using hash"} {
+			got := joinLines(t, d, command+using)
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("%v produced %v rows, expected %v", command+using, len(got), len(want))
+			}
+		}
+	}
+	// Four tables, each joined with the one before on the same attribute.
+	want := format(joinNaive(joinNaive(joinNaive(first, "key", "c", "key", ""), "key", "b", "key", ""), "key", "c", "key", ""))
+	if got := joinLines(t, d, "join b key on c key on b key on c key"); strings.Join(got, "\n") != strings.Join(want, "\n") || len(want) != 14 {
+		t.Errorf("four-way join produced %v rows, expected %v", len(got), len(want))
+	}
+	got := explainLines(t, d, "explain join b val on h key val on c val")
+	if len(got) != 5 || !strings.HasPrefix(got[0], "join h val = c val (algorithm chosen when run, est. ") ||
+		!strings.HasPrefix(got[1], "  ") || !strings.Contains(got[1], " join b val = h key (est. cost ") || !strings.HasPrefix(got[2], "    scan b") ||
+		!strings.HasPrefix(got[3], "    scan h") || !strings.HasPrefix(got[4], "  scan c") {
+		t.Errorf("explain printed %q", got)
+	}
+	got = explainLines(t, d, "explain analyze join b val on h key val on c val using hash")
+	if !strings.HasPrefix(got[0], "hash join h val = c val ") || !strings.Contains(got[0], fmt.Sprintf("(actual rows=%v ", len(joinLines(t, d, "join b val on h key val on c val")))) ||
+		!strings.Contains(got[1], " spilled rows=") {
+		t.Errorf("explain analyze printed %q", got)
+	}
+	for _, command := range []string{"join b val semi on h key val on c val", "join b val on h key val", "join b val on h key val val on c val", "join b val on h key on"} {
+		if err := query.HandleJoin(d, command, ioutil.Discard); err == nil {
+			t.Errorf("%v: expected an error", command)
+		}
+	}
+	// A table created from a join holds its rows, numbered, with a column per key and value.
+	var out strings.Builder
+	if err := db.HandleCreateTable(d, "create table r as join b val on h key val on c val", &out); err != nil {
+		t.Fatal(err)
+	}
+	want = joinLines(t, d, "join b val on h key val on c val")
+	if out.String() != fmt.Sprintf("btree table r created with %v rows.\n", len(want)) {
+		t.Errorf("create printed %q", out.String())
+	}
+	if schema := d.GetSchema("r").String(); schema != "(id int primary key, b_key int, b_value int, h_key int, h_value int, c_key int, c_value int)" {
+		t.Errorf("created table r with schema %v", schema)
+	}
+	var rows strings.Builder
+	if err := query.HandleSelect(d, "select b_key, b_value, h_key, h_value, c_key, c_value from r", &rows); err != nil {
+		t.Fatal(err)
+	}
+	got = make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(rows.String()), "\n") {
+		values := strings.Split(strings.Trim(line, "()"), ", ")
+		got = append(got, fmt.Sprintf("{(%v, %v), (%v, %v), (%v, %v)}", values[0], values[1], values[2], values[3], values[4], values[5]))
+	}
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("table r holds %q, expected %q", got, want)
+	}
+	// A table can be joined again, with a column for each of its own, and a self join names
+	// its columns apart.
+	runCommands(t, d, "create table s as join r key on r key semi on c key")
+	if schema := d.GetSchema("s").String(); schema != "(id int primary key, r_id int, r_b_key int, r_b_value int, r_h_key int, r_h_value int, r_c_key int, r_c_value int, "+
+		"r_2_id int, r_2_b_key int, r_2_b_value int, r_2_h_key int, r_2_h_value int, r_2_c_key int, r_2_c_value int)" {
+		t.Errorf("created table s with schema %v", schema)
+	}
+	want = make([]string, 0)
+	for i := 0; i < len(got); i++ {
+		if i%3 == 0 {
+			want = append(want, fmt.Sprintf("(%v, %v)", i, i))
+		}
+	}
+	rows.Reset()
+	if err := query.HandleSelect(d, "select r_id, r_2_id from s", &rows); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(strings.TrimSpace(rows.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("table s holds %q, expected %q", got, want)
+	}
+	// A table can't hold the nulls of an outer join, and isn't left behind.
+	if err := db.HandleCreateTable(d, "create table o as join b key left on h key", ioutil.Discard); err == nil {
+		t.Error("created a table holding nulls")
+	}
+	if _, err := d.GetTable("o"); err == nil {
+		t.Error("a table that failed to be created was kept")
+	}
+	if err := db.HandleCreateTable(d, "create table r as join b key on c key", ioutil.Discard); err == nil {
+		t.Error("created a table that already exists")
+	}
+}
+
+func testHashJoinSkew(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	defer func(memory int, partitions int, blockSize int) {
+		query.HASH_JOIN_MEMORY, query.HASH_JOIN_PARTITIONS, query.JOIN_BLOCK_SIZE = memory, partitions, blockSize
+	}(query.HASH_JOIN_MEMORY, query.HASH_JOIN_PARTITIONS, query.JOIN_BLOCK_SIZE)
+	query.HASH_JOIN_MEMORY, query.HASH_JOIN_PARTITIONS = 40, 4
+	runCommands(t, d, "create btree table s", "create hash table h")
+	// Two thirds of the values of s are 8.
+	for i := int64(0); i < 600; i++ {
+		value := i
+		if i%3 != 0 {
+			value = 8
+		}
+		runCommands(t, d, fmt.Sprintf("insert %v %v into s", i, value))
+		if i < 300 {
+			runCommands(t, d, fmt.Sprintf("insert %v %v into h", i*2, i))
+		}
+	}
+	tempFiles, _ := filepath.Glob("db-*")
+	for _, joinType := range []string{"", "left ", "right ", "full ", "semi ", "anti "} {
+		on := "s val " + joinType + "on h key"
+		// The naive join is block nested loop join with every entry in one block.
+		query.JOIN_BLOCK_SIZE = 1 << 20
+		want := joinLines(t, d, "join "+on+" using block")
+		if got := joinLines(t, d, "join "+on+" using hash"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("join %v using hash found %v pairs, expected %v", on, len(got), len(want))
+		}
+	}
+	// The partitions too large to probe in memory are split again, until the one holding
+	// every 8, which no hash splits, is probed a block at a time.
+	got := explainLines(t, d, "explain analyze join s val on h key using hash")[0]
+	var rows, probed, repartitions int64
+	if _, err := fmt.Sscanf(got[strings.Index(got, "(actual"):], "(actual rows=%d time=%s partitions probed=%d repartitions=%d",
+		&rows, new(string), &probed, &repartitions); err != nil {
+		t.Fatalf("explain analyze printed %q: %v", got, err)
+	}
+	if rows != 400+100 || repartitions == 0 || probed <= 4 {
+		t.Errorf("explain analyze printed %q", got)
+	}
+	if left, _ := filepath.Glob("db-*"); len(left) != len(tempFiles) {
+		t.Errorf("grace hash join left %v partition files behind", len(left)-len(tempFiles))
+	}
+}
+
+func testFilterSize(t *testing.T) {
+	for _, rate := range []float64{0.1, 0.01} {
+		filter := db.NewOptimalFilter(1000, rate)
+		for i := int64(0); i < 1000; i++ {
+			filter.Insert(i)
+		}
+		falsePositives := 0
+		for i := int64(1000); i < 21000; i++ {
+			if filter.Contains(i) {
+				falsePositives++
+			}
+		}
+		if measured := float64(falsePositives) / 20000; measured > 1.5*rate {
+			t.Errorf("a filter sized for a false positive rate of %v had %v", rate, measured)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Run("TestExplainSelect", testExplainSelect)
+	t.Run("TestExplainJoin", testExplainJoin)
+}
+
+// explainLines runs an explain command, returning its output lines.
+func explainLines(t *testing.T, d *db.Database, command string) []string {
+	var out strings.Builder
+	if err := query.HandleExplain(d, command, &out); err != nil {
+		t.Fatalf("%v: %v", command, err)
+	}
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func testExplainSelect(t *testing.T) {
+	d, cleanup := setupExec(t, 400)
+	defer cleanup()
+	// The plan is printed as a tree, each operator above the ones it reads from
+	got := explainLines(t, d, "explain select id from s where name = 'n1' and score > 0.5 order by score desc limit 5")
+	want := []string{
+		"project id",
+		"  limit 5",
+		"    external sort by score desc",
+		"      filter ((name = \"n1\") and (score > 0.5))",
+		"        index seek s (name = \"n1\")",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("explain printed\n%v\nexpected\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// Once the table is analyzed, access paths are annotated with the rows they read
+	if _, err := d.Analyze("s"); err != nil {
+		t.Fatal(err)
+	}
+	got = explainLines(t, d, "explain find from s where id >= 100 and id < 200")
+	if want := "  range scan s [100, 200) (est. 100 rows)"; len(got) != 2 || got[1] != want {
+		t.Errorf("explain printed %q, expected the scan %q", got, want)
+	}
+	// Explain analyze runs the plan and measures each operator
+	got = explainLines(t, d, "explain analyze select id from s where name = 'n1' and score > 0.5 order by score desc limit 5")
+	for i, want := range []string{
+		"project id (actual rows=5 loops=1 ",
+		"  limit 5 (actual rows=5 loops=1 ",
+		"    external sort by score desc (actual rows=5 loops=1 ",
+		"      filter ((name = \"n1\") and (score > 0.5)) (actual rows=60 loops=1 ",
+		"        index seek s (name = \"n1\") (est. 100 rows) (actual rows=100 loops=1 ",
+	} {
+		if i >= len(got) || !strings.HasPrefix(got[i], want) {
+			t.Fatalf("explain analyze printed %q, expected line %v to start with %q", got, i, want)
+		}
+	}
+	if !strings.HasSuffix(got[0], got[4][strings.LastIndex(got[4], " pages="):]) || strings.HasSuffix(got[4], " pages=0)") {
+		t.Errorf("pages read were not counted up the plan: %q", got)
+	}
+	if err := query.HandleExplain(d, "explain insert into s values (1000, 'x', 1)", ioutil.Discard); err == nil {
+		t.Error("explained an insert")
+	}
+}
+
+func testExplainJoin(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	runCommands(t, d, "create hash table a", "create hash table b")
+	for i := int64(0); i < 500; i++ {
+		runCommands(t, d, fmt.Sprintf("insert %v %v into a", i, i%50), fmt.Sprintf("insert %v %v into b", i*2, i))
+	}
+	got := explainLines(t, d, "explain join a val on b key using hash")
+	if len(got) != 3 || !strings.HasPrefix(got[0], "hash join a val = b key (est. cost ") ||
+		!strings.HasPrefix(got[1], "  scan a (est. 500 rows)") || !strings.HasPrefix(got[2], "  scan b (est. 500 rows)") {
+		t.Errorf("explain printed %q", got)
+	}
+	// Every even value of a matches a key of b; bloom filter hits that match nothing are
+	// false positives.
+	got = explainLines(t, d, "explain analyze join a val on b key using hash")
+	var rows, probed, repartitions, positives, falsePositives, tempPages int64
+	if _, err := fmt.Sscanf(got[0][strings.Index(got[0], "(actual"):], "(actual rows=%d time=%s partitions probed=%d repartitions=%d filter positives=%d false positives=%d temp pages=%d)",
+		&rows, new(string), &probed, &repartitions, &positives, &falsePositives, &tempPages); err != nil {
+		t.Fatalf("explain analyze printed %q: %v", got, err)
+	}
+	if rows != 250 || probed == 0 || repartitions != 0 || tempPages == 0 {
+		t.Errorf("explain analyze printed %q", got)
+	}
+	// Each of the 25 keys of b that match is passed by the filter, along with the false positives.
+	if positives != 25+falsePositives {
+		t.Errorf("%v filter positives, with %v false positives, expected 25 true positives", positives, falsePositives)
+	}
+	got = explainLines(t, d, "explain analyze join a key on b key using index")
+	if !strings.Contains(got[0], "actual rows=250 ") || !strings.HasSuffix(got[0], "index probes=500)") {
+		t.Errorf("explain analyze printed %q", got)
+	}
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	concurrency "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/concurrency"
+	db "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/db"
+	recovery "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/recovery"
+
+	uuid "github.com/google/uuid"
+)
+
+func TestRecovery(t *testing.T) {
+	t.Run("TestRecoveryBytes", testRecoveryBytes)
+	t.Run("TestRecoveryBytesCheckpoint", testRecoveryBytesCheckpoint)
+}
+
+// openRecovery opens a database in the given folder with a table t, and a recovery manager
+// that logs to the given file.
+func openRecovery(t *testing.T, dir string, logName string) (*db.Database, *concurrency.TransactionManager, *recovery.RecoveryManager) {
+	d, err := db.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetTable("t"); err != nil {
+		runCommands(t, d, "create table t")
+	}
+	tm := concurrency.NewTransactionManager(concurrency.NewLockManager())
+	rm, err := recovery.NewRecoveryManager(d, tm, logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, tm, rm
+}
+
+// Edits of values that are byte slices are logged, rolled back and recovered.
+func testRecoveryBytes(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	logName := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logName, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	d, tm, rm := openRecovery(t, filepath.Join(dir, "a"), logName)
+	run := func(clientId uuid.UUID, commands ...string) {
+		for _, command := range commands {
+			var err error
+			switch strings.Fields(command)[0] {
+			case "transaction":
+				err = recovery.HandleTransaction(d, tm, rm, command, ioutil.Discard, clientId)
+			case "insert":
+				err = recovery.HandleInsert(d, tm, rm, command, clientId)
+			case "update":
+				err = recovery.HandleUpdate(d, tm, rm, command, clientId)
+			case "delete":
+				err = recovery.HandleDelete(d, tm, rm, command, clientId)
+			case "abort":
+				err = recovery.HandleAbort(d, tm, rm, command, ioutil.Discard, clientId)
+			}
+			if err != nil {
+				t.Fatalf("%v: %v", command, err)
+			}
+		}
+	}
+	run(uuid.New(), "transaction begin", `insert 1 "one" into t`, `insert 2 "two, 'too'" into t`, "transaction commit")
+	run(uuid.New(), "transaction begin", `update t 1 "uno"`, "delete 2 from t", `insert 3 "three" into t`, "abort")
+	want := "found entry: (1, \"one\")\nfound entry: (2, \"two, 'too'\")\n"
+	if out := runCommands(t, d, "find 1 from t", "find 2 from t"); out != want {
+		t.Errorf("after rollback, got output\n%v\nexpected\n%v", out, want)
+	}
+	// A transaction left running when the database crashes is undone when the log is replayed
+	// into a database that never saw the committed ones.
+	run(uuid.New(), "transaction begin", `update t 2 ""`, `insert 4 "four" into t`)
+	d.Close()
+	d, _, rm = openRecovery(t, filepath.Join(dir, "b"), logName)
+	defer d.Close()
+	if err := rm.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	if out := runCommands(t, d, "find 1 from t", "find 2 from t"); out != want {
+		t.Errorf("after recovery, got output\n%v\nexpected\n%v", out, want)
+	}
+	table, _ := d.GetTable("t")
+	for _, key := range []int64{3, 4} {
+		if _, err := table.Find(key); err == nil {
+			t.Errorf("key %v was not undone", key)
+		}
+	}
+}
+
+// A checkpoint's copy of the database holds the byte-slice values written before it.
+func testRecoveryBytesCheckpoint(t *testing.T) {
+	dir := getTempDBDir(t)
+	defer os.RemoveAll(dir)
+	folder := filepath.Join(dir, "db")
+	defer os.RemoveAll(folder + "-recovery")
+	logName := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logName, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	d, tm, rm := openRecovery(t, folder, logName)
+	clientId := uuid.New()
+	for _, command := range []string{"transaction begin", `insert 1 "one" into t`, `insert 2 "two" into t`, "transaction commit"} {
+		var err error
+		if strings.HasPrefix(command, "transaction") {
+			err = recovery.HandleTransaction(d, tm, rm, command, ioutil.Discard, clientId)
+		} else {
+			err = recovery.HandleInsert(d, tm, rm, command, clientId)
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", command, err)
+		}
+	}
+	rm.Checkpoint()
+	// Crash without closing the database, then start over from the checkpoint's copy.
+	d, err := recovery.Prime(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	rm, err = recovery.NewRecoveryManager(d, concurrency.NewTransactionManager(concurrency.NewLockManager()), logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rm.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	want := "found entry: (1, \"one\")\nfound entry: (2, \"two\")\n"
+	if out := runCommands(t, d, "find 1 from t", "find 2 from t"); out != want {
+		t.Errorf("after recovering from a checkpoint, got output\n%v\nexpected\n%v", out, want)
+	}
+}
@@ -0,0 +1,204 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	sql "github.com/csci1270-fall-2023/dbms-projects-handout/pkg/sql"
+)
+
+func TestSQL(t *testing.T) {
+	t.Run("TestSQLParse", testSQLParse)
+	t.Run("TestSQLLegacy", testSQLLegacy)
+	t.Run("TestSQLErrors", testSQLErrors)
+}
+
+func testSQLParse(t *testing.T) {
+	statement, err := sql.Parse(`SELECT name, t.score FROM t WHERE (id >= -2 AND NOT name = 'o''brien') OR score NOT BETWEEN 1.5 AND 2e3 ORDER BY score DESC, id LIMIT 10`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectStatement, ok := statement.(*sql.SelectStmt)
+	if !ok {
+		t.Fatalf("parsed a %T, expected a select", statement)
+	}
+	if got := fmt.Sprint(selectStatement.Columns); got != "[name t.score]" {
+		t.Errorf("selected %v", got)
+	}
+	want := `(((id >= -2) and not (name = "o'brien")) or (score not between 1.5 and 2000))`
+	if got := selectStatement.Where.String(); got != want {
+		t.Errorf("parsed where clause %v, expected %v", got, want)
+	}
+	if len(selectStatement.OrderBy) != 2 || !selectStatement.OrderBy[0].Desc || selectStatement.OrderBy[1].Desc {
+		t.Errorf("parsed order %v", selectStatement.OrderBy)
+	}
+	if selectStatement.Table != "t" || selectStatement.Limit != 10 {
+		t.Errorf("parsed table %v and limit %v", selectStatement.Table, selectStatement.Limit)
+	}
+	statement, err = sql.Parse("select name, COUNT(*), avg(score) from t group by name, t.id order by count(*) desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grouped := statement.(*sql.SelectStmt); fmt.Sprint(grouped.Columns, grouped.GroupBy, grouped.OrderBy[0].Expr) != "[name count(*) avg(score)] [name t.id] count(*)" {
+		t.Errorf("parsed grouped select %v group by %v order by %v", grouped.Columns, grouped.GroupBy, grouped.OrderBy)
+	}
+	// An aggregate function's name is still a column name where it isn't called.
+	if statement, err = sql.Parse("select count from t group by count"); err != nil {
+		t.Fatal(err)
+	}
+	if grouped := statement.(*sql.SelectStmt); fmt.Sprint(grouped.Columns, grouped.GroupBy) != "[count] [count]" {
+		t.Errorf("parsed grouped select %v group by %v", grouped.Columns, grouped.GroupBy)
+	}
+	statement, err = sql.Parse("select from t where id not in (select max(id) from u where x in (select y from v) limit 1) and a = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "((id not in (select max(id) from u where (x in (select y from v)) limit 1)) and (a = 1))"
+	if got := statement.(*sql.SelectStmt).Where.String(); got != want {
+		t.Errorf("parsed where clause %v, expected %v", got, want)
+	}
+	statement, err = sql.Parse(`insert into t (id, name) values (1, "a\tb")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if insert := statement.(*sql.InsertStmt); fmt.Sprint(insert.Columns, insert.Values) != `[id name] [1 "a\tb"]` {
+		t.Errorf("parsed insert %v %v", insert.Columns, insert.Values)
+	}
+	statement, err = sql.Parse("update t set score = 2, name = other where id != 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update := statement.(*sql.UpdateStmt); len(update.Set) != 2 || update.Set[1].Value.String() != "other" || update.Where.String() != "(id != 3)" {
+		t.Errorf("parsed update %v where %v", update.Set, update.Where)
+	}
+	statement, err = sql.Parse("create hash table t (id int primary key, name text)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if create := statement.(*sql.CreateTableStmt); create.Type != "hash" || len(create.Columns) != 2 || !create.Columns[0].PrimaryKey {
+		t.Errorf("parsed create %+v", create)
+	}
+	statement, err = sql.Parse("create table r as  join b val on h key ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if create := statement.(*sql.CreateTableStmt); create.Type != "btree" || create.Table != "r" || create.As != "join b val on h key" {
+		t.Errorf("parsed create %+v", create)
+	}
+	if _, err = sql.Parse("create table r as"); err == nil {
+		t.Error("parsed create table as without a command")
+	}
+	// Each join names its type and the attributes it is on; a table joined with the next on
+	// another attribute names that one too.
+	statement, err = sql.Parse("join b val LEFT on h key val semi on c val using INDEX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(statement); got != "&{b [{left h false true} {semi c false false}] index}" {
+		t.Errorf("parsed join %v", got)
+	}
+	statement, err = sql.Parse("join b key on c key on b key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(statement); got != "&{b [{ c true true} { b true true}] }" {
+		t.Errorf("parsed join %v", got)
+	}
+	statement, err = sql.Parse("create index i on t(name) using btree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if create := statement.(*sql.CreateIndexStmt); *create != (sql.CreateIndexStmt{Name: "i", Table: "t", Column: "name", Type: "btree"}) {
+		t.Errorf("parsed create index %+v", create)
+	}
+	// Commands that manage tables are statements too, so they check names as the others do.
+	for command, want := range map[string]string{
+		"drop table t":        "&{table t}",
+		"DROP INDEX i":        "&{index i}",
+		"rename table t to u": "&{t u}",
+		"truncate table t":    "&{t}",
+		"show tables":         "&{}",
+		"describe t":          "&{t}",
+		"analyze t":           "&{t}",
+		"filter on t 0.05":    "&{true t 0.05}",
+		"filter on t":         "&{true t <nil>}",
+		"filter off t":        "&{false t <nil>}",
+	} {
+		statement, err := sql.Parse(command)
+		if err != nil {
+			t.Errorf("%v: %v", command, err)
+		} else if got := fmt.Sprint(statement); got != want {
+			t.Errorf("%v parsed to %v, expected %v", command, got, want)
+		}
+	}
+	statement, err = sql.Parse("delete from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleteStatement := statement.(*sql.DeleteStmt); deleteStatement.Where != nil {
+		t.Errorf("parsed delete where %v", deleteStatement.Where)
+	}
+}
+
+func testSQLLegacy(t *testing.T) {
+	for command, want := range map[string]string{
+		`insert 1 "x" into t`: `&{t [] [1 "x"]}`,
+		"update t 1 -2":       "&{t [] [1 -2] <nil>}",
+		"delete 4 from t":     "&{t (key = 4)}",
+		"find 4 from t":       "&{t (key = 4)}",
+		"select from t where key between 1 and 3 desc limit 2": "&{[] t (key between 1 and 3) [] [{key true}] 2}",
+	} {
+		statement, err := sql.Parse(command)
+		if err != nil {
+			t.Errorf("%v: %v", command, err)
+			continue
+		}
+		if got := fmt.Sprint(statement); got != want {
+			t.Errorf("%v parsed to %v, expected %v", command, got, want)
+		}
+	}
+}
+
+func testSQLErrors(t *testing.T) {
+	for command, want := range map[string]string{
+		"select from":                      "syntax error at position 12: expected a table name, found end of input",
+		"select a b from t":                `syntax error at position 10: expected FROM, found "b"`,
+		"select from t where a = ":         "syntax error at position 25: expected a value, found end of input",
+		"select from t where a":            "syntax error at position 22: expected a comparison, found end of input",
+		"select from t limit x":            `syntax error at position 21: expected a row count, found "x"`,
+		"insert into t values (1, 2":       `syntax error at position 27: expected ")", found end of input`,
+		"insert into t (a) values (1, 2)":  "syntax error at position 32: 1 columns are named but 2 values are given",
+		`insert "abc into t`:               "syntax error at position 8: unterminated string",
+		"update t set where a = 1":         `syntax error at position 14: expected a column name, found "where"`,
+		"create table t (a int primary)":   `syntax error at position 30: expected KEY, found ")"`,
+		"create index i on t(a) using avl": `syntax error at position 30: expected BTREE or HASH, found "avl"`,
+		"select from t # 1":                "syntax error at position 15: unexpected character '#'",
+		"pretty from t":                    `syntax error at position 1: expected a statement, found "pretty"`,
+		"drop view v":                      `syntax error at position 6: expected TABLE or INDEX, found "view"`,
+		"rename table t u":                 `syntax error at position 16: expected TO, found "u"`,
+		"truncate table from":              `syntax error at position 16: expected a table name, found "from"`,
+		"show tables t":                    `syntax error at position 13: unexpected "t" after the end of the statement`,
+		"analyze t u":                      `syntax error at position 11: unexpected "u" after the end of the statement`,
+		"filter t":                         `syntax error at position 8: expected OFF, found "t"`,
+		"filter on t x":                    `syntax error at position 13: expected a false positive rate, found "x"`,
+		"filter off t 0.1":                 `syntax error at position 14: unexpected "0.1" after the end of the statement`,
+		"delete from t where 1e":           `syntax error at position 21: malformed number "1e"`,
+		"select sum(*) from t":             "syntax error at position 8: sum needs an argument",
+		"select count(a from t":            `syntax error at position 16: expected ")", found "from"`,
+		"select from t group a":            `syntax error at position 21: expected BY, found "a"`,
+		"select from t where a in (b)":     `syntax error at position 27: expected SELECT, found "b"`,
+		"select from t where a not like b": `syntax error at position 27: expected BETWEEN or IN, found "like"`,
+		"join b key":                       "syntax error at position 11: expected ON, found end of input",
+		"join b on h key":                  `syntax error at position 8: expected KEY or VAL, found "on"`,
+		"join b val sideways on h key":     `syntax error at position 12: expected ON or a join type, found "sideways"`,
+		"join b val on h key val":          "syntax error at position 24: expected ON, found end of input",
+		"join b val on h key using":        "syntax error at position 26: expected a join algorithm, found end of input",
+	} {
+		_, err := sql.Parse(command)
+		if err == nil {
+			t.Errorf("%v: expected an error", command)
+		} else if err.Error() != want {
+			t.Errorf("%v: got error %q, expected %q", command, err, want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Statement is a parsed command.
+type Statement interface {
+	statementNode()
+}
+
+// An Expr is a parsed expression. String formats it back into source form.
+type Expr interface {
+	exprNode()
+	String() string
+}
+
+// A ColumnRef names a column, optionally qualified by its table.
+type ColumnRef struct {
+	Table string // Empty if unqualified.
+	Name  string
+}
+
+// A Literal is an int64, float64 or string constant.
+type Literal struct {
+	Value interface{}
+}
+
+// A BinaryExpr applies a comparison (=, !=, <, <=, >, >=) or AND or OR to two operands.
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// A NotExpr negates a condition.
+type NotExpr struct {
+	Expr Expr
+}
+
+// A BetweenExpr checks that an operand lies in an inclusive range.
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// An InExpr checks whether an operand is among the values a subquery selects.
+type InExpr struct {
+	Expr     Expr
+	Subquery *SelectStmt // Selects one column.
+	Not      bool
+}
+
+// A Star selects every column.
+type Star struct{}
+
+// A FuncCall applies an aggregate function to an expression over a group of rows.
+type FuncCall struct {
+	Name string
+	Arg  Expr // nil for count(*).
+}
+
+func (*ColumnRef) exprNode()   {}
+func (*Literal) exprNode()     {}
+func (*BinaryExpr) exprNode()  {}
+func (*NotExpr) exprNode()     {}
+func (*BetweenExpr) exprNode() {}
+func (*InExpr) exprNode()      {}
+func (*Star) exprNode()        {}
+func (*FuncCall) exprNode()    {}
+
+func (expr *ColumnRef) String() string {
+	if expr.Table != "" {
+		return expr.Table + "." + expr.Name
+	}
+	return expr.Name
+}
+
+func (expr *Literal) String() string {
+	switch v := expr.Value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (expr *BinaryExpr) String() string {
+	return fmt.Sprintf("(%v %v %v)", expr.Left, expr.Op, expr.Right)
+}
+
+func (expr *NotExpr) String() string {
+	return fmt.Sprintf("not %v", expr.Expr)
+}
+
+func (expr *BetweenExpr) String() string {
+	not := ""
+	if expr.Not {
+		not = "not "
+	}
+	return fmt.Sprintf("(%v %vbetween %v and %v)", expr.Expr, not, expr.Low, expr.High)
+}
+
+func (expr *InExpr) String() string {
+	not := ""
+	if expr.Not {
+		not = "not "
+	}
+	return fmt.Sprintf("(%v %vin (%v))", expr.Expr, not, formatSelect(expr.Subquery))
+}
+
+func (*Star) String() string {
+	return "*"
+}
+
+func (expr *FuncCall) String() string {
+	if expr.Arg == nil {
+		return expr.Name + "(*)"
+	}
+	return fmt.Sprintf("%v(%v)", expr.Name, expr.Arg)
+}
+
+// An OrderItem is an expression to sort by, and its direction.
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+// SelectStmt is select [<expr>, ...] from <table> [where <expr>] [group by <expr>, ...]
+// [order by <expr> [asc|desc], ...] [limit <n>]. An empty list of columns selects every column.
+type SelectStmt struct {
+	Columns []Expr
+	Table   string
+	Where   Expr // nil if there is no where clause.
+	GroupBy []Expr
+	OrderBy []OrderItem
+	Limit   int64 // -1 if there is no limit.
+}
+
+// formatSelect formats a select statement as it is written.
+func formatSelect(statement *SelectStmt) string {
+	var b strings.Builder
+	b.WriteString("select ")
+	for i, column := range statement.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(column.String())
+	}
+	if len(statement.Columns) > 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString("from " + statement.Table)
+	if statement.Where != nil {
+		b.WriteString(fmt.Sprintf(" where %v", statement.Where))
+	}
+	for i, expr := range statement.GroupBy {
+		if i == 0 {
+			b.WriteString(" group by ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(expr.String())
+	}
+	for i, item := range statement.OrderBy {
+		if i == 0 {
+			b.WriteString(" order by ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(item.Expr.String())
+		if item.Desc {
+			b.WriteString(" desc")
+		}
+	}
+	if statement.Limit >= 0 {
+		b.WriteString(fmt.Sprintf(" limit %v", statement.Limit))
+	}
+	return b.String()
+}
+
+// FindStmt is find <key> from <table>, or find from <table> where <expr>.
+type FindStmt struct {
+	Table string
+	Where Expr
+}
+
+// InsertStmt is insert into <table> [(<column>, ...)] values (<value>, ...), or insert <value> ... into <table>.
+type InsertStmt struct {
+	Table   string
+	Columns []string // Empty if the values are given in column order.
+	Values  []Expr
+}
+
+// An Assignment sets a column in an update.
+type Assignment struct {
+	Column string
+	Value  Expr
+}
+
+// UpdateStmt is update <table> set <column> = <value>, ... [where <expr>], or update <table> <value> ...,
+// which replaces the row with the given values, key included.
+type UpdateStmt struct {
+	Table  string
+	Set    []Assignment
+	Values []Expr // The values of the replacement row, if Set is empty.
+	Where  Expr
+}
+
+// DeleteStmt is delete from <table> [where <expr>], or delete <key> from <table>.
+type DeleteStmt struct {
+	Table string
+	Where Expr
+}
+
+// A ColumnDef declares a column of a table.
+type ColumnDef struct {
+	Name       string
+	Type       string
+	PrimaryKey bool
+}
+
+// CreateTableStmt is create [<btree|hash>] table <table> [(<column> <type> [primary key], ...)],
+// or create [<btree|hash>] table <table> as <command ...>.
+type CreateTableStmt struct {
+	Table   string
+	Type    string      // Index type of the table; btree if not given.
+	Columns []ColumnDef // Empty for a table of (key, value) pairs.
+	As      string      // The command whose rows fill the table, if it is created from one.
+}
+
+// CreateIndexStmt is create index <index> on <table>(<column>) using <btree|hash>.
+type CreateIndexStmt struct {
+	Name   string
+	Table  string
+	Column string
+	Type   string
+}
+
+// JoinStmt is join <table> <key|val> [left|right|full|semi|anti] on <table> <key|val>
+// [<key|val>] ... [using <algorithm>]: a left-deep join of the first table with the second,
+// then of what they produce with the third, and so on. Each join is on the key or value of
+// the table before it and of its own table; a table joined with the ones before and after
+// it on different attributes names both, that of the join before first.
+type JoinStmt struct {
+	Table string // The first table.
+	Joins []JoinClause
+	Using string // The algorithm named, or empty to pick the cheapest.
+}
+
+// A JoinClause joins what the joins before it produce with a table.
+type JoinClause struct {
+	Type      string // left, right, full, semi or anti, or empty for an inner join.
+	Table     string
+	PrevOnKey bool // Whether the table before is joined on its key.
+	OnKey     bool // Whether the table is joined on its key.
+}
+
+// DropStmt is drop table <table> or drop index <index>.
+type DropStmt struct {
+	Kind string // table or index.
+	Name string
+}
+
+// RenameStmt is rename table <table> to <new name>.
+type RenameStmt struct {
+	Table   string
+	NewName string
+}
+
+// TruncateStmt is truncate table <table>.
+type TruncateStmt struct {
+	Table string
+}
+
+// ShowTablesStmt is show tables.
+type ShowTablesStmt struct{}
+
+// DescribeStmt is describe <table>.
+type DescribeStmt struct {
+	Table string
+}
+
+// AnalyzeStmt is analyze <table>.
+type AnalyzeStmt struct {
+	Table string
+}
+
+// FilterStmt is filter on <table> [<false positive rate>] or filter off <table>.
+type FilterStmt struct {
+	On    bool
+	Table string
+	Rate  Expr // The false positive rate to size the filter for; nil if not given.
+}
+
+func (*SelectStmt) statementNode()      {}
+func (*JoinStmt) statementNode()        {}
+func (*FindStmt) statementNode()        {}
+func (*InsertStmt) statementNode()      {}
+func (*UpdateStmt) statementNode()      {}
+func (*DeleteStmt) statementNode()      {}
+func (*CreateTableStmt) statementNode() {}
+func (*CreateIndexStmt) statementNode() {}
+func (*DropStmt) statementNode()        {}
+func (*RenameStmt) statementNode()      {}
+func (*TruncateStmt) statementNode()    {}
+func (*ShowTablesStmt) statementNode()  {}
+func (*DescribeStmt) statementNode()    {}
+func (*AnalyzeStmt) statementNode()     {}
+func (*FilterStmt) statementNode()      {}
+
+// Conjuncts splits a condition into the conditions it ANDs together.
+func Conjuncts(expr Expr) []Expr {
+	if expr == nil {
+		return nil
+	}
+	if binary, ok := expr.(*BinaryExpr); ok && binary.Op == "and" {
+		return append(Conjuncts(binary.Left), Conjuncts(binary.Right)...)
+	}
+	return []Expr{expr}
+}
@@ -0,0 +1,153 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The kind of a token.
+type TokenKind int
+
+const (
+	EOF    TokenKind = iota // End of the input
+	IDENT                   // A name or keyword
+	INT                     // An integer literal
+	FLOAT                   // A floating-point literal
+	STRING                  // A quoted string literal
+	SYMBOL                  // Punctuation or an operator
+)
+
+var tokenKindNames = map[TokenKind]string{
+	EOF: "end of input", IDENT: "name", INT: "integer", FLOAT: "float", STRING: "string", SYMBOL: "symbol",
+}
+
+// String returns a description of the token kind for error messages.
+func (kind TokenKind) String() string {
+	return tokenKindNames[kind]
+}
+
+// A Token is a lexeme of a statement, and the position it starts at.
+type Token struct {
+	Kind TokenKind
+	Text string // Source text of the token; the unquoted value of a string.
+	Pos  int    // 1-based offset of the token in the statement.
+}
+
+// String formats the token as it appears in error messages.
+func (token Token) String() string {
+	switch token.Kind {
+	case EOF:
+		return "end of input"
+	case STRING:
+		return strconv.Quote(token.Text)
+	default:
+		return fmt.Sprintf("%q", token.Text)
+	}
+}
+
+// Symbols, longest first so that two-character operators win.
+var symbols = []string{"<=", ">=", "!=", "<>", "=", "<", ">", "(", ")", ",", "*", "-", "."}
+
+// A SyntaxError is an error at a position in a statement.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", err.Pos, err.Msg)
+}
+
+// Lex splits a statement into tokens, ending with an EOF token. Strings may be written in
+// double quotes, with Go escapes, or in single quotes, where a doubled quote stands for one.
+func Lex(input string) ([]Token, error) {
+	tokens := make([]Token, 0)
+	i := 0
+	for i < len(input) {
+		c := rune(input[i])
+		start := i
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '_' || unicode.IsLetter(c):
+			for i < len(input) && (input[i] == '_' || unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i]))) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: IDENT, Text: input[start:i], Pos: start + 1})
+		case unicode.IsDigit(c) || c == '.' && i+1 < len(input) && unicode.IsDigit(rune(input[i+1])):
+			kind := INT
+			for i < len(input) && unicode.IsDigit(rune(input[i])) {
+				i++
+			}
+			if i < len(input) && input[i] == '.' {
+				kind = FLOAT
+				for i++; i < len(input) && unicode.IsDigit(rune(input[i])); i++ {
+				}
+			}
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				kind = FLOAT
+				i++
+				if i < len(input) && (input[i] == '+' || input[i] == '-') {
+					i++
+				}
+				if i >= len(input) || !unicode.IsDigit(rune(input[i])) {
+					return nil, &SyntaxError{Pos: start + 1, Msg: fmt.Sprintf("malformed number %q", input[start:i])}
+				}
+				for i < len(input) && unicode.IsDigit(rune(input[i])) {
+					i++
+				}
+			}
+			tokens = append(tokens, Token{Kind: kind, Text: input[start:i], Pos: start + 1})
+		case c == '"':
+			// Scan to the closing quote, skipping escaped characters.
+			for i++; i < len(input) && input[i] != '"'; i++ {
+				if input[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(input) {
+				return nil, &SyntaxError{Pos: start + 1, Msg: "unterminated string"}
+			}
+			i++
+			s, err := strconv.Unquote(input[start:i])
+			if err != nil {
+				return nil, &SyntaxError{Pos: start + 1, Msg: fmt.Sprintf("malformed string %v", input[start:i])}
+			}
+			tokens = append(tokens, Token{Kind: STRING, Text: s, Pos: start + 1})
+		case c == '\'':
+			var s strings.Builder
+			for i++; ; i++ {
+				if i >= len(input) {
+					return nil, &SyntaxError{Pos: start + 1, Msg: "unterminated string"}
+				}
+				if input[i] == '\'' {
+					if i+1 < len(input) && input[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+				s.WriteByte(input[i])
+			}
+			i++
+			tokens = append(tokens, Token{Kind: STRING, Text: s.String(), Pos: start + 1})
+		default:
+			symbol := ""
+			for _, candidate := range symbols {
+				if strings.HasPrefix(input[i:], candidate) {
+					symbol = candidate
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, &SyntaxError{Pos: start + 1, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			i += len(symbol)
+			tokens = append(tokens, Token{Kind: SYMBOL, Text: symbol, Pos: start + 1})
+		}
+	}
+	return append(tokens, Token{Kind: EOF, Pos: len(input) + 1}), nil
+}
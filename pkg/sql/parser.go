@@ -0,0 +1,851 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Words that can't be used as unquoted names, so that they can end a list of names or expressions.
+var reserved = map[string]bool{
+	"select": true, "from": true, "where": true, "order": true, "by": true, "limit": true, "and": true,
+	"or": true, "not": true, "between": true, "into": true, "values": true, "set": true, "asc": true,
+	"desc": true, "on": true, "using": true, "table": true, "index": true, "group": true, "in": true,
+}
+
+// Types of join besides an inner join, which is named by naming none.
+var joinTypes = map[string]bool{"left": true, "right": true, "full": true, "semi": true, "anti": true}
+
+// Names of the aggregate functions.
+var aggregateFuncs = map[string]bool{"count": true, "sum": true, "min": true, "max": true, "avg": true}
+
+// A parser walks the tokens of one statement.
+type parser struct {
+	input  string
+	tokens []Token
+	pos    int
+}
+
+// Parse parses a single statement.
+func Parse(input string) (Statement, error) {
+	tokens, err := Lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{input: input, tokens: tokens}
+	statement, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Kind != EOF {
+		return nil, p.errorf("unexpected %v after the end of the statement", p.peek())
+	}
+	return statement, nil
+}
+
+// ParseValues parses a row of literals separated by spaces, as a line of a file to load
+// gives one.
+func ParseValues(input string) ([]Expr, error) {
+	tokens, err := Lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{input: input, tokens: tokens}
+	values, err := p.parseLiterals()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Kind != EOF {
+		return nil, p.errorf("unexpected %v after the end of the row", p.peek())
+	}
+	return values, nil
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the next token.
+func (p *parser) next() Token {
+	token := p.tokens[p.pos]
+	if token.Kind != EOF {
+		p.pos++
+	}
+	return token
+}
+
+// errorf returns a syntax error at the next token.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Pos: p.peek().Pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// isKeyword checks whether the next token is the given keyword.
+func (p *parser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.Kind == IDENT && strings.EqualFold(token.Text, keyword)
+}
+
+// acceptKeyword consumes the next token if it is the given keyword.
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expectKeyword consumes the given keyword, or errors.
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("expected %v, found %v", strings.ToUpper(keyword), p.peek())
+	}
+	return nil
+}
+
+// isSymbol checks whether the next token is the given symbol.
+func (p *parser) isSymbol(symbol string) bool {
+	token := p.peek()
+	return token.Kind == SYMBOL && token.Text == symbol
+}
+
+// acceptSymbol consumes the next token if it is the given symbol.
+func (p *parser) acceptSymbol(symbol string) bool {
+	if p.isSymbol(symbol) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expectSymbol consumes the given symbol, or errors.
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf("expected %q, found %v", symbol, p.peek())
+	}
+	return nil
+}
+
+// parseName consumes a name that isn't a reserved word.
+func (p *parser) parseName(what string) (string, error) {
+	token := p.peek()
+	if token.Kind != IDENT || reserved[strings.ToLower(token.Text)] {
+		return "", p.errorf("expected %v, found %v", what, token)
+	}
+	p.next()
+	return token.Text, nil
+}
+
+// parseIndexType consumes btree or hash.
+func (p *parser) parseIndexType() (string, error) {
+	if p.isKeyword("btree") || p.isKeyword("hash") {
+		return strings.ToLower(p.next().Text), nil
+	}
+	return "", p.errorf("expected BTREE or HASH, found %v", p.peek())
+}
+
+// parseStatement dispatches on the statement's first word.
+func (p *parser) parseStatement() (Statement, error) {
+	switch {
+	case p.acceptKeyword("select"):
+		return p.parseSelect()
+	case p.acceptKeyword("find"):
+		return p.parseFind()
+	case p.acceptKeyword("join"):
+		return p.parseJoin()
+	case p.acceptKeyword("insert"):
+		return p.parseInsert()
+	case p.acceptKeyword("update"):
+		return p.parseUpdate()
+	case p.acceptKeyword("delete"):
+		return p.parseDelete()
+	case p.acceptKeyword("create"):
+		return p.parseCreate()
+	case p.acceptKeyword("drop"):
+		return p.parseDrop()
+	case p.acceptKeyword("rename"):
+		return p.parseRename()
+	case p.acceptKeyword("truncate"):
+		return p.parseTruncate()
+	case p.acceptKeyword("show"):
+		if err := p.expectKeyword("tables"); err != nil {
+			return nil, err
+		}
+		return &ShowTablesStmt{}, nil
+	case p.acceptKeyword("describe"):
+		table, err := p.parseName("a table name")
+		if err != nil {
+			return nil, err
+		}
+		return &DescribeStmt{Table: table}, nil
+	case p.acceptKeyword("analyze"):
+		table, err := p.parseName("a table name")
+		if err != nil {
+			return nil, err
+		}
+		return &AnalyzeStmt{Table: table}, nil
+	case p.acceptKeyword("filter"):
+		return p.parseFilter()
+	default:
+		return nil, p.errorf("expected a statement, found %v", p.peek())
+	}
+}
+
+// parseSelect parses the rest of a select statement. For backwards compatibility, a
+// desc right after the where clause orders by the key, descending.
+func (p *parser) parseSelect() (Statement, error) {
+	statement := &SelectStmt{Limit: -1}
+	if !p.isKeyword("from") {
+		for {
+			if p.acceptSymbol("*") {
+				statement.Columns = append(statement.Columns, &Star{})
+			} else {
+				expr, err := p.parseSelectItem()
+				if err != nil {
+					return nil, err
+				}
+				statement.Columns = append(statement.Columns, expr)
+			}
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	var err error
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("where") {
+		if statement.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("group") {
+		if err = p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			statement.GroupBy = append(statement.GroupBy, expr)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("order") {
+		if err = p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			item := OrderItem{}
+			if item.Expr, err = p.parseSelectItem(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("desc") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("asc")
+			}
+			statement.OrderBy = append(statement.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	} else if p.acceptKeyword("desc") {
+		statement.OrderBy = []OrderItem{{Expr: &ColumnRef{Name: "key"}, Desc: true}}
+	}
+	if p.acceptKeyword("limit") {
+		token := p.peek()
+		if token.Kind != INT {
+			return nil, p.errorf("expected a row count, found %v", token)
+		}
+		p.next()
+		if statement.Limit, err = strconv.ParseInt(token.Text, 10, 64); err != nil {
+			return nil, &SyntaxError{Pos: token.Pos, Msg: fmt.Sprintf("bad row count %v", token.Text)}
+		}
+	}
+	return statement, nil
+}
+
+// parseFind parses the rest of find <key> from <table> or find from <table> where <expr>.
+func (p *parser) parseFind() (Statement, error) {
+	statement := &FindStmt{}
+	var key Expr
+	var err error
+	if !p.isKeyword("from") {
+		if key, err = p.parseLiteral(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		statement.Where = &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "key"}, Right: key}
+		return statement, nil
+	}
+	if err = p.expectKeyword("where"); err != nil {
+		return nil, err
+	}
+	if statement.Where, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseJoin parses the rest of join <table> <key|val> [<type>] on <table> <key|val> [<key|val>]
+// ... [using <algorithm>].
+func (p *parser) parseJoin() (Statement, error) {
+	statement := &JoinStmt{}
+	var err error
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	// Whether the table before the next join is joined on its key, and whether that was
+	// named after the attribute its own join is on.
+	prevOnKey, err := p.parseJoinAttribute()
+	if err != nil {
+		return nil, err
+	}
+	named := false
+	for !p.isKeyword("using") && p.peek().Kind != EOF {
+		clause := JoinClause{PrevOnKey: prevOnKey}
+		if token := p.peek(); !p.isKeyword("on") {
+			if token.Kind != IDENT || !joinTypes[strings.ToLower(token.Text)] {
+				return nil, p.errorf("expected ON or a join type, found %v", token)
+			}
+			clause.Type = strings.ToLower(p.next().Text)
+		}
+		if err = p.expectKeyword("on"); err != nil {
+			return nil, err
+		}
+		if clause.Table, err = p.parseName("a table name"); err != nil {
+			return nil, err
+		}
+		if clause.OnKey, err = p.parseJoinAttribute(); err != nil {
+			return nil, err
+		}
+		statement.Joins = append(statement.Joins, clause)
+		prevOnKey, named = clause.OnKey, false
+		if p.isKeyword("key") || p.isKeyword("val") {
+			prevOnKey, named = strings.EqualFold(p.next().Text, "key"), true
+		}
+	}
+	if named || len(statement.Joins) == 0 {
+		return nil, p.errorf("expected ON, found %v", p.peek())
+	}
+	if p.acceptKeyword("using") {
+		token := p.peek()
+		if token.Kind != IDENT {
+			return nil, p.errorf("expected a join algorithm, found %v", token)
+		}
+		statement.Using = strings.ToLower(p.next().Text)
+	}
+	return statement, nil
+}
+
+// parseJoinAttribute consumes key or val, returning whether it is key.
+func (p *parser) parseJoinAttribute() (bool, error) {
+	if p.acceptKeyword("key") {
+		return true, nil
+	}
+	if p.acceptKeyword("val") {
+		return false, nil
+	}
+	return false, p.errorf("expected KEY or VAL, found %v", p.peek())
+}
+
+// parseInsert parses the rest of insert into <table> [(<column>, ...)] values (<value>, ...)
+// or insert <value> ... into <table>.
+func (p *parser) parseInsert() (Statement, error) {
+	statement := &InsertStmt{}
+	var err error
+	if !p.acceptKeyword("into") {
+		if statement.Values, err = p.parseLiterals(); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("into"); err != nil {
+			return nil, err
+		}
+		if statement.Table, err = p.parseName("a table name"); err != nil {
+			return nil, err
+		}
+		return statement, nil
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	if p.acceptSymbol("(") {
+		for {
+			column, err := p.parseName("a column name")
+			if err != nil {
+				return nil, err
+			}
+			statement.Columns = append(statement.Columns, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("values"); err != nil {
+		return nil, err
+	}
+	if err = p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		value, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		statement.Values = append(statement.Values, value)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err = p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if len(statement.Columns) > 0 && len(statement.Columns) != len(statement.Values) {
+		return nil, p.errorf("%v columns are named but %v values are given", len(statement.Columns), len(statement.Values))
+	}
+	return statement, nil
+}
+
+// parseUpdate parses the rest of update <table> set <column> = <value>, ... [where <expr>]
+// or update <table> <value> ....
+func (p *parser) parseUpdate() (Statement, error) {
+	statement := &UpdateStmt{}
+	var err error
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("set") {
+		if statement.Values, err = p.parseLiterals(); err != nil {
+			return nil, err
+		}
+		return statement, nil
+	}
+	for {
+		assignment := Assignment{}
+		if assignment.Column, err = p.parseName("a column name"); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		if assignment.Value, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+		statement.Set = append(statement.Set, assignment)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("where") {
+		if statement.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// parseDelete parses the rest of delete from <table> [where <expr>] or delete <key> from <table>.
+func (p *parser) parseDelete() (Statement, error) {
+	statement := &DeleteStmt{}
+	var key Expr
+	var err error
+	if !p.isKeyword("from") {
+		if key, err = p.parseLiteral(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		statement.Where = &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "key"}, Right: key}
+	} else if p.acceptKeyword("where") {
+		if statement.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// parseCreate parses the rest of a create table or create index statement.
+func (p *parser) parseCreate() (Statement, error) {
+	var err error
+	if p.acceptKeyword("index") {
+		statement := &CreateIndexStmt{}
+		if statement.Name, err = p.parseName("an index name"); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("on"); err != nil {
+			return nil, err
+		}
+		if statement.Table, err = p.parseName("a table name"); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		if statement.Column, err = p.parseName("a column name"); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("using"); err != nil {
+			return nil, err
+		}
+		if statement.Type, err = p.parseIndexType(); err != nil {
+			return nil, err
+		}
+		return statement, nil
+	}
+	statement := &CreateTableStmt{Type: "btree"}
+	if !p.isKeyword("table") {
+		if statement.Type, err = p.parseIndexType(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	// The command a table is created from is run by whatever it names, so is kept as text.
+	if p.acceptKeyword("as") {
+		if p.peek().Kind == EOF {
+			return nil, p.errorf("expected a command, found %v", p.peek())
+		}
+		statement.As = strings.TrimSpace(p.input[p.peek().Pos-1:])
+		for p.peek().Kind != EOF {
+			p.next()
+		}
+		return statement, nil
+	}
+	if p.acceptSymbol("(") {
+		for {
+			def := ColumnDef{}
+			if def.Name, err = p.parseName("a column name"); err != nil {
+				return nil, err
+			}
+			if def.Type, err = p.parseName("a column type"); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("primary") {
+				if err = p.expectKeyword("key"); err != nil {
+					return nil, err
+				}
+				def.PrimaryKey = true
+			}
+			statement.Columns = append(statement.Columns, def)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// parseDrop parses the rest of drop table <table> or drop index <index>.
+func (p *parser) parseDrop() (Statement, error) {
+	statement := &DropStmt{}
+	var err error
+	switch {
+	case p.acceptKeyword("table"):
+		statement.Kind = "table"
+		statement.Name, err = p.parseName("a table name")
+	case p.acceptKeyword("index"):
+		statement.Kind = "index"
+		statement.Name, err = p.parseName("an index name")
+	default:
+		err = p.errorf("expected TABLE or INDEX, found %v", p.peek())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseRename parses the rest of rename table <table> to <new name>.
+func (p *parser) parseRename() (Statement, error) {
+	statement := &RenameStmt{}
+	var err error
+	if err = p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("to"); err != nil {
+		return nil, err
+	}
+	if statement.NewName, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseTruncate parses the rest of truncate table <table>.
+func (p *parser) parseTruncate() (Statement, error) {
+	statement := &TruncateStmt{}
+	var err error
+	if err = p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseFilter parses the rest of filter on <table> [<false positive rate>] or filter off <table>.
+func (p *parser) parseFilter() (Statement, error) {
+	statement := &FilterStmt{}
+	var err error
+	if statement.On = p.acceptKeyword("on"); !statement.On {
+		if err = p.expectKeyword("off"); err != nil {
+			return nil, err
+		}
+	}
+	if statement.Table, err = p.parseName("a table name"); err != nil {
+		return nil, err
+	}
+	if statement.On && p.peek().Kind != EOF {
+		if token := p.peek(); token.Kind != INT && token.Kind != FLOAT {
+			return nil, p.errorf("expected a false positive rate, found %v", token)
+		}
+		if statement.Rate, err = p.parseLiteral(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// parseLiterals parses one or more literals.
+func (p *parser) parseLiterals() ([]Expr, error) {
+	values := make([]Expr, 0)
+	for {
+		value, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		token := p.peek()
+		if token.Kind != INT && token.Kind != FLOAT && token.Kind != STRING && !p.isSymbol("-") {
+			return values, nil
+		}
+	}
+}
+
+// parseExpr parses a condition: comparisons combined with AND, OR, NOT and parentheses.
+func (p *parser) parseExpr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses conditions joined by AND.
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseNot parses a condition, possibly negated.
+func (p *parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("not") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+// Comparison operators, and what they are normalized to.
+var comparisons = map[string]string{"=": "=", "!=": "!=", "<>": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+// parseComparison parses an operand, compared to another or checked against a range.
+func (p *parser) parseComparison() (Expr, error) {
+	// A parenthesized condition.
+	if p.acceptSymbol("(") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.Kind == SYMBOL && comparisons[token.Text] != "" {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Op: comparisons[token.Text], Left: left, Right: right}, nil
+	}
+	not := p.acceptKeyword("not")
+	if p.acceptKeyword("between") {
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Expr: left, Low: low, High: high, Not: not}, nil
+	}
+	if p.acceptKeyword("in") {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("select"); err != nil {
+			return nil, err
+		}
+		subquery, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &InExpr{Expr: left, Subquery: subquery.(*SelectStmt), Not: not}, nil
+	}
+	if not {
+		return nil, p.errorf("expected BETWEEN or IN, found %v", p.peek())
+	}
+	return nil, p.errorf("expected a comparison, found %v", p.peek())
+}
+
+// parseSelectItem parses an aggregate function call, a column or a literal.
+func (p *parser) parseSelectItem() (Expr, error) {
+	token := p.peek()
+	if token.Kind != IDENT || !aggregateFuncs[strings.ToLower(token.Text)] ||
+		p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1].Kind != SYMBOL || p.tokens[p.pos+1].Text != "(" {
+		return p.parseOperand()
+	}
+	p.next()
+	p.next()
+	call := &FuncCall{Name: strings.ToLower(token.Text)}
+	if !p.acceptSymbol("*") {
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		call.Arg = arg
+	} else if call.Name != "count" {
+		return nil, &SyntaxError{Pos: token.Pos, Msg: fmt.Sprintf("%v needs an argument", call.Name)}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// parseOperand parses a column or a literal.
+func (p *parser) parseOperand() (Expr, error) {
+	if p.peek().Kind == IDENT {
+		name, err := p.parseName("a column name")
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptSymbol(".") {
+			column, err := p.parseName("a column name")
+			if err != nil {
+				return nil, err
+			}
+			return &ColumnRef{Table: name, Name: column}, nil
+		}
+		return &ColumnRef{Name: name}, nil
+	}
+	return p.parseLiteral()
+}
+
+// parseLiteral parses a number, possibly negative, or a string.
+func (p *parser) parseLiteral() (Expr, error) {
+	negative := p.acceptSymbol("-")
+	token := p.peek()
+	switch token.Kind {
+	case INT:
+		p.next()
+		text := token.Text
+		if negative {
+			text = "-" + text
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: token.Pos, Msg: fmt.Sprintf("integer %v out of range", text)}
+		}
+		return &Literal{Value: n}, nil
+	case FLOAT:
+		p.next()
+		f, err := strconv.ParseFloat(token.Text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: token.Pos, Msg: fmt.Sprintf("bad float %v", token.Text)}
+		}
+		if negative {
+			f = -f
+		}
+		return &Literal{Value: f}, nil
+	case STRING:
+		if negative {
+			return nil, p.errorf("expected a number, found %v", token)
+		}
+		p.next()
+		return &Literal{Value: token.Text}, nil
+	default:
+		return nil, p.errorf("expected a value, found %v", token)
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrNotFound is returned by an index's Find when no entry has the key.
+var ErrNotFound = errors.New("entry could not be found")
+
+// ErrBytesValue is returned where an entry's value is used as an int but is a byte slice,
+// of which GetValue gives only the length.
+var ErrBytesValue = errors.New("value is a byte slice, not an int")
+
+// IntValue returns an entry's value, or ErrBytesValue if it is a byte slice.
+func IntValue(entry Entry) (int64, error) {
+	if _, isBytes := entry.(BytesEntry); isBytes {
+		return 0, ErrBytesValue
+	}
+	return entry.GetValue(), nil
+}
+
+// bytesEntry is an entry with a byte-slice value. Implements BytesEntry.
+type bytesEntry struct {
+	key   int64
+	value []byte
+}
+
+// NewBytesEntry returns an entry with the given key and byte-slice value.
+func NewBytesEntry(key int64, value []byte) BytesEntry {
+	return bytesEntry{key: key, value: value}
+}
+
+// Get key.
+func (entry bytesEntry) GetKey() int64 {
+	return entry.key
+}
+
+// Get the length of the value.
+func (entry bytesEntry) GetValue() int64 {
+	return int64(len(entry.value))
+}
+
+// Get value.
+func (entry bytesEntry) GetBytes() []byte {
+	return entry.value
+}
+
+// Marshal serializes a given entry into a byte array: the key, then the raw value.
+func (entry bytesEntry) Marshal() []byte {
+	newdata := make([]byte, binary.MaxVarintLen64)
+	binary.PutVarint(newdata, entry.key)
+	return append(newdata, entry.value...)
+}
@@ -13,3 +13,9 @@ type Cursor interface {
 	IsEnd() bool
 	GetEntry() (Entry, error)
 }
+
+// Interface for an entry whose value is a byte slice. GetValue returns its length.
+type BytesEntry interface {
+	Entry
+	GetBytes() []byte
+}